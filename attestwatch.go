@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/availproject/cdk-avail-da-server/lease"
+	avail "github.com/availproject/cdk-avail-da-server/lib/avail"
+	"github.com/availproject/cdk-avail-da-server/pkg/l1"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// attestationWatchTimeout bounds the attestation read and the index writes of a sequence
+const attestationWatchTimeout = 30 * time.Second
+
+// attestationWatcher records the Avail locations of the leaves attested on L1 in the
+// index of the storage
+type attestationWatcher struct {
+	client   *l1.Client
+	abi      abi.ABI
+	contract common.Address
+	cold     *da.AvailBackend
+	index    *da.IndexResolver
+	// leases hand the watch to one server of the deployment, the lease is renewed
+	// before every sequence and lasts leaseTTL
+	leases   *lease.Leases
+	leaseTTL time.Duration
+}
+
+// runAttestationWatch watches L1 for newly attested leaves every
+// ATTESTATION_WATCH_INTERVAL until ctx is done, and records their Avail block and leaf
+// index in the index of the storage, for the leaf and for every batch of its sequence.
+// The attestation contract emits no event, leaves are attested by the verifyMessage
+// call of the sequenceBatchesValidium transactions, so the watch follows the sequences
+// of the validium contract whose data availability message is a merkle proof. The
+// index resolver then serves the recoveries without an eth_call, also while the L1
+// RPC is down. With leases only the server holding the watch lease watches.
+func runAttestationWatch(ctx context.Context, cfg serverConfig, cold *da.AvailBackend, storage da.DAProvider, leases *lease.Leases) error {
+	index := da.IndexOf(storage)
+	if index == nil {
+		return errors.New("the attestation watch needs a storage with an index")
+	}
+	ethClient, err := ethclient.DialContext(ctx, cfg.L1RPCURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to L1: %w", err)
+	}
+	client := l1.NewClient(ethClient, nil)
+
+	contractAbi, err := abi.JSON(strings.NewReader(l1.PolygonValidiumABI))
+	if err != nil {
+		client.Close()
+		return err
+	}
+
+	next := cfg.AttestationWatchStartBlock
+	if next == 0 {
+		head, err := client.BlockNumber(ctx)
+		if err != nil {
+			client.Close()
+			return fmt.Errorf("failed to get the L1 head: %w", err)
+		}
+		next = head + 1
+	}
+	w := &attestationWatcher{
+		client:   client,
+		abi:      contractAbi,
+		contract: common.HexToAddress(cfg.ValidiumContractAddress),
+		cold:     cold,
+		index:    da.NewIndexResolver(index),
+		leases:   leases,
+		leaseTTL: 2*cfg.AttestationWatchInterval + attestationWatchTimeout,
+	}
+	log.Printf("Watching the attestations of the sequences of %s from L1 block %d every %v", cfg.ValidiumContractAddress, next, cfg.AttestationWatchInterval)
+
+	go func() {
+		defer client.Close()
+		ticker := time.NewTicker(cfg.AttestationWatchInterval)
+		defer ticker.Stop()
+		for {
+			var err error
+			next, err = w.catchUp(ctx, next)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Attestation watch stopped at L1 block %d, retrying: %v", next, err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// catchUp records the attestations of the sequences of the L1 blocks from next to the
+// head and returns the first block not watched yet. It stops when another server holds
+// the watch lease, the blocks it watches are checked again on takeover.
+func (w *attestationWatcher) catchUp(ctx context.Context, next uint64) (uint64, error) {
+	if !w.leases.Hold(ctx, lease.JobAttestations, w.leaseTTL) {
+		return next, nil
+	}
+	head, err := w.client.BlockNumber(ctx)
+	if err != nil {
+		return next, fmt.Errorf("failed to get the L1 head: %w", err)
+	}
+	for next <= head && ctx.Err() == nil {
+		end := min(next+ingestRangeSize-1, head)
+		blocks, err := l1.QuerySequencesFromL1ByRange(ctx, w.client, w.abi, w.contract,
+			new(big.Int).SetUint64(next), new(big.Int).SetUint64(end))
+		if err != nil {
+			return next, fmt.Errorf("failed to query the sequences of blocks %d to %d: %w", next, end, err)
+		}
+		for block := next; block <= end; block++ {
+			for _, seq := range blocks[block] {
+				if !w.leases.Hold(ctx, lease.JobAttestations, w.leaseTTL) {
+					return block, nil
+				}
+				if err := w.record(ctx, seq); err != nil {
+					// The location is still found by the attestation resolver
+					log.Printf("Failed to record the attestation of the sequence of L1 block %d, tx %s: %v", block, seq.TxHash.Hex(), err)
+				}
+			}
+		}
+		next = end + 1
+	}
+	return next, ctx.Err()
+}
+
+// record records the attested location of the leaf of the sequence, for the leaf and
+// every batch of the sequence. Sequences of other message types are skipped.
+func (w *attestationWatcher) record(ctx context.Context, seq l1.Sequence) error {
+	ctx, cancel := context.WithTimeout(ctx, attestationWatchTimeout)
+	defer cancel()
+
+	envelope, err := avail.UnpackEnvelope(seq.DataAvailabilityMessage)
+	if err != nil {
+		return err
+	}
+	if envelope.MsgType != avail.DAM_TYPE_MERKLE_PROOF {
+		return nil
+	}
+	var proof avail.MerkleProofInput
+	if err := proof.DecodeFromBinary(envelope.Payload); err != nil {
+		return err
+	}
+	leaf := common.Hash(proof.Leaf)
+	location, err := w.cold.Attestation(ctx, leaf)
+	if err != nil {
+		return err
+	}
+	for _, hash := range append([]common.Hash{leaf}, seq.BatchHashes...) {
+		if err := w.index.Record(ctx, hash, location); err != nil {
+			return err
+		}
+	}
+	log.Printf("Recorded the attestation of leaf %s, %s, for %d batches", leaf.Hex(), location, len(seq.BatchHashes))
+	return nil
+}
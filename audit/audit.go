@@ -0,0 +1,109 @@
+// Package audit records who accessed which batch data, for operators who need
+// traceability of the data availability access.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Actions and results of the entries
+const (
+	ActionGet      = "get"
+	ActionPut      = "put"
+	ActionRepair   = "repair"
+	ActionUndelete = "undelete"
+
+	ResultOK       = "ok"
+	ResultNotFound = "not_found"
+	ResultError    = "error"
+)
+
+// Entry is a line of the audit log
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Client is the remote address of the request, ForwardedFor its X-Forwarded-For
+	// header when it came through a proxy
+	Client       string      `json:"client"`
+	ForwardedFor string      `json:"forwardedFor,omitempty"`
+	Action       string      `json:"action"`
+	Method       string      `json:"method"`
+	Hash         common.Hash `json:"hash"`
+	Backend      string      `json:"backend"`
+	Size         int         `json:"size"`
+	Result       string      `json:"result"`
+}
+
+// Logger appends entries to a JSON lines file. A nil logger records nothing, so the
+// audit log is optional.
+type Logger struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Open returns a logger appending to path, nil when path is empty
+func Open(path string) (*Logger, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", path, err)
+	}
+	return &Logger{file: file}, nil
+}
+
+// Record appends the entry of the request r, the client is read from it
+func (l *Logger) Record(r *http.Request, e Entry) error {
+	if l == nil {
+		return nil
+	}
+	e.Client = r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		e.Client = host
+	}
+	e.ForwardedFor = r.Header.Get("X-Forwarded-For")
+	return l.write(e)
+}
+
+// RecordJob appends the entry of a background job of the server, the job is recorded
+// as client
+func (l *Logger) RecordJob(job string, e Entry) error {
+	if l == nil {
+		return nil
+	}
+	e.Client = job
+	return l.write(e)
+}
+
+func (l *Logger) write(e Entry) error {
+	e.Time = time.Now().UTC()
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err = l.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the file, a nil logger has nothing to close
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file.Close()
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/availproject/cdk-avail-da-server/pkg/l1"
+	"github.com/availproject/cdk-avail-da-server/service"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// newBatchIndex returns the index resolving the batch numbers of
+// sync_getOffChainDataByBatchNum, nil when BATCH_INDEX_START_BLOCK isn't set
+func newBatchIndex(ctx context.Context, cfg serverConfig, storage da.DAProvider) (*service.BatchIndex, error) {
+	if cfg.BatchIndexStartBlock == 0 {
+		return nil, nil
+	}
+	ethClient, err := ethclient.DialContext(ctx, cfg.L1RPCURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to L1: %w", err)
+	}
+	batches, err := service.NewBatchIndex(l1.NewClient(ethClient, nil), common.HexToAddress(cfg.ValidiumContractAddress), cfg.BatchIndexStartBlock, cfg.L1Confirmations, storage)
+	if err != nil {
+		ethClient.Close()
+		return nil, err
+	}
+	log.Printf("Batch numbers are indexed from L1 block %d on demand", cfg.BatchIndexStartBlock)
+	return batches, nil
+}
@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"log"
 	"math/big"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/availproject/avail-go-sdk/primitives"
@@ -14,29 +17,102 @@ import (
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/availproject/cdk-avail-da-server/logging"
+	"github.com/availproject/cdk-avail-da-server/pkg/daerrors"
+)
+
+// Number of recently read blocks kept in memory, batches of a sequence are stored in
+// the same block and are usually recovered one after the other
+const blockCacheSize = 16
+
+// ErrAvailNotSynced is returned while the Avail node is syncing or behind the minimum
+// finalized height, Avail recovery is refused until it caught up
+var ErrAvailNotSynced = fmt.Errorf("%w: avail node is not synced", daerrors.ErrBackendUnavailable)
+
+// Clients of the Avail backend, rebuilt by Reconnect
+const (
+	ClientL1    = "l1"
+	ClientAvail = "avail"
 )
 
 type AvailBackend struct {
 	isBridgeEnabled bool
-	eth_client      *ethclient.Client
-	avail_sdk       avail_sdk.SDK
-	attestorAddr    common.Address
+	l1RPCURL        string
+	availRPCURL     string
+	// clients are swapped by Reconnect while requests are served
+	clients      atomic.Pointer[availClients]
+	attestorAddr common.Address
+	blocks       *blockCache
+	// fetches limits the blocks fetched from the Avail RPC at once, so a burst of
+	// recoveries doesn't overload a shared node
+	fetches chan struct{}
+	// minFinalizedHeight is the finalized height the node must have reached, synced
+	// is the result of the last sync check
+	minFinalizedHeight uint32
+	synced             atomic.Bool
+	// resolvers map the hashes to the locations of their data, tried in order, and
+	// index records the locations found by the others when it is one of them
+	resolvers []Resolver
+	index     *IndexResolver
+}
+
+type availClients struct {
+	eth_client *ethclient.Client
+	avail_sdk  avail_sdk.SDK
 }
 
-func NewAvailBackend(isBridgeEnabled bool, attestorAddr string, l1RPCURL string, availRPCURL string) (*AvailBackend, error) {
+// blockCache keeps the data submissions of the most recently read finalized blocks
+type blockCache struct {
+	mu     sync.Mutex
+	blobs  map[uint32][]avail_sdk.DataSubmission
+	recent []uint32
+}
 
-	if !isBridgeEnabled {
-		log.Println("Avail Bridge is not enabled, returning empty backend")
-		return &AvailBackend{isBridgeEnabled: false}, nil
-	}
+func newBlockCache() *blockCache {
+	return &blockCache{blobs: make(map[uint32][]avail_sdk.DataSubmission)}
+}
 
-	addr := common.HexToAddress(attestorAddr)
+func (c *blockCache) get(blockNumber uint32) ([]avail_sdk.DataSubmission, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	client, err := ethclient.Dial(l1RPCURL)
-	if err != nil {
-		log.Printf("Failed to connect to Ethereum RPC, error:%v", err)
-		return nil, err
+	blobs, ok := c.blobs[blockNumber]
+	return blobs, ok
+}
+
+func (c *blockCache) add(blockNumber uint32, blobs []avail_sdk.DataSubmission) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.blobs[blockNumber]; ok {
+		return
+	}
+	if len(c.recent) >= blockCacheSize {
+		delete(c.blobs, c.recent[0])
+		c.recent = c.recent[1:]
+	}
+	c.blobs[blockNumber] = blobs
+	c.recent = append(c.recent, blockNumber)
+}
+
+// NewAvailBackend returns the Avail backend, at most maxFetches blocks are fetched from
+// the Avail RPC at once. Without the bridge there is no L1 client, the data is found
+// through the data availability messages of the sequences.
+func NewAvailBackend(isBridgeEnabled bool, attestorAddr string, l1RPCURL string, availRPCURL string, minFinalizedHeight uint32, maxFetches int) (*AvailBackend, error) {
+	var client *ethclient.Client
+	if isBridgeEnabled {
+		var err error
+		client, err = ethclient.Dial(l1RPCURL)
+		if err != nil {
+			log.Printf("Failed to connect to Ethereum RPC, error:%v", err)
+			return nil, err
+		}
+	} else {
+		log.Println("Avail Bridge is not enabled, data is found through the data availability messages")
 	}
 
 	sdk, err := avail_sdk.NewSDK(availRPCURL)
@@ -45,66 +121,356 @@ func NewAvailBackend(isBridgeEnabled bool, attestorAddr string, l1RPCURL string,
 		return nil, err
 	}
 
-	return &AvailBackend{
-		isBridgeEnabled: true,
-		eth_client:      client,
-		avail_sdk:       sdk,
-		attestorAddr:    addr,
-	}, nil
+	a := &AvailBackend{
+		isBridgeEnabled:    isBridgeEnabled,
+		l1RPCURL:           l1RPCURL,
+		availRPCURL:        availRPCURL,
+		attestorAddr:       common.HexToAddress(attestorAddr),
+		blocks:             newBlockCache(),
+		fetches:            make(chan struct{}, max(maxFetches, 1)),
+		minFinalizedHeight: minFinalizedHeight,
+	}
+	a.clients.Store(&availClients{eth_client: client, avail_sdk: sdk})
+	if isBridgeEnabled {
+		a.resolvers = []Resolver{a.AttestationResolver()}
+	} else {
+		a.resolvers = []Resolver{NewDAMResolver(nil)}
+	}
+	if err := a.CheckSync(); err != nil {
+		log.Printf("Avail recovery is unavailable until the node is synced: %v", err)
+	}
+	return a, nil
 }
 
+// IsBridgeEnabled returns whether the data is attested on L1 through the bridge
 func (a *AvailBackend) IsBridgeEnabled() bool {
 	return a.isBridgeEnabled
 }
 
-func (a *AvailBackend) GetDataFromAvail(hash common.Hash) ([]byte, error) {
+// AttestationResolver returns the resolver reading the locations from the attestation
+// contract, the only resolver by default
+func (a *AvailBackend) AttestationResolver() Resolver {
+	return attestationResolver{a: a}
+}
+
+// UseResolvers replaces the resolvers of the hashes, they are tried in order until one
+// of them knows the hash. The locations found by the others are recorded in the index
+// resolver when it is one of them.
+func (a *AvailBackend) UseResolvers(resolvers ...Resolver) {
+	a.resolvers = resolvers
+	a.index = nil
+	for _, r := range resolvers {
+		if index, ok := r.(*IndexResolver); ok {
+			a.index = index
+		}
+	}
+}
+
+// resolve returns the location of the data of hash from the first resolver that knows
+// it. ErrNotFound is returned when none does, unless one of them failed.
+func (a *AvailBackend) resolve(ctx context.Context, hash common.Hash) (AvailLocation, Resolver, error) {
+	err := fmt.Errorf("%w: no location found for %s", ErrNotFound, hash.Hex())
+	for _, r := range a.resolvers {
+		location, resolveErr := r.Resolve(ctx, hash)
+		if errors.Is(resolveErr, ErrNotFound) {
+			continue
+		}
+		if resolveErr != nil {
+			log.Printf("Failed to resolve %s with the %s resolver, error:%v", hash.Hex(), r.Name(), resolveErr)
+			err = fmt.Errorf("%s resolver: %w", r.Name(), resolveErr)
+			continue
+		}
+		location.Resolver = r.Name()
+		logging.Debugf(logging.Avail, "Resolved %s with the %s resolver: %+v", hash.Hex(), r.Name(), location)
+		if a.index != nil && r != Resolver(a.index) {
+			if err := a.index.Record(ctx, hash, location); err != nil {
+				log.Printf("Failed to record the location of %s, error:%v", hash.Hex(), err)
+			}
+		}
+		return location, r, nil
+	}
+	return AvailLocation{}, nil, err
+}
+
+// CheckSync checks that the Avail node has peers, is not syncing and finalized at
+// least minFinalizedHeight. The result is kept, Avail recovery is refused until a
+// check succeeds.
+func (a *AvailBackend) CheckSync() error {
+	err := a.checkSync()
+	a.synced.Store(err == nil)
+	return err
+}
+
+// Heartbeat sends a request to the L1 and the Avail RPC and returns the client that
+// didn't answer within timeout, so wedged connections are detected. The L1 RPC is only
+// checked with the bridge. The Avail SDK takes no context, a wedged call is left
+// behind.
+func (a *AvailBackend) Heartbeat(timeout time.Duration) (string, error) {
+	clients := a.clients.Load()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if a.isBridgeEnabled {
+		if _, err := clients.eth_client.BlockNumber(ctx); err != nil {
+			return ClientL1, fmt.Errorf("L1 RPC heartbeat failed: %w", err)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := clients.avail_sdk.Client.Rpc.System.Health()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return ClientAvail, fmt.Errorf("avail RPC heartbeat failed: %w", err)
+		}
+	case <-ctx.Done():
+		return ClientAvail, fmt.Errorf("avail RPC heartbeat failed: no answer within %v", timeout)
+	}
+	return "", nil
+}
+
+// Reconnect rebuilds the client, ClientL1 or ClientAvail. Requests in flight finish on
+// the old client, the old L1 connection is closed once it is replaced.
+func (a *AvailBackend) Reconnect(client string) error {
+	old := a.clients.Load()
+	clients := *old
+	switch client {
+	case ClientL1:
+		if !a.isBridgeEnabled {
+			return fmt.Errorf("no L1 client without the bridge")
+		}
+		eth, err := ethclient.Dial(a.l1RPCURL)
+		if err != nil {
+			return fmt.Errorf("failed to connect to Ethereum RPC: %w", err)
+		}
+		clients.eth_client = eth
+	case ClientAvail:
+		sdk, err := avail_sdk.NewSDK(a.availRPCURL)
+		if err != nil {
+			return fmt.Errorf("failed to connect to %s: %w", a.availRPCURL, err)
+		}
+		clients.avail_sdk = sdk
+	default:
+		return fmt.Errorf("unknown client %q", client)
+	}
+	a.clients.Store(&clients)
+	if client == ClientL1 {
+		old.eth_client.Close()
+	}
+	log.Printf("Reconnected the %s client", client)
+	return nil
+}
+
+func (a *AvailBackend) checkSync() error {
+	sdk := a.clients.Load().avail_sdk
+	health, err := sdk.Client.Rpc.System.Health()
+	if err != nil {
+		return fmt.Errorf("failed to get the avail node health: %w", err)
+	}
+	if health.IsSyncing {
+		return fmt.Errorf("%w: the node is syncing", ErrAvailNotSynced)
+	}
+	if health.ShouldHavePeers && health.Peers == 0 {
+		return fmt.Errorf("%w: the node has no peers", ErrAvailNotSynced)
+	}
+	finalized, err := sdk.Client.FinalizedBlockNumber()
+	if err != nil {
+		return fmt.Errorf("failed to get the avail finalized height: %w", err)
+	}
+	if finalized < a.minFinalizedHeight {
+		return fmt.Errorf("%w: finalized height %d is below %d", ErrAvailNotSynced, finalized, a.minFinalizedHeight)
+	}
+	return nil
+}
+
+// GetDataFromAvail reads the data of hash from the location its resolvers found,
+// Avail or Turbo DA. The data availability message set on ctx with
+// WithDataAvailabilityMessage is resolved by the dam resolver.
+func (a *AvailBackend) GetDataFromAvail(ctx context.Context, hash common.Hash) ([]byte, error) {
 	start := time.Now()
 	log.Printf("Fetching data from Avail")
 
-	blockNumber, leafIndex, err := a.getAttestation(hash)
-	if blockNumber == 0 {
-		log.Printf("No attestation found")
-		return nil, errors.New("no attestation found")
-	}
+	location, r, err := a.resolve(ctx, hash)
 	if err != nil {
-		log.Printf("Failed to get attestation, error:%v", err)
+		log.Printf("Failed to resolve the location, error:%v", err)
 		return nil, err
 	}
+	log.Printf("Location found by the %s resolver, %s (duration:%v)", location.Resolver, location, time.Since(start))
 
-	log.Printf("Attestation found, blockNumber:%d, leafIndex:%d (duration:%v)",
-		blockNumber,
-		leafIndex,
-		time.Since(start),
-	)
-
-	data, err := a.getData(blockNumber, leafIndex)
+	var data []byte
+	if reader, ok := r.(LocationReader); ok {
+		data, err = reader.Read(ctx, location)
+	} else {
+		data, err = a.getData(location)
+	}
 	if err != nil {
 		log.Printf("Failed to get data from Avail, error:%v", err)
 		return nil, err
 	}
+	// Blob pointers and Turbo DA submissions hold the whole sequence
+	data, err = batchOf(data, hash)
+	if err != nil {
+		return nil, err
+	}
 
 	log.Printf("Successfully retrieved data from Avail, duration:%v", time.Since(start))
 	return data, nil
 }
 
-func (a *AvailBackend) getData(blockNumber uint32, index int64) ([]byte, error) {
-	blockHash, err := a.avail_sdk.Client.BlockHash(blockNumber)
+// HasAttestation returns whether a resolver knows a location of the data of hash
+// attested on L1, so it can be recovered from Avail. Turbo DA submissions and blob
+// pointers aren't attested.
+func (a *AvailBackend) HasAttestation(hash common.Hash) (bool, error) {
+	var err error
+	for _, r := range a.resolvers {
+		location, resolveErr := r.Resolve(context.Background(), hash)
+		if errors.Is(resolveErr, ErrNotFound) {
+			continue
+		}
+		if resolveErr != nil {
+			err = fmt.Errorf("%s resolver: %w", r.Name(), resolveErr)
+			continue
+		}
+		if location.Block != 0 && location.LeafIndex != nil {
+			return true, nil
+		}
+	}
+	return false, err
+}
+
+// AvailLocation is the location the data of a hash was submitted at, the Avail block
+// and the leaf index attested on L1 or the extrinsic index of a blob pointer, or the
+// Turbo DA submission
+type AvailLocation struct {
+	Block     uint32 `json:"block,omitempty"`
+	LeafIndex *int64 `json:"leafIndex,omitempty"`
+	// Extrinsic is the index of the submission in the block and ExtrinsicHash its hash,
+	// known when the block was read recently
+	Extrinsic     *uint32 `json:"extrinsic,omitempty"`
+	ExtrinsicHash string  `json:"extrinsicHash,omitempty"`
+	SubmissionID  string  `json:"submissionId,omitempty"`
+	// Resolver is the name of the resolver that found the location
+	Resolver string `json:"resolver,omitempty"`
+}
+
+func (l AvailLocation) String() string {
+	switch {
+	case l.SubmissionID != "":
+		return fmt.Sprintf("submissionId:%s", l.SubmissionID)
+	case l.LeafIndex != nil:
+		return fmt.Sprintf("blockNumber:%d, leafIndex:%d", l.Block, *l.LeafIndex)
+	case l.Extrinsic != nil:
+		return fmt.Sprintf("blockNumber:%d, extrinsic:%d", l.Block, *l.Extrinsic)
+	}
+	return fmt.Sprintf("blockNumber:%d", l.Block)
+}
+
+// Locate returns the location of the data of hash from its resolvers, without reading
+// the block. ErrNotFound is returned when no resolver knows it.
+func (a *AvailBackend) Locate(hash common.Hash) (AvailLocation, error) {
+	location, _, err := a.resolve(context.Background(), hash)
+	if err != nil {
+		return AvailLocation{}, err
+	}
+	if location.LeafIndex == nil {
+		return location, nil
+	}
+	leafIndex := *location.LeafIndex
+	if blobs, ok := a.blocks.get(location.Block); ok && leafIndex >= 0 && int(leafIndex) < len(blobs) {
+		blob := blobs[leafIndex]
+		location.Extrinsic = &blob.TxIndex
+		location.ExtrinsicHash = blob.TxHash.ToHexWith0x()
+	}
+	return location, nil
+}
+
+// batchOf returns data when it is the batch of hash, else the batch of hash in the RLP
+// encoded batches of the sequence data holds
+func batchOf(data []byte, hash common.Hash) ([]byte, error) {
+	if crypto.Keccak256Hash(data) == hash {
+		return data, nil
+	}
+	var batches [][]byte
+	if err := rlp.DecodeBytes(data, &batches); err != nil {
+		return nil, fmt.Errorf("data read from Avail doesn't match the hash %s", hash.Hex())
+	}
+	for _, batch := range batches {
+		if crypto.Keccak256Hash(batch) == hash {
+			return batch, nil
+		}
+	}
+	return nil, fmt.Errorf("the sequence read from Avail has no batch of hash %s among %d batches", hash.Hex(), len(batches))
+}
+
+func (a *AvailBackend) getBlockDataSubmissions(blockNumber uint32) ([]avail_sdk.DataSubmission, error) {
+	if blobs, ok := a.blocks.get(blockNumber); ok {
+		log.Printf("Block %d served from cache", blockNumber)
+		return blobs, nil
+	}
+
+	select {
+	case a.fetches <- struct{}{}:
+	default:
+		log.Printf("Waiting to fetch block %d, %d block fetches are running", blockNumber, cap(a.fetches))
+		a.fetches <- struct{}{}
+	}
+	defer func() { <-a.fetches }()
+	// Another request may have fetched the block while this one waited
+	if blobs, ok := a.blocks.get(blockNumber); ok {
+		return blobs, nil
+	}
+
+	sdk := a.clients.Load().avail_sdk
+	blockHash, err := sdk.Client.BlockHash(blockNumber)
 	if err != nil {
 		return nil, fmt.Errorf("❎ Cannot get block hash: %w", err)
 	}
 
-	block, err := avail_sdk.NewBlock(a.avail_sdk.Client, blockHash)
+	block, err := avail_sdk.NewBlock(sdk.Client, blockHash)
 	if err != nil {
 		return nil, fmt.Errorf("❎ Cannot get block: %w", err)
 	}
 
-	var blob avail_sdk.DataSubmission
-
 	blobs := block.DataSubmissions(avail_sdk.Filter{})
-	if int(index) >= len(blobs) {
-		return nil, fmt.Errorf("❎ Unable to retrieve blob at index %d from block %d", index, blockNumber)
+	logging.Debugf(logging.Avail, "Fetched block %d, hash:%s, submissions:%d", blockNumber, blockHash.ToHexWith0x(), len(blobs))
+	a.blocks.add(blockNumber, blobs)
+	return blobs, nil
+}
+
+// getData reads the submission at the leaf index or the extrinsic index of location
+func (a *AvailBackend) getData(location AvailLocation) ([]byte, error) {
+	if !a.synced.Load() {
+		if err := a.CheckSync(); err != nil {
+			log.Printf("Refusing to read from Avail: %v", err)
+			return nil, err
+		}
+	}
+	blockNumber := location.Block
+	blobs, err := a.getBlockDataSubmissions(blockNumber)
+	if err != nil {
+		return nil, err
 	}
-	blob = blobs[index]
+
+	var blob avail_sdk.DataSubmission
+	switch {
+	case location.LeafIndex != nil:
+		index := *location.LeafIndex
+		if index < 0 || int(index) >= len(blobs) {
+			return nil, fmt.Errorf("❎ Unable to retrieve blob at index %d from block %d", index, blockNumber)
+		}
+		blob = blobs[index]
+	case location.Extrinsic != nil:
+		i := slices.IndexFunc(blobs, func(blob avail_sdk.DataSubmission) bool { return blob.TxIndex == *location.Extrinsic })
+		if i < 0 {
+			return nil, fmt.Errorf("❎ Unable to retrieve blob of extrinsic %d from block %d", *location.Extrinsic, blockNumber)
+		}
+		blob = blobs[i]
+	default:
+		return nil, fmt.Errorf("❎ No index of the blob in block %d", blockNumber)
+	}
+	logging.Debugf(logging.Avail, "Read submission %s, extrinsic:%d, size:%d", location, blob.TxIndex, len(blob.Data))
 
 	signerAddress, err := primitives.NewAccountIdFromMultiAddress(blob.TxSigner)
 	if err != nil {
@@ -122,7 +488,13 @@ func (a *AvailBackend) getData(blockNumber uint32, index int64) ([]byte, error)
 
 const attestationABI = `[{"inputs":[{"internalType":"bytes32","name":"","type":"bytes32"}],"name":"attestations","outputs":[{"internalType":"uint32","name":"blockNumber","type":"uint32"},{"internalType":"uint128","name":"leafIndex","type":"uint128"}],"stateMutability":"view","type":"function"}]`
 
-func (a *AvailBackend) getAttestation(hash common.Hash) (uint32, int64, error) {
+// Attestation returns the Avail block and leaf index attested for leaf on L1,
+// ErrNotFound when it isn't attested
+func (a *AvailBackend) Attestation(ctx context.Context, leaf common.Hash) (AvailLocation, error) {
+	return attestationResolver{a: a}.Resolve(ctx, leaf)
+}
+
+func (a *AvailBackend) getAttestation(ctx context.Context, hash common.Hash) (uint32, int64, error) {
 	start := time.Now()
 	log.Printf("Getting attestation from contract:%v, hash:%v", a.attestorAddr, hash.Hex())
 
@@ -136,7 +508,7 @@ func (a *AvailBackend) getAttestation(hash common.Hash) (uint32, int64, error) {
 		return 0, 0, err
 	}
 
-	res, err := a.eth_client.CallContract(context.Background(), ethereum.CallMsg{
+	res, err := a.clients.Load().eth_client.CallContract(ctx, ethereum.CallMsg{
 		To:   &a.attestorAddr,
 		Data: data,
 	}, nil)
@@ -153,6 +525,7 @@ func (a *AvailBackend) getAttestation(hash common.Hash) (uint32, int64, error) {
 		log.Printf("Failed to unpack attestation result, error:%v, duration:%v", err, time.Since(start))
 		return 0, 0, err
 	}
+	logging.Debugf(logging.Bridge, "Attestation of %s: blockNumber:%d, leafIndex:%v, result:%x (duration:%v)", hash.Hex(), output.BlockNumber, output.LeafIndex, res, time.Since(start))
 
 	return output.BlockNumber, output.LeafIndex.Int64(), nil
 }
@@ -0,0 +1,133 @@
+package da
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// bootstrapMultipartDays is the number of days after which incomplete multipart
+	// uploads are aborted in bootstrapped buckets
+	bootstrapMultipartDays = 7
+	// bootstrapWait is how long a created bucket may take to exist
+	bootstrapWait = time.Minute
+)
+
+// Bootstrap creates the bucket when it doesn't exist, for new deployments. The bucket
+// is versioned, so data deleted by mistake can be recovered. Its lifecycle rules
+// expire the noncurrent versions after noncurrentDays, the delete markers left alone
+// and the incomplete multipart uploads. Public access is blocked and its policy denies
+// requests without TLS. Existing buckets are left as they are.
+func (s *S3Backend) Bootstrap(ctx context.Context, region string, noncurrentDays int) error {
+	if s.anonymous {
+		return ErrReadOnly
+	}
+	_, err := s.s3Client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s.bucket),
+	})
+	var notFound *types.NotFound
+	if err == nil {
+		log.Printf("S3 bucket %s exists, it isn't bootstrapped", s.bucket)
+		return nil
+	}
+	if !errors.As(err, &notFound) {
+		return fmt.Errorf("failed to check bucket %s: %w", s.bucket, err)
+	}
+
+	log.Printf("S3 bucket %s doesn't exist, creating it in %s", s.bucket, region)
+	input := &s3.CreateBucketInput{Bucket: aws.String(s.bucket)}
+	// us-east-1 is the default location and can't be given as constraint
+	if region != "us-east-1" {
+		input.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+			LocationConstraint: types.BucketLocationConstraint(region),
+		}
+	}
+	if _, err := s.s3Client.CreateBucket(ctx, input); err != nil {
+		return fmt.Errorf("failed to create bucket %s: %w", s.bucket, err)
+	}
+	if err := s3.NewBucketExistsWaiter(s.s3Client).Wait(ctx, &s3.HeadBucketInput{Bucket: aws.String(s.bucket)}, bootstrapWait); err != nil {
+		return fmt.Errorf("bucket %s wasn't created: %w", s.bucket, err)
+	}
+
+	_, err = s.s3Client.PutPublicAccessBlock(ctx, &s3.PutPublicAccessBlockInput{
+		Bucket: aws.String(s.bucket),
+		PublicAccessBlockConfiguration: &types.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(true),
+			BlockPublicPolicy:     aws.Bool(true),
+			IgnorePublicAcls:      aws.Bool(true),
+			RestrictPublicBuckets: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to block the public access of bucket %s: %w", s.bucket, err)
+	}
+	_, err = s.s3Client.PutBucketVersioning(ctx, &s3.PutBucketVersioningInput{
+		Bucket: aws.String(s.bucket),
+		VersioningConfiguration: &types.VersioningConfiguration{
+			Status: types.BucketVersioningStatusEnabled,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enable the versioning of bucket %s: %w", s.bucket, err)
+	}
+	_, err = s.s3Client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket: aws.String(s.bucket),
+		LifecycleConfiguration: &types.BucketLifecycleConfiguration{
+			Rules: []types.LifecycleRule{{
+				ID:     aws.String("expire-noncurrent-versions"),
+				Status: types.ExpirationStatusEnabled,
+				Filter: &types.LifecycleRuleFilter{Prefix: aws.String(s.objectPrefix)},
+				NoncurrentVersionExpiration: &types.NoncurrentVersionExpiration{
+					NoncurrentDays: aws.Int32(int32(noncurrentDays)),
+				},
+				Expiration: &types.LifecycleExpiration{
+					ExpiredObjectDeleteMarker: aws.Bool(true),
+				},
+				AbortIncompleteMultipartUpload: &types.AbortIncompleteMultipartUpload{
+					DaysAfterInitiation: aws.Int32(bootstrapMultipartDays),
+				},
+			}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set the lifecycle rules of bucket %s: %w", s.bucket, err)
+	}
+	_, err = s.s3Client.PutBucketPolicy(ctx, &s3.PutBucketPolicyInput{
+		Bucket: aws.String(s.bucket),
+		Policy: aws.String(bootstrapPolicy(s.bucket)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set the policy of bucket %s: %w", s.bucket, err)
+	}
+
+	log.Printf("Created S3 bucket %s, versioned, noncurrent versions expire after %d days", s.bucket, noncurrentDays)
+	return nil
+}
+
+// bootstrapPolicy returns the policy of a bootstrapped bucket, denying the requests
+// sent without TLS. Access is granted by the IAM policies of the credentials.
+func bootstrapPolicy(bucket string) string {
+	policy := map[string]any{
+		"Version": "2012-10-17",
+		"Statement": []map[string]any{{
+			"Sid":       "DenyInsecureTransport",
+			"Effect":    "Deny",
+			"Principal": "*",
+			"Action":    "s3:*",
+			"Resource":  []string{"arn:aws:s3:::" + bucket, "arn:aws:s3:::" + bucket + "/*"},
+			"Condition": map[string]any{
+				"Bool": map[string]string{"aws:SecureTransport": "false"},
+			},
+		}},
+	}
+	data, _ := json.Marshal(policy)
+	return string(data)
+}
@@ -0,0 +1,106 @@
+package da
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// HotCache is the hot tier of the batch data, recently sequenced batches are kept in
+// it for a TTL
+type HotCache interface {
+	// Get returns the cached data of hash, false when it isn't cached
+	Get(ctx context.Context, hash common.Hash) ([]byte, bool, error)
+	Set(ctx context.Context, hash common.Hash, data []byte) error
+	// Size returns the size of the cached data of hash without reading it, false when
+	// it isn't cached
+	Size(ctx context.Context, hash common.Hash) (int, bool, error)
+}
+
+// MemoryCache is a local hot cache holding at most maxBytes of data, the least
+// recently used entries are evicted first and entries expire after the TTL
+type MemoryCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	maxBytes int
+	size     int
+	entries  map[common.Hash]*list.Element
+	// lru is ordered from the most to the least recently used entry
+	lru *list.List
+}
+
+type memoryCacheEntry struct {
+	hash    common.Hash
+	data    []byte
+	expires time.Time
+}
+
+func NewMemoryCache(maxBytes int, ttl time.Duration) *MemoryCache {
+	return &MemoryCache{
+		ttl:      ttl,
+		maxBytes: maxBytes,
+		entries:  make(map[common.Hash]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+func (c *MemoryCache) Get(ctx context.Context, hash common.Hash) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[hash]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*memoryCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(elem)
+		return nil, false, nil
+	}
+	c.lru.MoveToFront(elem)
+	return entry.data, true, nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, hash common.Hash, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[hash]; ok {
+		c.remove(elem)
+	}
+	// Data larger than the whole cache is never cached
+	if len(data) > c.maxBytes {
+		return nil
+	}
+	for c.size+len(data) > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+	entry := &memoryCacheEntry{hash: hash, data: data, expires: time.Now().Add(c.ttl)}
+	c.entries[hash] = c.lru.PushFront(entry)
+	c.size += len(data)
+	return nil
+}
+
+func (c *MemoryCache) Size(ctx context.Context, hash common.Hash) (int, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[hash]
+	if !ok {
+		return 0, false, nil
+	}
+	entry := elem.Value.(*memoryCacheEntry)
+	if time.Now().After(entry.expires) {
+		return 0, false, nil
+	}
+	return len(entry.data), true, nil
+}
+
+func (c *MemoryCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*memoryCacheEntry)
+	delete(c.entries, entry.hash)
+	c.size -= len(entry.data)
+}
@@ -0,0 +1,308 @@
+package da
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// CompressionZstd compresses the objects with zstd, with the last trained
+	// dictionary once there is one
+	CompressionZstd = "zstd"
+	// s3DictionaryDir is the directory under the prefix the trained dictionaries are
+	// stored in, named by their id
+	s3DictionaryDir = "dictionaries/"
+	// dictionaryMaxSize is the size of the trained dictionaries, the default of zstd
+	dictionaryMaxSize = 112 << 10
+	// dictionaryMetadata is the object metadata holding the id of the dictionary the
+	// object was compressed with, zero for none
+	dictionaryMetadata = "zstd-dictionary"
+	// sizeMetadata is the object metadata holding the size of the data of a compressed
+	// object
+	sizeMetadata = "uncompressed-size"
+)
+
+// ErrCompressionDisabled is returned when dictionaries are trained for storage that
+// isn't compressed
+var ErrCompressionDisabled = errors.New("the storage isn't compressed, set S3_COMPRESSION=zstd")
+
+// Dictionary is a zstd dictionary trained on the stored data
+type Dictionary struct {
+	ID      uint32 `json:"id"`
+	Size    int    `json:"size"`
+	Samples int    `json:"samples"`
+	// Ratio is the compression ratio of the samples with the dictionary
+	Ratio float64 `json:"ratio"`
+}
+
+// DictionaryTrainer is a storage compressing the data with a dictionary trained on the
+// stored data
+type DictionaryTrainer interface {
+	// TrainDictionary trains a dictionary on samples stored objects, new data is
+	// compressed with it from then on
+	TrainDictionary(ctx context.Context, samples int) (Dictionary, error)
+}
+
+// DictionaryTrainerOf returns the trainer of the provider, nil when it has none
+func DictionaryTrainerOf(p DAProvider) DictionaryTrainer {
+	trainer, _ := p.(DictionaryTrainer)
+	return trainer
+}
+
+// compressor compresses the objects with the last dictionary and decompresses them
+// with any dictionary stored in the bucket
+type compressor struct {
+	mu      sync.RWMutex
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+	// dictID is the id of the dictionary of the encoder, zero for none
+	dictID uint32
+}
+
+func newCompressor(dicts [][]byte) (*compressor, error) {
+	var encoderOpts []zstd.EOption
+	var dictID uint32
+	if len(dicts) > 0 {
+		last := dicts[len(dicts)-1]
+		encoderOpts = append(encoderOpts, zstd.WithEncoderDict(last))
+		dictID = dictionaryID(last)
+	}
+	encoder, err := zstd.NewWriter(nil, encoderOpts...)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderDicts(dicts...))
+	if err != nil {
+		encoder.Close()
+		return nil, err
+	}
+	return &compressor{encoder: encoder, decoder: decoder, dictID: dictID}, nil
+}
+
+func (c *compressor) compress(data []byte) ([]byte, uint32) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.encoder.EncodeAll(data, nil), c.dictID
+}
+
+func (c *compressor) decompress(data []byte) ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.decoder.DecodeAll(data, nil)
+}
+
+// replace switches to the encoder and decoder of other
+func (c *compressor) replace(other *compressor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.encoder.Close()
+	c.decoder.Close()
+	c.encoder, c.decoder, c.dictID = other.encoder, other.decoder, other.dictID
+}
+
+// dictionaryID returns the id in the header of a zstd dictionary
+func dictionaryID(d []byte) uint32 {
+	if len(d) < 8 {
+		return 0
+	}
+	return uint32(d[4]) | uint32(d[5])<<8 | uint32(d[6])<<16 | uint32(d[7])<<24
+}
+
+// Compress compresses the objects written from then on with zstd, with the last
+// dictionary trained for the bucket. Compressed objects are read by the server only,
+// other readers of the bucket get the compressed bytes.
+func (s *S3Backend) Compress(ctx context.Context) error {
+	c, err := s.loadCompressor(ctx)
+	if err != nil {
+		return err
+	}
+	s.compression = c
+	if c.dictID != 0 {
+		log.Printf("Compressing S3 objects with zstd dictionary %d", c.dictID)
+	} else {
+		log.Printf("Compressing S3 objects with zstd, no dictionary is trained yet")
+	}
+	return nil
+}
+
+// loadCompressor returns a compressor of the dictionaries stored in the bucket, the
+// last written is used for compression
+func (s *S3Backend) loadCompressor(ctx context.Context) (*compressor, error) {
+	type stored struct {
+		key      string
+		modified time.Time
+	}
+	var keys []stored
+	paginator := s3.NewListObjectsV2Paginator(s.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.objectPrefix + s3DictionaryDir),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the dictionaries: %w", err)
+		}
+		for _, object := range page.Contents {
+			keys = append(keys, stored{key: aws.ToString(object.Key), modified: aws.ToTime(object.LastModified)})
+		}
+	}
+	// The last written dictionary is the last one
+	slices.SortFunc(keys, func(a, b stored) int {
+		return a.modified.Compare(b.modified)
+	})
+	dicts := make([][]byte, 0, len(keys))
+	for _, k := range keys {
+		d, err := s.getObject(ctx, k.key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dictionary %s: %w", k.key, err)
+		}
+		dicts = append(dicts, d)
+	}
+	return newCompressor(dicts)
+}
+
+// compressObject returns the body and the encoding an object is written with, the
+// data is kept as is when it doesn't get smaller
+func (s *S3Backend) compressObject(data []byte) ([]byte, *string, map[string]string) {
+	if s.compression == nil {
+		return data, nil, nil
+	}
+	compressed, dictID := s.compression.compress(data)
+	if len(compressed) >= len(data) {
+		return data, nil, nil
+	}
+	return compressed, aws.String(CompressionZstd), map[string]string{
+		dictionaryMetadata: strconv.FormatUint(uint64(dictID), 10),
+		sizeMetadata:       strconv.Itoa(len(data)),
+	}
+}
+
+// decompressObject returns the data of an object read with its encoding. A dictionary
+// trained by another server sharing the bucket is loaded on its first use.
+func (s *S3Backend) decompressObject(ctx context.Context, body []byte, encoding *string) ([]byte, error) {
+	if aws.ToString(encoding) != CompressionZstd {
+		return body, nil
+	}
+	if s.compression == nil {
+		return nil, fmt.Errorf("the object is compressed with zstd, set S3_COMPRESSION=zstd to read it")
+	}
+	data, err := s.compression.decompress(body)
+	if errors.Is(err, zstd.ErrUnknownDictionary) {
+		c, loadErr := s.loadCompressor(ctx)
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		s.compression.replace(c)
+		data, err = s.compression.decompress(body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress the object: %w", err)
+	}
+	return data, nil
+}
+
+// TrainDictionary trains a dictionary on samples objects of the bucket, which are
+// spread over the stored data as the keys are hashes. The dictionary is stored in the
+// bucket and compresses the objects written from then on, the objects already written
+// are kept as they are.
+func (s *S3Backend) TrainDictionary(ctx context.Context, samples int) (Dictionary, error) {
+	if s.compression == nil {
+		return Dictionary{}, ErrCompressionDisabled
+	}
+	if s.anonymous {
+		return Dictionary{}, ErrReadOnly
+	}
+	start := time.Now()
+	var inputs [][]byte
+	raw := 0
+	paginator := s3.NewListObjectsV2Paginator(s.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.objectPrefix),
+	})
+	for paginator.HasMorePages() && len(inputs) < samples {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return Dictionary{}, fmt.Errorf("failed to list objects: %w", err)
+		}
+		for _, object := range page.Contents {
+			if len(inputs) == samples {
+				break
+			}
+			hash, ok := s.hashOfKey(aws.ToString(object.Key))
+			if !ok {
+				continue
+			}
+			data, err := s.Get(ctx, hash)
+			if err != nil {
+				return Dictionary{}, fmt.Errorf("failed to read sample %s: %w", hash.Hex(), err)
+			}
+			inputs = append(inputs, data)
+			raw += len(data)
+		}
+	}
+	if len(inputs) == 0 {
+		return Dictionary{}, fmt.Errorf("%w: the bucket holds no data to train on", ErrNotFound)
+	}
+
+	d, err := dict.BuildZstdDict(inputs, dict.Options{MaxDictSize: dictionaryMaxSize, HashBytes: 6})
+	if err != nil {
+		return Dictionary{}, fmt.Errorf("failed to train the dictionary: %w", err)
+	}
+	trained, err := newCompressor([][]byte{d})
+	if err != nil {
+		return Dictionary{}, fmt.Errorf("invalid dictionary: %w", err)
+	}
+	compressed := 0
+	for _, data := range inputs {
+		out, _ := trained.compress(data)
+		compressed += len(out)
+	}
+	trained.encoder.Close()
+	trained.decoder.Close()
+
+	id := dictionaryID(d)
+	key := s.objectPrefix + s3DictionaryDir + strconv.FormatUint(uint64(id), 10)
+	_, err = s.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:            aws.String(s.bucket),
+		Key:               aws.String(key),
+		Body:              bytes.NewReader(d),
+		ChecksumAlgorithm: s.checksumAlgorithm,
+	})
+	if err != nil {
+		return Dictionary{}, fmt.Errorf("failed to store dictionary %s: %w", key, err)
+	}
+	c, err := s.loadCompressor(ctx)
+	if err != nil {
+		return Dictionary{}, err
+	}
+	s.compression.replace(c)
+
+	info := Dictionary{ID: id, Size: len(d), Samples: len(inputs), Ratio: float64(raw) / float64(max(compressed, 1))}
+	log.Printf("Trained zstd dictionary %d of %d bytes on %d objects, compression ratio %.2f (duration %v)", info.ID, info.Size, info.Samples, info.Ratio, time.Since(start))
+	return info, nil
+}
+
+// objectEncoding returns the encoding and the metadata of the object of key, so copies
+// of compressed objects stay readable
+func (s *S3Backend) objectEncoding(ctx context.Context, key string) (*string, map[string]string, error) {
+	out, err := s.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return out.ContentEncoding, out.Metadata, nil
+}
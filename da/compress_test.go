@@ -0,0 +1,61 @@
+package da
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testBatch returns batch data alike enough between batches to train a dictionary
+func testBatch(i int) []byte {
+	return []byte(fmt.Sprintf(`{"batch":%d,"sequencer":"0x5b06837a43bdc3dd9f114558daf4b26ed49842ed","txs":["0xf86c808504a817c800825208943535353535353535353535353535353535353535880de0b6b3a76400008025a0%064x"],"timestamp":%d}`, i, i*7919, 1700000000+i))
+}
+
+// ✅ Test a dictionary trained by another server is loaded on its first use
+func TestCompressionDictionaryReload(t *testing.T) {
+	ctx := context.Background()
+	bucket := newFakeS3()
+	trainer := newFakeS3Backend(t, bucket, "")
+	reader := newFakeS3Backend(t, bucket, "")
+	require.NoError(t, trainer.Compress(ctx))
+	require.NoError(t, reader.Compress(ctx))
+
+	for i := 0; i < 200; i++ {
+		require.NoError(t, trainer.Put(ctx, crypto.Keccak256Hash(testBatch(i)), testBatch(i)))
+	}
+	dict, err := trainer.TrainDictionary(ctx, 200)
+	require.NoError(t, err)
+	assert.NotZero(t, dict.ID)
+
+	data := testBatch(1000)
+	hash := crypto.Keccak256Hash(data)
+	require.NoError(t, trainer.Put(ctx, hash, data))
+	info, err := trainer.Stat(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, CompressionZstd, info.Encoding)
+
+	assert.Zero(t, reader.compression.dictID)
+	got, err := reader.Get(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	assert.Equal(t, dict.ID, reader.compression.dictID, "the reader must compress with the new dictionary too")
+
+	// ❌ The dictionary of the object is gone
+	bucket.remove(s3DictionaryDir)
+	fresh := newFakeS3Backend(t, bucket, "")
+	require.NoError(t, fresh.Compress(ctx))
+	_, err = fresh.Get(ctx, hash)
+	assert.ErrorIs(t, err, zstd.ErrUnknownDictionary)
+
+	// ❌ Compressed objects can't be read without compression
+	plain := newFakeS3Backend(t, bucket, "")
+	_, err = plain.Get(ctx, hash)
+	assert.Error(t, err)
+	_, err = plain.TrainDictionary(ctx, 10)
+	assert.ErrorIs(t, err, ErrCompressionDisabled)
+}
@@ -0,0 +1,51 @@
+package da
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/availproject/cdk-avail-da-server/scripts/migration/pkg/dac"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrDACReadOnly is returned by writes to the DAC, the server never posts to the
+// committee
+var ErrDACReadOnly = errors.New("the DAC is read-only")
+
+// DACBackend reads the batch data from the members of the data availability
+// committee, to serve the batches that weren't migrated to Avail yet during the
+// transition. A member that fails is skipped for the next one.
+type DACBackend struct {
+	client *dac.Client
+}
+
+// NewDACBackend returns the backend of the committee members at urls, credentials in
+// the userinfo of a url are sent to that member
+func NewDACBackend(urls []string) (*DACBackend, error) {
+	client, err := dac.NewClient(urls, 0, dac.Auth{})
+	if err != nil {
+		return nil, err
+	}
+	return &DACBackend{client: client}, nil
+}
+
+// Backend returns BackendDAC
+func (d *DACBackend) Backend() string {
+	return BackendDAC
+}
+
+// Get returns the data of hash from the first member that has it, the data is
+// checked against the hash. ErrNotFound when every member answered without it.
+func (d *DACBackend) Get(ctx context.Context, hash common.Hash) ([]byte, error) {
+	data, err := d.client.GetDataByHash(ctx, hash)
+	if errors.Is(err, dac.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return data, err
+}
+
+// Put returns ErrDACReadOnly
+func (d *DACBackend) Put(ctx context.Context, hash common.Hash, data []byte) error {
+	return ErrDACReadOnly
+}
@@ -0,0 +1,75 @@
+package da
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	avail "github.com/availproject/cdk-avail-da-server/lib/avail"
+)
+
+// DAMSource finds the data availability message of the sequence a batch hash was
+// sequenced with on L1
+type DAMSource interface {
+	// DataAvailabilityMessage returns ErrNotFound when no sequence holds hash
+	DataAvailabilityMessage(ctx context.Context, hash common.Hash) ([]byte, error)
+}
+
+type damKey struct{}
+
+// WithDataAvailabilityMessage returns a context carrying the data availability message
+// of the sequence of the hash read with it, it is resolved before the DAMSource
+func WithDataAvailabilityMessage(ctx context.Context, dam []byte) context.Context {
+	return context.WithValue(ctx, damKey{}, dam)
+}
+
+// DAMResolver resolves the blob pointers of data availability messages
+type DAMResolver struct {
+	source DAMSource
+}
+
+// NewDAMResolver returns the resolver of the data availability messages set on the
+// contexts or found by source, source may be nil
+func NewDAMResolver(source DAMSource) *DAMResolver {
+	return &DAMResolver{source: source}
+}
+
+func (r *DAMResolver) Name() string {
+	return ResolverDAM
+}
+
+// Resolve returns the Avail block and extrinsic index of the blob pointer of the data
+// availability message of hash
+func (r *DAMResolver) Resolve(ctx context.Context, hash common.Hash) (AvailLocation, error) {
+	dam, ok := ctx.Value(damKey{}).([]byte)
+	if !ok || len(dam) == 0 {
+		if r.source == nil {
+			return AvailLocation{}, fmt.Errorf("%w: no data availability message of %s", ErrNotFound, hash.Hex())
+		}
+		var err error
+		dam, err = r.source.DataAvailabilityMessage(ctx, hash)
+		if err != nil {
+			return AvailLocation{}, err
+		}
+	}
+	return DecodeDataAvailabilityMessage(dam)
+}
+
+// DecodeDataAvailabilityMessage returns the Avail location of the blob pointer of the
+// data availability message dam, the other message types aren't supported
+func DecodeDataAvailabilityMessage(dam []byte) (AvailLocation, error) {
+	envelope, err := avail.UnpackEnvelope(dam)
+	if err != nil {
+		return AvailLocation{}, err
+	}
+	if envelope.MsgType != avail.DAM_TYPE_BLOB_POINTER {
+		info, _ := avail.LookupMessageType(envelope.MsgType)
+		return AvailLocation{}, fmt.Errorf("unsupported %s data availability message, only blob pointers are resolved", info.Name)
+	}
+	var pointer avail.BlobPointer
+	if err := pointer.UnmarshalFromBinary(envelope.Payload); err != nil {
+		return AvailLocation{}, err
+	}
+	return AvailLocation{Block: pointer.BlockHeight, Extrinsic: &pointer.ExtrinsicIndex}, nil
+}
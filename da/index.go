@@ -0,0 +1,36 @@
+package da
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Commitment schemes the data can be looked up by. The data is always stored under
+// its keccak256, the digests of the other schemes are aliases of it in the Index.
+const (
+	SchemeKeccak256 = "keccak256"
+	SchemeSHA256    = "sha256"
+)
+
+// SchemeBatchNumber maps the number of a batch, as a big endian 32 byte digest, to the
+// hash of its data in the Index. It isn't a commitment scheme data is looked up by.
+const SchemeBatchNumber = "batchnum"
+
+// SchemeSequenceTx maps the hash of the data of a batch to the hash of the L1
+// transaction that sequenced it in the Index
+const SchemeSequenceTx = "seqtx"
+
+// Index is a storage that maps the digests of other commitment schemes to the
+// keccak256 hash the data is stored under
+type Index interface {
+	PutAlias(ctx context.Context, scheme string, digest, hash common.Hash) error
+	// GetAlias returns ErrNotFound when the digest has no alias
+	GetAlias(ctx context.Context, scheme string, digest common.Hash) (common.Hash, error)
+}
+
+// IndexOf returns the index of the provider, nil when it has none
+func IndexOf(p DAProvider) Index {
+	index, _ := p.(Index)
+	return index
+}
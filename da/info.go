@@ -0,0 +1,142 @@
+package da
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Verification status of the data of a hash in BlobInfo
+const (
+	// VerificationAttested is data attested on L1, which Avail serves
+	VerificationAttested = "attested"
+	// VerificationUnattested is data without L1 attestation
+	VerificationUnattested = "unattested"
+	// VerificationUnknown is data whose attestation isn't checked as there is no cold
+	// tier
+	VerificationUnknown = "unknown"
+)
+
+// ObjectInfo is the metadata of the data of a hash in a backend
+type ObjectInfo struct {
+	Backend string `json:"backend"`
+	// Size is the size of the data, StoredSize the size it takes in the backend when
+	// it is compressed
+	Size       int    `json:"size"`
+	StoredSize int    `json:"storedSize,omitempty"`
+	Encoding   string `json:"encoding,omitempty"`
+	// StoredAt is when the data was written to the backend, nil when it isn't known
+	StoredAt *time.Time `json:"storedAt,omitempty"`
+	// Checksum is the checksum algorithm the backend validates the data with
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// Stater is a storage that returns the metadata of the data of a hash without reading
+// it
+type Stater interface {
+	// Stat returns ErrNotFound when the data of hash isn't stored
+	Stat(ctx context.Context, hash common.Hash) (ObjectInfo, error)
+}
+
+// StaterOf returns the stater of the provider, nil when it has none
+func StaterOf(p DAProvider) Stater {
+	stater, _ := p.(Stater)
+	return stater
+}
+
+// BlobInfo is the metadata of the data of a hash in every tier
+type BlobInfo struct {
+	Hash common.Hash `json:"hash"`
+	// Size is the size of the data, zero when no tier that knows it stores the data
+	Size int `json:"size"`
+	// Backends are the backends storing the data
+	Backends []ObjectInfo `json:"backends"`
+	// Avail is the location the data was submitted at, nil when no resolver knows it
+	// or there is no cold tier
+	Avail        *AvailLocation `json:"avail,omitempty"`
+	Verification string         `json:"verification"`
+}
+
+// Inspector is a provider that returns the metadata of the data of a hash in all of
+// its tiers without reading it
+type Inspector interface {
+	// Inspect returns ErrNotFound when no tier stores the data of hash
+	Inspect(ctx context.Context, hash common.Hash) (BlobInfo, error)
+}
+
+// Inspect returns the metadata of the data of hash in the provider, from its tiers
+// when it has some
+func Inspect(ctx context.Context, p DAProvider, hash common.Hash) (BlobInfo, error) {
+	if inspector, ok := p.(Inspector); ok {
+		return inspector.Inspect(ctx, hash)
+	}
+	info := BlobInfo{Hash: hash, Backends: []ObjectInfo{}, Verification: VerificationUnknown}
+	stater := StaterOf(p)
+	if stater == nil {
+		return info, fmt.Errorf("the storage doesn't return the metadata of its data")
+	}
+	object, err := stater.Stat(ctx, hash)
+	if err != nil {
+		return info, err
+	}
+	info.Size = object.Size
+	info.Backends = append(info.Backends, object)
+	return info, nil
+}
+
+// Inspect returns the metadata of the data of hash in the hot cache, the warm storage
+// and its replicas, and its Avail block when there is a cold tier. Backends that fail
+// are left out, the data is not found when no tier stores it and it isn't attested.
+func (t *TieredProvider) Inspect(ctx context.Context, hash common.Hash) (BlobInfo, error) {
+	info := BlobInfo{Hash: hash, Backends: []ObjectInfo{}, Verification: VerificationUnknown}
+	if t.hot != nil {
+		size, ok, err := t.hot.Size(ctx, hash)
+		if err != nil {
+			return info, fmt.Errorf("failed to read the hot cache: %w", err)
+		}
+		if ok {
+			info.Backends = append(info.Backends, ObjectInfo{Backend: BackendCache, Size: size})
+		}
+	}
+
+	staters := []Replica{{Backend: BackendOf(t.warm), Provider: t.warm}}
+	staters = append(staters, t.replicas...)
+	for _, r := range staters {
+		stater := StaterOf(r.Provider)
+		if stater == nil {
+			continue
+		}
+		object, err := stater.Stat(ctx, hash)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return info, fmt.Errorf("failed to read the %s tier: %w", r.Backend, err)
+		}
+		object.Backend = r.Backend
+		info.Backends = append(info.Backends, object)
+	}
+	for _, object := range info.Backends {
+		info.Size = max(info.Size, object.Size)
+	}
+
+	if t.cold != nil {
+		location, err := t.cold.Locate(hash)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			info.Verification = VerificationUnattested
+		case err != nil:
+			return info, fmt.Errorf("failed to read the attestation: %w", err)
+		default:
+			info.Avail = &location
+			info.Verification = VerificationAttested
+		}
+	}
+	if len(info.Backends) == 0 && info.Avail == nil {
+		return info, fmt.Errorf("%w: %s", ErrNotFound, hash.Hex())
+	}
+	return info, nil
+}
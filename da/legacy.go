@@ -0,0 +1,178 @@
+package da
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/availproject/cdk-avail-da-server/pkg/s3object"
+	"github.com/availproject/cdk-avail-da-server/pkg/storagekey"
+)
+
+const (
+	// s3LegacyKeyDir is the directory under the alias directory the keys objects were
+	// found under are recorded in, as objects holding the key
+	s3LegacyKeyDir = s3AliasDir + "key/"
+	// maxLegacyProbes is the number of hashes whose probe result is kept in memory,
+	// the results are dropped when it is reached
+	maxLegacyProbes = 100_000
+)
+
+// legacyKeys resolves the objects written by older tools under other encodings of
+// their hash. The encodings are probed once per hash, the key an object is found
+// under is recorded in the index so later reads and restarts skip the probing.
+type legacyKeys struct {
+	mu sync.Mutex
+	// probed holds the key found per probed hash, empty when none was found
+	probed map[common.Hash]string
+	// record writes the keys found to the index, replicas only keep them in memory
+	record bool
+}
+
+// ResolveLegacyKeys makes reads of hashes that aren't found under their key probe the
+// encodings of older tools: with 0x, in upper case hex, length prefixed like RLP,
+// ABI encoded as bytes and without the object prefix. With record the keys found are
+// written to the index of the bucket.
+func (s *S3Backend) ResolveLegacyKeys(record bool) {
+	s.legacy = &legacyKeys{probed: make(map[common.Hash]string), record: record}
+}
+
+// legacyKeyCandidates returns the keys older tools may have written the object of
+// hash under
+func (s *S3Backend) legacyKeyCandidates(hash common.Hash) []string {
+	encoded := storagekey.Encode(hash)
+	upper := strings.ToUpper(encoded)
+	names := []string{
+		"0x" + encoded,
+		upper,
+		"0x" + upper,
+		// RLP string of 32 bytes
+		"a0" + encoded,
+		// ABI encoded bytes: offset, length and data
+		fmt.Sprintf("%064x%064x%s", 32, common.HashLength, encoded),
+	}
+	prefixes := []string{s.objectPrefix}
+	if s.objectPrefix != "" {
+		prefixes = append(prefixes, "", strings.TrimSuffix(s.objectPrefix, "/"))
+	}
+
+	var keys []string
+	for _, prefix := range prefixes {
+		for _, name := range names {
+			keys = append(keys, prefix+name)
+		}
+		if prefix != s.objectPrefix {
+			keys = append(keys, prefix+encoded)
+		}
+	}
+	return keys
+}
+
+// getLegacy returns the object of hash found under a legacy key and the key
+func (s *S3Backend) getLegacy(ctx context.Context, hash common.Hash) ([]byte, string, error) {
+	s.legacy.mu.Lock()
+	key, probed := s.legacy.probed[hash]
+	s.legacy.mu.Unlock()
+	if probed && key == "" {
+		return nil, "", fmt.Errorf("%w: no legacy key of %s", ErrNotFound, hash.Hex())
+	}
+
+	if !probed {
+		recorded, err := s.recordedKey(ctx, hash)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, "", err
+		}
+		key = recorded
+	}
+	if key != "" {
+		data, err := s.getObject(ctx, key)
+		if err == nil {
+			s.remember(hash, key)
+			return data, key, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return nil, "", err
+		}
+	}
+
+	for _, candidate := range s.legacyKeyCandidates(hash) {
+		data, err := s.getObject(ctx, candidate)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		log.Printf("Found object under legacy key, hash:%v, key:%s", hash.Hex(), candidate)
+		s.remember(hash, candidate)
+		if err := s.recordKey(ctx, hash, candidate); err != nil {
+			log.Printf("Failed to record legacy key, hash:%v, err:%v", hash.Hex(), err)
+		}
+		return data, candidate, nil
+	}
+	s.remember(hash, "")
+	return nil, "", fmt.Errorf("%w: no legacy key of %s", ErrNotFound, hash.Hex())
+}
+
+func (s *S3Backend) remember(hash common.Hash, key string) {
+	s.legacy.mu.Lock()
+	defer s.legacy.mu.Unlock()
+	if len(s.legacy.probed) >= maxLegacyProbes {
+		s.legacy.probed = make(map[common.Hash]string)
+	}
+	s.legacy.probed[hash] = key
+}
+
+func (s *S3Backend) legacyIndexKey(hash common.Hash) string {
+	return s.objectPrefix + s3LegacyKeyDir + storagekey.Encode(hash)
+}
+
+// recordKey records the key the object of hash was found under in the index, read-only
+// buckets only keep it in memory
+func (s *S3Backend) recordKey(ctx context.Context, hash common.Hash, key string) error {
+	if s.anonymous || !s.legacy.record {
+		return nil
+	}
+	_, err := s.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:            aws.String(s.bucket),
+		Key:               aws.String(s.legacyIndexKey(hash)),
+		Body:              bytes.NewReader([]byte(key)),
+		ChecksumAlgorithm: s.checksumAlgorithm,
+	})
+	return err
+}
+
+// recordedKey returns the key recorded for hash in the index
+func (s *S3Backend) recordedKey(ctx context.Context, hash common.Hash) (string, error) {
+	key, err := s.getObject(ctx, s.legacyIndexKey(hash))
+	if err != nil {
+		return "", err
+	}
+	return string(key), nil
+}
+
+// getObject returns the object of key, ErrNotFound when there is none
+func (s *S3Backend) getObject(ctx context.Context, key string) ([]byte, error) {
+	data, _, err := s3object.Read(ctx, s.s3Client, &s3.GetObjectInput{
+		Bucket:       aws.String(s.bucket),
+		Key:          aws.String(key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	}, s3object.DefaultAttempts)
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, fmt.Errorf("%w: %w", ErrNotFound, err)
+		}
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,42 @@
+// Package mock provides an in-memory da.DAProvider for tests of the RPC server.
+package mock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/availproject/cdk-avail-da-server/da"
+)
+
+var ErrNotFound = da.ErrNotFound
+
+type Backend struct {
+	mu   sync.RWMutex
+	data map[common.Hash][]byte
+}
+
+func New() *Backend {
+	return &Backend{data: make(map[common.Hash][]byte)}
+}
+
+func (b *Backend) Get(ctx context.Context, hash common.Hash) ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	data, ok := b.data[hash]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, hash.Hex())
+	}
+	return data, nil
+}
+
+func (b *Backend) Put(ctx context.Context, hash common.Hash, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.data[hash] = append([]byte(nil), data...)
+	return nil
+}
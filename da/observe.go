@@ -0,0 +1,38 @@
+package da
+
+import (
+	"time"
+)
+
+// Backends the batch data is read from or written to, used as label of the metrics and
+// in the audit log
+const (
+	BackendCache    = "cache"
+	BackendS3       = "s3"
+	BackendPostgres = "postgres"
+	BackendAvail    = "avail"
+	BackendDAC      = "dac"
+)
+
+// Operations of the observed backends
+const (
+	OpGet = "get"
+	OpPut = "put"
+)
+
+// Observer is called after every operation on a backend with the size of the data
+// read or written, e.g. to record metrics
+type Observer func(backend, op string, size int, duration time.Duration, err error)
+
+// Named is a provider that knows the backend it stores the data in
+type Named interface {
+	Backend() string
+}
+
+// BackendOf returns the backend of the provider, empty when it doesn't know it
+func BackendOf(p DAProvider) string {
+	if named, ok := p.(Named); ok {
+		return named.Backend()
+	}
+	return ""
+}
@@ -0,0 +1,291 @@
+package da
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/lib/pq"
+)
+
+// DefaultPostgresTable is the table the batch data is stored in
+const DefaultPostgresTable = "batch_data"
+
+var postgresTableRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// PostgresBackend stores the batch data in a Postgres table keyed by hash, for small
+// networks that prefer their existing managed database over S3
+type PostgresBackend struct {
+	db    *sql.DB
+	table string
+	// aliases is the table of the aliases of the other commitment schemes
+	aliases string
+	// trash is the table evicted rows are moved to with soft delete
+	trash      string
+	softDelete bool
+}
+
+// NewPostgresBackend connects to the database of dsn, a postgres:// URL or a key=value
+// connection string, and creates the table when it doesn't exist
+func NewPostgresBackend(dsn, table string, maxConns int) (*PostgresBackend, error) {
+	if table == "" {
+		table = DefaultPostgresTable
+	}
+	if !postgresTableRegexp.MatchString(table) {
+		return nil, fmt.Errorf("invalid Postgres table %q, expected [schema.]name", table)
+	}
+	parts := strings.Split(table, ".")
+	name := parts[len(parts)-1]
+	for i, part := range parts {
+		parts[i] = pq.QuoteIdentifier(part)
+	}
+	quoted := strings.Join(parts, ".")
+	parts[len(parts)-1] = pq.QuoteIdentifier(name + "_aliases")
+	aliases := strings.Join(parts, ".")
+	parts[len(parts)-1] = pq.QuoteIdentifier(name + "_trash")
+	trash := strings.Join(parts, ".")
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Postgres: %w", err)
+	}
+	if maxConns > 0 {
+		db.SetMaxOpenConns(maxConns)
+		db.SetMaxIdleConns(maxConns)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to Postgres: %w", err)
+	}
+	// The data of a hash never changes, rows are only ever inserted
+	_, err = db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+quoted+` (
+		hash BYTEA PRIMARY KEY,
+		data BYTEA NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create Postgres table %s: %w", table, err)
+	}
+	_, err = db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+aliases+` (
+		scheme TEXT NOT NULL,
+		digest BYTEA NOT NULL,
+		hash BYTEA NOT NULL,
+		PRIMARY KEY (scheme, digest)
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create Postgres table %s_aliases: %w", table, err)
+	}
+	_, err = db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+trash+` (
+		hash BYTEA PRIMARY KEY,
+		data BYTEA NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL,
+		deleted_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create Postgres table %s_trash: %w", table, err)
+	}
+
+	log.Printf("Connected to Postgres, table:%s", table)
+	return &PostgresBackend{db: db, table: quoted, aliases: aliases, trash: trash}, nil
+}
+
+func (p *PostgresBackend) Get(ctx context.Context, hash common.Hash) ([]byte, error) {
+	start := time.Now()
+	log.Printf("Fetching data from Postgres, hash:%v", hash.Hex())
+
+	var data []byte
+	err := p.db.QueryRowContext(ctx, `SELECT data FROM `+p.table+` WHERE hash = $1`, hash.Bytes()).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, hash.Hex())
+	}
+	if err != nil {
+		log.Printf("Failed to get data from Postgres, hash:%v, err:%v", hash.Hex(), err)
+		return nil, fmt.Errorf("failed to get data: %w", err)
+	}
+
+	log.Printf("Successfully retrieved data from Postgres, hash:%s, size:%d, duration:%v", hash.Hex(), len(data), time.Since(start))
+	return data, nil
+}
+
+// Stat returns the size of the data of hash and when it was stored
+func (p *PostgresBackend) Stat(ctx context.Context, hash common.Hash) (ObjectInfo, error) {
+	var size int
+	var createdAt time.Time
+	err := p.db.QueryRowContext(ctx, `SELECT octet_length(data), created_at FROM `+p.table+` WHERE hash = $1`, hash.Bytes()).Scan(&size, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ObjectInfo{}, fmt.Errorf("%w: %s", ErrNotFound, hash.Hex())
+	}
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to stat data: %w", err)
+	}
+	return ObjectInfo{Backend: BackendPostgres, Size: size, StoredAt: &createdAt}, nil
+}
+
+// Put inserts the data of hash, data already stored is kept as it is the same
+func (p *PostgresBackend) Put(ctx context.Context, hash common.Hash, data []byte) error {
+	start := time.Now()
+	log.Printf("Storing data in Postgres, hash:%s, size:%d", hash.Hex(), len(data))
+
+	_, err := p.db.ExecContext(ctx, `INSERT INTO `+p.table+` (hash, data) VALUES ($1, $2) ON CONFLICT (hash) DO NOTHING`, hash.Bytes(), data)
+	if err != nil {
+		log.Printf("Failed to store data in Postgres, hash:%s, err:%v", hash.Hex(), err)
+		return fmt.Errorf("failed to store data: %w", err)
+	}
+
+	log.Printf("Successfully stored data in Postgres, hash:%s, size:%d, duration:%v", hash.Hex(), len(data), time.Since(start))
+	return nil
+}
+
+// Canary writes the data, reads it back and deletes it, to check the database before
+// the server starts
+func (p *PostgresBackend) Canary(ctx context.Context, data []byte) error {
+	hash := crypto.Keccak256Hash(data)
+	if err := p.Put(ctx, hash, data); err != nil {
+		return err
+	}
+	read, err := p.Get(ctx, hash)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(read, data) {
+		return fmt.Errorf("canary %s read back differs from the data written", hash.Hex())
+	}
+	if _, err := p.db.ExecContext(ctx, `DELETE FROM `+p.table+` WHERE hash = $1`, hash.Bytes()); err != nil {
+		return fmt.Errorf("failed to delete canary %s: %w", hash.Hex(), err)
+	}
+	return nil
+}
+
+// PutAlias stores the keccak256 hash of the data whose digest in scheme is digest
+func (p *PostgresBackend) PutAlias(ctx context.Context, scheme string, digest, hash common.Hash) error {
+	_, err := p.db.ExecContext(ctx, `INSERT INTO `+p.aliases+` (scheme, digest, hash) VALUES ($1, $2, $3) ON CONFLICT (scheme, digest) DO NOTHING`, scheme, digest.Bytes(), hash.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to store alias: %w", err)
+	}
+	return nil
+}
+
+// GetAlias returns the keccak256 hash of the data whose digest in scheme is digest
+func (p *PostgresBackend) GetAlias(ctx context.Context, scheme string, digest common.Hash) (common.Hash, error) {
+	var hash []byte
+	err := p.db.QueryRowContext(ctx, `SELECT hash FROM `+p.aliases+` WHERE scheme = $1 AND digest = $2`, scheme, digest.Bytes()).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return common.Hash{}, fmt.Errorf("%w: no %s alias %s", ErrNotFound, scheme, digest.Hex())
+	}
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to get alias: %w", err)
+	}
+	return common.BytesToHash(hash), nil
+}
+
+func (p *PostgresBackend) Backend() string {
+	return BackendPostgres
+}
+
+func (p *PostgresBackend) Close() error {
+	return p.db.Close()
+}
+
+// EvictOlderThan deletes the rows stored before cutoff whose hash is evictable. With
+// soft delete the rows are moved to the trash table instead.
+func (p *PostgresBackend) EvictOlderThan(ctx context.Context, cutoff time.Time, evictable func(common.Hash) bool) (int, error) {
+	evicted := 0
+	// Rows are walked in hash order, rows that are kept are never read twice
+	after := []byte{}
+	for {
+		rows, err := p.db.QueryContext(ctx, `SELECT hash FROM `+p.table+` WHERE created_at < $1 AND hash > $2 ORDER BY hash LIMIT 1000`, cutoff, after)
+		if err != nil {
+			return evicted, fmt.Errorf("failed to list rows: %w", err)
+		}
+		var hashes []common.Hash
+		for rows.Next() {
+			var hash []byte
+			if err := rows.Scan(&hash); err != nil {
+				rows.Close()
+				return evicted, err
+			}
+			hashes = append(hashes, common.BytesToHash(hash))
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return evicted, err
+		}
+		if len(hashes) == 0 {
+			return evicted, nil
+		}
+		after = hashes[len(hashes)-1].Bytes()
+
+		for _, hash := range hashes {
+			if !evictable(hash) {
+				continue
+			}
+			if err := p.delete(ctx, hash); err != nil {
+				return evicted, fmt.Errorf("failed to delete row %s: %w", hash.Hex(), err)
+			}
+			evicted++
+		}
+	}
+}
+
+func (p *PostgresBackend) delete(ctx context.Context, hash common.Hash) error {
+	if !p.softDelete {
+		_, err := p.db.ExecContext(ctx, `DELETE FROM `+p.table+` WHERE hash = $1`, hash.Bytes())
+		return err
+	}
+	_, err := p.db.ExecContext(ctx, `WITH moved AS (
+		DELETE FROM `+p.table+` WHERE hash = $1 RETURNING hash, data, created_at
+	)
+	INSERT INTO `+p.trash+` (hash, data, created_at) SELECT hash, data, created_at FROM moved
+	ON CONFLICT (hash) DO UPDATE SET data = EXCLUDED.data, deleted_at = now()`, hash.Bytes())
+	return err
+}
+
+// SoftDelete makes evictions move the rows to the trash table, where they are kept
+// until PurgeDeleted
+func (p *PostgresBackend) SoftDelete(ctx context.Context) error {
+	p.softDelete = true
+	return nil
+}
+
+// PurgeDeleted permanently deletes the rows moved to the trash before cutoff
+func (p *PostgresBackend) PurgeDeleted(ctx context.Context, cutoff time.Time) (int, error) {
+	res, err := p.db.ExecContext(ctx, `DELETE FROM `+p.trash+` WHERE deleted_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge the trash: %w", err)
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// Undelete moves the row of hash back from the trash. Its creation time is reset, so
+// the retention starts over.
+func (p *PostgresBackend) Undelete(ctx context.Context, hash common.Hash) error {
+	var restored []byte
+	err := p.db.QueryRowContext(ctx, `WITH moved AS (
+		DELETE FROM `+p.trash+` WHERE hash = $1 RETURNING hash, data
+	)
+	INSERT INTO `+p.table+` (hash, data) SELECT hash, data FROM moved
+	ON CONFLICT (hash) DO UPDATE SET created_at = now()
+	RETURNING hash`, hash.Bytes()).Scan(&restored)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %s is not in the trash", ErrNotFound, hash.Hex())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to undelete %s: %w", hash.Hex(), err)
+	}
+	return nil
+}
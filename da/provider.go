@@ -0,0 +1,24 @@
+package da
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/availproject/cdk-avail-da-server/pkg/daerrors"
+)
+
+// ErrNotFound is returned by providers that don't store the data of the hash
+var ErrNotFound = daerrors.ErrNotFound
+
+// DAProvider is a store of off-chain batch data addressed by the batch hash.
+type DAProvider interface {
+	Get(ctx context.Context, hash common.Hash) ([]byte, error)
+	Put(ctx context.Context, hash common.Hash, data []byte) error
+}
+
+// Canary is a storage that can check it is writable by writing, reading back and
+// deleting the data
+type Canary interface {
+	Canary(ctx context.Context, data []byte) error
+}
@@ -0,0 +1,226 @@
+package da
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Resolvers that map the hash of a batch to the location its data can be retrieved
+// from. The bridge API serves the proofs of a known Avail block and can't find a
+// location by hash, so it isn't a resolver.
+const (
+	// ResolverAttestation reads the Avail block and leaf index of the hash from the
+	// attestation contract of the bridge
+	ResolverAttestation = "attestation"
+	// ResolverIndex reads the location recorded under SchemeLocation in the index of
+	// the storage, by another resolver or by the ingestion
+	ResolverIndex = "index"
+	// ResolverTurboDA reads the Turbo DA submission of the hash from the submissions
+	// file of the migration tool, the data is read from Turbo DA
+	ResolverTurboDA = "turboda"
+	// ResolverDAM decodes the blob pointer of the data availability message the
+	// sequence of the hash was sequenced with on L1, supplied with the request or found
+	// by a DAMSource. It finds the data of chains without the bridge, which isn't
+	// attested.
+	ResolverDAM = "dam"
+)
+
+// ResolverNames returns the names of the resolvers
+func ResolverNames() []string {
+	return []string{ResolverAttestation, ResolverIndex, ResolverTurboDA, ResolverDAM}
+}
+
+// SchemeLocation maps the hash of the data to its encoded Avail location in the
+// Index. It isn't a commitment scheme data is looked up by.
+const SchemeLocation = "location"
+
+// Resolver maps the hash of a batch to the location its data can be retrieved from
+type Resolver interface {
+	Name() string
+	// Resolve returns ErrNotFound when the resolver doesn't know the hash
+	Resolve(ctx context.Context, hash common.Hash) (AvailLocation, error)
+}
+
+// LocationReader is a resolver whose locations are read from another service than
+// Avail
+type LocationReader interface {
+	Read(ctx context.Context, location AvailLocation) ([]byte, error)
+}
+
+// attestationResolver reads the locations from the attestation contract of the bridge
+type attestationResolver struct {
+	a *AvailBackend
+}
+
+func (r attestationResolver) Name() string {
+	return ResolverAttestation
+}
+
+func (r attestationResolver) Resolve(ctx context.Context, hash common.Hash) (AvailLocation, error) {
+	blockNumber, leafIndex, err := r.a.getAttestation(ctx, hash)
+	if err != nil {
+		return AvailLocation{}, err
+	}
+	if blockNumber == 0 {
+		return AvailLocation{}, fmt.Errorf("%w: no attestation found for %s", ErrNotFound, hash.Hex())
+	}
+	return AvailLocation{Block: blockNumber, LeafIndex: &leafIndex}, nil
+}
+
+// Kinds of the index of an encoded location
+const (
+	locationLeaf      = 1
+	locationExtrinsic = 2
+)
+
+// IndexResolver reads the locations recorded in an index
+type IndexResolver struct {
+	index Index
+}
+
+// NewIndexResolver returns the resolver of the locations recorded in index
+func NewIndexResolver(index Index) *IndexResolver {
+	return &IndexResolver{index: index}
+}
+
+func (r *IndexResolver) Name() string {
+	return ResolverIndex
+}
+
+// Resolve decodes the location recorded for hash
+func (r *IndexResolver) Resolve(ctx context.Context, hash common.Hash) (AvailLocation, error) {
+	encoded, err := r.index.GetAlias(ctx, SchemeLocation, hash)
+	if err != nil {
+		return AvailLocation{}, err
+	}
+	location := AvailLocation{Block: binary.BigEndian.Uint32(encoded[4:8])}
+	switch index := binary.BigEndian.Uint64(encoded[8:16]); encoded[0] {
+	case locationLeaf:
+		leafIndex := int64(index)
+		location.LeafIndex = &leafIndex
+	case locationExtrinsic:
+		extrinsic := uint32(index)
+		location.Extrinsic = &extrinsic
+	default:
+		return AvailLocation{}, fmt.Errorf("invalid location of %s: %x", hash.Hex(), encoded)
+	}
+	return location, nil
+}
+
+// Record records the Avail location of hash, so it is resolved without the resolver
+// that found it. Locations outside of Avail aren't recorded.
+func (r *IndexResolver) Record(ctx context.Context, hash common.Hash, location AvailLocation) error {
+	var encoded common.Hash
+	switch {
+	case location.Block == 0:
+		return nil
+	case location.LeafIndex != nil:
+		encoded[0] = locationLeaf
+		binary.BigEndian.PutUint64(encoded[8:16], uint64(*location.LeafIndex))
+	case location.Extrinsic != nil:
+		encoded[0] = locationExtrinsic
+		binary.BigEndian.PutUint64(encoded[8:16], uint64(*location.Extrinsic))
+	default:
+		return nil
+	}
+	binary.BigEndian.PutUint32(encoded[4:8], location.Block)
+	return r.index.PutAlias(ctx, SchemeLocation, hash, encoded)
+}
+
+// PreImageReader reads the data of a Turbo DA submission
+type PreImageReader interface {
+	GetPreImage(ctx context.Context, submissionID string) ([]byte, error)
+}
+
+// TurboDAResolver resolves the hashes submitted to Turbo DA by the migration tool,
+// from the JSON lines of its submissions file. The file is read again when it changed.
+type TurboDAResolver struct {
+	path   string
+	reader PreImageReader
+
+	mu          sync.Mutex
+	modTime     time.Time
+	size        int64
+	submissions map[common.Hash]string
+}
+
+// NewTurboDAResolver returns the resolver of the submissions of the file at path, read
+// through reader
+func NewTurboDAResolver(path string, reader PreImageReader) *TurboDAResolver {
+	return &TurboDAResolver{path: path, reader: reader}
+}
+
+func (r *TurboDAResolver) Name() string {
+	return ResolverTurboDA
+}
+
+// Resolve returns the Turbo DA submission of hash
+func (r *TurboDAResolver) Resolve(ctx context.Context, hash common.Hash) (AvailLocation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.reload(); err != nil {
+		return AvailLocation{}, err
+	}
+	submissionID, ok := r.submissions[hash]
+	if !ok {
+		return AvailLocation{}, fmt.Errorf("%w: no Turbo DA submission of %s", ErrNotFound, hash.Hex())
+	}
+	return AvailLocation{SubmissionID: submissionID}, nil
+}
+
+// Read reads the data of the submission from Turbo DA
+func (r *TurboDAResolver) Read(ctx context.Context, location AvailLocation) ([]byte, error) {
+	return r.reader.GetPreImage(ctx, location.SubmissionID)
+}
+
+// reload reads the submissions file when it changed since it was last read
+func (r *TurboDAResolver) reload() error {
+	stat, err := os.Stat(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Nothing was submitted yet
+		r.submissions = nil
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the submissions file: %w", err)
+	}
+	if r.submissions != nil && stat.ModTime().Equal(r.modTime) && stat.Size() == r.size {
+		return nil
+	}
+
+	f, err := os.Open(r.path)
+	if err != nil {
+		return fmt.Errorf("failed to read the submissions file: %w", err)
+	}
+	defer f.Close()
+	submissions := make(map[common.Hash]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var submission struct {
+			Hash         common.Hash `json:"hash"`
+			SubmissionID string      `json:"submissionId"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &submission); err != nil {
+			// The last line may be partially written
+			log.Printf("Skipping line %d of the submissions file %s: %v", line, r.path, err)
+			continue
+		}
+		submissions[submission.Hash] = submission.SubmissionID
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read the submissions file: %w", err)
+	}
+	r.submissions, r.modTime, r.size = submissions, stat.ModTime(), stat.Size()
+	log.Printf("Loaded %d Turbo DA submissions from %s", len(submissions), r.path)
+	return nil
+}
@@ -1,29 +1,85 @@
 package da
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/availproject/cdk-avail-da-server/logging"
+	"github.com/availproject/cdk-avail-da-server/pkg/s3object"
+	"github.com/availproject/cdk-avail-da-server/pkg/storagekey"
+)
+
+var ErrReadOnly = errors.New("S3 backend has no credentials and is read-only")
+
+// s3AliasDir is the directory under the prefix the aliases of the other commitment
+// schemes are stored in, as objects holding the keccak256 hash
+const s3AliasDir = "aliases/"
+
+// Object key layouts, aliases of the storagekey layouts
+const (
+	KeyLayoutFlat    = storagekey.LayoutFlat
+	KeyLayoutSharded = storagekey.LayoutSharded
 )
 
 type S3Backend struct {
 	s3Client     *s3.Client
 	bucket       string
 	objectPrefix string
+	keys         storagekey.Codec
+	anonymous    bool
+	// checksumAlgorithm is the checksum sent with uploads, empty keeps the SDK default
+	checksumAlgorithm types.ChecksumAlgorithm
+	// legacy resolves the keys of older tools, nil when disabled
+	legacy *legacyKeys
+	// softDelete keeps evicted objects until they are purged, as noncurrent versions
+	// when the bucket is versioned
+	softDelete bool
+	versioned  bool
+	// compression compresses the objects written, nil writes them as they are
+	compression *compressor
 }
 
-func NewS3Backend(bucket, region, accessKey, secretKey, objectPrefix string) (*S3Backend, error) {
+// NewS3Backend creates an S3 backend. Without access and secret key the requests are
+// sent unsigned, which allows reading public buckets but no writes. Uploads carry a
+// checksum of checksumAlgorithm S3 verifies and stores with the object, reads
+// validate it, so data corrupted on the network is caught before it is served.
+func NewS3Backend(bucket, region, accessKey, secretKey, objectPrefix, keyLayout, checksumAlgorithm string) (*S3Backend, error) {
+	keys, err := storagekey.NewCodec(objectPrefix, keyLayout)
+	if err != nil {
+		return nil, err
+	}
+	if checksumAlgorithm != "" && !slices.Contains(ChecksumAlgorithms(), checksumAlgorithm) {
+		return nil, fmt.Errorf("invalid S3 checksum algorithm %q, expected one of %v", checksumAlgorithm, ChecksumAlgorithms())
+	}
+
+	anonymous := accessKey == "" && secretKey == ""
+	var credentialsProvider aws.CredentialsProvider = credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")
+	if anonymous {
+		log.Printf("No S3 credentials configured, using anonymous read-only access")
+		credentialsProvider = aws.AnonymousCredentials{}
+	}
+
 	cfg, err := config.LoadDefaultConfig(context.TODO(),
 		config.WithRegion(region),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")),
+		config.WithCredentialsProvider(credentialsProvider),
+		// Responses and retries are traced when the s3 debug traces are enabled, the
+		// requests aren't, they carry the signature of the credentials
+		config.WithClientLogMode(aws.LogResponse|aws.LogRetries),
+		config.WithLogger(logging.SDKLogger(logging.S3)),
 	)
 	if err != nil {
 		log.Printf("Failed to load AWS config, err:%v", err)
@@ -32,50 +88,302 @@ func NewS3Backend(bucket, region, accessKey, secretKey, objectPrefix string) (*S
 	s3Client := s3.NewFromConfig(cfg)
 
 	return &S3Backend{
-		s3Client:     s3Client,
-		bucket:       bucket,
-		objectPrefix: objectPrefix,
+		s3Client:          s3Client,
+		bucket:            bucket,
+		objectPrefix:      objectPrefix,
+		keys:              keys,
+		anonymous:         anonymous,
+		checksumAlgorithm: types.ChecksumAlgorithm(checksumAlgorithm),
 	}, nil
 }
 
-func encodeKey(hash common.Hash) string {
-	return hash.Hex()[2:] // strip 0x
+// ChecksumAlgorithms returns the checksum algorithms of S3 uploads, e.g. CRC32C
+func ChecksumAlgorithms() []string {
+	var algorithms []string
+	for _, a := range types.ChecksumAlgorithm("").Values() {
+		algorithms = append(algorithms, string(a))
+	}
+	return algorithms
+}
+
+func (s *S3Backend) Backend() string {
+	return BackendS3
+}
+
+// objectKey returns the key objects are written to
+func (s *S3Backend) objectKey(hash common.Hash) string {
+	return s.keys.Key(hash)
+}
+
+// readKeys returns the keys an object may be stored under, objects written before
+// switching to the sharded layout are still found under the flat key
+func (s *S3Backend) readKeys(hash common.Hash) []string {
+	return s.keys.ReadKeys(hash)
 }
 
 func (s *S3Backend) GetDataFromS3(hash common.Hash) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return s.Get(ctx, hash)
+}
+
+func (s *S3Backend) Get(ctx context.Context, hash common.Hash) ([]byte, error) {
 	start := time.Now()
 	log.Printf("Fetching data from S3, hash:%v", hash.Hex())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	// Public buckets usually don't grant anonymous users the ListBucket permission
+	// HeadBucket needs, so the check is only done with credentials
+	if !s.anonymous {
+		_, err := s.s3Client.HeadBucket(ctx, &s3.HeadBucketInput{
+			Bucket: aws.String(s.bucket),
+		})
+		if err != nil {
+			log.Printf("Bucket check failed, bucket:%v, err:%v", s.bucket, err)
+			return nil, fmt.Errorf("bucket check failed: %w", err)
+		}
+	}
 
-	_, err := s.s3Client.HeadBucket(ctx, &s3.HeadBucketInput{
-		Bucket: aws.String(s.bucket),
+	var data []byte
+	var out *s3.GetObjectOutput
+	var key string
+	var err error
+	for _, key = range s.readKeys(hash) {
+		// Truncated bodies are resumed, and fail rather than returning a short blob
+		data, out, err = s3object.Read(ctx, s.s3Client, &s3.GetObjectInput{
+			Bucket:       aws.String(s.bucket),
+			Key:          aws.String(key),
+			ChecksumMode: types.ChecksumModeEnabled,
+		}, s3object.DefaultAttempts)
+		if err == nil {
+			break
+		}
+		log.Printf("Failed to get object from S3, key:%v, err:%v", key, err)
+		if errors.Is(err, s3object.ErrTruncated) {
+			return nil, fmt.Errorf("failed to read object body: %w", err)
+		}
+	}
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			if s.legacy != nil {
+				data, key, err := s.getLegacy(ctx, hash)
+				if err == nil {
+					log.Printf("Successfully retrieved data from S3, bucket:%s, key:%s, size:%d, duration:%v", s.bucket, key, len(data), time.Since(start))
+				}
+				return data, err
+			}
+			return nil, fmt.Errorf("%w: %w", ErrNotFound, err)
+		}
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	data, err = s.decompressObject(ctx, data, out.ContentEncoding)
+	if err != nil {
+		log.Printf("Failed to decompress object, key:%v, err:%v", key, err)
+		return nil, err
+	}
+
+	log.Printf("Successfully retrieved data from S3, bucket:%s, key:%s, size:%d, duration:%v", s.bucket, key,
+		len(data),
+		time.Since(start),
+	)
+	return data, nil
+}
+
+func (s *S3Backend) Put(ctx context.Context, hash common.Hash, data []byte) error {
+	start := time.Now()
+	key := s.objectKey(hash)
+	if s.anonymous {
+		return ErrReadOnly
+	}
+	log.Printf("Uploading data to S3, bucket:%s, key:%s, size:%d", s.bucket, key, len(data))
+
+	body, encoding, metadata := s.compressObject(data)
+	_, err := s.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:            aws.String(s.bucket),
+		Key:               aws.String(key),
+		Body:              bytes.NewReader(body),
+		ContentEncoding:   encoding,
+		Metadata:          metadata,
+		ChecksumAlgorithm: s.checksumAlgorithm,
 	})
 	if err != nil {
-		log.Printf("Bucket check failed, bucket:%v, err:%v", s.bucket, err)
-		return nil, fmt.Errorf("bucket check failed: %w", err)
+		log.Printf("Failed to put object to S3, key:%v, err:%v", key, err)
+		return fmt.Errorf("failed to put object: %w", err)
 	}
 
+	log.Printf("Successfully uploaded data to S3, bucket:%s, key:%s, size:%d, duration:%v", s.bucket, key, len(data), time.Since(start))
+	return nil
+}
+
+// Stat returns the metadata of the object of hash without reading it
+func (s *S3Backend) Stat(ctx context.Context, hash common.Hash) (ObjectInfo, error) {
+	for _, key := range s.readKeys(hash) {
+		out, err := s.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket:       aws.String(s.bucket),
+			Key:          aws.String(key),
+			ChecksumMode: types.ChecksumModeEnabled,
+		})
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			continue
+		}
+		if err != nil {
+			return ObjectInfo{}, fmt.Errorf("failed to stat object %s: %w", key, err)
+		}
+		info := ObjectInfo{
+			Backend:  BackendS3,
+			Size:     int(aws.ToInt64(out.ContentLength)),
+			Encoding: aws.ToString(out.ContentEncoding),
+			StoredAt: out.LastModified,
+			Checksum: checksumOf(out),
+		}
+		if size, err := strconv.Atoi(out.Metadata[sizeMetadata]); err == nil && info.Encoding != "" {
+			info.StoredSize, info.Size = info.Size, size
+		}
+		return info, nil
+	}
+	return ObjectInfo{}, fmt.Errorf("%w: %s", ErrNotFound, hash.Hex())
+}
+
+// checksumOf returns the algorithm of the checksum S3 stores with an object, empty
+// when it has none
+func checksumOf(out *s3.HeadObjectOutput) string {
+	switch {
+	case out.ChecksumCRC32 != nil:
+		return string(types.ChecksumAlgorithmCrc32)
+	case out.ChecksumCRC32C != nil:
+		return string(types.ChecksumAlgorithmCrc32c)
+	case out.ChecksumCRC64NVME != nil:
+		return string(types.ChecksumAlgorithmCrc64nvme)
+	case out.ChecksumSHA1 != nil:
+		return string(types.ChecksumAlgorithmSha1)
+	case out.ChecksumSHA256 != nil:
+		return string(types.ChecksumAlgorithmSha256)
+	}
+	return ""
+}
+
+func (s *S3Backend) aliasKey(scheme string, digest common.Hash) string {
+	return s.objectPrefix + s3AliasDir + scheme + "/" + storagekey.Encode(digest)
+}
+
+// PutAlias stores the keccak256 hash of the data whose digest in scheme is digest
+func (s *S3Backend) PutAlias(ctx context.Context, scheme string, digest, hash common.Hash) error {
+	if s.anonymous {
+		return ErrReadOnly
+	}
+	key := s.aliasKey(scheme, digest)
+	_, err := s.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:            aws.String(s.bucket),
+		Key:               aws.String(key),
+		Body:              bytes.NewReader(hash.Bytes()),
+		ChecksumAlgorithm: s.checksumAlgorithm,
+	})
+	if err != nil {
+		log.Printf("Failed to put alias to S3, key:%v, err:%v", key, err)
+		return fmt.Errorf("failed to put alias: %w", err)
+	}
+	return nil
+}
+
+// GetAlias returns the keccak256 hash of the data whose digest in scheme is digest
+func (s *S3Backend) GetAlias(ctx context.Context, scheme string, digest common.Hash) (common.Hash, error) {
+	key := s.aliasKey(scheme, digest)
 	out, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(s.objectPrefix + encodeKey(hash)),
+		Bucket:       aws.String(s.bucket),
+		Key:          aws.String(key),
+		ChecksumMode: types.ChecksumModeEnabled,
 	})
 	if err != nil {
-		log.Printf("Failed to get object from S3, key:%v, err:%v", s.objectPrefix+encodeKey(hash), err)
-		return nil, fmt.Errorf("failed to get object: %w", err)
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return common.Hash{}, fmt.Errorf("%w: no %s alias %s", ErrNotFound, scheme, digest.Hex())
+		}
+		return common.Hash{}, fmt.Errorf("failed to get alias: %w", err)
 	}
 	defer out.Body.Close()
 
-	data, err := io.ReadAll(out.Body)
+	hash, err := io.ReadAll(io.LimitReader(out.Body, common.HashLength+1))
 	if err != nil {
-		log.Printf("Failed to read object body, err:%v", err)
-		return nil, fmt.Errorf("failed to read object body: %w", err)
+		return common.Hash{}, fmt.Errorf("failed to read alias: %w", err)
+	}
+	if len(hash) != common.HashLength {
+		return common.Hash{}, fmt.Errorf("invalid alias %s of %d bytes", key, len(hash))
 	}
+	return common.BytesToHash(hash), nil
+}
 
-	log.Printf("Successfully retrieved data from S3, bucket:%s, key:%s, size:%d, duration:%v", s.bucket, s.objectPrefix+hash.String(),
-		len(data),
-		time.Since(start),
-	)
-	return data, nil
+// Canary writes the data to a canary object, reads it back and deletes it, to check
+// the bucket and the credentials before the server starts
+func (s *S3Backend) Canary(ctx context.Context, data []byte) error {
+	if s.anonymous {
+		return ErrReadOnly
+	}
+	key := fmt.Sprintf("%sselftest-canary-%x", s.objectPrefix, data[:8])
+	_, err := s.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:            aws.String(s.bucket),
+		Key:               aws.String(key),
+		Body:              bytes.NewReader(data),
+		ChecksumAlgorithm: s.checksumAlgorithm,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write canary %s: %w", key, err)
+	}
+	read, err := s.getObject(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to read canary %s: %w", key, err)
+	}
+	if !bytes.Equal(read, data) {
+		return fmt.Errorf("canary %s read back differs from the data written", key)
+	}
+	_, err = s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete canary %s: %w", key, err)
+	}
+	return nil
+}
+
+// EvictOlderThan deletes the objects under the prefix last modified before cutoff
+// whose hash is evictable. Objects whose key isn't a hash, aliases and the trash are
+// never deleted.
+func (s *S3Backend) EvictOlderThan(ctx context.Context, cutoff time.Time, evictable func(common.Hash) bool) (int, error) {
+	if s.anonymous {
+		return 0, ErrReadOnly
+	}
+	evicted := 0
+	paginator := s3.NewListObjectsV2Paginator(s.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.objectPrefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return evicted, fmt.Errorf("failed to list objects: %w", err)
+		}
+		for _, object := range page.Contents {
+			if object.LastModified == nil || !object.LastModified.Before(cutoff) {
+				continue
+			}
+			key := aws.ToString(object.Key)
+			hash, ok := s.hashOfKey(key)
+			if !ok || !evictable(hash) {
+				continue
+			}
+			if err := s.delete(ctx, key); err != nil {
+				return evicted, fmt.Errorf("failed to delete object %s: %w", key, err)
+			}
+			evicted++
+		}
+	}
+	return evicted, nil
+}
+
+// hashOfKey returns the hash of the object of key, false for aliases, the trash and
+// the keys that aren't a hash
+func (s *S3Backend) hashOfKey(key string) (common.Hash, bool) {
+	hash, err := s.keys.Hash(key)
+	return hash, err == nil
 }
@@ -0,0 +1,162 @@
+package da
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/availproject/cdk-avail-da-server/pkg/storagekey"
+	"github.com/stretchr/testify/require"
+)
+
+const testBucket = "test-bucket"
+
+// fakeObject is an object of the fake S3 bucket
+type fakeObject struct {
+	body     []byte
+	header   http.Header
+	modified time.Time
+}
+
+// fakeS3 is an in-memory S3 bucket served over the S3 REST api, path style, with the
+// requests the backend sends
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]fakeObject
+	// pageSize is the number of keys of a list page
+	pageSize int
+	// onList is called before every list page is served
+	onList func()
+}
+
+func newFakeS3Backend(t *testing.T, bucket *fakeS3, prefix string) *S3Backend {
+	srv := httptest.NewServer(bucket)
+	t.Cleanup(srv.Close)
+	keys, err := storagekey.NewCodec(prefix, "")
+	require.NoError(t, err)
+	client := s3.New(s3.Options{
+		Region:                     "us-east-1",
+		BaseEndpoint:               aws.String(srv.URL),
+		UsePathStyle:               true,
+		Credentials:                aws.AnonymousCredentials{},
+		RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+		ResponseChecksumValidation: aws.ResponseChecksumValidationWhenRequired,
+	})
+	return &S3Backend{s3Client: client, bucket: testBucket, objectPrefix: prefix, keys: keys}
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: make(map[string]fakeObject), pageSize: 1000}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/"+testBucket), "/")
+	if key == "" {
+		switch r.Method {
+		case http.MethodHead:
+			return
+		case http.MethodGet:
+			f.list(w, r)
+			return
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		header := http.Header{}
+		for k, v := range r.Header {
+			if k == "Content-Encoding" || strings.HasPrefix(k, "X-Amz-Meta-") {
+				header[k] = v
+			}
+		}
+		f.objects[key] = fakeObject{body: body, header: header, modified: time.Now()}
+	case http.MethodGet, http.MethodHead:
+		object, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+			}
+			return
+		}
+		for k, v := range object.header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.body)))
+		w.Header().Set("Last-Modified", object.modified.UTC().Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			w.Write(object.body)
+		}
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+type fakeListResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	IsTruncated           bool
+	NextContinuationToken string `xml:",omitempty"`
+	Contents              []fakeListObject
+}
+
+type fakeListObject struct {
+	Key          string
+	LastModified string
+	Size         int
+}
+
+// list serves a ListObjectsV2 page, the continuation token is the last key served
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	if f.onList != nil {
+		f.onList()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prefix := r.URL.Query().Get("prefix")
+	after := r.URL.Query().Get("continuation-token")
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var result fakeListResult
+	if len(keys) > f.pageSize {
+		keys = keys[:f.pageSize]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[len(keys)-1]
+	}
+	for _, key := range keys {
+		object := f.objects[key]
+		result.Contents = append(result.Contents, fakeListObject{Key: key, LastModified: object.modified.UTC().Format(time.RFC3339Nano), Size: len(object.body)})
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+// remove deletes the objects whose key has the prefix
+func (f *fakeS3) remove(prefix string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			delete(f.objects, key)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package da
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// scoreAlpha is the weight of a new sample in the rolling failure rate
+	scoreAlpha = 0.2
+	// scoreSlowLatency is the latency above which a read counts as failed
+	scoreSlowLatency = 5 * time.Second
+	// scoreHalfLife is the time after which the failure rate of an unused backend is
+	// halved, so a degraded backend is tried first again once it had time to recover
+	scoreHalfLife = time.Minute
+	// scoreDegraded is the failure rate above which a backend is degraded
+	scoreDegraded = 0.1
+)
+
+// healthScore is the rolling failure rate of a backend. Errors and reads slower than
+// scoreSlowLatency are failures, data that isn't found is a regular answer.
+type healthScore struct {
+	mu       sync.Mutex
+	failures float64
+	updated  time.Time
+}
+
+func (s *healthScore) observe(latency time.Duration, err error) {
+	sample := 0.0
+	if (err != nil && !errors.Is(err, ErrNotFound)) || latency > scoreSlowLatency {
+		sample = 1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.failures = scoreAlpha*sample + (1-scoreAlpha)*s.decayed(now)
+	s.updated = now
+}
+
+// degradation returns the failure rate of a degraded backend, zero when it is healthy
+func (s *healthScore) degradation(now time.Time) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if failures := s.decayed(now); failures > scoreDegraded {
+		return failures
+	}
+	return 0
+}
+
+func (s *healthScore) decayed(now time.Time) float64 {
+	if s.updated.IsZero() {
+		return 0
+	}
+	age := now.Sub(s.updated)
+	return s.failures * math.Pow(0.5, float64(age)/float64(scoreHalfLife))
+}
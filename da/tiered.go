@@ -0,0 +1,346 @@
+package da
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/availproject/cdk-avail-da-server/lease"
+)
+
+// Evictor is a warm tier that can drop old data
+type Evictor interface {
+	// EvictOlderThan deletes the data stored before cutoff for which evictable returns
+	// true, and returns the number of deleted entries
+	EvictOlderThan(ctx context.Context, cutoff time.Time, evictable func(common.Hash) bool) (int, error)
+}
+
+// TieredProvider serves recently sequenced batches from the hot cache, mid-term data
+// from the warm storage (S3 or Postgres) and its read replicas, and data evicted from
+// the warm storage from Avail. Data read from a lower tier is promoted to the hot
+// cache, data read from a mirrored source is also copied to the warm storage.
+type TieredProvider struct {
+	// hot and cold are optional
+	hot  HotCache
+	warm DAProvider
+	cold *AvailBackend
+	// lower are the tiers below the hot cache in their configured order, degraded
+	// tiers are read last so requests don't wait on them first
+	lower []*lowerTier
+	// replicas are the read-only copies of the warm storage
+	replicas []Replica
+	// observe is called after every read or write of a tier, it is optional
+	observe Observer
+	// leases hand the eviction to one server of the deployment, nil runs it
+	leases *lease.Leases
+}
+
+// lowerTier is a backend below the hot cache
+type lowerTier struct {
+	backend string
+	get     func(ctx context.Context, hash common.Hash) ([]byte, error)
+	health  healthScore
+}
+
+// NewTieredProvider returns the tiers, replicas are read-only copies of the warm
+// storage, e.g. buckets in other regions
+func NewTieredProvider(hot HotCache, warm DAProvider, cold *AvailBackend, replicas ...Replica) *TieredProvider {
+	t := &TieredProvider{hot: hot, warm: warm, cold: cold, replicas: replicas}
+	t.lower = append(t.lower, &lowerTier{backend: BackendOf(warm), get: warm.Get})
+	for _, replica := range replicas {
+		t.lower = append(t.lower, &lowerTier{backend: replica.Backend, get: replica.Provider.Get})
+	}
+	if cold != nil {
+		t.lower = append(t.lower, &lowerTier{backend: BackendAvail, get: func(ctx context.Context, hash common.Hash) ([]byte, error) {
+			return t.getCold(ctx, hash)
+		}})
+	}
+	return t
+}
+
+// WarmOf returns the warm storage of the provider, the provider itself when it has
+// no tiers
+func WarmOf(p DAProvider) DAProvider {
+	if t, ok := p.(*TieredProvider); ok {
+		return t.warm
+	}
+	return p
+}
+
+// Replica is a read-only copy of the warm storage
+type Replica struct {
+	// Backend labels the replica in the metrics
+	Backend  string
+	Provider DAProvider
+}
+
+// Mirror reads the data missing from the warm storage and its replicas from source
+// before the cold tier, and copies the data found into the warm storage, so data that
+// still lives elsewhere, e.g. on the DAC during the migration to Avail, is served from
+// the storage from then on
+func (t *TieredProvider) Mirror(source DAProvider) {
+	tier := &lowerTier{backend: BackendOf(source), get: func(ctx context.Context, hash common.Hash) ([]byte, error) {
+		data, err := source.Get(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		err = t.warm.Put(ctx, hash, data)
+		t.record(t.Backend(), OpPut, start, len(data), err)
+		if err != nil {
+			// The data is served anyway, the next read mirrors it again
+			log.Printf("Failed to copy the data read from %s to the storage, hash:%s, err:%v", BackendOf(source), hash.Hex(), err)
+		} else {
+			log.Printf("Copied the data read from %s to the storage, hash:%s", BackendOf(source), hash.Hex())
+		}
+		return data, nil
+	}}
+	// The cold tier is last
+	n := len(t.lower)
+	if t.cold != nil {
+		n--
+	}
+	t.lower = slices.Insert(t.lower, n, tier)
+}
+
+// Observe calls observe after every read or write of a tier, labeled with the backend
+// of the tier
+func (t *TieredProvider) Observe(observe Observer) {
+	t.observe = observe
+}
+
+// UseLeases runs the eviction only while the server holds its lease, so servers
+// sharing the warm storage don't delete the same data
+func (t *TieredProvider) UseLeases(leases *lease.Leases) {
+	t.leases = leases
+}
+
+// Backend returns the backend of the warm tier, which stores all the data
+func (t *TieredProvider) Backend() string {
+	return BackendOf(t.warm)
+}
+
+func (t *TieredProvider) record(backend, op string, start time.Time, size int, err error) {
+	if t.observe != nil {
+		t.observe(backend, op, size, time.Since(start), err)
+	}
+}
+
+func (t *TieredProvider) Get(ctx context.Context, hash common.Hash) ([]byte, error) {
+	if t.hot != nil {
+		start := time.Now()
+		data, ok, err := t.hot.Get(ctx, hash)
+		if err != nil {
+			// The cache is an optimization, the lower tiers still serve the data
+			log.Printf("Failed to read the hot cache, hash:%s, err:%v", hash.Hex(), err)
+		} else if !ok {
+			err = ErrNotFound
+		}
+		t.record(BackendCache, OpGet, start, len(data), err)
+		if ok {
+			return data, nil
+		}
+	}
+
+	err := ErrNotFound
+	for i, tier := range t.ordered() {
+		if i > 0 {
+			log.Printf("Data not read from the previous tier, reading it from %s, hash:%s", tier.backend, hash.Hex())
+		}
+		start := time.Now()
+		data, e := tier.get(ctx, hash)
+		tier.health.observe(time.Since(start), e)
+		t.record(tier.backend, OpGet, start, len(data), e)
+		if e == nil {
+			t.promote(ctx, hash, data)
+			return data, nil
+		}
+		// A failure is returned over a miss, the data may be in the failed tier
+		if !errors.Is(e, ErrNotFound) {
+			log.Printf("Failed to read the %s tier, hash:%s, err:%v", tier.backend, hash.Hex(), e)
+			err = e
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, err
+}
+
+// ordered returns the healthy lower tiers in their configured order followed by the
+// degraded ones, the least degraded first
+func (t *TieredProvider) ordered() []*lowerTier {
+	if len(t.lower) == 1 {
+		return t.lower
+	}
+	now := time.Now()
+	scores := make(map[*lowerTier]float64, len(t.lower))
+	for _, tier := range t.lower {
+		scores[tier] = tier.health.degradation(now)
+	}
+	ordered := slices.Clone(t.lower)
+	slices.SortStableFunc(ordered, func(a, b *lowerTier) int {
+		switch {
+		case scores[a] < scores[b]:
+			return -1
+		case scores[a] > scores[b]:
+			return 1
+		}
+		return 0
+	})
+	return ordered
+}
+
+// getCold reads the data from Avail, data no resolver locates is not found
+func (t *TieredProvider) getCold(ctx context.Context, hash common.Hash) ([]byte, error) {
+	data, err := t.cold.GetDataFromAvail(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if crypto.Keccak256Hash(data) != hash {
+		return nil, fmt.Errorf("data read from Avail doesn't match the hash %s", hash.Hex())
+	}
+	return data, nil
+}
+
+// Put stores the data in the warm tier, and in the hot cache as it was just sequenced
+func (t *TieredProvider) Put(ctx context.Context, hash common.Hash, data []byte) error {
+	start := time.Now()
+	err := t.warm.Put(ctx, hash, data)
+	t.record(t.Backend(), OpPut, start, len(data), err)
+	if err != nil {
+		return err
+	}
+	t.promote(ctx, hash, data)
+	return nil
+}
+
+// PutAlias stores the alias in the warm tier
+func (t *TieredProvider) PutAlias(ctx context.Context, scheme string, digest, hash common.Hash) error {
+	index := IndexOf(t.warm)
+	if index == nil {
+		return fmt.Errorf("the warm storage has no index")
+	}
+	return index.PutAlias(ctx, scheme, digest, hash)
+}
+
+// GetAlias reads the alias from the warm tier
+func (t *TieredProvider) GetAlias(ctx context.Context, scheme string, digest common.Hash) (common.Hash, error) {
+	index := IndexOf(t.warm)
+	if index == nil {
+		return common.Hash{}, fmt.Errorf("%w: the warm storage has no index", ErrNotFound)
+	}
+	return index.GetAlias(ctx, scheme, digest)
+}
+
+func (t *TieredProvider) promote(ctx context.Context, hash common.Hash, data []byte) {
+	if t.hot == nil {
+		return
+	}
+	start := time.Now()
+	err := t.hot.Set(ctx, hash, data)
+	t.record(BackendCache, OpPut, start, len(data), err)
+	if err != nil {
+		log.Printf("Failed to write the hot cache, hash:%s, err:%v", hash.Hex(), err)
+	}
+}
+
+// RunEviction deletes the data older than retention from the warm tier every
+// interval until ctx is done. Only data attested on L1, which Avail still serves, is
+// deleted. With a grace period the evicted data is soft deleted and purged once it
+// was deleted for longer than grace, zero deletes it right away.
+func (t *TieredProvider) RunEviction(ctx context.Context, retention, grace, interval time.Duration) error {
+	evictor, ok := t.warm.(Evictor)
+	if !ok {
+		return fmt.Errorf("the warm storage doesn't support eviction")
+	}
+	if t.cold == nil {
+		return fmt.Errorf("eviction needs Avail as cold tier")
+	}
+	var trash Trash
+	if grace > 0 {
+		if trash, ok = t.warm.(Trash); !ok {
+			return fmt.Errorf("the warm storage doesn't support soft delete")
+		}
+		if err := trash.SoftDelete(ctx); err != nil {
+			return err
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			// The holder renews the lease during and between runs, another server
+			// takes over once it missed a run and a run stops once it lost the lease
+			t.leases.Run(ctx, lease.JobEviction, 2*interval, func(ctx context.Context) {
+				t.evict(ctx, evictor, retention)
+				if trash != nil && ctx.Err() == nil {
+					t.purge(ctx, trash, grace)
+				}
+			})
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+func (t *TieredProvider) evict(ctx context.Context, evictor Evictor, retention time.Duration) {
+	start := time.Now()
+	cutoff := start.Add(-retention)
+	log.Printf("Evicting data older than %s from the warm tier", cutoff.Format(time.RFC3339))
+
+	kept := 0
+	evicted, err := evictor.EvictOlderThan(ctx, cutoff, func(hash common.Hash) bool {
+		attested, err := t.cold.HasAttestation(hash)
+		if err != nil || !attested {
+			kept++
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		log.Printf("Eviction from the warm tier failed after %d entries: %v", evicted, err)
+		return
+	}
+	log.Printf("Evicted %d entries from the warm tier, kept %d without attestation (duration %v)", evicted, kept, time.Since(start))
+}
+
+func (t *TieredProvider) purge(ctx context.Context, trash Trash, grace time.Duration) {
+	start := time.Now()
+	purged, err := trash.PurgeDeleted(ctx, start.Add(-grace))
+	if err != nil {
+		log.Printf("Purging the deleted data of the warm tier failed after %d entries: %v", purged, err)
+		return
+	}
+	log.Printf("Purged %d entries deleted more than %v ago from the warm tier (duration %v)", purged, grace, time.Since(start))
+}
+
+// Undelete restores the data of hash evicted from the warm tier during its grace
+// period
+func (t *TieredProvider) Undelete(ctx context.Context, hash common.Hash) error {
+	trash, ok := t.warm.(Trash)
+	if !ok {
+		return fmt.Errorf("the warm storage doesn't support soft delete")
+	}
+	return trash.Undelete(ctx, hash)
+}
+
+// TrainDictionary trains the compression dictionary of the warm tier
+func (t *TieredProvider) TrainDictionary(ctx context.Context, samples int) (Dictionary, error) {
+	trainer, ok := t.warm.(DictionaryTrainer)
+	if !ok {
+		return Dictionary{}, ErrCompressionDisabled
+	}
+	return trainer.TrainDictionary(ctx, samples)
+}
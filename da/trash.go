@@ -0,0 +1,296 @@
+package da
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// s3TrashDir is the directory under the prefix evicted objects are moved to with soft
+// delete when the bucket isn't versioned
+const s3TrashDir = "trash/"
+
+// Trash is a warm tier that keeps the data it evicts for a grace period, so data
+// deleted by a misconfigured retention can be recovered
+type Trash interface {
+	// SoftDelete makes EvictOlderThan keep the evicted data until PurgeDeleted
+	SoftDelete(ctx context.Context) error
+	// PurgeDeleted permanently deletes the data evicted before cutoff, and returns the
+	// number of purged entries
+	PurgeDeleted(ctx context.Context, cutoff time.Time) (int, error)
+	Undeleter
+}
+
+// Undeleter restores soft deleted data
+type Undeleter interface {
+	// Undelete restores the evicted data of hash, ErrNotFound when there is none
+	Undelete(ctx context.Context, hash common.Hash) error
+}
+
+// UndeleterOf returns the undeleter of the provider, nil when it has none
+func UndeleterOf(p DAProvider) Undeleter {
+	undeleter, _ := p.(Undeleter)
+	return undeleter
+}
+
+// SoftDelete makes evictions keep the objects. In a versioned bucket the delete
+// leaves a delete marker over the object versions, otherwise the object is moved
+// under the trash directory of the prefix.
+func (s *S3Backend) SoftDelete(ctx context.Context) error {
+	if s.anonymous {
+		return ErrReadOnly
+	}
+	out, err := s.s3Client.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{
+		Bucket: aws.String(s.bucket),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read the versioning of bucket %s: %w", s.bucket, err)
+	}
+	s.versioned = out.Status == types.BucketVersioningStatusEnabled
+	s.softDelete = true
+	if s.versioned {
+		log.Printf("S3 bucket %s is versioned, evicted objects are kept as noncurrent versions", s.bucket)
+	} else {
+		log.Printf("S3 bucket %s isn't versioned, evicted objects are moved under %s%s", s.bucket, s.objectPrefix, s3TrashDir)
+	}
+	return nil
+}
+
+func (s *S3Backend) trashKey(key string) string {
+	return s.objectPrefix + s3TrashDir + strings.TrimPrefix(key, s.objectPrefix)
+}
+
+// delete deletes the object of key, with soft delete it is kept in the trash
+func (s *S3Backend) delete(ctx context.Context, key string) error {
+	if s.softDelete && !s.versioned {
+		if err := s.copyObject(ctx, key, s.trashKey(key)); err != nil {
+			return err
+		}
+	}
+	_, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// copyObject copies the object of src to dst. The copy is a new object, so its
+// retention starts over, even when src and dst are the same key. The encoding and the
+// metadata of compressed objects are carried over.
+func (s *S3Backend) copyObject(ctx context.Context, src, dst string) error {
+	encoding, metadata, err := s.objectEncoding(ctx, src)
+	if err != nil {
+		return err
+	}
+	_, err = s.s3Client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:            aws.String(s.bucket),
+		Key:               aws.String(dst),
+		CopySource:        aws.String(s.bucket + "/" + src),
+		MetadataDirective: types.MetadataDirectiveReplace,
+		ContentEncoding:   encoding,
+		Metadata:          metadata,
+		ChecksumAlgorithm: s.checksumAlgorithm,
+	})
+	return err
+}
+
+// PurgeDeleted permanently deletes the objects evicted before cutoff
+func (s *S3Backend) PurgeDeleted(ctx context.Context, cutoff time.Time) (int, error) {
+	if s.anonymous {
+		return 0, ErrReadOnly
+	}
+	if s.versioned {
+		return s.purgeVersions(ctx, cutoff)
+	}
+	purged := 0
+	paginator := s3.NewListObjectsV2Paginator(s.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.objectPrefix + s3TrashDir),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return purged, fmt.Errorf("failed to list the trash: %w", err)
+		}
+		for _, object := range page.Contents {
+			if object.LastModified == nil || !object.LastModified.Before(cutoff) {
+				continue
+			}
+			_, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(s.bucket),
+				Key:    object.Key,
+			})
+			if err != nil {
+				return purged, fmt.Errorf("failed to purge object %s: %w", aws.ToString(object.Key), err)
+			}
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// purgeVersions deletes every version of the objects whose latest version is a
+// delete marker older than cutoff
+func (s *S3Backend) purgeVersions(ctx context.Context, cutoff time.Time) (int, error) {
+	var deleted []string
+	paginator := s3.NewListObjectVersionsPaginator(s.s3Client, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.objectPrefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to list object versions: %w", err)
+		}
+		for _, marker := range page.DeleteMarkers {
+			key := aws.ToString(marker.Key)
+			if !aws.ToBool(marker.IsLatest) || marker.LastModified == nil || !marker.LastModified.Before(cutoff) {
+				continue
+			}
+			if _, ok := s.hashOfKey(key); ok {
+				deleted = append(deleted, key)
+			}
+		}
+	}
+
+	purged := 0
+	for _, key := range deleted {
+		versions, err := s.versionsOf(ctx, key)
+		if err != nil {
+			return purged, err
+		}
+		for _, version := range versions {
+			_, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket:    aws.String(s.bucket),
+				Key:       aws.String(key),
+				VersionId: aws.String(version),
+			})
+			if err != nil {
+				return purged, fmt.Errorf("failed to purge version %s of object %s: %w", version, key, err)
+			}
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// versionsOf returns the ids of the versions and delete markers of key, the latest
+// last, so an interrupted purge leaves the object deleted
+func (s *S3Backend) versionsOf(ctx context.Context, key string) ([]string, error) {
+	var latest, versions []string
+	paginator := s3.NewListObjectVersionsPaginator(s.s3Client, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(key),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the versions of object %s: %w", key, err)
+		}
+		for _, marker := range page.DeleteMarkers {
+			if aws.ToString(marker.Key) != key {
+				continue
+			}
+			if aws.ToBool(marker.IsLatest) {
+				latest = append(latest, aws.ToString(marker.VersionId))
+			} else {
+				versions = append(versions, aws.ToString(marker.VersionId))
+			}
+		}
+		for _, version := range page.Versions {
+			if aws.ToString(version.Key) != key {
+				continue
+			}
+			if aws.ToBool(version.IsLatest) {
+				latest = append(latest, aws.ToString(version.VersionId))
+			} else {
+				versions = append(versions, aws.ToString(version.VersionId))
+			}
+		}
+	}
+	return append(versions, latest...), nil
+}
+
+// Undelete restores the evicted object of hash. The restored object is written again,
+// so its retention starts over and it isn't evicted on the next run.
+func (s *S3Backend) Undelete(ctx context.Context, hash common.Hash) error {
+	if s.anonymous {
+		return ErrReadOnly
+	}
+	for _, key := range s.readKeys(hash) {
+		var err error
+		if s.versioned {
+			err = s.removeDeleteMarker(ctx, key)
+		} else {
+			err = s.restoreFromTrash(ctx, key)
+		}
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		return err
+	}
+	return fmt.Errorf("%w: %s is not in the trash", ErrNotFound, hash.Hex())
+}
+
+func (s *S3Backend) removeDeleteMarker(ctx context.Context, key string) error {
+	out, err := s.s3Client.ListObjectVersions(ctx, &s3.ListObjectVersionsInput{
+		Bucket:  aws.String(s.bucket),
+		Prefix:  aws.String(key),
+		MaxKeys: aws.Int32(2),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list the versions of object %s: %w", key, err)
+	}
+	for _, marker := range out.DeleteMarkers {
+		if aws.ToString(marker.Key) != key || !aws.ToBool(marker.IsLatest) {
+			continue
+		}
+		_, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket:    aws.String(s.bucket),
+			Key:       aws.String(key),
+			VersionId: marker.VersionId,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to remove the delete marker of object %s: %w", key, err)
+		}
+		if err := s.copyObject(ctx, key, key); err != nil {
+			return fmt.Errorf("failed to rewrite object %s: %w", key, err)
+		}
+		return nil
+	}
+	return ErrNotFound
+}
+
+func (s *S3Backend) restoreFromTrash(ctx context.Context, key string) error {
+	trashed := s.trashKey(key)
+	_, err := s.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(trashed),
+	})
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read object %s: %w", trashed, err)
+	}
+	if err := s.copyObject(ctx, trashed, key); err != nil {
+		return fmt.Errorf("failed to restore object %s: %w", key, err)
+	}
+	_, err = s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(trashed),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete object %s from the trash: %w", trashed, err)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/availproject/cdk-avail-da-server/pkg/l1"
+	"github.com/availproject/cdk-avail-da-server/service"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// newDAMSource returns the scanner finding the data availability messages of the dam
+// resolver on L1, nil when DAM_SCAN_START_BLOCK isn't set and they are only supplied
+// with the requests
+func newDAMSource(ctx context.Context, cfg serverConfig, storage da.DAProvider) (da.DAMSource, error) {
+	if cfg.DAMScanStartBlock == 0 {
+		return nil, nil
+	}
+	ethClient, err := ethclient.DialContext(ctx, cfg.L1RPCURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to L1: %w", err)
+	}
+	scanner, err := service.NewDAMScanner(l1.NewClient(ethClient, nil), common.HexToAddress(cfg.ValidiumContractAddress), cfg.DAMScanStartBlock, cfg.L1Confirmations, storage)
+	if err != nil {
+		ethClient.Close()
+		return nil, err
+	}
+	log.Printf("Data availability messages are scanned from L1 block %d on demand", cfg.DAMScanStartBlock)
+	return scanner, nil
+}
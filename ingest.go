@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/availproject/cdk-avail-da-server/lease"
+	avail "github.com/availproject/cdk-avail-da-server/lib/avail"
+	"github.com/availproject/cdk-avail-da-server/pkg/l1"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	// ingestRangeSize is the number of L1 blocks queried with a single eth_getLogs
+	// request while catching up
+	ingestRangeSize = 1000
+	// ingestReaderSeed is the account of the Avail reader, it never submits so a
+	// development account is enough
+	ingestReaderSeed = "//Ingest"
+	// ingestTimeout bounds the read of a sequence and the writes of its batches
+	ingestTimeout = 2 * time.Minute
+)
+
+// Results of the ingestion of the batches passed to onIngest
+const (
+	ingestOK      = "ok"
+	ingestSkipped = "skipped"
+	ingestFailed  = "failed"
+)
+
+// ingester mirrors the batches sequenced by the validium contract into the storage
+type ingester struct {
+	client   *l1.Client
+	abi      abi.ABI
+	contract common.Address
+	reader   *avail.AvailBackend
+	storage  da.DAProvider
+	// warm is the warm storage of the storage, batches missing from it are ingested
+	warm da.DAProvider
+	// index records the batch numbers, nil when the storage has none
+	index    da.Index
+	onIngest func(result string, batches int)
+	// leases hand the ingestion to one server of the deployment, the lease is renewed
+	// before every sequence and lasts leaseTTL
+	leases   *lease.Leases
+	leaseTTL time.Duration
+}
+
+// runIngestion watches the validium contract for new sequences every INGEST_INTERVAL
+// until ctx is done. The batches of every sequence missing from the storage are read
+// from Avail or Turbo DA through its data availability message, checked against their
+// hash and written to the storage and the hot cache, so the server mirrors the rollup
+// without the sequencer posting to it. The number of batches of every result is
+// passed to onIngest. With leases only the server holding the ingestion lease ingests.
+func runIngestion(ctx context.Context, cfg serverConfig, storage da.DAProvider, leases *lease.Leases, onIngest func(result string, batches int)) error {
+	ethClient, err := ethclient.DialContext(ctx, cfg.L1RPCURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to L1: %w", err)
+	}
+	client := l1.NewClient(ethClient, nil)
+
+	contractAbi, err := abi.JSON(strings.NewReader(l1.PolygonValidiumABI))
+	if err != nil {
+		client.Close()
+		return err
+	}
+	reader, err := avail.New(cfg.L1RPCURL, common.HexToAddress(cfg.AttestationContractAddress), avail.Config{
+		Seed:       ingestReaderSeed,
+		HttpApiUrl: cfg.AvailRPCURL,
+		TurboDA: avail.TurboDAConfig{
+			ApiUrl: cfg.TurboDAURL,
+			ApiKey: cfg.TurboDAAPIKey,
+		},
+		ReadPriority: string(avail.ReadPriorityAvailFirst),
+	}, nil)
+	if err != nil {
+		client.Close()
+		return fmt.Errorf("failed to initialize the Avail reader: %w", err)
+	}
+
+	next := cfg.IngestStartBlock
+	if next == 0 {
+		head, err := client.BlockNumber(ctx)
+		if err != nil {
+			client.Close()
+			return fmt.Errorf("failed to get the L1 head: %w", err)
+		}
+		next = head + 1
+	}
+	i := &ingester{
+		client:   client,
+		abi:      contractAbi,
+		contract: common.HexToAddress(cfg.ValidiumContractAddress),
+		reader:   reader,
+		storage:  storage,
+		warm:     da.WarmOf(storage),
+		index:    da.IndexOf(storage),
+		onIngest: onIngest,
+		leases:   leases,
+		leaseTTL: 2*cfg.IngestInterval + ingestTimeout,
+	}
+	log.Printf("Ingesting the sequences of %s from L1 block %d every %v", cfg.ValidiumContractAddress, next, cfg.IngestInterval)
+
+	go func() {
+		defer client.Close()
+		ticker := time.NewTicker(cfg.IngestInterval)
+		defer ticker.Stop()
+		for {
+			var err error
+			next, err = i.catchUp(ctx, next)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Ingestion stopped at L1 block %d, retrying: %v", next, err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// catchUp ingests the sequences of the L1 blocks from next to the head and returns the
+// first block not ingested yet. Sequences that fail aren't retried, their batches are
+// left to the cold tier and the repairs. It stops when another server holds the
+// ingestion lease, the blocks it ingests are checked again on takeover.
+func (i *ingester) catchUp(ctx context.Context, next uint64) (uint64, error) {
+	if !i.leases.Hold(ctx, lease.JobIngest, i.leaseTTL) {
+		return next, nil
+	}
+	head, err := i.client.BlockNumber(ctx)
+	if err != nil {
+		return next, fmt.Errorf("failed to get the L1 head: %w", err)
+	}
+	for next <= head && ctx.Err() == nil {
+		if !i.leases.Hold(ctx, lease.JobIngest, i.leaseTTL) {
+			return next, nil
+		}
+		end := min(next+ingestRangeSize-1, head)
+		blocks, err := l1.QuerySequencesFromL1ByRange(ctx, i.client, i.abi, i.contract,
+			new(big.Int).SetUint64(next), new(big.Int).SetUint64(end))
+		if err != nil {
+			return next, fmt.Errorf("failed to query the sequences of blocks %d to %d: %w", next, end, err)
+		}
+		for block := next; block <= end; block++ {
+			for _, seq := range blocks[block] {
+				if !i.leases.Hold(ctx, lease.JobIngest, i.leaseTTL) {
+					return block, nil
+				}
+				i.ingest(ctx, block, seq)
+			}
+		}
+		next = end + 1
+	}
+	return next, ctx.Err()
+}
+
+// ingest writes the batches of the sequence missing from the storage
+func (i *ingester) ingest(ctx context.Context, block uint64, seq l1.Sequence) {
+	ctx, cancel := context.WithTimeout(ctx, ingestTimeout)
+	defer cancel()
+
+	i.recordBatchNumbers(ctx, seq)
+	missing := make(map[common.Hash]bool)
+	for _, hash := range seq.BatchHashes {
+		if !i.stored(ctx, hash) {
+			missing[hash] = true
+		}
+	}
+	skipped := len(seq.BatchHashes) - len(missing)
+	if len(missing) == 0 {
+		i.observe(ingestSkipped, skipped)
+		return
+	}
+
+	batches, err := i.reader.GetSequence(ctx, seq.BatchHashes, seq.DataAvailabilityMessage)
+	if err == nil && len(batches) != len(seq.BatchHashes) {
+		err = fmt.Errorf("read %d batches, the sequence has %d", len(batches), len(seq.BatchHashes))
+	}
+	if err != nil {
+		log.Printf("Failed to ingest the sequence of L1 block %d, tx %s: %v", block, seq.TxHash.Hex(), err)
+		i.observe(ingestFailed, len(missing))
+		i.observe(ingestSkipped, skipped)
+		return
+	}
+
+	ingested, failed := 0, 0
+	for n, hash := range seq.BatchHashes {
+		if !missing[hash] {
+			continue
+		}
+		data := batches[n]
+		if actual := crypto.Keccak256Hash(data); actual != hash {
+			log.Printf("Failed to ingest batch %s of L1 block %d, the data read has keccak256 %s", hash.Hex(), block, actual.Hex())
+			failed++
+			continue
+		}
+		if err := i.storage.Put(ctx, hash, data); err != nil {
+			log.Printf("Failed to ingest batch %s of L1 block %d: %v", hash.Hex(), block, err)
+			failed++
+			continue
+		}
+		ingested++
+	}
+	log.Printf("Ingested the sequence of L1 block %d, tx %s: %d batches written, %d failed", block, seq.TxHash.Hex(), ingested, failed)
+	i.observe(ingestOK, ingested)
+	i.observe(ingestFailed, failed)
+	i.observe(ingestSkipped, skipped)
+}
+
+// stored returns whether the warm storage already has the batch, e.g. because the
+// sequencer posted it. The cold tier isn't read, batches only Avail serves are
+// ingested so the warm storage mirrors them.
+func (i *ingester) stored(ctx context.Context, hash common.Hash) bool {
+	var err error
+	if stater := da.StaterOf(i.warm); stater != nil {
+		_, err = stater.Stat(ctx, hash)
+	} else {
+		_, err = i.warm.Get(ctx, hash)
+	}
+	if err != nil && !errors.Is(err, da.ErrNotFound) {
+		log.Printf("Failed to check batch %s, ingesting it: %v", hash.Hex(), err)
+	}
+	return err == nil
+}
+
+// recordBatchNumbers records the numbers of the batches of the sequence in the index,
+// so sync_getOffChainDataByBatchNum doesn't scan L1 for them
+func (i *ingester) recordBatchNumbers(ctx context.Context, seq l1.Sequence) {
+	if i.index == nil || seq.LastBatch == 0 {
+		return
+	}
+	for n, number := range seq.BatchNumbers() {
+		key := common.BigToHash(new(big.Int).SetUint64(number))
+		if err := i.index.PutAlias(ctx, da.SchemeBatchNumber, key, seq.BatchHashes[n]); err != nil {
+			log.Printf("Failed to index batch %d: %v", number, err)
+			return
+		}
+	}
+}
+
+func (i *ingester) observe(result string, batches int) {
+	if i.onIngest != nil && batches > 0 {
+		i.onIngest(result, batches)
+	}
+}
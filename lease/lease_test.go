@@ -0,0 +1,143 @@
+package lease
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis answers the commands the leases send over RESP. The holder of the server
+// holds every lease while held is set.
+type fakeRedis struct {
+	held  atomic.Bool
+	holds atomic.Int32
+}
+
+func newFakeRedis(t *testing.T) (*fakeRedis, string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeRedis{}
+	var wg sync.WaitGroup
+	t.Cleanup(wg.Wait)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer conn.Close()
+				f.serve(conn)
+			}()
+		}
+	}()
+	return f, "redis://" + ln.Addr().String() + "/0"
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			fmt.Fprint(conn, "+PONG\r\n")
+		case "EVALSHA":
+			f.holds.Add(1)
+			if f.held.Load() {
+				fmt.Fprint(conn, ":1\r\n")
+			} else {
+				fmt.Fprint(conn, ":0\r\n")
+			}
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+	}
+}
+
+// readCommand reads a command sent as a RESP array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		args[i] = string(arg[:size])
+	}
+	return args, nil
+}
+
+// ✅ Test the lease is renewed during a run and the run stops once it is lost
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	redis, url := newFakeRedis(t)
+	l, err := New(url)
+	require.NoError(t, err)
+	defer l.Close()
+
+	redis.held.Store(true)
+	ran := l.Run(ctx, JobEviction, 30*time.Millisecond, func(ctx context.Context) {
+		time.Sleep(100 * time.Millisecond)
+		assert.NoError(t, ctx.Err(), "the run must go on while the lease is renewed")
+	})
+	assert.True(t, ran)
+	assert.GreaterOrEqual(t, redis.holds.Load(), int32(4))
+
+	// The renewals stop with the run
+	holds := redis.holds.Load()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, holds, redis.holds.Load())
+
+	// ❌ Another server took the lease over during the run
+	ran = l.Run(ctx, JobEviction, 30*time.Millisecond, func(ctx context.Context) {
+		redis.held.Store(false)
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Error("the run must stop once the lease is lost")
+		}
+	})
+	assert.True(t, ran)
+
+	// ❌ Another server holds the lease
+	ran = l.Run(ctx, JobEviction, 30*time.Millisecond, func(ctx context.Context) {
+		t.Error("the run must be skipped")
+	})
+	assert.False(t, ran)
+
+	// Without leases every run goes on
+	var none *Leases
+	assert.True(t, none.Run(ctx, JobEviction, time.Millisecond, func(ctx context.Context) {}))
+}
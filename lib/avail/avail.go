@@ -7,13 +7,20 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/big"
+	"math/bits"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/vedhavyas/go-subkey/v2"
 
 	"github.com/0xPolygon/cdk/log"
@@ -27,37 +34,105 @@ import (
 const (
 	AvailMessageHeaderFlag byte = 0x0a
 	AvailNetworkID              = 42
-	BridgeApiTimeout            = time.Duration(1200)
-	AvailRPCTimeout             = time.Duration(120)
-	BridgeApiWaitInterval       = time.Duration(420)
-	BridgeApiRetryCount         = 10
 	VectorXTimeout              = time.Duration(10000)
+	// Defaults of the timeouts in Config, the bridge proof is waited for during
+	// DefaultBridgeApiRetryCount times DefaultBridgeApiWaitInterval
+	DefaultAvailRPCTimeout       = time.Duration(120) * time.Second
+	DefaultBridgeApiWaitInterval = time.Duration(420) * time.Second
+	DefaultBridgeApiRetryCount   = 10
+	// Window in which posting an identical sequence again returns the earlier message
+	DefaultDedupWindow       = time.Duration(3600) * time.Second
+	postedSequencesCacheSize = 1024
+	// Upper bound for a single data submission (pallet MaxAppDataLength)
+	DefaultMaxSequenceSize = 1024 * 1024
+	// Defaults of the extrinsic era in blocks and of the retries of an extrinsic that
+	// outlived it, those of ExecuteAndWatchFinalization
+	DefaultMortality     = 32
+	DefaultSubmitRetries = 2
+	// Target block time of Avail, the submissions wait for the era of each attempt
+	AvailBlockTime = time.Duration(20) * time.Second
 )
 
 var (
 	ErrAvailDAClientInit          = errors.New("unable to initialize to connect with AvailDA")
 	ErrBatchSubmitToAvailDAFailed = errors.New("unable to submit batch to AvailDA")
 	ErrWrongAvailDAPointer        = errors.New("unable to retrieve batch, wrong blobPointer")
+	ErrDataExpiredFromDA          = errors.New("data expired from AvailDA, the block has been pruned and no fallback copy is available")
+	ErrFinalityUnconfirmed        = errors.New("the finalization of the included sequence was not confirmed before the backend was closed")
+	ErrSequenceTooLarge           = errors.New("sequence exceeds the maximum size accepted by AvailDA, split the batches into smaller sequences")
 )
 
 type AvailBackend struct {
 	logger *log.Logger
 
-	sdk     avail_sdk.SDK
+	client  AvailClient
 	acc     subkey.KeyPair
 	address string
 	appId   int
 
-	httpApi string
+	httpApi         string
+	maxSequenceSize int
 
 	// AvailDA bridge
 	bridgeEnabled       bool
 	bridgeApi           string
-	attestationContract *availattestation.Availattestation
-	bridgeTimeout       int
+	attestationContract AttestationReader
+	vectorx             DataRootCommitmentReader
+	attestationAddress  common.Address
+	l1Client            CodeReader
+	bridgeApiTimeout    time.Duration
+	bridgeWaitInterval  time.Duration
+	bridgeRetryCount    int
+	availRPCTimeout     time.Duration
+
+	// Era of the submitted extrinsics and retries of those that outlived it
+	mortality     uint32
+	submitRetries int
+	blockTime     time.Duration
+
+	// Submissions return on avail_sdk.Inclusion with FastInclusion and the watcher
+	// confirms their finalization, avail_sdk.Finalization otherwise
+	waitFor    uint8
+	inclusions *inclusionWatcher
+
+	// Data submissions in flight and deadline of the whole post of a sequence, 0 when
+	// only the Avail RPC and bridge timeouts apply
+	submissions   *submissionTracker
+	submitTimeout time.Duration
 
 	// S3 Fallback service
-	fallbackS3Service *s3_storage_service.S3StorageService
+	fallbackS3Service FallbackStorage
+	readPriority      ReadPriority
+
+	// Caches of bridge proofs keyed by block hash and tx index and of attestations
+	// keyed by leaf, nil when caching is disabled
+	bridgeProofCache *ttlCache[bridgeProofKey, *MerkleProofInput]
+	attestationCache *ttlCache[[32]byte, attestation]
+
+	// Data availability messages of recently posted sequences keyed by the sequence
+	// commitment and app id, nil when deduplication is disabled
+	postedSequences *ttlCache[sequenceKey, *PostResult]
+
+	// Recently read finalized blocks
+	blockHashCache *ttlCache[uint32, primitives.H256]
+	blockCache     *ttlCache[primitives.H256, []avail_sdk.DataSubmission]
+
+	// Optional durable submission queue
+	queue *submissionQueue
+
+	// Optional background requests of bridge proofs, and the extrinsics of the
+	// sequences presubmitted ahead of their PostSequence keyed by sequence commitment
+	// and app id, until their PostSequence consumes them
+	proofWorker  *proofWorker
+	presubmitted *ttlCache[sequenceKey, submittedData]
+
+	// TurboDA, the client is kept when only the api url is set so that turbo
+	// submissions posted earlier can still be read
+	turboDAEnabled bool
+	turboDA        TurboDAClient
+
+	// Client of the bridge api requests, through the configured proxy
+	httpClient *http.Client
 }
 
 func New(l1RPCURL string, attestationContractAddress common.Address, config Config, logger *log.Logger) (*AvailBackend, error) {
@@ -67,22 +142,31 @@ func New(l1RPCURL string, attestationContractAddress common.Address, config Conf
 	}
 
 	logger.Info("AvailDAInfo: ✏️ Avail backend client is being initialized...")
-	logger.Debugf("AvailDADebug: AvailDA config, ws-api-url: %s, http-api-url: %s, app-id: %d, bridge-enabled: %t, bridge-api-url: %s, bridge-timeout: %d",
+	logger.Debugf("AvailDADebug: AvailDA config, ws-api-url: %s, http-api-url: %s, app-id: %d, bridge-enabled: %t, bridge-api-url: %s, bridge-api-timeout: %d, bridge-api-wait-interval: %d, bridge-api-retry-count: %d, avail-rpc-timeout: %d",
 		config.WsApiUrl,
 		config.HttpApiUrl,
 		config.AppID,
 		config.BridgeEnabled,
 		config.BridgeApiUrl,
-		config.BridgeTimeout,
+		config.BridgeApiTimeout,
+		config.BridgeApiWaitInterval,
+		config.BridgeApiRetryCount,
+		config.AvailRPCTimeout,
 	)
 	logger.Debugf("AvailDADebug: 📜 Attestation contract address=%s", attestationContractAddress)
 
-	ethClient, err := ethclient.Dial(l1RPCURL)
+	httpClient, err := newHTTPClient(config.ProxyUrl)
+	if err != nil {
+		return nil, fmt.Errorf("AvailDAError: %w. %w", err, ErrAvailDAClientInit)
+	}
+	rpcClient, err := rpc.DialOptions(context.Background(), l1RPCURL, rpc.WithHTTPClient(httpClient))
 	if err != nil {
 		logger.Errorf("AvailDAError: ⚠️ error connecting to %s: %+v", l1RPCURL, err)
 		return nil, err
 	}
 
+	ethClient := ethclient.NewClient(rpcClient)
+
 	attestationContract, err := availattestation.NewAvailattestation(attestationContractAddress, ethClient)
 	if err != nil {
 		return nil, err
@@ -94,6 +178,43 @@ func New(l1RPCURL string, attestationContractAddress common.Address, config Conf
 		return nil, err
 	}
 
+	var fallbackS3Service FallbackStorage
+	if config.FallbackS3ServiceConfig.Enable {
+		logger.Debugf("AvailDADebug:ℹ️ Fallback S3 config: s3-bucket: %s, region: %s, object-prefix: %s", config.FallbackS3ServiceConfig.Bucket, config.FallbackS3ServiceConfig.Region, config.FallbackS3ServiceConfig.ObjectPrefix)
+		s3Service, err := s3_storage_service.NewS3StorageService(config.FallbackS3ServiceConfig, logger)
+		if err != nil {
+			return nil, fmt.Errorf("AvailDAError: unable to intialize s3 storage service for fallback, %w. %w", err, ErrAvailDAClientInit)
+		}
+		fallbackS3Service = s3Service
+	}
+	if config.FallbackErasureConfig.Enable {
+		if fallbackS3Service != nil {
+			return nil, fmt.Errorf("AvailDAError: FallbackS3ServiceConfig and FallbackErasureConfig are both enabled, enable only one. %w", ErrAvailDAClientInit)
+		}
+		logger.Debugf("AvailDADebug:ℹ️ Fallback erasure coded storage: buckets: %d, data-shards: %d", len(config.FallbackErasureConfig.Buckets), config.FallbackErasureConfig.DataShards)
+		erasureService, err := s3_storage_service.NewErasureStorageService(config.FallbackErasureConfig, logger)
+		if err != nil {
+			return nil, fmt.Errorf("AvailDAError: unable to intialize erasure coded storage service for fallback, %w. %w", err, ErrAvailDAClientInit)
+		}
+		fallbackS3Service = erasureService
+	}
+
+	backend, err := NewWithClients(config, NewSDKClient(sdk), attestationContract, fallbackS3Service, logger)
+	if err != nil {
+		return nil, err
+	}
+	backend.SetAttestationContractCodeReader(ethClient, attestationContractAddress)
+	backend.SetDataRootCommitmentReader(newVectorxContract(attestationContract, ethClient))
+	return backend, nil
+}
+
+// NewWithClients creates the backend on top of already constructed clients. The
+// fallback storage is optional and may be nil.
+func NewWithClients(config Config, client AvailClient, attestationContract AttestationReader, fallbackS3Service FallbackStorage, logger *log.Logger) (*AvailBackend, error) {
+	if logger == nil {
+		logger = log.GetDefaultLogger()
+	}
+
 	appId := 0
 
 	// if app id is greater than 0 then it must be created before submitting data
@@ -101,66 +222,420 @@ func New(l1RPCURL string, attestationContractAddress common.Address, config Conf
 		appId = config.AppID
 	}
 
+	maxSequenceSize := DefaultMaxSequenceSize
+	if config.MaxSequenceSize > 0 {
+		maxSequenceSize = config.MaxSequenceSize
+	}
+
 	acc, err := avail_sdk.Account.NewKeyPair(config.Seed)
 	if err != nil {
 		logger.Error("AvailDAError: ⚠️ unable to generate keypair from given seed")
+		return nil, fmt.Errorf("AvailDAError: unable to generate keypair from given seed, %w. %w", err, ErrAvailDAClientInit)
 	}
 
-	var fallbackS3Service *s3_storage_service.S3StorageService
-	if config.FallbackS3ServiceConfig.Enable {
-		logger.Debugf("AvailDADebug:ℹ️ Fallback S3 config: s3-bucket: %s, region: %s, object-prefix: %s, secret-key: %s, access-key: %s", config.FallbackS3ServiceConfig.Bucket, config.FallbackS3ServiceConfig.Region, config.FallbackS3ServiceConfig.ObjectPrefix, config.FallbackS3ServiceConfig.SecretKey, config.FallbackS3ServiceConfig.AccessKey)
-		fallbackS3Service, err = s3_storage_service.NewS3StorageService(config.FallbackS3ServiceConfig, logger)
-		if err != nil {
-			return nil, fmt.Errorf("AvailDAError: unable to intialize s3 storage service for fallback, %w. %w", err, ErrAvailDAClientInit)
+	readPriority := ReadPriority(config.ReadPriority)
+	switch readPriority {
+	case "":
+		readPriority = ReadPriorityS3First
+	case ReadPriorityS3First, ReadPriorityAvailFirst, ReadPriorityRace:
+	default:
+		return nil, fmt.Errorf("AvailDAError: invalid read priority %q, expected one of %s, %s, %s. %w", config.ReadPriority, ReadPriorityS3First, ReadPriorityAvailFirst, ReadPriorityRace, ErrAvailDAClientInit)
+	}
+
+	httpClient, err := newHTTPClient(config.ProxyUrl)
+	if err != nil {
+		return nil, fmt.Errorf("AvailDAError: %w. %w", err, ErrAvailDAClientInit)
+	}
+
+	var turboDA TurboDAClient
+	if config.TurboDA.ApiUrl != "" {
+		turboDA = newTurboDAClient(config.TurboDA.ApiUrl, config.TurboDA.ApiKey, httpClient.Transport)
+	} else if config.TurboDA.Enable {
+		return nil, fmt.Errorf("AvailDAError: TurboDA is enabled, %w. %w", ErrTurboDANotConfigured, ErrAvailDAClientInit)
+	}
+
+	if config.BridgeApiTimeout < 0 || config.BridgeApiWaitInterval < 0 || config.BridgeTimeout < 0 || config.BridgeApiRetryCount < 0 || config.AvailRPCTimeout < 0 || config.ProofWorker.Concurrency < 0 || config.Mortality < 0 || config.FinalityCheckInterval < 0 || config.SubmitTimeout < 0 {
+		return nil, fmt.Errorf("AvailDAError: timeouts, intervals and retry counts must not be negative. %w", ErrAvailDAClientInit)
+	}
+
+	// A total wait shorter than the retry schedule would give up on the bridge proof
+	// before the last queries
+	bridgeWaitInterval := config.bridgeWaitInterval()
+	bridgeRetryCount := intOrDefault(config.BridgeApiRetryCount, DefaultBridgeApiRetryCount)
+	if schedule := time.Duration(bridgeRetryCount) * bridgeWaitInterval; config.BridgeApiTimeout > 0 && time.Duration(config.BridgeApiTimeout)*time.Second < schedule {
+		return nil, fmt.Errorf("AvailDAError: BridgeApiTimeout of %ds is shorter than the %d bridge proof queries every %v. %w", config.BridgeApiTimeout, bridgeRetryCount, bridgeWaitInterval, ErrAvailDAClientInit)
+	}
+
+	var bridgeProofCache *ttlCache[bridgeProofKey, *MerkleProofInput]
+	var attestationCache *ttlCache[[32]byte, attestation]
+	if config.ProofCacheTTL >= 0 {
+		ttl := DefaultProofCacheTTL
+		if config.ProofCacheTTL > 0 {
+			ttl = time.Duration(config.ProofCacheTTL) * time.Second
 		}
+		bridgeProofCache = newTTLCache[bridgeProofKey, *MerkleProofInput](ttl, proofCacheSize)
+		attestationCache = newTTLCache[[32]byte, attestation](ttl, proofCacheSize)
 	}
 
 	logger.Debugf("AvailDADebug: 🔑 Using KeyringPair address=%s", acc.SS58Address(AvailNetworkID))
 	logger.Info("AvailDAInfo:✌️ Avail backend client is created successfully")
 
-	return &AvailBackend{
+	backend := &AvailBackend{
 		logger:  logger,
-		sdk:     sdk,
+		client:  client,
 		acc:     acc,
 		address: acc.SS58Address(AvailNetworkID),
 		appId:   appId,
 		httpApi: config.HttpApiUrl,
 
+		maxSequenceSize: maxSequenceSize,
+
 		bridgeEnabled:       config.BridgeEnabled,
 		attestationContract: attestationContract,
 		bridgeApi:           config.BridgeApiUrl,
-		bridgeTimeout:       config.BridgeTimeout,
+		bridgeApiTimeout:    time.Duration(config.BridgeApiTimeout) * time.Second,
+		bridgeWaitInterval:  bridgeWaitInterval,
+		bridgeRetryCount:    bridgeRetryCount,
+		availRPCTimeout:     secondsOrDefault(config.AvailRPCTimeout, DefaultAvailRPCTimeout),
+
+		mortality:     uint32(intOrDefault(config.Mortality, DefaultMortality)),
+		submitRetries: max(intOrDefault(config.SubmitRetries, DefaultSubmitRetries), 0),
+		blockTime:     AvailBlockTime,
+		waitFor:       avail_sdk.Finalization,
+		submissions:   newSubmissionTracker(),
+		submitTimeout: time.Duration(config.SubmitTimeout) * time.Second,
 
 		fallbackS3Service: fallbackS3Service,
-	}, nil
+		readPriority:      readPriority,
+
+		bridgeProofCache: bridgeProofCache,
+		attestationCache: attestationCache,
+
+		blockHashCache: newTTLCache[uint32, primitives.H256](DefaultBlockCacheTTL, blockHashCacheSize),
+		blockCache:     newTTLCache[primitives.H256, []avail_sdk.DataSubmission](DefaultBlockCacheTTL, blockCacheSize),
+
+		turboDAEnabled: config.TurboDA.Enable,
+		turboDA:        turboDA,
+
+		presubmitted: newTTLCache[sequenceKey, submittedData](DefaultPresubmitTTL, presubmittedCacheSize),
+
+		httpClient: httpClient,
+	}
+
+	if config.FastInclusion {
+		if config.BridgeEnabled || config.TurboDA.Enable {
+			// Bridge proofs only exist for finalized blocks and TurboDA submits itself
+			logger.Warn("AvailDAWarn: ⚠️ fast inclusion only applies to blob pointers posted directly to Avail, waiting for finalization")
+		} else {
+			backend.waitFor = avail_sdk.Inclusion
+			backend.inclusions = newInclusionWatcher(backend, secondsOrDefault(config.FinalityCheckInterval, DefaultFinalityCheckInterval))
+		}
+	}
+
+	if config.ProofWorker.Enable {
+		if config.BridgeEnabled {
+			backend.proofWorker = newProofWorker(intOrDefault(config.ProofWorker.Concurrency, DefaultProofWorkerConcurrency), backend.getMerkleProofFromAvailBridge, logger)
+		} else {
+			logger.Warn("AvailDAWarn: ⚠️ the proof worker is enabled but the bridge is disabled, there are no proofs to request")
+		}
+	}
+
+	if config.DedupWindow >= 0 {
+		backend.postedSequences = newTTLCache[sequenceKey, *PostResult](secondsOrDefault(config.DedupWindow, DefaultDedupWindow), postedSequencesCacheSize)
+	}
+
+	if config.SubmissionQueue.Enable {
+		queue, err := newSubmissionQueue(config.SubmissionQueue, func(ctx context.Context, batchesData [][]byte, appID *int) (*PostResult, error) {
+			if appID == nil {
+				return backend.postSequence(ctx, batchesData, backend.appId)
+			}
+			return backend.postSequence(ctx, batchesData, *appID)
+		}, logger)
+		if err != nil {
+			return nil, fmt.Errorf("AvailDAError: unable to initialize the submission queue, %w. %w", err, ErrAvailDAClientInit)
+		}
+		backend.queue = queue
+	}
+	return backend, nil
 }
 
+func secondsOrDefault(seconds int, def time.Duration) time.Duration {
+	if seconds == 0 {
+		return def
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func intOrDefault(value int, def int) int {
+	if value == 0 {
+		return def
+	}
+	return value
+}
+
+// Init starts the submission queue worker if the queue is enabled.
 func (a *AvailBackend) Init() error {
+	if a.queue != nil {
+		a.queue.start()
+	}
 	return nil
 }
 
+// Close stops the submission queue worker, the proof worker and the finalization
+// checks, pending submissions are resumed by the next Init.
+func (a *AvailBackend) Close() {
+	if a.queue != nil {
+		a.queue.stop()
+	}
+	if a.proofWorker != nil {
+		a.proofWorker.stop()
+	}
+	if a.inclusions != nil {
+		a.inclusions.stop()
+	}
+	a.submissions.stop()
+}
+
+// PostResult describes a posted sequence, it links the data availability message to
+// the Avail extrinsic carrying the data.
+type PostResult struct {
+	DataAvailabilityMessage hexutil.Bytes `json:"dataAvailabilityMessage"`
+	// Keccak256 of the RLP encoded sequence
+	Commitment  common.Hash `json:"commitment"`
+	TxHash      common.Hash `json:"txHash"`
+	BlockHash   common.Hash `json:"blockHash"`
+	BlockNumber uint32      `json:"blockNumber"`
+	TxIndex     uint32      `json:"txIndex"`
+	AppID       int         `json:"appId"`
+	// Extrinsics sent until the data was found on chain, the retries reuse the nonce of
+	// the first one
+	Attempts    int  `json:"attempts,omitempty"`
+	NonceReused bool `json:"nonceReused,omitempty"`
+	// Set for sequences returned on block inclusion with FastInclusion, the block may
+	// still be dropped and the sequence submitted again, see Finalized
+	Included bool `json:"included,omitempty"`
+	// Set instead of the extrinsic details for sequences posted through TurboDA, which
+	// submits to Avail asynchronously
+	TurboSubmissionID string `json:"turboSubmissionId,omitempty"`
+
+	// final is shared by the copies of an included result, nil otherwise
+	final *finality
+}
+
+// Finalized waits for the finalization of a sequence returned on block inclusion and
+// returns the result of its finalized submission. When the block was dropped that is
+// the result of the new submission, whose data availability message replaces the
+// one returned on inclusion. Other results are returned as is.
+func (r *PostResult) Finalized(ctx context.Context) (*PostResult, error) {
+	if r.final == nil {
+		return r, nil
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-r.final.done:
+	}
+	if r.final.result == nil {
+		return nil, ErrFinalityUnconfirmed
+	}
+	return r.final.result, nil
+}
+
 func (a *AvailBackend) PostSequence(ctx context.Context, batchesData [][]byte) ([]byte, error) {
+	result, err := a.PostSequenceWithResult(ctx, batchesData)
+	if err != nil {
+		return nil, err
+	}
+	return result.DataAvailabilityMessage, nil
+}
+
+// PostSequenceWithResult posts the sequence like PostSequence and additionally returns
+// the Avail extrinsic hash, block and app id of the submission.
+func (a *AvailBackend) PostSequenceWithResult(ctx context.Context, batchesData [][]byte) (*PostResult, error) {
+	return a.PostSequenceWithAppID(ctx, batchesData, a.appId)
+}
+
+// PostSequenceWithAppID posts the sequence like PostSequenceWithResult under appID
+// instead of the configured AppID, so one backend serves several streams of sequences
+// on Avail. The app id must be registered on chain. An identical sequence posted under
+// another app id is submitted again. The app id of sequences posted through TurboDA
+// is the one of its api key, it can't be overridden.
+func (a *AvailBackend) PostSequenceWithAppID(ctx context.Context, batchesData [][]byte, appID int) (*PostResult, error) {
+	if appID < 0 || int64(appID) > math.MaxUint32 {
+		return nil, fmt.Errorf("invalid app id %d", appID)
+	}
+	if a.turboDAEnabled && appID != a.appId {
+		return nil, fmt.Errorf("the app id of sequences posted through TurboDA can't be overridden")
+	}
+	if a.queue == nil {
+		return a.postSequence(ctx, batchesData, appID)
+	}
+
+	if err := checkSequenceSize(batchesData, a.maxSequenceSize); err != nil {
+		return nil, err
+	}
+	// Sequences of the configured app id keep their SubmissionID
+	var override *int
+	if appID != a.appId {
+		override = &appID
+	}
+	id, err := a.queue.enqueue(batchesData, override)
+	if err != nil {
+		return nil, fmt.Errorf("cannot enqueue sequence: %w", err)
+	}
+	a.logger.Infof("AvailDAInfo: 📥 Sequence queued for submission id=%s", id.Hex())
+
+	submission, err := a.queue.wait(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("sequence %s is still queued: %w", id.Hex(), err)
+	}
+	if submission.Status == SubmissionFailed {
+		return nil, fmt.Errorf("%w: id=%s: %s", ErrSubmissionFailed, id.Hex(), submission.LastError)
+	}
+	return submission.Result, nil
+}
+
+// GetSubmission returns the state of a queued submission, see SubmissionID.
+func (a *AvailBackend) GetSubmission(id common.Hash) (*Submission, error) {
+	if a.queue == nil {
+		return nil, fmt.Errorf("submission queue is not enabled")
+	}
+	return a.queue.status(id)
+}
+
+// Presubmit submits the sequence to Avail ahead of its PostSequence, which then only
+// builds the data availability message of the extrinsic. With the proof worker the
+// bridge proof is requested right away, so PostSequence doesn't wait for the bridge
+// either when the proof is ready by then. Sequences posted through TurboDA aren't
+// presubmitted.
+func (a *AvailBackend) Presubmit(ctx context.Context, batchesData [][]byte) error {
+	if a.turboDAEnabled {
+		return fmt.Errorf("sequences posted through TurboDA can't be presubmitted")
+	}
+	sequenceBlobData, commitment, err := a.encodeSequence(batchesData)
+	if err != nil {
+		return err
+	}
+	key := sequenceKey{commitment: commitment, appID: a.appId}
+	if _, ok := a.postedSequences.Get(key); ok {
+		return nil
+	}
+	if _, ok := a.presubmitted.Get(key); ok {
+		return nil
+	}
+
+	a.logger.Infof("AvailDAInfo: 📤 Presubmitting data to Avail chain length=%d", len(sequenceBlobData))
+	txDetails, err := a.submitData(ctx, sequenceBlobData, a.appId, a.waitFor)
+	if err != nil {
+		return fmt.Errorf("cannot submit data: %w", err)
+	}
+	a.presubmitted.Add(key, txDetails)
+	if a.proofWorker != nil {
+		a.proofWorker.schedule(txDetails.BlockHash, txDetails.TxIndex)
+	}
+	return nil
+}
+
+// sequenceKey identifies a sequence posted under an app id
+type sequenceKey struct {
+	commitment common.Hash
+	appID      int
+}
+
+// encodeSequence returns the RLP encoded sequence and its commitment
+func (a *AvailBackend) encodeSequence(batchesData [][]byte) ([]byte, common.Hash, error) {
+	if err := checkSequenceSize(batchesData, a.maxSequenceSize); err != nil {
+		return nil, common.Hash{}, err
+	}
+
 	// RLP Encode
 	sequenceBlobData, err := rlp.EncodeToBytes(batchesData)
 	if err != nil {
-		return nil, fmt.Errorf("cannot RLP encode data:%w", err)
+		return nil, common.Hash{}, fmt.Errorf("cannot RLP encode data:%w", err)
 	}
+	if len(sequenceBlobData) > a.maxSequenceSize {
+		return nil, common.Hash{}, fmt.Errorf("%w: encoded_size=%d max_size=%d", ErrSequenceTooLarge, len(sequenceBlobData), a.maxSequenceSize)
+	}
+	return sequenceBlobData, crypto.Keccak256Hash(sequenceBlobData), nil
+}
 
-	a.logger.Infof("AvailDAInfo: ⚡️ Posting Sequence length=%d", len(sequenceBlobData))
+func (a *AvailBackend) postSequence(ctx context.Context, batchesData [][]byte, appID int) (*PostResult, error) {
+	sequenceBlobData, commitment, err := a.encodeSequence(batchesData)
+	if err != nil {
+		return nil, err
+	}
+	key := sequenceKey{commitment: commitment, appID: appID}
+
+	// Sequencer retries post the very same sequence again, return the message of the
+	// earlier submission instead of paying for the data twice
+	if a.postedSequences != nil {
+		if result, ok := a.postedSequences.Get(key); ok {
+			a.logger.Infof("AvailDAInfo: ♻️ Sequence was already posted, reusing data availability message commitment=%s", commitment.Hex())
+			return result, nil
+		}
+	}
 
-	// Submit the data to the Avail chain
-	a.logger.Info("AvailDAInfo: 📤 Submitting data to Avail chain")
-	txDetails, err := a.submitData(ctx, sequenceBlobData)
+	if a.submitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.submitTimeout)
+		defer cancel()
+	}
+	result, err := a.submitSequence(ctx, batchesData, sequenceBlobData, key)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, &SubmitTimeoutError{Commitment: commitment, InFlight: a.submissions.inFlight(key), Err: err}
+	}
 	if err != nil {
-		return nil, fmt.Errorf("cannot submit data: %w", err)
+		return nil, err
+	}
+	result.Commitment = commitment
+	result.AppID = appID
+	if result.Included {
+		result.final = &finality{done: make(chan struct{})}
+	}
+	if a.postedSequences != nil {
+		a.postedSequences.Add(key, result)
+	}
+	if result.Included {
+		// Recoverable from the fallback until the block is finalized or the sequence is
+		// submitted again
+		a.inclusions.watch(*result, sequenceBlobData)
+	}
+	return result, nil
+}
+
+func (a *AvailBackend) submitSequence(ctx context.Context, batchesData [][]byte, sequenceBlobData []byte, key sequenceKey) (*PostResult, error) {
+	a.logger.Infof("AvailDAInfo: ⚡️ Posting Sequence length=%d", len(sequenceBlobData))
+
+	if a.turboDAEnabled {
+		dataAvailabilityMessage, submissionID, err := a.postToTurboDA(ctx, sequenceBlobData)
+		if err != nil {
+			return nil, err
+		}
+		a.putOnFallback(ctx, batchesData)
+		a.logger.Debugf("AvailDADebug: ✅ Data availability message (hex): %s", common.Bytes2Hex(dataAvailabilityMessage))
+		a.logger.Infof("AvailDAInfo: ⚡️ Sequence posted successfully through TurboDA length=%d", len(sequenceBlobData))
+		return &PostResult{DataAvailabilityMessage: dataAvailabilityMessage, TurboSubmissionID: submissionID}, nil
+	}
+
+	// Submit the data to the Avail chain, unless it was presubmitted
+	txDetails, ok := a.presubmitted.Get(key)
+	if ok {
+		a.logger.Infof("AvailDAInfo: 📤 Data was presubmitted to Avail chain block_number=%d tx_index=%d", txDetails.BlockNumber, txDetails.TxIndex)
+	} else {
+		a.logger.Info("AvailDAInfo: 📤 Submitting data to Avail chain")
+		var err error
+		txDetails, err = a.submitData(ctx, sequenceBlobData, key.appID, a.waitFor)
+		if err != nil {
+			return nil, fmt.Errorf("cannot submit data: %w", err)
+		}
+		a.logger.Info("AvailDAInfo: 📤 Data submitted to Avail chain")
 	}
-	a.logger.Info("AvailDAInfo: 📤 Data submitted to Avail chain")
 
 	var dataAvailabilityMessage []byte
 	if a.bridgeEnabled {
 		a.logger.Info("AvailDAInfo: Bridge is enabled, getting merkle proof from the bridge")
 		// Get the merkle proof from the Avail Bridge
-		merkleProofInput, err := a.getMerkleProofFromAvailBridge(ctx, txDetails.BlockHash, txDetails.TxIndex)
+		merkleProofInput, err := a.bridgeProof(ctx, txDetails.BlockHash, txDetails.TxIndex)
 		if err != nil {
 			return nil, fmt.Errorf("cannot get merkle proof from bridge: %w", err)
 		}
@@ -174,36 +649,103 @@ func (a *AvailBackend) PostSequence(ctx context.Context, batchesData [][]byte) (
 		}
 	} else {
 		a.logger.Info("AvailDAInfo: Bridge is disabled, using blob pointer as data availability message")
-		dataCommitment := crypto.Keccak256Hash(sequenceBlobData)
-		blobPointer := NewBlobPointer(txDetails.BlockNumber, txDetails.TxIndex, dataCommitment)
-		payload, err := blobPointer.MarshalToBinary()
-		if err != nil {
-			return nil, fmt.Errorf("encode blob pointer failed: %w", err)
-		}
-		dataAvailabilityMessage, err = PackEnvelopeWithMsgType(DAM_TYPE_BLOB_POINTER, payload)
+		var err error
+		dataAvailabilityMessage, err = blobPointerMessage(txDetails, sequenceBlobData)
 		if err != nil {
-			return nil, fmt.Errorf("pack envelope failed: %w", err)
+			return nil, err
 		}
 	}
 
 	// fallback
-	if a.fallbackS3Service != nil {
-		a.logger.Info("AvailDAInfo: Fallback S3 storage service is enabled, putting data on s3 storage")
-		// Put the data on the s3 storage service
-		// Log error but don't fail the whole operation
-		// as data is already submitted to Avail chain
-		if err = a.fallbackS3Service.PutMultiple(ctx, batchesData); err != nil {
-			a.logger.Errorf("AvailDAError: failed to put data on s3 storage service: %v", err)
-		} else {
-			a.logger.Info("AvailDAInfo: ✅  Succesfully posted data to S3 using fallbackS3Service")
-		}
-	}
+	a.putOnFallback(ctx, batchesData)
 
 	a.logger.Debugf("AvailDADebug: ✅ Data availability message (hex): %s", common.Bytes2Hex(dataAvailabilityMessage))
 	a.logger.Infof("AvailDAInfo: ⚡️ Sequence posted successfully length=%d", len(sequenceBlobData))
+	// The presubmitted extrinsic is consumed, a sequence posted again is submitted again
+	a.presubmitted.Remove(key)
+	result := newPostResult(dataAvailabilityMessage, txDetails)
+	result.Included = txDetails.included
+	return result, nil
+}
+
+// blobPointerMessage returns the blob pointer data availability message of the
+// submitted sequence
+func blobPointerMessage(txDetails submittedData, sequenceBlobData []byte) ([]byte, error) {
+	dataCommitment := crypto.Keccak256Hash(sequenceBlobData)
+	blobPointer := NewBlobPointer(txDetails.BlockNumber, txDetails.TxIndex, dataCommitment)
+	payload, err := blobPointer.MarshalToBinary()
+	if err != nil {
+		return nil, fmt.Errorf("encode blob pointer failed: %w", err)
+	}
+	dataAvailabilityMessage, err := PackEnvelopeWithMsgType(DAM_TYPE_BLOB_POINTER, payload)
+	if err != nil {
+		return nil, fmt.Errorf("pack envelope failed: %w", err)
+	}
 	return dataAvailabilityMessage, nil
 }
 
+func newPostResult(dataAvailabilityMessage []byte, txDetails submittedData) *PostResult {
+	return &PostResult{
+		DataAvailabilityMessage: dataAvailabilityMessage,
+		TxHash:                  txDetails.TxHash.Value,
+		BlockHash:               txDetails.BlockHash.Value,
+		BlockNumber:             txDetails.BlockNumber,
+		TxIndex:                 txDetails.TxIndex,
+		Attempts:                txDetails.attempts,
+		NonceReused:             txDetails.attempts > 1,
+	}
+}
+
+// postToTurboDA submits the sequence through TurboDA and returns the turbo
+// submission data availability message along with the submission id.
+func (a *AvailBackend) postToTurboDA(ctx context.Context, sequenceBlobData []byte) ([]byte, string, error) {
+	a.logger.Info("AvailDAInfo: 📤 Submitting data to TurboDA")
+	submissionID, err := a.turboDA.SubmitRawData(ctx, sequenceBlobData)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot submit data to TurboDA: %w. %w", err, ErrBatchSubmitToAvailDAFailed)
+	}
+	a.logger.Infof("AvailDAInfo: 📤 Data submitted to TurboDA submission_id=%s", submissionID)
+
+	payload, err := NewTurboSubmission(submissionID, crypto.Keccak256Hash(sequenceBlobData)).MarshalToBinary()
+	if err != nil {
+		return nil, "", fmt.Errorf("encode turbo submission failed: %w", err)
+	}
+	dataAvailabilityMessage, err := PackEnvelopeWithMsgType(DAM_TYPE_TURBO_SUBMISSION, payload)
+	if err != nil {
+		return nil, "", fmt.Errorf("pack envelope failed: %w", err)
+	}
+	return dataAvailabilityMessage, submissionID, nil
+}
+
+// putOnFallback stores the batches on the fallback storage if it is enabled.
+func (a *AvailBackend) putOnFallback(ctx context.Context, batchesData [][]byte) {
+	if a.fallbackS3Service == nil {
+		return
+	}
+	a.logger.Info("AvailDAInfo: Fallback S3 storage service is enabled, putting data on s3 storage")
+	// Put the data on the s3 storage service
+	// Log error but don't fail the whole operation
+	// as data is already submitted to Avail chain
+	if err := a.fallbackS3Service.PutMultiple(ctx, batchesData); err != nil {
+		a.logger.Errorf("AvailDAError: failed to put data on s3 storage service: %v", err)
+	} else {
+		a.logger.Info("AvailDAInfo: ✅  Succesfully posted data to S3 using fallbackS3Service")
+	}
+}
+
+// checkSequenceSize rejects sequences whose raw batch payload alone is already above
+// the limit, before spending time on RLP encoding and extrinsic submission.
+func checkSequenceSize(batchesData [][]byte, maxSize int) error {
+	size := 0
+	for _, batch := range batchesData {
+		size += len(batch)
+	}
+	if size > maxSize {
+		return fmt.Errorf("%w: num_batches=%d size=%d max_size=%d", ErrSequenceTooLarge, len(batchesData), size, maxSize)
+	}
+	return nil
+}
+
 func (a *AvailBackend) GetSequence(ctx context.Context, batchHashes []common.Hash, dataAvailabilityMessage []byte) ([][]byte, error) {
 
 	a.logger.Infof("AvailDAInfo: 📤 Getting Sequence num_batches=%d", len(batchHashes))
@@ -224,7 +766,7 @@ func (a *AvailBackend) GetSequence(ctx context.Context, batchHashes []common.Has
 		if err := merkleProofInput.DecodeFromBinary(payload); err != nil {
 			return nil, fmt.Errorf("failed to decode MerkleProofInput: %w", err)
 		}
-		attestationData, err := a.attestationContract.Attestations(nil, merkleProofInput.Leaf)
+		attestationData, err := a.getAttestation(ctx, merkleProofInput.Leaf)
 		if err != nil {
 			return nil, fmt.Errorf("cannot get attestation data: %w", err)
 		}
@@ -242,21 +784,163 @@ func (a *AvailBackend) GetSequence(ctx context.Context, batchHashes []common.Has
 		index = blobPointer.ExtrinsicIndex
 		indexType = TxIndex
 
+	case DAM_TYPE_TURBO_SUBMISSION:
+		a.logger.Debug("AvailDADebug: Data availability message is of type TurboSubmission")
+		turboSubmission := &TurboSubmission{}
+		if err := turboSubmission.UnmarshalFromBinary(payload); err != nil {
+			return nil, fmt.Errorf("failed to decode TurboSubmission: %w", err)
+		}
+		batchesData, err := a.readTurboSubmission(ctx, batchHashes, turboSubmission)
+		if err != nil {
+			a.logger.Error("AvailDAError: unable to read data from TurboDA & Fallback s3 storage")
+			return nil, err
+		}
+		a.logger.Infof("AvailDAInfo: 📥 Sequence retrieved successfully num_batches=%d", len(batchesData))
+		return batchesData, nil
+
 	default:
-		return nil, fmt.Errorf("unknown data availabilty message type: %d", msgType)
+		return nil, fmt.Errorf("%w: %d", ErrUnknownMessageType, msgType)
 	}
 
-	if a.fallbackS3Service != nil {
-		a.logger.Info("AvailDAInfo: Fallback S3 storage service is enabled, trying to get data from s3 storage")
-		var err error
-		batchesData, err := a.fallbackS3Service.GetMultipleByHash(ctx, batchHashes)
+	batchesData, err := a.readSequence(ctx, batchHashes, blockNumber, index, indexType)
+	if err != nil {
+		a.logger.Error("AvailDAError: unable to read data from AvailDA & Fallback s3 storage")
+		return nil, err
+	}
+
+	a.logger.Infof("AvailDAInfo: 📥 Sequence retrieved successfully num_batches=%d", len(batchesData))
+	return batchesData, nil
+}
+
+// readSequence reads the sequence from AvailDA and the fallback S3 storage in the
+// order given by the configured read priority.
+func (a *AvailBackend) readSequence(ctx context.Context, batchHashes []common.Hash, blockNumber uint32, index uint32, indexType IndexType) ([][]byte, error) {
+	if a.fallbackS3Service == nil {
+		batchesData, err := a.getFromAvail(ctx, blockNumber, index, indexType)
 		if err != nil {
-			a.logger.Warnf("AvailDAWarn: ❌  failed to read data from fallback s3 storage, err: %v", err)
+			return nil, a.availReadError(blockNumber, err)
+		}
+		return batchesData, nil
+	}
+
+	switch a.readPriority {
+	case ReadPriorityAvailFirst:
+		batchesData, err := a.getFromAvail(ctx, blockNumber, index, indexType)
+		if err == nil {
+			return batchesData, nil
+		}
+		a.logger.Warnf("AvailDAWarn: ❌ failed to read data from AvailDA, trying fallback s3 storage, err: %v", err)
+		if batchesData, fallbackErr := a.getFromFallback(ctx, batchHashes); fallbackErr == nil {
+			return batchesData, nil
+		}
+		return nil, a.availReadError(blockNumber, err)
+
+	case ReadPriorityRace:
+		return a.raceRead(ctx, batchHashes, blockNumber, index, indexType)
+
+	default:
+		if batchesData, err := a.getFromFallback(ctx, batchHashes); err == nil {
+			return batchesData, nil
+		}
+		batchesData, err := a.getFromAvail(ctx, blockNumber, index, indexType)
+		if err == nil {
+			return batchesData, nil
+		}
+		return nil, a.availReadError(blockNumber, err)
+	}
+}
+
+// raceRead queries AvailDA and the fallback S3 storage concurrently and returns the
+// first successful result.
+func (a *AvailBackend) raceRead(ctx context.Context, batchHashes []common.Hash, blockNumber uint32, index uint32, indexType IndexType) ([][]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		data    [][]byte
+		err     error
+		isAvail bool
+	}
+	resultCh := make(chan result, 2)
+
+	go func() {
+		data, err := a.getFromFallback(ctx, batchHashes)
+		resultCh <- result{data: data, err: err}
+	}()
+	go func() {
+		data, err := a.getFromAvail(ctx, blockNumber, index, indexType)
+		resultCh <- result{data: data, err: err, isAvail: true}
+	}()
+
+	var availErr, fallbackErr error
+	for i := 0; i < 2; i++ {
+		res := <-resultCh
+		if res.err == nil {
+			return res.data, nil
+		}
+		if res.isAvail {
+			availErr = res.err
 		} else {
-			a.logger.Info("AvailDAInfo: ✅  Succesfully fetched data from Avail S3 using fallbackS3Service")
+			fallbackErr = res.err
+		}
+	}
+
+	a.logger.Warnf("AvailDAWarn: ❌ both fallback s3 storage and AvailDA reads failed, s3 err: %v", fallbackErr)
+	return nil, a.availReadError(blockNumber, availErr)
+}
+
+// readTurboSubmission reads a sequence submitted through TurboDA, preferring the
+// fallback S3 storage when it is enabled.
+func (a *AvailBackend) readTurboSubmission(ctx context.Context, batchHashes []common.Hash, submission *TurboSubmission) ([][]byte, error) {
+	if a.fallbackS3Service != nil {
+		if batchesData, err := a.getFromFallback(ctx, batchHashes); err == nil {
 			return batchesData, nil
 		}
 	}
+	if a.turboDA == nil {
+		return nil, fmt.Errorf("cannot read turbo submission %s: %w", submission.SubmissionID, ErrTurboDANotConfigured)
+	}
+
+	a.logger.Infof("AvailDAInfo: 📥 Retrieving data from TurboDA submission_id=%s", submission.SubmissionID)
+	blobData, err := a.turboDA.GetPreImage(ctx, submission.SubmissionID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get data from TurboDA: %w", err)
+	}
+	if commitment := crypto.Keccak256Hash(blobData); commitment != submission.Commitment {
+		return nil, fmt.Errorf("TurboDA data does not match the commitment, expected %s, got %s", submission.Commitment.Hex(), commitment.Hex())
+	}
+
+	var batchesData [][]byte
+	if err := rlp.DecodeBytes(blobData, &batchesData); err != nil {
+		return nil, fmt.Errorf("cannot RLP decode data:%w", err)
+	}
+	return batchesData, nil
+}
+
+// availReadError converts an AvailDA read failure into the error returned to callers,
+// reporting pruned blocks as expired data.
+func (a *AvailBackend) availReadError(blockNumber uint32, err error) error {
+	if isBlockPrunedError(err) {
+		a.logger.Warnf("AvailDAWarn: ⚠️ block %d is pruned on the connected Avail node", blockNumber)
+		return fmt.Errorf("%w: block_number=%d: %v", ErrDataExpiredFromDA, blockNumber, err)
+	}
+	return err
+}
+
+func (a *AvailBackend) getFromFallback(ctx context.Context, batchHashes []common.Hash) ([][]byte, error) {
+	a.logger.Info("AvailDAInfo: Fallback S3 storage service is enabled, trying to get data from s3 storage")
+	batchesData, err := a.fallbackS3Service.GetMultipleByHash(ctx, batchHashes)
+	if err != nil {
+		a.logger.Warnf("AvailDAWarn: ❌  failed to read data from fallback s3 storage, err: %v", err)
+		return nil, err
+	}
+	a.logger.Info("AvailDAInfo: ✅  Succesfully fetched data from Avail S3 using fallbackS3Service")
+	return batchesData, nil
+}
+
+func (a *AvailBackend) getFromAvail(ctx context.Context, blockNumber uint32, index uint32, indexType IndexType) ([][]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.availRPCTimeout)
+	defer cancel()
 
 	var blobData []byte
 	blobDataCh := make(chan struct {
@@ -277,7 +961,6 @@ func (a *AvailBackend) GetSequence(ctx context.Context, batchHashes []common.Has
 		return nil, ctx.Err()
 	case res := <-blobDataCh:
 		if res.err != nil {
-			a.logger.Error("AvailDAError: unable to read data from AvailDA & Fallback s3 storage")
 			return nil, fmt.Errorf("cannot get data from block:%w", res.err)
 		}
 		blobData = res.data
@@ -288,59 +971,97 @@ func (a *AvailBackend) GetSequence(ctx context.Context, batchHashes []common.Has
 	if err := rlp.DecodeBytes(blobData, &batchesData); err != nil {
 		return nil, fmt.Errorf("cannot RLP decode data:%w", err)
 	}
-
-	a.logger.Infof("AvailDAInfo: 📥 Sequence retrieved successfully num_batches=%d", len(batchesData))
 	return batchesData, nil
 }
 
-func (a *AvailBackend) submitData(ctx context.Context, sequence []byte) (avail_sdk.TransactionDetails, error) {
-	resultCh := make(chan struct {
-		details avail_sdk.TransactionDetails
-		err     error
-	}, 1)
-
-	// Run the blocking SDK call in a goroutine
-	go func() {
-		// Transaction will be signed, sent, and watched
-		// If the transaction was dropped or never executed, the system will retry it
-		// for 2 more times using the same nonce and app id.
-		//
-		// Waits for finalization to finalize the transaction.
-		tx := a.sdk.Tx.DataAvailability.SubmitData(sequence)
-		txDetails, err := tx.ExecuteAndWatchFinalization(
-			a.acc,
-			avail_sdk.NewTransactionOptions().WithAppId(uint32(a.appId)),
-		)
+// prunedBlockMarkers are fragments of node errors returned when a block or its state
+// has been discarded by a pruning node
+var prunedBlockMarkers = []string{
+	"state already discarded",
+	"pruned",
+}
 
-		if err == nil {
-			// Check success
-			// Returns None if there was no way to determine the
-			// success status of a transaction. Otherwise it returns
-			// true or false.
-			status := txDetails.IsSuccessful().UnsafeUnwrap()
-			if !status {
-				err = fmt.Errorf("⚠️ extrinsic failed on avail chain, status: %v", status)
-			}
+// isBlockPrunedError reports whether err indicates that the Avail node no longer has
+// the requested block. Only explicit pruning errors match: unknown blocks and the null
+// results the SDK reports with ErrorCode005 are also returned for blocks the node
+// hasn't synced yet, which must not be reported as expired.
+func isBlockPrunedError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, marker := range prunedBlockMarkers {
+		if strings.Contains(msg, marker) {
+			return true
 		}
+	}
+	return false
+}
 
-		resultCh <- struct {
-			details avail_sdk.TransactionDetails
-			err     error
-		}{txDetails, err}
-	}()
+// submittedData is a data submission and the number of extrinsics sent for it, the
+// retries reuse the nonce of the first one. Included submissions aren't finalized yet.
+type submittedData struct {
+	avail_sdk.TransactionDetails
+	attempts int
+	included bool
+}
+
+// submitWait is the time a submission is waited for, the era of every attempt on top
+// of AvailRPCTimeout so the retries with the same nonce finish within PostSequence
+func (a *AvailBackend) submitWait() time.Duration {
+	// The SDK rounds the era up to a power of two of at least 4 blocks
+	era := max(uint32(1)<<bits.Len32(a.mortality-1), 4)
+	return a.availRPCTimeout + time.Duration(era)*time.Duration(a.submitRetries+1)*a.blockTime
+}
+
+// submitData submits the sequence under appID and waits for its finalization or, with
+// avail_sdk.Inclusion, for its inclusion in a block
+func (a *AvailBackend) submitData(ctx context.Context, sequence []byte, appID int, waitFor uint8) (submittedData, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.submitWait())
+	defer cancel()
+
+	// Run the blocking SDK call in a goroutine, or join the one still submitting the
+	// same data for a caller that gave up on it. The extrinsic of an abandoned
+	// submission is reused by the next PostSequence of the sequence.
+	commitment := crypto.Keccak256Hash(sequence)
+	key := sequenceKey{commitment: commitment, appID: appID}
+	sub, joined := a.submissions.run(key, func(ctx context.Context) (submittedData, error) {
+		txDetails, attempts, err := a.client.SubmitData(
+			ctx,
+			a.acc,
+			sequence,
+			avail_sdk.NewTransactionOptions().WithAppId(uint32(appID)).WithMortality(a.mortality),
+			a.submitRetries,
+			waitFor,
+		)
+		return submittedData{txDetails, attempts, waitFor == avail_sdk.Inclusion}, err
+	}, func(details submittedData) {
+		a.logger.Infof("AvailDAInfo: 📤 Abandoned submission finished, keeping it for the next post block_number=%d tx_index=%d commitment=%s", details.BlockNumber, details.TxIndex, commitment.Hex())
+		a.presubmitted.Add(key, details)
+	})
+	if joined {
+		a.logger.Infof("AvailDAInfo: 📤 Joining the submission in flight of the same data commitment=%s", commitment.Hex())
+	}
 
 	// Now wait for either SDK result or context cancellation
 	select {
 	case <-ctx.Done():
-		return avail_sdk.TransactionDetails{}, ctx.Err()
-	case res := <-resultCh:
+		if a.submissions.abandon(sub) {
+			a.logger.Warnf("AvailDAWarn: ⏳ gave up waiting for the submission, it goes on in the background commitment=%s: %v", commitment.Hex(), ctx.Err())
+		}
+		return submittedData{}, ctx.Err()
+	case <-sub.done:
+		res := sub
 		if res.err != nil {
-			return avail_sdk.TransactionDetails{}, fmt.Errorf("⚠️ extrinsic got rejected: %w", res.err)
+			return submittedData{}, fmt.Errorf("⚠️ extrinsic got rejected: %w", res.err)
+		}
+		if res.details.attempts > 1 {
+			a.logger.Warnf("AvailDAWarn: 🔁 Extrinsic outlived its era of %d blocks and was sent again with the same nonce attempts=%d tx_hash=%s", a.mortality, res.details.attempts, res.details.TxHash)
 		}
 
 		a.logger.Debugf("AvailDADebug: ✅ Data is included in Avail chain address=%s appID=%d block_number=%d block_hash=%s tx_index=%d",
 			a.address,
-			a.appId,
+			appID,
 			res.details.BlockNumber,
 			res.details.BlockHash,
 			res.details.TxIndex,
@@ -349,12 +1070,80 @@ func (a *AvailBackend) submitData(ctx context.Context, sequence []byte) (avail_s
 	}
 }
 
+type bridgeProofKey struct {
+	blockHash primitives.H256
+	txIndex   uint32
+}
+
+type attestation struct {
+	BlockNumber uint32
+	LeafIndex   *big.Int
+}
+
+// getAttestation reads the attestation of the leaf from the attestation contract.
+// Only attested leaves are cached, a missing attestation may still show up later.
+func (a *AvailBackend) getAttestation(ctx context.Context, leaf [32]byte) (attestation, error) {
+	if a.attestationCache != nil {
+		if cached, ok := a.attestationCache.Get(leaf); ok {
+			a.logger.Debugf("AvailDADebug: attestation cache hit leaf=%s", common.Hash(leaf).Hex())
+			return cached, nil
+		}
+	}
+
+	res, err := a.attestationContract.Attestations(&bind.CallOpts{Context: ctx}, leaf)
+	if err != nil {
+		return attestation{}, err
+	}
+	attestationData := attestation{BlockNumber: res.BlockNumber, LeafIndex: res.LeafIndex}
+	if attestationData.LeafIndex == nil {
+		attestationData.LeafIndex = new(big.Int)
+	}
+	if a.attestationCache != nil && attestationData.BlockNumber != 0 {
+		a.attestationCache.Add(leaf, attestationData)
+	}
+	return attestationData, nil
+}
+
+// bridgeProof returns the bridge proof of the extrinsic, through the proof worker when
+// it is enabled so a proof requested ahead of time is joined instead of requested again
+func (a *AvailBackend) bridgeProof(ctx context.Context, blockHash primitives.H256, txIndex uint32) (*MerkleProofInput, error) {
+	if a.proofWorker != nil {
+		return a.proofWorker.wait(ctx, blockHash, txIndex)
+	}
+	return a.getMerkleProofFromAvailBridge(ctx, blockHash, txIndex)
+}
+
 func (a *AvailBackend) getMerkleProofFromAvailBridge(ctx context.Context, blockHash primitives.H256, txIndex uint32) (*MerkleProofInput, error) {
+	key := bridgeProofKey{blockHash: blockHash, txIndex: txIndex}
+	if a.bridgeProofCache != nil {
+		if cached, ok := a.bridgeProofCache.Get(key); ok {
+			a.logger.Debugf("AvailDADebug: bridge proof cache hit blockHash=%s txIndex=%d", blockHash, txIndex)
+			return cached, nil
+		}
+	}
+
+	merkleProofInput, err := a.queryAvailBridge(ctx, blockHash, txIndex)
+	if err != nil {
+		return nil, err
+	}
+	if a.bridgeProofCache != nil {
+		a.bridgeProofCache.Add(key, merkleProofInput)
+	}
+	return merkleProofInput, nil
+}
+
+func (a *AvailBackend) queryAvailBridge(ctx context.Context, blockHash primitives.H256, txIndex uint32) (*MerkleProofInput, error) {
 
 	a.logger.Infof("AvailDAInfo: ℹ️ Querying merkle proof of data submitted from Avail Bridge for attesting on settlement layer blockHash=%s txIndex=%d", blockHash, txIndex)
+	if a.bridgeApiTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.bridgeApiTimeout)
+		defer cancel()
+	}
+
 	var input *BridgeAPIResponse
-	waitTime := time.Duration(a.bridgeTimeout) * time.Second
-	retryCount := BridgeApiRetryCount
+	waitTime := a.bridgeWaitInterval
+	retryCount := a.bridgeRetryCount
 	for retryCount > 0 {
 		url := fmt.Sprintf("%s/eth/proof/%s?index=%d", a.bridgeApi, blockHash.String(), txIndex)
 		a.logger.Debugf("AvailDAInfo: ℹ️ Querying Bridge for merkle proof URL=%s", url)
@@ -363,7 +1152,7 @@ func (a *AvailBackend) getMerkleProofFromAvailBridge(ctx context.Context, blockH
 			return nil, fmt.Errorf("new request: %w", err)
 		}
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := a.httpClient.Do(req)
 		if err == nil && resp.StatusCode == http.StatusOK {
 			defer resp.Body.Close()
 			a.logger.Info("AvailDAInfo: ✅ Attestation proof received")
@@ -381,8 +1170,10 @@ func (a *AvailBackend) getMerkleProofFromAvailBridge(ctx context.Context, blockH
 
 		if resp != nil {
 			resp.Body.Close()
+			a.logger.Debugf("AvailDAWarn: ⏳ Attestation proof RPC errored, response code: %v, retry count left: %v, retrying in %v", resp.StatusCode, (retryCount - 1), waitTime)
+		} else {
+			a.logger.Debugf("AvailDAWarn: ⏳ Attestation proof RPC errored, err: %v, retry count left: %v, retrying in %v", err, (retryCount - 1), waitTime)
 		}
-		a.logger.Debugf("AvailDAWarn: ⏳ Attestation proof RPC errored, response code: %v, retry count left: %v, retrying in %v", resp.StatusCode, (retryCount - 1), waitTime)
 
 		timer := time.NewTimer(waitTime)
 		defer timer.Stop()
@@ -406,6 +1197,14 @@ func (a *AvailBackend) getMerkleProofFromAvailBridge(ctx context.Context, blockH
 	return merkleProofInput, nil
 }
 
+type ReadPriority string
+
+const (
+	ReadPriorityS3First    ReadPriority = "s3-first"
+	ReadPriorityAvailFirst ReadPriority = "avail-first"
+	ReadPriorityRace       ReadPriority = "race"
+)
+
 type IndexType string
 
 const (
@@ -413,33 +1212,59 @@ const (
 	TxIndex   IndexType = "tx"
 )
 
-func (a *AvailBackend) getData(blockNumber uint32, index uint32, indexType IndexType) ([]byte, error) {
-	blockHash, err := a.sdk.Client.BlockHash(blockNumber)
-	if err != nil {
-		return nil, fmt.Errorf("❎ Cannot get block hash: %w", err)
+// blockDataSubmissions returns the data submissions of a finalized block. Hashes and
+// decoded submissions of recently read blocks are cached, sequences spread over many
+// batches read the same block over and over.
+func (a *AvailBackend) blockDataSubmissions(blockNumber uint32) ([]avail_sdk.DataSubmission, error) {
+	blockHash, ok := a.blockHashCache.Get(blockNumber)
+	if !ok {
+		var err error
+		blockHash, err = a.client.BlockHash(blockNumber)
+		if err != nil {
+			return nil, fmt.Errorf("❎ Cannot get block hash: %w", err)
+		}
+		a.blockHashCache.Add(blockNumber, blockHash)
 	}
 
-	block, err := avail_sdk.NewBlock(a.sdk.Client, blockHash)
+	if blobs, ok := a.blockCache.Get(blockHash); ok {
+		a.logger.Debugf("AvailDADebug: block cache hit block_number=%d", blockNumber)
+		return blobs, nil
+	}
+	blobs, err := a.client.BlockDataSubmissions(blockHash)
 	if err != nil {
 		return nil, fmt.Errorf("❎ Cannot get block: %w", err)
 	}
+	a.blockCache.Add(blockHash, blobs)
+	return blobs, nil
+}
+
+func (a *AvailBackend) getData(blockNumber uint32, index uint32, indexType IndexType) ([]byte, error) {
+	blobs, err := a.blockDataSubmissions(blockNumber)
+	if err != nil {
+		return nil, err
+	}
 
 	var blob avail_sdk.DataSubmission
 
 	switch indexType {
 	case LeafIndex:
-		blobs := block.DataSubmissions(avail_sdk.Filter{})
 		if int(index) >= len(blobs) {
 			return nil, fmt.Errorf("❎ Unable to retrieve blob at index %d from block %d", index, blockNumber)
 		}
 		blob = blobs[index]
 
 	case TxIndex:
-		blobs := block.DataSubmissions(avail_sdk.Filter{}.WTxIndex(index))
-		if len(blobs) == 0 {
+		found := false
+		for _, b := range blobs {
+			if b.TxIndex == index {
+				blob = b
+				found = true
+				break
+			}
+		}
+		if !found {
 			return nil, fmt.Errorf("❎ No blobs found for transaction index %d in block %d", index, blockNumber)
 		}
-		blob = blobs[0]
 
 	default:
 		return nil, fmt.Errorf("❎ Invalid index type: %v", indexType)
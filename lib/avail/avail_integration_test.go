@@ -2,6 +2,7 @@ package avail
 
 import (
 	"context"
+	"net/http"
 	"testing"
 
 	"github.com/0xPolygon/cdk/log"
@@ -40,10 +41,24 @@ func createAvailBackend(t *testing.T) AvailBackend {
 	t.Log("AvailDAInfo: Avail backend client created successfully")
 
 	return AvailBackend{
-		log.GetDefaultLogger(),
-		sdk, acc, acc.SS58Address(AvailNetworkID),
-		appId, config.HttpApiUrl, false,
-		config.BridgeApiUrl, nil, config.BridgeTimeout, nil,
+		logger:             log.GetDefaultLogger(),
+		client:             NewSDKClient(sdk),
+		acc:                acc,
+		address:            acc.SS58Address(AvailNetworkID),
+		appId:              appId,
+		httpApi:            config.HttpApiUrl,
+		maxSequenceSize:    DefaultMaxSequenceSize,
+		bridgeEnabled:      false,
+		bridgeApi:          config.BridgeApiUrl,
+		bridgeWaitInterval: config.bridgeWaitInterval(),
+		bridgeRetryCount:   DefaultBridgeApiRetryCount,
+		availRPCTimeout:    DefaultAvailRPCTimeout,
+		mortality:          DefaultMortality,
+		submitRetries:      DefaultSubmitRetries,
+		blockTime:          AvailBlockTime,
+		waitFor:            avail_sdk.Finalization,
+		submissions:        newSubmissionTracker(),
+		httpClient:         &http.Client{},
 	}
 }
 
@@ -129,7 +144,7 @@ func TestSubmitAndGetData(t *testing.T) {
 	availBackend := createAvailBackend(t)
 
 	data := []byte("This is the power of Avail Data Availability layer!")
-	txDetails, err := availBackend.submitData(ctx, data)
+	txDetails, err := availBackend.submitData(ctx, data, availBackend.appId, avail_sdk.Finalization)
 	require.NoError(t, err)
 
 	t.Logf("Tx included: block=%d, hash=%s, index=%d", txDetails.BlockNumber, txDetails.BlockHash, txDetails.TxIndex)
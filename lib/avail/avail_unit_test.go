@@ -1,8 +1,24 @@
 package avail
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/availproject/avail-go-sdk/primitives"
+	avail_sdk "github.com/availproject/avail-go-sdk/sdk"
+	"github.com/availproject/cdk-avail-da-server/lib/avail/availtest"
+	s3_storage_service "github.com/availproject/cdk-avail-da-server/lib/avail/s3StorageService"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -80,3 +96,835 @@ func TestUnpackEnvelopeInvalid(t *testing.T) {
 	_, _, err := UnpackEnvelopeForMsgType([]byte{0x99, 0x01, 0x02})
 	assert.Error(t, err, "should error for invalid msg type")
 }
+
+// ✅ Test sequence size limit
+func TestCheckSequenceSize(t *testing.T) {
+	batches := [][]byte{make([]byte, 600), make([]byte, 500)}
+
+	require.NoError(t, checkSequenceSize(batches, 1100))
+
+	err := checkSequenceSize(batches, 1000)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrSequenceTooLarge)
+}
+
+// ✅ Test pruned block error detection
+func TestIsBlockPrunedError(t *testing.T) {
+	assert.False(t, isBlockPrunedError(nil))
+	assert.False(t, isBlockPrunedError(errors.New("connection refused")))
+
+	assert.True(t, isBlockPrunedError(errors.New("State already discarded for 0x1234")))
+
+	// ❌ Blocks the node hasn't synced yet aren't pruned
+	assert.False(t, isBlockPrunedError(fmt.Errorf("❎ Cannot get block: %w", avail_sdk.ErrorCode005)))
+	assert.False(t, isBlockPrunedError(errors.New("Unknown block 0x1234")))
+	assert.False(t, isBlockPrunedError(errors.New("Block not found")))
+}
+
+func newFakeBackend(t *testing.T, config Config, fallback *availtest.Storage) (*AvailBackend, *availtest.Chain) {
+	t.Helper()
+	config.Seed = "//Alice"
+	chain := availtest.NewChain()
+
+	var fallbackStorage FallbackStorage
+	if fallback != nil {
+		fallbackStorage = fallback
+	}
+	backend, err := NewWithClients(config, chain, availtest.NewAttestations(), fallbackStorage, nil)
+	require.NoError(t, err)
+	return backend, chain
+}
+
+func batchHashes(batches [][]byte) []common.Hash {
+	hashes := make([]common.Hash, len(batches))
+	for i, batch := range batches {
+		hashes[i] = crypto.Keccak256Hash(batch)
+	}
+	return hashes
+}
+
+// ✅ Test sequence round-trip through the blob pointer path
+func TestPostAndGetSequenceFakeChain(t *testing.T) {
+	ctx := context.Background()
+	backend, _ := newFakeBackend(t, Config{}, nil)
+
+	batches := [][]byte{[]byte("batch-1"), []byte("batch-2")}
+	dam, err := backend.PostSequence(ctx, batches)
+	require.NoError(t, err)
+
+	msgType, _, err := UnpackEnvelopeForMsgType(dam)
+	require.NoError(t, err)
+	assert.Equal(t, uint8(DAM_TYPE_BLOB_POINTER), msgType)
+
+	retrieved, err := backend.GetSequence(ctx, batchHashes(batches), dam)
+	require.NoError(t, err)
+	assert.Equal(t, batches, retrieved)
+}
+
+// ✅ Test fallback read ordering
+func TestGetSequenceReadPriority(t *testing.T) {
+	ctx := context.Background()
+	batches := [][]byte{[]byte("batch-1")}
+
+	storage := availtest.NewStorage()
+	backend, _ := newFakeBackend(t, Config{ReadPriority: string(ReadPriorityAvailFirst)}, storage)
+	dam, err := backend.PostSequence(ctx, batches)
+	require.NoError(t, err)
+
+	_, err = backend.GetSequence(ctx, batchHashes(batches), dam)
+	require.NoError(t, err)
+	assert.Equal(t, 0, storage.Reads(), "avail-first must not touch the fallback when Avail serves the data")
+
+	backend.readPriority = ReadPriorityS3First
+	_, err = backend.GetSequence(ctx, batchHashes(batches), dam)
+	require.NoError(t, err)
+	assert.Equal(t, 1, storage.Reads())
+}
+
+// ✅ Test pruned blocks are served from the fallback or reported as expired
+func TestGetSequencePrunedBlock(t *testing.T) {
+	ctx := context.Background()
+	batches := [][]byte{[]byte("batch-1")}
+
+	storage := availtest.NewStorage()
+	backend, chain := newFakeBackend(t, Config{ReadPriority: string(ReadPriorityAvailFirst)}, storage)
+	dam, err := backend.PostSequence(ctx, batches)
+	require.NoError(t, err)
+	chain.Prune(chain.Height())
+
+	retrieved, err := backend.GetSequence(ctx, batchHashes(batches), dam)
+	require.NoError(t, err)
+	assert.Equal(t, batches, retrieved)
+
+	storage.Delete(crypto.Keccak256Hash(batches[0]))
+	_, err = backend.GetSequence(ctx, batchHashes(batches), dam)
+	assert.ErrorIs(t, err, ErrDataExpiredFromDA)
+
+	// s3-first reads the fallback once before falling back to Avail
+	backend.readPriority = ReadPriorityS3First
+	reads := storage.Reads()
+	_, err = backend.GetSequence(ctx, batchHashes(batches), dam)
+	assert.ErrorIs(t, err, ErrDataExpiredFromDA)
+	assert.Equal(t, reads+1, storage.Reads())
+}
+
+// ✅ Test malformed pointers are rejected with descriptive errors
+func TestBlobPointerUnmarshalInvalid(t *testing.T) {
+	var decoded BlobPointer
+	err := decoded.UnmarshalFromBinary([]byte{0x01, 0x02})
+	assert.ErrorIs(t, err, ErrInvalidBlobPointer)
+
+	bytes, err := NewBlobPointer(1, 2, [32]byte{3}).MarshalToBinary()
+	require.NoError(t, err)
+	bytes[31] = 0xff // version
+	err = decoded.UnmarshalFromBinary(bytes)
+	assert.ErrorIs(t, err, ErrInvalidBlobPointer)
+
+	err = decoded.UnmarshalFromBinary(bytes[:96])
+	assert.ErrorIs(t, err, ErrInvalidBlobPointer)
+}
+
+// ✅ Fuzz the decode path of on-chain data availability messages
+func FuzzUnpackEnvelope(f *testing.F) {
+	pointer, err := NewBlobPointer(12345, 7, [32]byte{1, 2, 3}).MarshalToBinary()
+	require.NoError(f, err)
+	envelope, err := PackEnvelopeWithMsgType(DAM_TYPE_BLOB_POINTER, pointer)
+	require.NoError(f, err)
+	f.Add(envelope)
+	f.Add([]byte{})
+	f.Add(make([]byte, minEnvelopeSize))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msgType, payload, err := UnpackEnvelopeForMsgType(data)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidEnvelope) && !errors.Is(err, ErrUnsupportedEnvelopeVersion) && !errors.Is(err, ErrUnknownMessageType) {
+				t.Fatalf("unexpected error type: %v", err)
+			}
+			return
+		}
+
+		switch msgType {
+		case DAM_TYPE_BLOB_POINTER:
+			var blobPointer BlobPointer
+			if err := blobPointer.UnmarshalFromBinary(payload); err != nil {
+				assert.ErrorIs(t, err, ErrInvalidBlobPointer)
+			}
+		case DAM_TYPE_MERKLE_PROOF:
+			var merkleProofInput MerkleProofInput
+			if err := merkleProofInput.DecodeFromBinary(payload); err != nil {
+				assert.ErrorIs(t, err, ErrInvalidMerkleProofInput)
+			}
+		}
+	})
+}
+
+// ✅ Test versioned envelopes and version negotiation
+func TestVersionedEnvelope(t *testing.T) {
+	payload := []byte("payload")
+
+	envelope, err := PackEnvelope(ENVELOPE_VERSION1, DAM_TYPE_BLOB_POINTER, payload)
+	require.NoError(t, err)
+	decoded, err := UnpackEnvelope(envelope)
+	require.NoError(t, err)
+	assert.Equal(t, Envelope{Version: ENVELOPE_VERSION1, MsgType: DAM_TYPE_BLOB_POINTER, Payload: payload}, decoded)
+
+	// Legacy envelopes keep decoding as version 0
+	legacy, err := PackEnvelopeWithMsgType(DAM_TYPE_MERKLE_PROOF, payload)
+	require.NoError(t, err)
+	decoded, err = UnpackEnvelope(legacy)
+	require.NoError(t, err)
+	assert.Equal(t, uint8(ENVELOPE_VERSION0), decoded.Version)
+
+	// A future version must be rejected with a typed error
+	envelope[31] = 0x07
+	_, err = UnpackEnvelope(envelope)
+	assert.ErrorIs(t, err, ErrUnsupportedEnvelopeVersion)
+
+	_, err = PackEnvelopeWithMsgType(0x3e, payload)
+	assert.ErrorIs(t, err, ErrUnknownMessageType)
+}
+
+// ✅ Test sequence round-trip through TurboDA
+func TestPostAndGetSequenceTurboDA(t *testing.T) {
+	ctx := context.Background()
+	backend, chain := newFakeBackend(t, Config{}, nil)
+	backend.turboDAEnabled = true
+	backend.turboDA = availtest.NewTurboDA()
+
+	batches := [][]byte{[]byte("batch-1"), []byte("batch-2")}
+	dam, err := backend.PostSequence(ctx, batches)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0), chain.Height(), "turbo submissions must not be posted on Avail directly")
+
+	envelope, err := UnpackEnvelope(dam)
+	require.NoError(t, err)
+	assert.Equal(t, uint8(ENVELOPE_VERSION1), envelope.Version)
+	assert.Equal(t, uint8(DAM_TYPE_TURBO_SUBMISSION), envelope.MsgType)
+
+	retrieved, err := backend.GetSequence(ctx, batchHashes(batches), dam)
+	require.NoError(t, err)
+	assert.Equal(t, batches, retrieved)
+
+	// A commitment mismatch must be detected
+	var submission TurboSubmission
+	require.NoError(t, submission.UnmarshalFromBinary(envelope.Payload))
+	submission.Commitment = common.Hash{1}
+	payload, err := submission.MarshalToBinary()
+	require.NoError(t, err)
+	dam, err = PackEnvelopeWithMsgType(DAM_TYPE_TURBO_SUBMISSION, payload)
+	require.NoError(t, err)
+	_, err = backend.GetSequence(ctx, batchHashes(batches), dam)
+	assert.Error(t, err)
+}
+
+// ✅ Test inclusion proofs of blob pointers and attested merkle proofs
+func TestGetProof(t *testing.T) {
+	ctx := context.Background()
+	backend, _ := newFakeBackend(t, Config{}, nil)
+
+	dam, err := backend.PostSequence(ctx, [][]byte{[]byte("batch-1")})
+	require.NoError(t, err)
+	proof, err := backend.GetProof(ctx, dam)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), proof.BlockNumber)
+
+	// Attested merkle proof with a two leaf blob tree
+	leaf := crypto.Keccak256Hash([]byte("sequence"))
+	sibling := crypto.Keccak256Hash([]byte("other"))
+	input := &MerkleProofInput{
+		LeafProof:     [][32]byte{sibling},
+		BlobRoot:      keccakPair(crypto.Keccak256Hash(leaf[:]), sibling),
+		Leaf:          leaf,
+		LeafIndex:     big.NewInt(0),
+		RangeHash:     [32]byte{5},
+		DataRootIndex: big.NewInt(3),
+	}
+	payload, err := input.EnodeToBinary()
+	require.NoError(t, err)
+	dam, err = PackEnvelopeWithMsgType(DAM_TYPE_MERKLE_PROOF, payload)
+	require.NoError(t, err)
+
+	_, err = backend.GetProof(ctx, dam)
+	assert.ErrorIs(t, err, ErrLeafNotAttested)
+
+	attestations := availtest.NewAttestations()
+	attestations.Attest(leaf, 42, 0)
+	backend.attestationContract = attestations
+	backend.SetDataRootCommitmentReader(attestations)
+
+	// ❌ The range has no data root commitment
+	_, err = backend.GetProof(ctx, dam)
+	assert.ErrorIs(t, err, ErrInvalidInclusionProof)
+
+	// ❌ The data root proof doesn't resolve to the commitment of the range
+	attestations.Commit(input.RangeHash, common.Hash{9})
+	_, err = backend.GetProof(ctx, dam)
+	assert.ErrorIs(t, err, ErrInvalidInclusionProof)
+
+	dataRoot := keccakPair(input.BlobRoot, input.BridgeRoot)
+	attestations.Commit(input.RangeHash, merkleRoot(nil, 3, dataRoot, sha256Pair))
+	proof, err = backend.GetProof(ctx, dam)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(42), proof.BlockNumber)
+	assert.Equal(t, dataRoot, proof.DataRoot)
+
+	// Tampered proofs must not verify
+	input.LeafProof = [][32]byte{leaf}
+	payload, err = input.EnodeToBinary()
+	require.NoError(t, err)
+	dam, err = PackEnvelopeWithMsgType(DAM_TYPE_MERKLE_PROOF, payload)
+	require.NoError(t, err)
+	_, err = backend.GetProof(ctx, dam)
+	assert.ErrorIs(t, err, ErrInvalidInclusionProof)
+}
+
+// ✅ Test cache expiry, eviction and removal
+func TestTTLCache(t *testing.T) {
+	now := time.Unix(0, 0)
+	cache := newTTLCache[string, int](time.Minute, 2)
+	cache.now = func() time.Time { return now }
+
+	cache.Add("a", 1)
+	now = now.Add(time.Second)
+	cache.Add("b", 2)
+	cache.Add("c", 3)
+	_, ok := cache.Get("a")
+	assert.False(t, ok, "the entry expiring first must be evicted")
+	value, ok := cache.Get("c")
+	require.True(t, ok)
+	assert.Equal(t, 3, value)
+
+	cache.Remove("c")
+	_, ok = cache.Get("c")
+	assert.False(t, ok)
+
+	now = now.Add(2 * time.Minute)
+	_, ok = cache.Get("b")
+	assert.False(t, ok)
+}
+
+// ✅ Test only attested leaves are cached
+func TestGetAttestationCache(t *testing.T) {
+	ctx := context.Background()
+	backend, _ := newFakeBackend(t, Config{}, nil)
+	attestations := availtest.NewAttestations()
+	backend.attestationContract = attestations
+
+	leaf := [32]byte{1}
+	res, err := backend.getAttestation(ctx, leaf)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0), res.BlockNumber)
+
+	attestations.Attest(leaf, 7, 3)
+	res, err = backend.getAttestation(ctx, leaf)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(7), res.BlockNumber)
+
+	// Served from the cache from now on
+	attestations.Attest(leaf, 8, 3)
+	res, err = backend.getAttestation(ctx, leaf)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(7), res.BlockNumber)
+}
+
+// ✅ Test timeout defaults and overrides
+func TestTimeoutConfig(t *testing.T) {
+	backend, _ := newFakeBackend(t, Config{}, nil)
+	assert.Zero(t, backend.bridgeApiTimeout, "the default wait must be bounded by the retries only")
+	assert.Equal(t, DefaultBridgeApiWaitInterval, backend.bridgeWaitInterval)
+	assert.Equal(t, DefaultBridgeApiRetryCount, backend.bridgeRetryCount)
+	assert.Equal(t, DefaultAvailRPCTimeout, backend.availRPCTimeout)
+
+	backend, _ = newFakeBackend(t, Config{BridgeTimeout: 30, BridgeApiRetryCount: 3, AvailRPCTimeout: 5}, nil)
+	assert.Equal(t, 30*time.Second, backend.bridgeWaitInterval)
+	assert.Equal(t, 3, backend.bridgeRetryCount)
+	assert.Equal(t, 5*time.Second, backend.availRPCTimeout)
+
+	_, err := NewWithClients(Config{Seed: "//Alice", AvailRPCTimeout: -1}, availtest.NewChain(), availtest.NewAttestations(), nil, nil)
+	assert.ErrorIs(t, err, ErrAvailDAClientInit)
+
+	// ❌ A total wait shorter than the retry schedule
+	_, err = NewWithClients(Config{Seed: "//Alice", BridgeApiTimeout: 1200}, availtest.NewChain(), availtest.NewAttestations(), nil, nil)
+	assert.ErrorIs(t, err, ErrAvailDAClientInit)
+	_, err = NewWithClients(Config{Seed: "//Alice", BridgeApiTimeout: 90, BridgeApiWaitInterval: 30, BridgeApiRetryCount: 3}, availtest.NewChain(), availtest.NewAttestations(), nil, nil)
+	assert.NoError(t, err)
+}
+
+// ✅ Test the bridge proof is queried DefaultBridgeApiRetryCount times with the default config
+func TestBridgeProofDefaultRetries(t *testing.T) {
+	var requests atomic.Int32
+	bridge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < DefaultBridgeApiRetryCount {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"leaf":"0x0100000000000000000000000000000000000000000000000000000000000000","leafIndex":3,"dataRootIndex":1}`)
+	}))
+	defer bridge.Close()
+
+	backend, _ := newFakeBackend(t, Config{BridgeEnabled: true, BridgeApiUrl: bridge.URL}, nil)
+	// Only the wait between the queries is shortened
+	backend.bridgeWaitInterval = time.Millisecond
+	proof, err := backend.queryAvailBridge(context.Background(), primitives.H256{}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(3), proof.LeafIndex)
+	assert.Equal(t, int32(DefaultBridgeApiRetryCount), requests.Load())
+}
+
+// ✅ Test bridge api requests go through the configured proxy
+func TestProxyConfig(t *testing.T) {
+	backend, _ := newFakeBackend(t, Config{ProxyUrl: "http://proxy.example.com:3128"}, nil)
+	req, err := http.NewRequest(http.MethodGet, "https://bridge-api.avail.so", nil)
+	require.NoError(t, err)
+	proxy, err := backend.httpClient.Transport.(*http.Transport).Proxy(req)
+	require.NoError(t, err)
+	assert.Equal(t, "proxy.example.com:3128", proxy.Host)
+
+	_, err = NewWithClients(Config{Seed: "//Alice", ProxyUrl: "ftp://proxy.example.com"}, availtest.NewChain(), availtest.NewAttestations(), nil, nil)
+	assert.ErrorIs(t, err, ErrAvailDAClientInit)
+}
+
+// ✅ Test health checks report unfunded accounts
+func TestHealthCheck(t *testing.T) {
+	ctx := context.Background()
+	backend, chain := newFakeBackend(t, Config{}, availtest.NewStorage())
+	require.NoError(t, backend.HealthCheck(ctx))
+
+	chain.SetBalance(0)
+	err := backend.HealthCheck(ctx)
+	assert.ErrorIs(t, err, ErrUnhealthy)
+	assert.Contains(t, err.Error(), "account")
+}
+
+// ✅ Test queued submissions survive restarts
+func TestSubmissionQueue(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	queueConfig := SubmissionQueueConfig{Enable: true, Dir: t.TempDir(), MaxAttempts: 1}
+	batches := [][]byte{[]byte("batch-1")}
+
+	// Enqueued while no worker is running, as if the node crashed before submitting
+	backend, chain := newFakeBackend(t, Config{SubmissionQueue: queueConfig}, nil)
+	id, err := backend.queue.enqueue(batches, nil)
+	require.NoError(t, err)
+	submission, err := backend.GetSubmission(id)
+	require.NoError(t, err)
+	assert.Equal(t, SubmissionPending, submission.Status)
+
+	restarted, err := NewWithClients(Config{Seed: "//Alice", SubmissionQueue: queueConfig}, chain, availtest.NewAttestations(), nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, restarted.Init())
+	defer restarted.Close()
+
+	dam, err := restarted.PostSequence(ctx, batches)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), chain.Height(), "the sequence must be submitted once")
+	retrieved, err := restarted.GetSequence(ctx, batchHashes(batches), dam)
+	require.NoError(t, err)
+	assert.Equal(t, batches, retrieved)
+
+	chain.FailSubmissions(errors.New("rpc down"))
+	_, err = restarted.PostSequence(ctx, [][]byte{[]byte("batch-2")})
+	assert.ErrorIs(t, err, ErrSubmissionFailed)
+}
+
+// ✅ Test a corrupted submission file doesn't stall the queue
+func TestSubmissionQueueCorruptedFile(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	dir := t.TempDir()
+	corrupted := filepath.Join(dir, common.Hash{1}.Hex()+".json")
+	require.NoError(t, os.WriteFile(corrupted, []byte(`{"id":"0x01","status":`), 0o644))
+
+	backend, chain := newFakeBackend(t, Config{SubmissionQueue: SubmissionQueueConfig{Enable: true, Dir: dir}}, nil)
+	require.NoError(t, backend.Init())
+	defer backend.Close()
+
+	batches := [][]byte{[]byte("batch-1")}
+	dam, err := backend.PostSequence(ctx, batches)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), chain.Height())
+	retrieved, err := backend.GetSequence(ctx, batchHashes(batches), dam)
+	require.NoError(t, err)
+	assert.Equal(t, batches, retrieved)
+
+	// The corrupted file is kept aside for inspection
+	assert.NoFileExists(t, corrupted)
+	assert.FileExists(t, corrupted+".corrupt")
+}
+
+// ✅ Test retried sequences are not submitted twice
+func TestPostSequenceDeduplication(t *testing.T) {
+	ctx := context.Background()
+	batches := [][]byte{[]byte("batch-1")}
+
+	backend, chain := newFakeBackend(t, Config{}, nil)
+	first, err := backend.PostSequence(ctx, batches)
+	require.NoError(t, err)
+	second, err := backend.PostSequence(ctx, batches)
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, uint32(1), chain.Height())
+
+	backend, chain = newFakeBackend(t, Config{DedupWindow: -1}, nil)
+	_, err = backend.PostSequence(ctx, batches)
+	require.NoError(t, err)
+	_, err = backend.PostSequence(ctx, batches)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), chain.Height())
+}
+
+// ✅ Test post results link the message to the Avail extrinsic
+func TestPostSequenceWithResult(t *testing.T) {
+	ctx := context.Background()
+	backend, chain := newFakeBackend(t, Config{AppID: 7}, nil)
+
+	result, err := backend.PostSequenceWithResult(ctx, [][]byte{[]byte("batch-1")})
+	require.NoError(t, err)
+	blockHash, err := chain.BlockHash(1)
+	require.NoError(t, err)
+	assert.Equal(t, common.Hash(blockHash.Value), result.BlockHash)
+	assert.Equal(t, uint32(1), result.BlockNumber)
+	assert.Equal(t, uint32(1), result.TxIndex)
+	assert.Equal(t, 7, result.AppID)
+	assert.NotEqual(t, common.Hash{}, result.TxHash)
+	assert.NotEmpty(t, result.DataAvailabilityMessage)
+}
+
+// ✅ Test presubmitted sequences are posted with the proof requested ahead of time
+func TestPresubmitProofWorker(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	batches := [][]byte{[]byte("batch-1")}
+
+	var requests atomic.Int32
+	release := make(chan struct{})
+	bridge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		fmt.Fprint(w, `{"leaf":"0x0100000000000000000000000000000000000000000000000000000000000000","leafIndex":3,"dataRootIndex":1}`)
+	}))
+	defer bridge.Close()
+
+	backend, chain := newFakeBackend(t, Config{
+		BridgeEnabled: true,
+		BridgeApiUrl:  bridge.URL,
+		ProofWorker:   ProofWorkerConfig{Enable: true},
+	}, nil)
+	defer backend.Close()
+
+	require.NoError(t, backend.Presubmit(ctx, batches))
+	require.NoError(t, backend.Presubmit(ctx, batches))
+	assert.Equal(t, uint32(1), chain.Height())
+	assert.Eventually(t, func() bool { return requests.Load() == 1 }, 5*time.Second, 10*time.Millisecond, "the proof must be requested once submitted")
+
+	// PostSequence joins the request in flight
+	close(release)
+	dam, err := backend.PostSequence(ctx, batches)
+	require.NoError(t, err)
+	msgType, _, err := UnpackEnvelopeForMsgType(dam)
+	require.NoError(t, err)
+	assert.Equal(t, uint8(DAM_TYPE_MERKLE_PROOF), msgType)
+	assert.Equal(t, uint32(1), chain.Height(), "the presubmitted sequence must not be submitted again")
+	assert.Equal(t, int32(1), requests.Load())
+	_, commitment, err := backend.encodeSequence(batches)
+	require.NoError(t, err)
+	_, ok := backend.presubmitted.Get(sequenceKey{commitment: commitment, appID: backend.appId})
+	assert.False(t, ok, "the presubmitted sequence must be forgotten once posted")
+
+	// ❌ Negative concurrency is rejected
+	_, err = NewWithClients(Config{Seed: "//Alice", ProofWorker: ProofWorkerConfig{Enable: true, Concurrency: -1}}, availtest.NewChain(), availtest.NewAttestations(), nil, nil)
+	assert.ErrorIs(t, err, ErrAvailDAClientInit)
+}
+
+// ✅ Test submissions retried with the same nonce are surfaced in the post result
+func TestSubmitRetries(t *testing.T) {
+	ctx := context.Background()
+	backend, chain := newFakeBackend(t, Config{Mortality: 64}, nil)
+	assert.Equal(t, uint32(64), backend.mortality)
+	assert.Equal(t, DefaultSubmitRetries, backend.submitRetries)
+
+	result, err := backend.PostSequenceWithResult(ctx, [][]byte{[]byte("batch-1")})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Attempts)
+	assert.False(t, result.NonceReused)
+
+	chain.DropExtrinsics(2)
+	result, err = backend.PostSequenceWithResult(ctx, [][]byte{[]byte("batch-2")})
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Attempts)
+	assert.True(t, result.NonceReused)
+
+	// ❌ Without retries a dropped extrinsic fails the submission
+	backend, chain = newFakeBackend(t, Config{SubmitRetries: -1}, nil)
+	chain.DropExtrinsics(1)
+	_, err = backend.PostSequence(ctx, [][]byte{[]byte("batch-3")})
+	assert.ErrorIs(t, err, avail_sdk.ErrorCode003)
+
+	_, err = NewWithClients(Config{Seed: "//Alice", Mortality: -1}, availtest.NewChain(), availtest.NewAttestations(), nil, nil)
+	assert.ErrorIs(t, err, ErrAvailDAClientInit)
+}
+
+// ✅ Test the retries with the same nonce finish within PostSequence with the default timeouts
+func TestSubmitRetriesDefaultTimeouts(t *testing.T) {
+	backend, chain := newFakeBackend(t, Config{}, nil)
+	assert.GreaterOrEqual(t, backend.submitWait(), DefaultAvailRPCTimeout+DefaultMortality*(DefaultSubmitRetries+1)*AvailBlockTime)
+
+	// The chain and the timeouts scaled down alike, 20s blocks last 2ms
+	const scale = 10000
+	backend.blockTime = AvailBlockTime / scale
+	backend.availRPCTimeout = DefaultAvailRPCTimeout / scale
+	chain.SetBlockTime(AvailBlockTime / scale)
+	chain.DropExtrinsics(DefaultSubmitRetries)
+
+	result, err := backend.PostSequenceWithResult(context.Background(), [][]byte{[]byte("batch-1")})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultSubmitRetries+1, result.Attempts)
+	assert.True(t, result.NonceReused)
+}
+
+// ✅ Test included sequences are confirmed or submitted again once finalized
+func TestFastInclusion(t *testing.T) {
+	ctx := context.Background()
+	backend, chain := newFakeBackend(t, Config{FastInclusion: true, FinalityCheckInterval: 1}, nil)
+	defer backend.Close()
+	backend.inclusions.interval = 10 * time.Millisecond
+
+	chain.HoldFinality()
+	finalized := [][]byte{[]byte("batch-1")}
+	result, err := backend.PostSequenceWithResult(ctx, finalized)
+	require.NoError(t, err)
+	assert.True(t, result.Included)
+	dropped := [][]byte{[]byte("batch-2")}
+	included, err := backend.PostSequenceWithResult(ctx, dropped)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), included.BlockNumber)
+
+	chain.Reorg(2)
+	chain.Finalize()
+	assert.Eventually(t, func() bool {
+		result, err := backend.PostSequenceWithResult(ctx, dropped)
+		return err == nil && !result.Included
+	}, 5*time.Second, 10*time.Millisecond)
+
+	result, err = backend.PostSequenceWithResult(ctx, finalized)
+	require.NoError(t, err)
+	assert.False(t, result.Included)
+	assert.Equal(t, uint32(1), result.BlockNumber)
+
+	// The dropped sequence was submitted again in a new block
+	result, err = backend.PostSequenceWithResult(ctx, dropped)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), result.BlockNumber)
+	retrieved, err := backend.GetSequence(ctx, batchHashes(dropped), result.DataAvailabilityMessage)
+	require.NoError(t, err)
+	assert.Equal(t, dropped, retrieved)
+	resubmitted, err := included.Finalized(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, result.DataAvailabilityMessage, resubmitted.DataAvailabilityMessage)
+
+	// Without deduplication the new submission is only returned by Finalized
+	backend, chain = newFakeBackend(t, Config{FastInclusion: true, FinalityCheckInterval: 1, DedupWindow: -1}, nil)
+	defer backend.Close()
+	backend.inclusions.interval = 10 * time.Millisecond
+	chain.HoldFinality()
+	included, err = backend.PostSequenceWithResult(ctx, dropped)
+	require.NoError(t, err)
+	chain.Reorg(included.BlockNumber)
+	chain.Finalize()
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err = included.Finalized(waitCtx)
+	require.NoError(t, err)
+	assert.False(t, result.Included)
+	assert.Greater(t, result.BlockNumber, included.BlockNumber)
+	assert.NotEqual(t, included.DataAvailabilityMessage, result.DataAvailabilityMessage)
+
+	// Results not returned on inclusion are final
+	resubmitted, err = result.Finalized(ctx)
+	require.NoError(t, err)
+	assert.Same(t, result, resubmitted)
+
+	// ❌ The backend is closed before the finalization
+	chain.HoldFinality()
+	included, err = backend.PostSequenceWithResult(ctx, [][]byte{[]byte("batch-3")})
+	require.NoError(t, err)
+	backend.Close()
+	_, err = included.Finalized(ctx)
+	assert.ErrorIs(t, err, ErrFinalityUnconfirmed)
+
+	// Bridge proofs need finalized blocks
+	backend, _ = newFakeBackend(t, Config{FastInclusion: true, BridgeEnabled: true}, nil)
+	assert.Nil(t, backend.inclusions)
+}
+
+// ✅ Test timed out submissions are joined or reused instead of submitted twice
+func TestSubmitTimeout(t *testing.T) {
+	ctx := context.Background()
+	backend, chain := newFakeBackend(t, Config{SubmitTimeout: 1}, nil)
+	defer backend.Close()
+
+	// ❌ The deadline fails the post with a typed error
+	batches := [][]byte{[]byte("batch-1")}
+	chain.PauseSubmissions()
+	_, err := backend.PostSequence(ctx, batches)
+	var timeoutErr *SubmitTimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.True(t, timeoutErr.InFlight)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The retry joins the submission in flight
+	time.AfterFunc(100*time.Millisecond, chain.ResumeSubmissions)
+	dam, err := backend.PostSequence(ctx, batches)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), chain.Height())
+	retrieved, err := backend.GetSequence(ctx, batchHashes(batches), dam)
+	require.NoError(t, err)
+	assert.Equal(t, batches, retrieved)
+
+	// The retry after the abandoned submission finished reuses its extrinsic
+	batches = [][]byte{[]byte("batch-2")}
+	chain.PauseSubmissions()
+	_, err = backend.PostSequence(ctx, batches)
+	require.ErrorAs(t, err, &timeoutErr)
+	chain.ResumeSubmissions()
+	assert.Eventually(t, func() bool { return !backend.submissions.inFlight(sequenceKey{commitment: timeoutErr.Commitment}) }, 5*time.Second, 10*time.Millisecond)
+	_, err = backend.PostSequence(ctx, batches)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), chain.Height())
+}
+
+// ✅ Test sequences are posted under the app id of the call
+func TestPostSequenceWithAppID(t *testing.T) {
+	ctx := context.Background()
+	batches := [][]byte{[]byte("batch-1")}
+	backend, chain := newFakeBackend(t, Config{AppID: 7}, nil)
+
+	result, err := backend.PostSequenceWithResult(ctx, batches)
+	require.NoError(t, err)
+	assert.Equal(t, 7, result.AppID)
+
+	// The same sequence of another stream is submitted again, once
+	for range 2 {
+		result, err = backend.PostSequenceWithAppID(ctx, batches, 9)
+		require.NoError(t, err)
+		assert.Equal(t, 9, result.AppID)
+		assert.Equal(t, uint32(2), chain.Height())
+	}
+	blockHash, err := chain.BlockHash(2)
+	require.NoError(t, err)
+	submissions, err := chain.BlockDataSubmissions(blockHash)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(9), submissions[0].AppId)
+
+	// ❌ App ids are u32
+	_, err = backend.PostSequenceWithAppID(ctx, batches, -1)
+	assert.Error(t, err)
+
+	// Queued sequences keep their app id
+	queued, chain := newFakeBackend(t, Config{AppID: 7, SubmissionQueue: SubmissionQueueConfig{Enable: true, Dir: t.TempDir()}}, nil)
+	require.NoError(t, queued.Init())
+	defer queued.Close()
+	result, err = queued.PostSequenceWithAppID(ctx, batches, 9)
+	require.NoError(t, err)
+	assert.Equal(t, 9, result.AppID)
+	id, err := SubmissionIDWithAppID(batches, 9)
+	require.NoError(t, err)
+	submission, err := queued.GetSubmission(id)
+	require.NoError(t, err)
+	assert.Equal(t, SubmissionSubmitted, submission.Status)
+	assert.Equal(t, uint32(1), chain.Height())
+}
+
+// ✅ Test blocks are served from the cache once read
+func TestBlockCache(t *testing.T) {
+	ctx := context.Background()
+	batches := [][]byte{[]byte("batch-1")}
+	backend, chain := newFakeBackend(t, Config{}, nil)
+
+	dam, err := backend.PostSequence(ctx, batches)
+	require.NoError(t, err)
+	_, err = backend.GetSequence(ctx, batchHashes(batches), dam)
+	require.NoError(t, err)
+
+	// The pruned block is still served from memory
+	chain.Prune(chain.Height())
+	retrieved, err := backend.GetSequence(ctx, batchHashes(batches), dam)
+	require.NoError(t, err)
+	assert.Equal(t, batches, retrieved)
+}
+
+// ✅ Test erasure coded storage reconstructs blobs from any data shards
+func TestErasureStorage(t *testing.T) {
+	ctx := context.Background()
+	buckets := make([]*availtest.Storage, 5)
+	stores := make([]s3_storage_service.ShardStore, len(buckets))
+	for i := range buckets {
+		buckets[i] = availtest.NewStorage()
+		stores[i] = buckets[i]
+	}
+	storage, err := s3_storage_service.NewErasureStorageServiceWithStores(s3_storage_service.ErasureStorageServiceConfig{DataShards: 3}, stores, nil)
+	require.NoError(t, err)
+
+	batches := [][]byte{[]byte("batch-1"), make([]byte, 1000), {}}
+	require.NoError(t, storage.PutMultiple(ctx, batches))
+
+	// Any two buckets may be lost
+	buckets[0].Fail(errors.New("bucket lost"))
+	buckets[3].Fail(errors.New("bucket lost"))
+	retrieved, err := storage.GetMultipleByHash(ctx, batchHashes(batches))
+	require.NoError(t, err)
+	assert.Equal(t, batches, retrieved)
+
+	buckets[4].Fail(errors.New("bucket lost"))
+	_, err = storage.GetMultipleByHash(ctx, batchHashes(batches))
+	assert.ErrorIs(t, err, s3_storage_service.ErrNotEnoughShards)
+
+	// Writes need every bucket unless the quorum is lowered
+	assert.Error(t, storage.PutMultiple(ctx, batches))
+	_, err = s3_storage_service.NewErasureStorageServiceWithStores(s3_storage_service.ErasureStorageServiceConfig{DataShards: 5}, stores, nil)
+	assert.Error(t, err)
+}
+
+// tamperedHeaders is a chain whose block headers commit to another data root
+type tamperedHeaders struct {
+	*availtest.Chain
+}
+
+func (c tamperedHeaders) HeaderDataRoot(hash primitives.H256) (uint32, primitives.H256, error) {
+	number, _, err := c.Chain.HeaderDataRoot(hash)
+	return number, primitives.H256{Value: common.Hash{3}}, err
+}
+
+// ✅ Test data proofs of the kate RPC are verified against the block header
+func TestVerifyDataProof(t *testing.T) {
+	ctx := context.Background()
+	backend, chain := newFakeBackend(t, Config{}, nil)
+	batches := [][]byte{[]byte("batch-1")}
+	dam, err := backend.PostSequence(ctx, batches)
+	require.NoError(t, err)
+	_, payload, err := UnpackEnvelopeForMsgType(dam)
+	require.NoError(t, err)
+	blobPointer := &BlobPointer{}
+	require.NoError(t, blobPointer.UnmarshalFromBinary(payload))
+	blockHash, err := chain.BlockHash(blobPointer.BlockHeight)
+	require.NoError(t, err)
+
+	proof, err := backend.VerifyDataProof(blockHash.Value, blobPointer.ExtrinsicIndex, blobPointer.BlobDataKeccak265H)
+	require.NoError(t, err)
+	assert.Equal(t, blobPointer.BlockHeight, proof.BlockNumber)
+	assert.Equal(t, blobPointer.BlobDataKeccak265H, proof.Leaf)
+
+	// ❌ Proof of another sequence
+	_, err = backend.VerifyDataProof(blockHash.Value, blobPointer.ExtrinsicIndex, crypto.Keccak256Hash([]byte("other")))
+	assert.ErrorIs(t, err, ErrInvalidInclusionProof)
+
+	// ❌ Unknown extrinsic
+	_, err = backend.VerifyDataProof(blockHash.Value, blobPointer.ExtrinsicIndex+1, blobPointer.BlobDataKeccak265H)
+	assert.ErrorIs(t, err, availtest.ErrNotFound)
+
+	// ❌ Data root not committed to in the block header
+	backend.client = tamperedHeaders{chain}
+	_, err = backend.VerifyDataProof(blockHash.Value, blobPointer.ExtrinsicIndex, blobPointer.BlobDataKeccak265H)
+	assert.ErrorIs(t, err, ErrInvalidInclusionProof)
+}
@@ -0,0 +1,499 @@
+// Package availtest provides in-memory implementations of the clients used by
+// avail.AvailBackend so sequencing and recovery logic can be tested without a live
+// Avail chain, L1 node or S3 bucket.
+package availtest
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/availproject/avail-go-sdk/metadata"
+	"github.com/availproject/avail-go-sdk/primitives"
+	avail_sdk "github.com/availproject/avail-go-sdk/sdk"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/vedhavyas/go-subkey/v2"
+)
+
+var ErrNotFound = errors.New("availtest: not found")
+
+type block struct {
+	hash        primitives.H256
+	submissions []avail_sdk.DataSubmission
+	pruned      bool
+}
+
+// Chain is an in-memory Avail chain where every submission is finalized in its own
+// block. The first extrinsic of every block is reserved for the timestamp inherent,
+// so submissions get tx index 1 like on a real chain.
+type Chain struct {
+	mu        sync.Mutex
+	blocks    []*block
+	submitErr error
+	dropped   int
+	balance   metadata.Balance
+	// finalized is the finalized height while finality is held
+	held      bool
+	finalized uint32
+	// paused blocks the submissions until it is closed
+	paused chan struct{}
+	// blockTime is the time a block takes, a dropped extrinsic is retried once its era
+	// of blocks passed
+	blockTime time.Duration
+}
+
+func NewChain() *Chain {
+	// block 0 is the genesis block without submissions
+	return &Chain{
+		blocks:  []*block{{hash: blockHash(0)}},
+		balance: metadata.Balance{}.Add64(1_000_000_000_000_000_000),
+	}
+}
+
+func (c *Chain) SubmitData(ctx context.Context, account subkey.KeyPair, data []byte, options avail_sdk.TransactionOptions, retries int, waitFor uint8) (avail_sdk.TransactionDetails, int, error) {
+	if err := ctx.Err(); err != nil {
+		return avail_sdk.TransactionDetails{}, 0, err
+	}
+	c.mu.Lock()
+	paused := c.paused
+	c.mu.Unlock()
+	if paused != nil {
+		<-paused
+	}
+
+	c.mu.Lock()
+	expired := time.Duration(min(c.dropped, retries+1)) * time.Duration(options.Mortality.UnwrapOr(0)) * c.blockTime
+	c.mu.Unlock()
+	if expired > 0 {
+		select {
+		case <-ctx.Done():
+			return avail_sdk.TransactionDetails{}, 0, ctx.Err()
+		case <-time.After(expired):
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.submitErr != nil {
+		return avail_sdk.TransactionDetails{}, 1, c.submitErr
+	}
+	attempts := c.dropped + 1
+	if c.dropped > retries {
+		c.dropped -= retries + 1
+		return avail_sdk.TransactionDetails{}, retries + 1, avail_sdk.ErrorCode003
+	}
+	c.dropped = 0
+
+	number := uint32(len(c.blocks))
+	txHash := primitives.H256{Value: crypto.Keccak256Hash(data)}
+	submission := avail_sdk.DataSubmission{
+		TxHash:   txHash,
+		TxIndex:  1,
+		Data:     append([]byte(nil), data...),
+		TxSigner: primitives.NewAccountIdFromKeyPair(account).ToMultiAddress(),
+		AppId:    options.AppId.UnwrapOr(0),
+	}
+	b := &block{hash: blockHash(number), submissions: []avail_sdk.DataSubmission{submission}}
+	c.blocks = append(c.blocks, b)
+
+	return avail_sdk.TransactionDetails{
+		TxHash:      txHash,
+		TxIndex:     submission.TxIndex,
+		BlockHash:   b.hash,
+		BlockNumber: number,
+	}, attempts, nil
+}
+
+func (c *Chain) BlockHash(blockNumber uint32) (primitives.H256, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if int(blockNumber) >= len(c.blocks) {
+		return primitives.H256{}, avail_sdk.ErrorCode005
+	}
+	return c.blocks[blockNumber].hash, nil
+}
+
+func (c *Chain) BlockDataSubmissions(hash primitives.H256) ([]avail_sdk.DataSubmission, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, b := range c.blocks {
+		if b.hash != hash {
+			continue
+		}
+		if b.pruned {
+			return nil, fmt.Errorf("State already discarded for BlockId::Hash(%s)", hash.ToHuman())
+		}
+		return b.submissions, nil
+	}
+	return nil, avail_sdk.ErrorCode005
+}
+
+// DataProof returns the proof of the submission at txIndex. Every block holds a
+// single submission, so the blob root is the hash of its only leaf and the bridge
+// root is empty.
+func (c *Chain) DataProof(hash primitives.H256, txIndex uint32) (metadata.DataProof, error) {
+	submissions, err := c.BlockDataSubmissions(hash)
+	if err != nil {
+		return metadata.DataProof{}, err
+	}
+	for _, submission := range submissions {
+		if submission.TxIndex != txIndex {
+			continue
+		}
+		leaf := crypto.Keccak256Hash(submission.Data)
+		return metadata.DataProof{
+			Roots:          dataRoots(submissions),
+			NumberOfLeaves: 1,
+			LeafIndex:      0,
+			Leaf:           primitives.H256{Value: leaf},
+		}, nil
+	}
+	return metadata.DataProof{}, fmt.Errorf("%w: tx index %d", ErrNotFound, txIndex)
+}
+
+// HeaderDataRoot returns the number of the block and the data root of its header.
+func (c *Chain) HeaderDataRoot(hash primitives.H256) (uint32, primitives.H256, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for number, b := range c.blocks {
+		if b.hash == hash {
+			return uint32(number), dataRoots(b.submissions).DataRoot, nil
+		}
+	}
+	return 0, primitives.H256{}, avail_sdk.ErrorCode005
+}
+
+// dataRoots returns the roots of a block holding at most one submission
+func dataRoots(submissions []avail_sdk.DataSubmission) metadata.TxDataRoots {
+	var blobRoot, bridgeRoot common.Hash
+	for _, submission := range submissions {
+		leaf := crypto.Keccak256Hash(submission.Data)
+		blobRoot = crypto.Keccak256Hash(leaf[:])
+	}
+	return metadata.TxDataRoots{
+		DataRoot:   primitives.H256{Value: crypto.Keccak256Hash(blobRoot[:], bridgeRoot[:])},
+		BlobRoot:   primitives.H256{Value: blobRoot},
+		BridgeRoot: primitives.H256{Value: bridgeRoot},
+	}
+}
+
+func (c *Chain) Health() (avail_sdk.RpcSystemHealth, error) {
+	return avail_sdk.RpcSystemHealth{Peers: 1, ShouldHavePeers: true}, nil
+}
+
+// FreeBalance returns the same balance for every account, see SetBalance.
+func (c *Chain) FreeBalance(accountId primitives.AccountId) (metadata.Balance, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.balance, nil
+}
+
+// SetBalance sets the free balance of all accounts.
+func (c *Chain) SetBalance(balance uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.balance = metadata.Balance{}.Add64(balance)
+}
+
+// Prune drops the body of the block, mimicking a pruning Avail node that reports its
+// state as discarded.
+func (c *Chain) Prune(blockNumber uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if int(blockNumber) < len(c.blocks) {
+		c.blocks[blockNumber].pruned = true
+	}
+}
+
+// FailSubmissions makes every following SubmitData call return err, nil resets it.
+func (c *Chain) FailSubmissions(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.submitErr = err
+}
+
+// DropExtrinsics drops the next dropped extrinsics sent by SubmitData, as if they
+// outlived their era on a congested chain. Submissions are retried with the same
+// nonce and fail when they run out of retries.
+func (c *Chain) DropExtrinsics(dropped int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.dropped = dropped
+}
+
+// SetBlockTime makes every dropped extrinsic take its era of blocks of blockTime before
+// it is sent again, as on a real chain.
+func (c *Chain) SetBlockTime(blockTime time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.blockTime = blockTime
+}
+
+// FinalizedHeight returns the latest block, or the finalized one while finality is held.
+func (c *Chain) FinalizedHeight() (uint32, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.held {
+		return c.finalized, nil
+	}
+	return uint32(len(c.blocks) - 1), nil
+}
+
+// HoldFinality stops finalizing the blocks submitted from now on until Finalize.
+func (c *Chain) HoldFinality() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.held = true
+	c.finalized = uint32(len(c.blocks) - 1)
+}
+
+// Finalize finalizes every block and the following ones.
+func (c *Chain) Finalize() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.held = false
+}
+
+// Reorg replaces the block with an empty block of another hash, as if it was dropped
+// by a reorg before its finalization.
+func (c *Chain) Reorg(blockNumber uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if int(blockNumber) < len(c.blocks) {
+		b := c.blocks[blockNumber]
+		c.blocks[blockNumber] = &block{hash: primitives.H256{Value: crypto.Keccak256Hash(b.hash.Value[:])}}
+	}
+}
+
+// PauseSubmissions blocks SubmitData until ResumeSubmissions, as if the extrinsics
+// took long to be finalized.
+func (c *Chain) PauseSubmissions() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.paused = make(chan struct{})
+}
+
+// ResumeSubmissions finishes the paused submissions.
+func (c *Chain) ResumeSubmissions() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.paused != nil {
+		close(c.paused)
+		c.paused = nil
+	}
+}
+
+// Height returns the number of the latest block.
+func (c *Chain) Height() uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return uint32(len(c.blocks) - 1)
+}
+
+func blockHash(number uint32) primitives.H256 {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, number)
+	return primitives.H256{Value: crypto.Keccak256Hash([]byte("availtest-block"), buf)}
+}
+
+type attestation struct {
+	BlockNumber uint32
+	LeafIndex   *big.Int
+}
+
+// Attestations is an in-memory attestation contract and the VectorX contract holding
+// the data root commitments it verifies against.
+type Attestations struct {
+	mu          sync.Mutex
+	leaves      map[[32]byte]attestation
+	commitments map[[32]byte][32]byte
+}
+
+func NewAttestations() *Attestations {
+	return &Attestations{leaves: make(map[[32]byte]attestation), commitments: make(map[[32]byte][32]byte)}
+}
+
+// Commit records the data root commitment of the block range.
+func (a *Attestations) Commit(rangeHash [32]byte, commitment [32]byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.commitments[rangeHash] = commitment
+}
+
+// DataRootCommitments returns the commitment of the range, zero for unknown ranges.
+func (a *Attestations) DataRootCommitments(opts *bind.CallOpts, rangeHash [32]byte) ([32]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.commitments[rangeHash], nil
+}
+
+// Attest records the leaf as attested at the given Avail block and leaf index.
+func (a *Attestations) Attest(leaf [32]byte, blockNumber uint32, leafIndex uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.leaves[leaf] = attestation{BlockNumber: blockNumber, LeafIndex: new(big.Int).SetUint64(leafIndex)}
+}
+
+func (a *Attestations) Attestations(opts *bind.CallOpts, arg0 [32]byte) (struct {
+	BlockNumber uint32
+	LeafIndex   *big.Int
+}, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Unknown leaves read as zero values like on the contract
+	res := a.leaves[arg0]
+	if res.LeafIndex == nil {
+		res.LeafIndex = new(big.Int)
+	}
+	return struct {
+		BlockNumber uint32
+		LeafIndex   *big.Int
+	}{res.BlockNumber, res.LeafIndex}, nil
+}
+
+// Storage is an in-memory fallback storage keyed by keccak256 of the stored value.
+type Storage struct {
+	mu      sync.Mutex
+	objects map[common.Hash][]byte
+	reads   int
+	err     error
+}
+
+func NewStorage() *Storage {
+	return &Storage{objects: make(map[common.Hash][]byte)}
+}
+
+func (s *Storage) GetMultipleByHash(ctx context.Context, keys []common.Hash) ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reads++
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	data := make([][]byte, len(keys))
+	for i, key := range keys {
+		value, ok := s.objects[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key.Hex())
+		}
+		data[i] = value
+	}
+	return data, nil
+}
+
+func (s *Storage) PutMultiple(ctx context.Context, values [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	for _, value := range values {
+		s.objects[crypto.Keccak256Hash(value)] = append([]byte(nil), value...)
+	}
+	return nil
+}
+
+// Put stores value under commitment, which needn't be its hash, like the shards of
+// erasure coded storage.
+func (s *Storage) Put(ctx context.Context, value []byte, timeout uint64, commitment common.Hash) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	s.objects[commitment] = append([]byte(nil), value...)
+	return nil
+}
+
+func (s *Storage) GetByHash(ctx context.Context, key common.Hash) ([]byte, error) {
+	data, err := s.GetMultipleByHash(ctx, []common.Hash{key})
+	if err != nil {
+		return nil, err
+	}
+	return data[0], nil
+}
+
+// Delete removes the value stored under key.
+func (s *Storage) Delete(key common.Hash) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.objects, key)
+}
+
+// Fail makes every following call return err, nil resets it.
+func (s *Storage) Fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+}
+
+// Reads returns the number of GetMultipleByHash calls.
+func (s *Storage) Reads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.reads
+}
+
+// TurboDA is an in-memory TurboDA service.
+type TurboDA struct {
+	mu          sync.Mutex
+	submissions map[string][]byte
+}
+
+func NewTurboDA() *TurboDA {
+	return &TurboDA{submissions: make(map[string][]byte)}
+}
+
+func (t *TurboDA) SubmitRawData(ctx context.Context, data []byte) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id := fmt.Sprintf("availtest-submission-%d", len(t.submissions))
+	t.submissions[id] = append([]byte(nil), data...)
+	return id, nil
+}
+
+func (t *TurboDA) GetPreImage(ctx context.Context, submissionID string) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	data, ok := t.submissions[submissionID]
+	if !ok {
+		return nil, fmt.Errorf("%w: submission %s", ErrNotFound, submissionID)
+	}
+	return data, nil
+}
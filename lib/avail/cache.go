@@ -0,0 +1,101 @@
+package avail
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	DefaultProofCacheTTL = time.Duration(600) * time.Second
+	// Bound on the number of entries so a long running node doesn't grow unbounded
+	proofCacheSize = 4096
+
+	DefaultBlockCacheTTL = time.Duration(600) * time.Second
+	blockHashCacheSize   = 1024
+	// Blocks carry up to a few MB of submissions, keep only the most recent ones
+	blockCacheSize = 16
+)
+
+type cacheEntry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// ttlCache is a small concurrency safe cache whose entries expire after ttl. A nil
+// cache is valid and caches nothing.
+type ttlCache[K comparable, V any] struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	entries map[K]cacheEntry[V]
+	now     func() time.Time
+}
+
+func newTTLCache[K comparable, V any](ttl time.Duration, size int) *ttlCache[K, V] {
+	return &ttlCache[K, V]{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[K]cacheEntry[V]),
+		now:     time.Now,
+	}
+}
+
+func (c *ttlCache[K, V]) Get(key K) (V, bool) {
+	if c == nil {
+		var zero V
+		return zero, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	if c.now().After(entry.expires) {
+		delete(c.entries, key)
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// Remove drops the entry of key
+func (c *ttlCache[K, V]) Remove(key K) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+func (c *ttlCache[K, V]) Add(key K, value V) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if len(c.entries) >= c.size {
+		// Drop the expired entries first and anything that expires soonest if that
+		// didn't free up room
+		var oldestKey K
+		var oldest time.Time
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+				continue
+			}
+			if oldest.IsZero() || entry.expires.Before(oldest) {
+				oldestKey, oldest = k, entry.expires
+			}
+		}
+		if len(c.entries) >= c.size {
+			delete(c.entries, oldestKey)
+		}
+	}
+	c.entries[key] = cacheEntry[V]{value: value, expires: now.Add(c.ttl)}
+}
@@ -0,0 +1,208 @@
+package avail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/availproject/avail-go-sdk/metadata"
+	"github.com/availproject/avail-go-sdk/primitives"
+	avail_sdk "github.com/availproject/avail-go-sdk/sdk"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/vedhavyas/go-subkey/v2"
+)
+
+// AvailClient is the subset of the Avail SDK used by AvailBackend. It allows the
+// chain to be replaced by an in-memory implementation (see availtest) in tests.
+type AvailClient interface {
+	// SubmitData submits the data, waits for finalization or inclusion as waitFor says
+	// and returns the details of a successfully executed extrinsic and the number of
+	// extrinsics sent. An extrinsic that wasn't found on chain before its era ended is
+	// signed again with a new era and sent with the same nonce, up to retries times. No
+	// extrinsic is sent once ctx is done, the one sent is still watched.
+	SubmitData(ctx context.Context, account subkey.KeyPair, data []byte, options avail_sdk.TransactionOptions, retries int, waitFor uint8) (avail_sdk.TransactionDetails, int, error)
+	// FinalizedHeight returns the number of the latest finalized block.
+	FinalizedHeight() (uint32, error)
+	BlockHash(blockNumber uint32) (primitives.H256, error)
+	// BlockDataSubmissions returns all data submissions of the block in extrinsic order.
+	BlockDataSubmissions(blockHash primitives.H256) ([]avail_sdk.DataSubmission, error)
+	// DataProof returns the proof of the data submitted by the extrinsic at txIndex.
+	DataProof(blockHash primitives.H256, txIndex uint32) (metadata.DataProof, error)
+	// HeaderDataRoot returns the number of the block and the data root committed to
+	// in its header.
+	HeaderDataRoot(blockHash primitives.H256) (uint32, primitives.H256, error)
+	Health() (avail_sdk.RpcSystemHealth, error)
+	// FreeBalance returns the free balance of the account, accounts that don't exist
+	// on chain have a zero balance.
+	FreeBalance(accountId primitives.AccountId) (metadata.Balance, error)
+}
+
+// AttestationReader reads attested leaves from the attestation contract on L1.
+type AttestationReader interface {
+	Attestations(opts *bind.CallOpts, arg0 [32]byte) (struct {
+		BlockNumber uint32
+		LeafIndex   *big.Int
+	}, error)
+}
+
+// DataRootCommitmentReader reads the data root commitments of Avail block ranges from
+// the VectorX contract on L1.
+type DataRootCommitmentReader interface {
+	DataRootCommitments(opts *bind.CallOpts, rangeHash [32]byte) ([32]byte, error)
+}
+
+// CodeReader reads contract code from L1.
+type CodeReader interface {
+	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+}
+
+// FallbackStorage stores and retrieves batches by their keccak256 hash.
+type FallbackStorage interface {
+	GetMultipleByHash(ctx context.Context, keys []common.Hash) ([][]byte, error)
+	PutMultiple(ctx context.Context, values [][]byte) error
+}
+
+type sdkClient struct {
+	sdk avail_sdk.SDK
+}
+
+// NewSDKClient wraps an avail-go-sdk SDK into an AvailClient.
+func NewSDKClient(sdk avail_sdk.SDK) AvailClient {
+	return &sdkClient{sdk: sdk}
+}
+
+func (c *sdkClient) SubmitData(ctx context.Context, account subkey.KeyPair, data []byte, options avail_sdk.TransactionOptions, retries int, waitFor uint8) (avail_sdk.TransactionDetails, int, error) {
+	// Transaction will be signed, sent, and watched until finalization or inclusion,
+	// like ExecuteAndWatchFinalization and ExecuteAndWatchInclusion do. If the transaction was dropped or never
+	// executed before its era ended, it is retried retries more times using the same
+	// nonce and app id.
+	tx := c.sdk.Tx.DataAvailability.SubmitData(data)
+	extra, additional, forkBlockNumber, err := options.ToPrimitive(c.sdk.Client, account.SS58Address(AvailNetworkID))
+	if err != nil {
+		return avail_sdk.TransactionDetails{}, 0, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return avail_sdk.TransactionDetails{}, attempt - 1, err
+		}
+		signed, err := primitives.CreateSigned(tx.Payload.Call, extra, additional, account)
+		if err != nil {
+			return avail_sdk.TransactionDetails{}, attempt - 1, err
+		}
+		txHash, err := c.sdk.Client.Send(signed)
+		if err != nil {
+			return avail_sdk.TransactionDetails{}, attempt - 1, err
+		}
+
+		logger := avail_sdk.NewCustomLogger(txHash, true)
+		logger.LogTxSubmitted(&account, extra.Era.Period)
+		watcher := avail_sdk.NewWatcher(c.sdk.Client, txHash).WaitFor(waitFor).Logger(logger).BlockHeightTimeout(forkBlockNumber + uint32(extra.Era.Period))
+		maybeDetails, err := watcher.Run()
+		if err != nil {
+			return avail_sdk.TransactionDetails{}, attempt, err
+		}
+		if maybeDetails.IsSome() {
+			txDetails := maybeDetails.Unwrap()
+			// Check success
+			// Returns None if there was no way to determine the
+			// success status of a transaction. Otherwise it returns
+			// true or false.
+			status := txDetails.IsSuccessful().UnsafeUnwrap()
+			if !status {
+				return avail_sdk.TransactionDetails{}, attempt, fmt.Errorf("⚠️ extrinsic failed on avail chain, status: %v", status)
+			}
+			return txDetails, attempt, nil
+		}
+
+		if attempt > retries {
+			logger.LogTxRetryAbort()
+			customErr := avail_sdk.ErrorCode003
+			customErr.Message = fmt.Sprintf("Attempts: %v", attempt)
+			return avail_sdk.TransactionDetails{}, attempt, &customErr
+		}
+		// The era starts again at the best block, unlike RegenerateEra the watch
+		// timeout follows it
+		forkHash, err := c.sdk.Client.Rpc.Chain.GetBlockHash(primitives.None[uint32]())
+		if err != nil {
+			return avail_sdk.TransactionDetails{}, attempt, err
+		}
+		header, err := c.sdk.Client.Rpc.Chain.GetHeader(primitives.Some(forkHash))
+		if err != nil {
+			return avail_sdk.TransactionDetails{}, attempt, err
+		}
+		additional.ForkHash = forkHash
+		extra.Era = primitives.NewEra(extra.Era.Period, uint64(header.Number))
+		forkBlockNumber = header.Number
+		logger.LogTxRetry()
+	}
+}
+
+func (c *sdkClient) FinalizedHeight() (uint32, error) {
+	return c.sdk.Client.FinalizedBlockNumber()
+}
+
+func (c *sdkClient) BlockHash(blockNumber uint32) (primitives.H256, error) {
+	return c.sdk.Client.BlockHash(blockNumber)
+}
+
+func (c *sdkClient) BlockDataSubmissions(blockHash primitives.H256) ([]avail_sdk.DataSubmission, error) {
+	block, err := avail_sdk.NewBlock(c.sdk.Client, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	return block.DataSubmissions(avail_sdk.Filter{}), nil
+}
+
+func (c *sdkClient) DataProof(blockHash primitives.H256, txIndex uint32) (metadata.DataProof, error) {
+	res, err := c.sdk.Client.Rpc.Kate.QueryDataProof(txIndex, primitives.Some(blockHash))
+	if err != nil {
+		return metadata.DataProof{}, err
+	}
+	return res.DataProof, nil
+}
+
+// rpcHeader is the part of the chain_getHeader result the SDK header doesn't decode,
+// the data root is committed to in the versioned header extension
+type rpcHeader struct {
+	Number    hexutil.Uint64 `json:"number"`
+	Extension map[string]struct {
+		Commitment struct {
+			DataRoot common.Hash `json:"dataRoot"`
+		} `json:"commitment"`
+	} `json:"extension"`
+}
+
+func (c *sdkClient) HeaderDataRoot(blockHash primitives.H256) (uint32, primitives.H256, error) {
+	params := avail_sdk.RPCParams{}
+	params.AddH256(blockHash)
+	value, err := c.sdk.Client.RequestWithRetry("chain_getHeader", params.Build())
+	if err != nil {
+		return 0, primitives.H256{}, err
+	}
+	var header rpcHeader
+	if err := json.Unmarshal([]byte(value), &header); err != nil {
+		return 0, primitives.H256{}, fmt.Errorf("cannot unmarshal header:%w", err)
+	}
+	// The extension is keyed by its version, only one version is set
+	var dataRoot common.Hash
+	for _, extension := range header.Extension {
+		dataRoot = extension.Commitment.DataRoot
+	}
+	return uint32(header.Number), primitives.H256{Value: dataRoot}, nil
+}
+
+func (c *sdkClient) Health() (avail_sdk.RpcSystemHealth, error) {
+	return c.sdk.Client.Rpc.System.Health()
+}
+
+func (c *sdkClient) FreeBalance(accountId primitives.AccountId) (metadata.Balance, error) {
+	accountData, err := avail_sdk.Account.Balance(c.sdk.Client, accountId)
+	if err != nil {
+		return metadata.Balance{}, err
+	}
+	return accountData.Free, nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"io"
 	"os"
+	"time"
 
 	s3_storage_service "github.com/availproject/cdk-avail-da-server/lib/avail/s3StorageService"
 )
@@ -14,12 +15,99 @@ type Config struct {
 	AppID      int    `mapstructure:"AppID"`
 	WsApiUrl   string `mapstructure:"WsApiUrl"`
 	HttpApiUrl string `mapstructure:"HttpApiUrl"`
+	// Maximum RLP encoded sequence size in bytes, defaults to DefaultMaxSequenceSize
+	MaxSequenceSize int `mapstructure:"MaxSequenceSize"`
 
 	BridgeEnabled bool   `mapstructure:"BridgeEnabled"`
 	BridgeApiUrl  string `mapstructure:"BridgeApiUrl"`
-	BridgeTimeout int    `mapstructure:"BridgeTimeout"`
+	// Deprecated: use BridgeApiWaitInterval, still honoured when the latter is not set
+	BridgeTimeout int `mapstructure:"BridgeTimeout"`
+	// Seconds PostSequence waits in total for the bridge proof, at least BridgeApiRetryCount
+	// times BridgeApiWaitInterval. 0 leaves the wait bounded by the retries only.
+	BridgeApiTimeout int `mapstructure:"BridgeApiTimeout"`
+	// Seconds between two bridge proof queries, defaults to DefaultBridgeApiWaitInterval
+	BridgeApiWaitInterval int `mapstructure:"BridgeApiWaitInterval"`
+	// Number of bridge proof queries, defaults to DefaultBridgeApiRetryCount
+	BridgeApiRetryCount int `mapstructure:"BridgeApiRetryCount"`
+	// Seconds allowed for an Avail read, defaults to DefaultAvailRPCTimeout. A submission
+	// is waited for this long plus Mortality blocks of AvailBlockTime for each of its
+	// SubmitRetries+1 attempts, about 32 minutes with the defaults.
+	AvailRPCTimeout int `mapstructure:"AvailRPCTimeout"`
+	// Seconds PostSequence may take for a sequence, the submission, its retries and the
+	// bridge proof included, 0 leaves only the submission wait and the bridge retries. Fails
+	// with a SubmitTimeoutError.
+	SubmitTimeout int `mapstructure:"SubmitTimeout"`
+	// Blocks a submitted extrinsic is valid for, rounded by the SDK to a power of two
+	// between 4 and 65536, defaults to DefaultMortality. Longer eras give congested
+	// periods more time to include the extrinsic before it is retried.
+	Mortality int `mapstructure:"Mortality"`
+	// Times an extrinsic that outlived its era without being found on chain is sent
+	// again with the same nonce, defaults to DefaultSubmitRetries, negative disables
+	// the retries
+	SubmitRetries int `mapstructure:"SubmitRetries"`
+	// Return blob pointer submissions once their block is included instead of finalized.
+	// A background check confirms the finalization and submits the sequence again when
+	// the block was dropped, until then the data may only be on the fallback. The
+	// result of the finalized submission is returned by PostResult.Finalized. Not used
+	// with the bridge or TurboDA.
+	FastInclusion bool `mapstructure:"FastInclusion"`
+	// Seconds between two finalization checks of an included submission, defaults to
+	// DefaultFinalityCheckInterval
+	FinalityCheckInterval int `mapstructure:"FinalityCheckInterval"`
+	// Seconds bridge proofs and attestations are cached, defaults to DefaultProofCacheTTL, negative disables the cache
+	ProofCacheTTL int `mapstructure:"ProofCacheTTL"`
 	// Fallback
 	FallbackS3ServiceConfig s3_storage_service.S3StorageServiceConfig `mapstructure:"FallbackS3ServiceConfig"`
+	// Fallback split with Reed-Solomon across several buckets, replaces FallbackS3ServiceConfig
+	FallbackErasureConfig s3_storage_service.ErasureStorageServiceConfig `mapstructure:"FallbackErasureConfig"`
+	// Order in which GetSequence reads AvailDA and the fallback: s3-first (default), avail-first or race
+	ReadPriority string `mapstructure:"ReadPriority"`
+	// TurboDA
+	TurboDA TurboDAConfig `mapstructure:"TurboDA"`
+	// Seconds an identical sequence is answered with the message of its earlier submission,
+	// defaults to DefaultDedupWindow, negative disables deduplication
+	DedupWindow int `mapstructure:"DedupWindow"`
+	// Durable queue PostSequence submits through
+	SubmissionQueue SubmissionQueueConfig `mapstructure:"SubmissionQueue"`
+	// Background requests of the bridge proofs of submitted sequences
+	ProofWorker ProofWorkerConfig `mapstructure:"ProofWorker"`
+	// Proxy the Turbo DA, bridge api and L1 requests are sent through, e.g.
+	// http://proxy:3128. Defaults to the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+	// variables, which the Avail RPC requests always use.
+	ProxyUrl string `mapstructure:"ProxyUrl"`
+}
+
+type SubmissionQueueConfig struct {
+	Enable bool `mapstructure:"Enable"`
+	// Directory the queued submissions are persisted in
+	Dir string `mapstructure:"Dir"`
+	// Seconds between two attempts of a failing submission, defaults to DefaultQueueRetryInterval
+	RetryInterval int `mapstructure:"RetryInterval"`
+	// Attempts before a submission is marked as failed, defaults to DefaultQueueMaxAttempts
+	MaxAttempts int `mapstructure:"MaxAttempts"`
+}
+
+type ProofWorkerConfig struct {
+	// Request the bridge proof of a sequence as soon as it is submitted, PostSequence
+	// joins the request and Presubmit starts it ahead of PostSequence. Only used with
+	// the bridge enabled.
+	Enable bool `mapstructure:"Enable"`
+	// Bridge proofs requested at once, defaults to DefaultProofWorkerConcurrency
+	Concurrency int `mapstructure:"Concurrency"`
+}
+
+type TurboDAConfig struct {
+	// Submit sequences through TurboDA instead of directly to Avail
+	Enable bool   `mapstructure:"Enable"`
+	ApiUrl string `mapstructure:"ApiUrl"`
+	ApiKey string `mapstructure:"ApiKey"`
+}
+
+func (c *Config) bridgeWaitInterval() time.Duration {
+	if c.BridgeApiWaitInterval == 0 && c.BridgeTimeout > 0 {
+		return time.Duration(c.BridgeTimeout) * time.Second
+	}
+	return secondsOrDefault(c.BridgeApiWaitInterval, DefaultBridgeApiWaitInterval)
 }
 
 func (c *Config) GetConfig(configFileName string) error {
@@ -0,0 +1,115 @@
+package avail
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	avail_sdk "github.com/availproject/avail-go-sdk/sdk"
+)
+
+// Avail finalizes blocks a couple of 20 seconds blocks after their inclusion
+const DefaultFinalityCheckInterval = time.Duration(20) * time.Second
+
+// inclusionWatcher confirms the finalization of the sequences posted on block
+// inclusion with FastInclusion. A sequence whose block was dropped by a reorg is
+// submitted again, waiting for finalization, and the result of the new submission is
+// returned by PostResult.Finalized and replaces the dropped one for the retries of
+// the sequencer. Sequences still watched when the backend is closed are not confirmed.
+type inclusionWatcher struct {
+	a        *AvailBackend
+	interval time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newInclusionWatcher(a *AvailBackend, interval time.Duration) *inclusionWatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &inclusionWatcher{a: a, interval: interval, ctx: ctx, cancel: cancel}
+}
+
+// finality is the outcome of the finalization check of an included sequence, result
+// is set before done is closed and stays nil when the check was stopped
+type finality struct {
+	done   chan struct{}
+	result *PostResult
+}
+
+// watch checks every interval whether the block of the included sequence is finalized
+func (w *inclusionWatcher) watch(result PostResult, sequenceBlobData []byte) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer close(result.final.done)
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.ctx.Done():
+				w.a.logger.Warnf("AvailDAWarn: ⚠️ stopped before the finalization of block %d was confirmed commitment=%s", result.BlockNumber, result.Commitment.Hex())
+				return
+			case <-ticker.C:
+			}
+			finalized, err := w.confirm(result, sequenceBlobData)
+			if err != nil {
+				w.a.logger.Warnf("AvailDAWarn: ❌ finalization check of block %d failed, retrying in %v: %v", result.BlockNumber, w.interval, err)
+				continue
+			}
+			if finalized != nil {
+				result.final.result = finalized
+				return
+			}
+		}
+	}()
+}
+
+// confirm returns the result of the finalized sequence, in its block or submitted
+// again when the block was dropped, nil while its block isn't finalized
+func (w *inclusionWatcher) confirm(result PostResult, sequenceBlobData []byte) (*PostResult, error) {
+	finalized, err := w.a.client.FinalizedHeight()
+	if err != nil {
+		return nil, err
+	}
+	if finalized < result.BlockNumber {
+		return nil, nil
+	}
+	// The canonical hash, not the block hash cache which also serves dropped blocks
+	blockHash, err := w.a.client.BlockHash(result.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if blockHash.Value == result.BlockHash {
+		w.a.logger.Infof("AvailDAInfo: ✅ Included sequence is finalized block_number=%d commitment=%s", result.BlockNumber, result.Commitment.Hex())
+		confirmed := result
+		confirmed.Included = false
+		confirmed.final = nil
+		w.a.postedSequences.Add(sequenceKey{commitment: result.Commitment, appID: result.AppID}, &confirmed)
+		return &confirmed, nil
+	}
+
+	w.a.logger.Warnf("AvailDAWarn: ⚠️ block %d of the included sequence was dropped, submitting it again commitment=%s", result.BlockNumber, result.Commitment.Hex())
+	txDetails, err := w.a.submitData(w.ctx, sequenceBlobData, result.AppID, avail_sdk.Finalization)
+	if err != nil {
+		return nil, fmt.Errorf("cannot submit data again: %w", err)
+	}
+	dataAvailabilityMessage, err := blobPointerMessage(txDetails, sequenceBlobData)
+	if err != nil {
+		return nil, err
+	}
+	resubmitted := newPostResult(dataAvailabilityMessage, txDetails)
+	resubmitted.Commitment = result.Commitment
+	resubmitted.AppID = result.AppID
+	w.a.postedSequences.Add(sequenceKey{commitment: result.Commitment, appID: result.AppID}, resubmitted)
+	w.a.logger.Warnf("AvailDAWarn: 🔁 Sequence submitted again block_number=%d tx_index=%d commitment=%s, the message of block %d is stale",
+		resubmitted.BlockNumber, resubmitted.TxIndex, result.Commitment.Hex(), result.BlockNumber)
+	return resubmitted, nil
+}
+
+// stop cancels the finalization checks and waits for them to return
+func (w *inclusionWatcher) stop() {
+	w.cancel()
+	w.wg.Wait()
+}
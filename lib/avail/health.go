@@ -0,0 +1,114 @@
+package avail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/availproject/avail-go-sdk/primitives"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const healthCheckTimeout = time.Duration(10) * time.Second
+
+var ErrUnhealthy = errors.New("AvailDA backend is unhealthy")
+
+// HealthChecker is implemented by fallback storages able to report their health.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// HealthCheck verifies every dependency of the backend: Avail RPC connectivity, the
+// balance of the submitting account, the attestation contract code, the bridge api
+// and the fallback storage. Dependencies that are not configured are skipped. The
+// returned error wraps ErrUnhealthy and joins the error of every failed check.
+func (a *AvailBackend) HealthCheck(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	var errs []error
+	check := func(name string, fn func() error) {
+		if err := fn(); err != nil {
+			a.logger.Warnf("AvailDAWarn: ❌ health check %s failed: %v", name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	check("avail-rpc", a.checkAvailRPC)
+	check("account", a.checkAccount)
+	if a.l1Client != nil {
+		check("attestation-contract", func() error { return a.checkAttestationContract(ctx) })
+	}
+	if a.bridgeEnabled {
+		check("bridge-api", func() error { return a.checkBridgeApi(ctx) })
+	}
+	if checker, ok := a.fallbackS3Service.(HealthChecker); ok {
+		check("fallback-s3", func() error { return checker.HealthCheck(ctx) })
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrUnhealthy, errors.Join(errs...))
+	}
+	return nil
+}
+
+func (a *AvailBackend) checkAvailRPC() error {
+	health, err := a.client.Health()
+	if err != nil {
+		return err
+	}
+	if health.ShouldHavePeers && health.Peers == 0 {
+		return fmt.Errorf("avail node has no peers")
+	}
+	if health.IsSyncing {
+		return fmt.Errorf("avail node is syncing")
+	}
+	return nil
+}
+
+func (a *AvailBackend) checkAccount() error {
+	balance, err := a.client.FreeBalance(primitives.NewAccountIdFromKeyPair(a.acc))
+	if err != nil {
+		return err
+	}
+	if balance.Value.IsZero() {
+		return fmt.Errorf("account %s does not exist or has no free balance", a.address)
+	}
+	return nil
+}
+
+func (a *AvailBackend) checkAttestationContract(ctx context.Context) error {
+	code, err := a.l1Client.CodeAt(ctx, a.attestationAddress, nil)
+	if err != nil {
+		return err
+	}
+	if len(code) == 0 {
+		return fmt.Errorf("no contract code at %s", a.attestationAddress.Hex())
+	}
+	return nil
+}
+
+func (a *AvailBackend) checkBridgeApi(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.bridgeApi, nil)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("bridge api responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SetAttestationContractCodeReader enables the attestation contract code check of
+// HealthCheck for backends created with NewWithClients.
+func (a *AvailBackend) SetAttestationContractCodeReader(l1Client CodeReader, address common.Address) {
+	a.l1Client = l1Client
+	a.attestationAddress = address
+}
@@ -0,0 +1,110 @@
+package avail
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SubmitTimeoutError is returned when the submission of a sequence outlives its
+// deadline. An extrinsic that was sent can't be recalled, when InFlight is set the
+// submission goes on in the background and posting the sequence again joins it or
+// reuses its extrinsic instead of submitting the data twice.
+type SubmitTimeoutError struct {
+	// Keccak256 of the RLP encoded sequence
+	Commitment common.Hash
+	InFlight   bool
+	Err        error
+}
+
+func (e *SubmitTimeoutError) Error() string {
+	if e.InFlight {
+		return fmt.Sprintf("submission of sequence %s timed out, still in flight: %v", e.Commitment.Hex(), e.Err)
+	}
+	return fmt.Sprintf("submission of sequence %s timed out: %v", e.Commitment.Hex(), e.Err)
+}
+
+func (e *SubmitTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// inflightSubmission is a data submission being run, done is closed once details or
+// err is set. Abandoned submissions were given up by their caller.
+type inflightSubmission struct {
+	done      chan struct{}
+	details   submittedData
+	err       error
+	abandoned bool
+}
+
+// submissionTracker runs the blocking SDK submissions, at most one per data. The
+// submissions aren't bound to the context of their caller, which can't recall the
+// extrinsics already sent: a caller that gives up leaves its submission running, and
+// its retry joins it. The SDK stops sending extrinsics once the tracker is stopped.
+type submissionTracker struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	inflight map[sequenceKey]*inflightSubmission
+}
+
+func newSubmissionTracker() *submissionTracker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &submissionTracker{ctx: ctx, cancel: cancel, inflight: make(map[sequenceKey]*inflightSubmission)}
+}
+
+// run starts submit for the sequence unless a submission of it is in flight, and
+// reports whether the returned submission was joined. finished is called with the
+// result of abandoned submissions.
+func (t *submissionTracker) run(key sequenceKey, submit func(ctx context.Context) (submittedData, error), finished func(submittedData)) (*inflightSubmission, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if sub, ok := t.inflight[key]; ok {
+		return sub, true
+	}
+	sub := &inflightSubmission{done: make(chan struct{})}
+	t.inflight[key] = sub
+	go func() {
+		details, err := submit(t.ctx)
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.inflight, key)
+		sub.details, sub.err = details, err
+		close(sub.done)
+		if sub.abandoned && err == nil {
+			finished(details)
+		}
+	}()
+	return sub, false
+}
+
+// abandon records that the caller of the submission gave up on it, and reports whether
+// it is still in flight
+func (t *submissionTracker) abandon(sub *inflightSubmission) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	select {
+	case <-sub.done:
+		return false
+	default:
+		sub.abandoned = true
+		return true
+	}
+}
+
+// inFlight reports whether a submission of the sequence is running
+func (t *submissionTracker) inFlight(key sequenceKey) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.inflight[key]
+	return ok
+}
+
+// stop stops the SDK from sending further extrinsics, the submissions in flight return
+// once their current extrinsic is watched
+func (t *submissionTracker) stop() {
+	t.cancel()
+}
@@ -0,0 +1,97 @@
+// Package mock provides an in-memory DA backend with the same PostSequence and
+// GetSequence surface as avail.AvailBackend, for end-to-end tests of sequencing and
+// recovery that must run without Avail, S3 or L1.
+package mock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/availproject/cdk-avail-da-server/lib/avail"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var ErrSequenceNotFound = errors.New("mock: sequence not found")
+
+// Backend keeps every posted sequence in memory and hands out blob pointer DAMs,
+// where the pointer block height is the sequence number.
+type Backend struct {
+	mu        sync.RWMutex
+	sequences [][]byte
+	batches   map[common.Hash][]byte
+}
+
+func New() *Backend {
+	return &Backend{batches: make(map[common.Hash][]byte)}
+}
+
+func (b *Backend) Init() error {
+	return nil
+}
+
+func (b *Backend) PostSequence(ctx context.Context, batchesData [][]byte) ([]byte, error) {
+	sequenceBlobData, err := rlp.EncodeToBytes(batchesData)
+	if err != nil {
+		return nil, fmt.Errorf("cannot RLP encode data:%w", err)
+	}
+
+	b.mu.Lock()
+	b.sequences = append(b.sequences, sequenceBlobData)
+	height := uint32(len(b.sequences))
+	for _, batch := range batchesData {
+		b.batches[crypto.Keccak256Hash(batch)] = batch
+	}
+	b.mu.Unlock()
+
+	blobPointer := avail.NewBlobPointer(height, 0, crypto.Keccak256Hash(sequenceBlobData))
+	payload, err := blobPointer.MarshalToBinary()
+	if err != nil {
+		return nil, fmt.Errorf("encode blob pointer failed: %w", err)
+	}
+	return avail.PackEnvelopeWithMsgType(avail.DAM_TYPE_BLOB_POINTER, payload)
+}
+
+func (b *Backend) GetSequence(ctx context.Context, batchHashes []common.Hash, dataAvailabilityMessage []byte) ([][]byte, error) {
+	msgType, payload, err := avail.UnpackEnvelopeForMsgType(dataAvailabilityMessage)
+	if err != nil {
+		return nil, err
+	}
+	if msgType != avail.DAM_TYPE_BLOB_POINTER {
+		return nil, fmt.Errorf("mock: unsupported data availability message type: %d", msgType)
+	}
+
+	blobPointer := &avail.BlobPointer{}
+	if err := blobPointer.UnmarshalFromBinary(payload); err != nil {
+		return nil, fmt.Errorf("failed to decode BlobPointer: %w", err)
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if blobPointer.BlockHeight == 0 || int(blobPointer.BlockHeight) > len(b.sequences) {
+		return nil, fmt.Errorf("%w: %s", ErrSequenceNotFound, blobPointer)
+	}
+	sequenceBlobData := b.sequences[blobPointer.BlockHeight-1]
+	if crypto.Keccak256Hash(sequenceBlobData) != blobPointer.BlobDataKeccak265H {
+		return nil, fmt.Errorf("mock: commitment mismatch for %s", blobPointer)
+	}
+
+	var batchesData [][]byte
+	if err := rlp.DecodeBytes(sequenceBlobData, &batchesData); err != nil {
+		return nil, fmt.Errorf("cannot RLP decode data:%w", err)
+	}
+	return batchesData, nil
+}
+
+// GetBatch returns a single posted batch by its keccak256 hash.
+func (b *Backend) GetBatch(hash common.Hash) ([]byte, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	batch, ok := b.batches[hash]
+	return batch, ok
+}
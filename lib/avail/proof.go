@@ -0,0 +1,265 @@
+package avail
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/availproject/avail-go-sdk/metadata"
+	"github.com/availproject/avail-go-sdk/primitives"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	ErrInvalidInclusionProof = errors.New("invalid inclusion proof")
+	ErrLeafNotAttested       = errors.New("leaf is not attested on the attestation contract")
+	ErrProofNotSupported     = errors.New("inclusion proofs are not supported for this data availability message type")
+)
+
+// InclusionProof proves that a sequence is part of an Avail block. Proofs of blob
+// pointers come from the Avail node, proofs of merkle proof messages are the ones
+// attested on L1 and additionally carry the data root proof against the VectorX
+// data root commitment.
+type InclusionProof struct {
+	MsgType     uint8
+	BlockNumber uint32
+
+	DataRoot   common.Hash
+	BlobRoot   common.Hash
+	BridgeRoot common.Hash
+
+	// Leaf is keccak256 of the submitted sequence
+	Leaf      common.Hash
+	LeafIndex uint64
+	LeafProof []common.Hash
+
+	// Only set for merkle proof messages
+	RangeHash     common.Hash
+	DataRootIndex uint64
+	DataRootProof []common.Hash
+	// DataRootCommitment is the root the data root proof resolves to, it must match
+	// the VectorX commitment of RangeHash
+	DataRootCommitment common.Hash
+}
+
+// GetProof returns the Avail inclusion proof of the sequence referenced by the data
+// availability message and verifies it. Merkle proof messages are additionally
+// checked against the leaf attested on the attestation contract and the VectorX data
+// root commitment of their range, so watchtowers can audit data availability
+// independently of the sequencer.
+func (a *AvailBackend) GetProof(ctx context.Context, dataAvailabilityMessage []byte) (*InclusionProof, error) {
+	msgType, payload, err := UnpackEnvelopeForMsgType(dataAvailabilityMessage)
+	if err != nil {
+		return nil, err
+	}
+
+	var proof *InclusionProof
+	switch msgType {
+	case DAM_TYPE_MERKLE_PROOF:
+		merkleProofInput := &MerkleProofInput{}
+		if err := merkleProofInput.DecodeFromBinary(payload); err != nil {
+			return nil, fmt.Errorf("failed to decode MerkleProofInput: %w", err)
+		}
+		proof, err = a.attestedProof(ctx, merkleProofInput)
+
+	case DAM_TYPE_BLOB_POINTER:
+		blobPointer := &BlobPointer{}
+		if err := blobPointer.UnmarshalFromBinary(payload); err != nil {
+			return nil, fmt.Errorf("failed to decode BlobPointer: %w", err)
+		}
+		proof, err = a.blobPointerProof(blobPointer)
+
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrProofNotSupported, msgType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	a.logger.Debugf("AvailDADebug: ✅ Inclusion proof verified block_number=%d leaf=%s leaf_index=%d", proof.BlockNumber, proof.Leaf.Hex(), proof.LeafIndex)
+	return proof, nil
+}
+
+func (a *AvailBackend) attestedProof(ctx context.Context, input *MerkleProofInput) (*InclusionProof, error) {
+	if !input.LeafIndex.IsUint64() || !input.DataRootIndex.IsUint64() {
+		return nil, fmt.Errorf("%w: index out of range", ErrInvalidInclusionProof)
+	}
+	proof := &InclusionProof{
+		MsgType:       DAM_TYPE_MERKLE_PROOF,
+		DataRoot:      crypto.Keccak256Hash(input.BlobRoot[:], input.BridgeRoot[:]),
+		BlobRoot:      input.BlobRoot,
+		BridgeRoot:    input.BridgeRoot,
+		Leaf:          input.Leaf,
+		LeafIndex:     input.LeafIndex.Uint64(),
+		LeafProof:     arrayToHashSlice(input.LeafProof),
+		RangeHash:     input.RangeHash,
+		DataRootIndex: input.DataRootIndex.Uint64(),
+		DataRootProof: arrayToHashSlice(input.DataRootProof),
+	}
+	if err := verifyLeafProof(proof); err != nil {
+		return nil, err
+	}
+	proof.DataRootCommitment = merkleRoot(proof.DataRootProof, proof.DataRootIndex, proof.DataRoot, sha256Pair)
+
+	attestationData, err := a.getAttestation(ctx, input.Leaf)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get attestation data: %w", err)
+	}
+	if attestationData.BlockNumber == 0 {
+		return nil, fmt.Errorf("%w: leaf=%s", ErrLeafNotAttested, common.Hash(input.Leaf).Hex())
+	}
+	if attestationData.LeafIndex.Cmp(new(big.Int).SetUint64(proof.LeafIndex)) != 0 {
+		return nil, fmt.Errorf("%w: attested leaf index %s does not match proof leaf index %d", ErrInvalidInclusionProof, attestationData.LeafIndex, proof.LeafIndex)
+	}
+	if err := a.verifyDataRootCommitment(ctx, proof); err != nil {
+		return nil, err
+	}
+	proof.BlockNumber = attestationData.BlockNumber
+	return proof, nil
+}
+
+// verifyDataRootCommitment checks that the data root proof resolves to the commitment
+// VectorX stores for the range, the one the bridge verifies attested leaves against
+func (a *AvailBackend) verifyDataRootCommitment(ctx context.Context, proof *InclusionProof) error {
+	if a.vectorx == nil {
+		return errors.New("cannot verify data root proof, the VectorX contract is not set")
+	}
+	commitment, err := a.vectorx.DataRootCommitments(&bind.CallOpts{Context: ctx}, proof.RangeHash)
+	if err != nil {
+		return fmt.Errorf("cannot get data root commitment: %w", err)
+	}
+	if commitment == ([32]byte{}) {
+		return fmt.Errorf("%w: no data root commitment for range %s", ErrInvalidInclusionProof, proof.RangeHash.Hex())
+	}
+	if proof.DataRootCommitment != commitment {
+		return fmt.Errorf("%w: data root proof resolves to %s, VectorX committed %s for range %s", ErrInvalidInclusionProof, proof.DataRootCommitment.Hex(), common.Hash(commitment).Hex(), proof.RangeHash.Hex())
+	}
+	return nil
+}
+
+// SetDataRootCommitmentReader sets the VectorX contract the data root proofs of
+// attested merkle proofs are verified against, for backends created with
+// NewWithClients.
+func (a *AvailBackend) SetDataRootCommitmentReader(vectorx DataRootCommitmentReader) {
+	a.vectorx = vectorx
+}
+
+func (a *AvailBackend) blobPointerProof(blobPointer *BlobPointer) (*InclusionProof, error) {
+	blockHash, err := a.client.BlockHash(blobPointer.BlockHeight)
+	if err != nil {
+		return nil, a.availReadError(blobPointer.BlockHeight, fmt.Errorf("❎ Cannot get block hash: %w", err))
+	}
+	dataProof, err := a.client.DataProof(blockHash, blobPointer.ExtrinsicIndex)
+	if err != nil {
+		return nil, a.availReadError(blobPointer.BlockHeight, fmt.Errorf("❎ Cannot get data proof: %w", err))
+	}
+
+	proof := newDataProofInclusion(blobPointer.BlockHeight, dataProof)
+	if err := verifyDataProof(proof, blobPointer.BlobDataKeccak265H); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+// VerifyDataProof gets the kate data proof of the extrinsic from the Avail node and
+// verifies it against the data root of the block header, as a check of the inclusion
+// of the sequence independent of the bridge. commitment is keccak256 of the submitted
+// sequence.
+func (a *AvailBackend) VerifyDataProof(blockHash common.Hash, txIndex uint32, commitment common.Hash) (*InclusionProof, error) {
+	hash := primitives.H256{Value: blockHash}
+	dataProof, err := a.client.DataProof(hash, txIndex)
+	if err != nil {
+		return nil, fmt.Errorf("❎ Cannot get data proof: %w", err)
+	}
+	blockNumber, headerDataRoot, err := a.client.HeaderDataRoot(hash)
+	if err != nil {
+		return nil, fmt.Errorf("❎ Cannot get block header: %w", err)
+	}
+	if headerDataRoot.Value == (common.Hash{}) {
+		return nil, fmt.Errorf("%w: block header %s has no data root", ErrInvalidInclusionProof, blockHash.Hex())
+	}
+
+	proof := newDataProofInclusion(blockNumber, dataProof)
+	if proof.DataRoot != headerDataRoot.Value {
+		return nil, fmt.Errorf("%w: data root %s does not match the data root %s of block %d", ErrInvalidInclusionProof, proof.DataRoot.Hex(), common.Hash(headerDataRoot.Value).Hex(), blockNumber)
+	}
+	if err := verifyDataProof(proof, commitment); err != nil {
+		return nil, err
+	}
+
+	a.logger.Debugf("AvailDADebug: ✅ Data proof verified against the block header block_number=%d tx_index=%d leaf=%s", proof.BlockNumber, txIndex, proof.Leaf.Hex())
+	return proof, nil
+}
+
+func newDataProofInclusion(blockNumber uint32, dataProof metadata.DataProof) *InclusionProof {
+	proof := &InclusionProof{
+		MsgType:     DAM_TYPE_BLOB_POINTER,
+		BlockNumber: blockNumber,
+		DataRoot:    dataProof.Roots.DataRoot.Value,
+		BlobRoot:    dataProof.Roots.BlobRoot.Value,
+		BridgeRoot:  dataProof.Roots.BridgeRoot.Value,
+		Leaf:        dataProof.Leaf.Value,
+		LeafIndex:   uint64(dataProof.LeafIndex),
+	}
+	for _, h := range dataProof.Proof {
+		proof.LeafProof = append(proof.LeafProof, h.Value)
+	}
+	return proof
+}
+
+// verifyDataProof checks that the data proof of the Avail node proves the inclusion
+// of the sequence with the given commitment
+func verifyDataProof(proof *InclusionProof, commitment common.Hash) error {
+	if proof.Leaf != commitment {
+		return fmt.Errorf("%w: leaf %s does not match the commitment %s", ErrInvalidInclusionProof, proof.Leaf.Hex(), commitment.Hex())
+	}
+	if proof.DataRoot != crypto.Keccak256Hash(proof.BlobRoot[:], proof.BridgeRoot[:]) {
+		return fmt.Errorf("%w: data root does not commit to the blob and bridge roots", ErrInvalidInclusionProof)
+	}
+	return verifyLeafProof(proof)
+}
+
+// verifyLeafProof checks that the leaf is part of the blob root, the same way the
+// Avail bridge verifies blob leaves.
+func verifyLeafProof(proof *InclusionProof) error {
+	if proof.BlobRoot == (common.Hash{}) {
+		return fmt.Errorf("%w: empty blob root", ErrInvalidInclusionProof)
+	}
+	if root := merkleRoot(proof.LeafProof, proof.LeafIndex, crypto.Keccak256Hash(proof.Leaf[:]), keccakPair); root != proof.BlobRoot {
+		return fmt.Errorf("%w: leaf proof resolves to %s, expected blob root %s", ErrInvalidInclusionProof, root.Hex(), proof.BlobRoot.Hex())
+	}
+	return nil
+}
+
+// merkleRoot folds the proof into the root of the tree containing node at index
+func merkleRoot(proof []common.Hash, index uint64, node common.Hash, hashPair func(left, right common.Hash) common.Hash) common.Hash {
+	for _, sibling := range proof {
+		if index&1 == 0 {
+			node = hashPair(node, sibling)
+		} else {
+			node = hashPair(sibling, node)
+		}
+		index >>= 1
+	}
+	return node
+}
+
+func keccakPair(left, right common.Hash) common.Hash {
+	return crypto.Keccak256Hash(left[:], right[:])
+}
+
+func sha256Pair(left, right common.Hash) common.Hash {
+	return sha256.Sum256(append(left.Bytes(), right.Bytes()...))
+}
+
+func arrayToHashSlice(arr [][32]byte) []common.Hash {
+	hashes := make([]common.Hash, len(arr))
+	for i, h := range arr {
+		hashes[i] = h
+	}
+	return hashes
+}
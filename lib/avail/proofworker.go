@@ -0,0 +1,111 @@
+package avail
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/0xPolygon/cdk/log"
+	"github.com/availproject/avail-go-sdk/primitives"
+)
+
+const (
+	DefaultProofWorkerConcurrency = 4
+	// Presubmitted sequences whose PostSequence doesn't come are forgotten after this,
+	// or earlier when more than presubmittedCacheSize of them are waiting
+	DefaultPresubmitTTL   = time.Duration(3600) * time.Second
+	presubmittedCacheSize = 1024
+)
+
+// proofRequest is a bridge proof being fetched, done is closed once proof or err is set
+type proofRequest struct {
+	done  chan struct{}
+	proof *MerkleProofInput
+	err   error
+}
+
+// proofWorker requests the bridge proofs of submitted sequences in the background, so
+// the bridge latency is paid before PostSequence asks for the proof. A proof is
+// fetched once at a time, PostSequence joins the request in flight and the fetched
+// proofs land in the bridge proof cache. At most concurrency proofs are requested from
+// the bridge api at once.
+type proofWorker struct {
+	fetch  func(ctx context.Context, blockHash primitives.H256, txIndex uint32) (*MerkleProofInput, error)
+	slots  chan struct{}
+	logger *log.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	pending map[bridgeProofKey]*proofRequest
+}
+
+func newProofWorker(concurrency int, fetch func(ctx context.Context, blockHash primitives.H256, txIndex uint32) (*MerkleProofInput, error), logger *log.Logger) *proofWorker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &proofWorker{
+		fetch:   fetch,
+		slots:   make(chan struct{}, concurrency),
+		logger:  logger,
+		ctx:     ctx,
+		cancel:  cancel,
+		pending: make(map[bridgeProofKey]*proofRequest),
+	}
+}
+
+// schedule requests the proof of the extrinsic unless it is already being requested
+func (w *proofWorker) schedule(blockHash primitives.H256, txIndex uint32) *proofRequest {
+	key := bridgeProofKey{blockHash: blockHash, txIndex: txIndex}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if req, ok := w.pending[key]; ok {
+		return req
+	}
+	req := &proofRequest{done: make(chan struct{})}
+	w.pending[key] = req
+	w.wg.Add(1)
+	go w.run(key, req)
+	return req
+}
+
+func (w *proofWorker) run(key bridgeProofKey, req *proofRequest) {
+	defer w.wg.Done()
+	defer func() {
+		w.mu.Lock()
+		delete(w.pending, key)
+		w.mu.Unlock()
+		close(req.done)
+	}()
+
+	select {
+	case w.slots <- struct{}{}:
+		defer func() { <-w.slots }()
+	case <-w.ctx.Done():
+		req.err = w.ctx.Err()
+		return
+	}
+	w.logger.Debugf("AvailDADebug: 🔮 Requesting bridge proof ahead of time blockHash=%s txIndex=%d", key.blockHash, key.txIndex)
+	req.proof, req.err = w.fetch(w.ctx, key.blockHash, key.txIndex)
+	if req.err != nil {
+		w.logger.Warnf("AvailDAWarn: ⚠️ Bridge proof request failed blockHash=%s txIndex=%d: %v", key.blockHash, key.txIndex, req.err)
+	}
+}
+
+// wait returns the proof of the extrinsic, requesting it when it isn't being requested
+// yet. The request goes on when ctx is done before it completes.
+func (w *proofWorker) wait(ctx context.Context, blockHash primitives.H256, txIndex uint32) (*MerkleProofInput, error) {
+	req := w.schedule(blockHash, txIndex)
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-req.done:
+		return req.proof, req.err
+	}
+}
+
+// stop cancels the requests in flight and waits for them to return
+func (w *proofWorker) stop() {
+	w.cancel()
+	w.wg.Wait()
+}
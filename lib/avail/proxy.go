@@ -0,0 +1,29 @@
+package avail
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// newHTTPClient returns the client of the Turbo DA, bridge api and L1 requests. They
+// go through proxyURL when it is set, otherwise through the proxy of the HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY environment variables like every default client.
+func newHTTPClient(proxyURL string) (*http.Client, error) {
+	if proxyURL == "" {
+		return &http.Client{}, nil
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy url, expected scheme://host:port")
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy url scheme %q, expected http, https or socks5", u.Scheme)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(u)
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,361 @@
+package avail
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xPolygon/cdk/log"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	DefaultQueueRetryInterval = time.Duration(30) * time.Second
+	DefaultQueueMaxAttempts   = 10
+	// Finished submissions are kept this long for status lookups
+	DefaultQueueRetention = time.Duration(24) * time.Hour
+)
+
+var (
+	ErrSubmissionNotFound = errors.New("submission not found in the queue")
+	ErrSubmissionFailed   = errors.New("submission failed after the maximum number of attempts")
+	// errSubmissionCorrupted is returned for submission files that can't be decoded
+	errSubmissionCorrupted = errors.New("corrupted submission file")
+)
+
+type SubmissionStatus string
+
+const (
+	SubmissionPending   SubmissionStatus = "pending"
+	SubmissionSubmitted SubmissionStatus = "submitted"
+	SubmissionFailed    SubmissionStatus = "failed"
+)
+
+// Submission is a sequence tracked by the submission queue. Its id is the keccak256
+// hash of the RLP encoded sequence, so posting the same sequence again after a
+// restart resolves to the same submission.
+type Submission struct {
+	ID      common.Hash      `json:"id"`
+	Status  SubmissionStatus `json:"status"`
+	Batches []hexutil.Bytes  `json:"batches,omitempty"`
+	// App id the sequence is posted under, the configured one when not set
+	AppID     *int        `json:"appId,omitempty"`
+	Attempts  int         `json:"attempts"`
+	LastError string      `json:"lastError,omitempty"`
+	Result    *PostResult `json:"result,omitempty"`
+	CreatedAt time.Time   `json:"createdAt"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+}
+
+// SubmissionID returns the id the queue assigns to the sequence.
+func SubmissionID(batchesData [][]byte) (common.Hash, error) {
+	sequenceBlobData, err := rlp.EncodeToBytes(batchesData)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("cannot RLP encode data:%w", err)
+	}
+	return crypto.Keccak256Hash(sequenceBlobData), nil
+}
+
+// SubmissionIDWithAppID returns the id the queue assigns to the sequence posted under
+// an app id other than the configured one, see AvailBackend.PostSequenceWithAppID.
+func SubmissionIDWithAppID(batchesData [][]byte, appID int) (common.Hash, error) {
+	id, err := SubmissionID(batchesData)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(id.Bytes(), binary.BigEndian.AppendUint32(nil, uint32(appID))), nil
+}
+
+// submissionQueue is a durable queue of sequences, one json file per submission in
+// dir. A single worker submits pending sequences in creation order and keeps
+// retrying them across restarts.
+type submissionQueue struct {
+	dir           string
+	retryInterval time.Duration
+	maxAttempts   int
+	retention     time.Duration
+	post          func(ctx context.Context, batchesData [][]byte, appID *int) (*PostResult, error)
+	logger        *log.Logger
+
+	mu      sync.Mutex
+	waiters map[common.Hash][]chan struct{}
+	wakeup  chan struct{}
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+func newSubmissionQueue(config SubmissionQueueConfig, post func(ctx context.Context, batchesData [][]byte, appID *int) (*PostResult, error), logger *log.Logger) (*submissionQueue, error) {
+	if config.Dir == "" {
+		return nil, fmt.Errorf("submission queue directory is not set")
+	}
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cannot create submission queue directory: %w", err)
+	}
+	return &submissionQueue{
+		dir:           config.Dir,
+		retryInterval: secondsOrDefault(config.RetryInterval, DefaultQueueRetryInterval),
+		maxAttempts:   intOrDefault(config.MaxAttempts, DefaultQueueMaxAttempts),
+		retention:     DefaultQueueRetention,
+		post:          post,
+		logger:        logger,
+		waiters:       make(map[common.Hash][]chan struct{}),
+		wakeup:        make(chan struct{}, 1),
+	}, nil
+}
+
+// start runs the worker until stop is called.
+func (q *submissionQueue) start() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+	q.done = make(chan struct{})
+	go func() {
+		defer close(q.done)
+		for {
+			if err := q.process(ctx); err != nil {
+				q.logger.Warnf("AvailDAWarn: ❌ submission queue: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.wakeup:
+			case <-time.After(q.retryInterval):
+			}
+		}
+	}()
+}
+
+func (q *submissionQueue) stop() {
+	q.mu.Lock()
+	cancel, done := q.cancel, q.done
+	q.cancel = nil
+	q.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// enqueue persists the sequence posted under appID, the configured one when nil,
+// unless it is already known and returns its id.
+func (q *submissionQueue) enqueue(batchesData [][]byte, appID *int) (common.Hash, error) {
+	id, err := SubmissionID(batchesData)
+	if appID != nil {
+		id, err = SubmissionIDWithAppID(batchesData, *appID)
+	}
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	existing, err := q.load(id)
+	switch {
+	case err == nil && existing.Status != SubmissionFailed:
+		return id, nil
+	case err != nil && !errors.Is(err, ErrSubmissionNotFound):
+		return common.Hash{}, err
+	}
+
+	now := time.Now()
+	submission := &Submission{ID: id, Status: SubmissionPending, AppID: appID, CreatedAt: now, UpdatedAt: now}
+	for _, batch := range batchesData {
+		submission.Batches = append(submission.Batches, batch)
+	}
+	if err := q.save(submission); err != nil {
+		return common.Hash{}, err
+	}
+
+	select {
+	case q.wakeup <- struct{}{}:
+	default:
+	}
+	return id, nil
+}
+
+// wait blocks until the submission is finished or ctx is done.
+func (q *submissionQueue) wait(ctx context.Context, id common.Hash) (*Submission, error) {
+	for {
+		q.mu.Lock()
+		submission, err := q.load(id)
+		if err != nil {
+			q.mu.Unlock()
+			return nil, err
+		}
+		if submission.Status != SubmissionPending {
+			q.mu.Unlock()
+			return submission, nil
+		}
+		ch := make(chan struct{})
+		q.waiters[id] = append(q.waiters[id], ch)
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ch:
+		}
+	}
+}
+
+func (q *submissionQueue) status(id common.Hash) (*Submission, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.load(id)
+}
+
+// process submits every pending submission that is due and drops expired ones.
+func (q *submissionQueue) process(ctx context.Context) error {
+	q.mu.Lock()
+	submissions, err := q.list()
+	q.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, submission := range submissions {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if submission.Status != SubmissionPending {
+			if time.Since(submission.UpdatedAt) > q.retention {
+				q.mu.Lock()
+				err := os.Remove(q.path(submission.ID))
+				q.mu.Unlock()
+				if err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+			continue
+		}
+		if submission.Attempts > 0 && time.Since(submission.UpdatedAt) < q.retryInterval {
+			continue
+		}
+
+		batchesData := make([][]byte, len(submission.Batches))
+		for i, batch := range submission.Batches {
+			batchesData[i] = batch
+		}
+		result, err := q.post(ctx, batchesData, submission.AppID)
+		if ctx.Err() != nil {
+			// Shutting down, the submission is retried on the next start
+			return nil
+		}
+
+		submission.Attempts++
+		submission.UpdatedAt = time.Now()
+		if err != nil {
+			submission.LastError = err.Error()
+			if submission.Attempts >= q.maxAttempts {
+				submission.Status = SubmissionFailed
+			}
+			q.logger.Warnf("AvailDAWarn: ❌ queued submission %s failed, attempt %d/%d: %v", submission.ID.Hex(), submission.Attempts, q.maxAttempts, err)
+		} else {
+			submission.Status = SubmissionSubmitted
+			submission.LastError = ""
+			submission.Result = result
+			submission.Batches = nil
+			q.logger.Infof("AvailDAInfo: ✅ queued submission %s submitted", submission.ID.Hex())
+		}
+
+		q.mu.Lock()
+		err = q.save(submission)
+		if submission.Status != SubmissionPending {
+			for _, ch := range q.waiters[submission.ID] {
+				close(ch)
+			}
+			delete(q.waiters, submission.ID)
+		}
+		q.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *submissionQueue) path(id common.Hash) string {
+	return filepath.Join(q.dir, id.Hex()+".json")
+}
+
+// load must be called with mu held
+func (q *submissionQueue) load(id common.Hash) (*Submission, error) {
+	data, err := os.ReadFile(q.path(id))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrSubmissionNotFound, id.Hex())
+	}
+	if err != nil {
+		return nil, err
+	}
+	submission := &Submission{}
+	if err := json.Unmarshal(data, submission); err != nil {
+		return nil, fmt.Errorf("%w, cannot decode submission %s: %w", errSubmissionCorrupted, id.Hex(), err)
+	}
+	return submission, nil
+}
+
+// save atomically replaces the submission file, it must be called with mu held
+func (q *submissionQueue) save(submission *Submission) error {
+	data, err := json.Marshal(submission)
+	if err != nil {
+		return err
+	}
+	tmp := q.path(submission.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.path(submission.ID))
+}
+
+// list returns all submissions in creation order, it must be called with mu held.
+// Files that can't be read are skipped so they don't stall the other submissions,
+// corrupted ones are moved aside with a .corrupt suffix for inspection.
+func (q *submissionQueue) list() ([]*Submission, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, err
+	}
+	var submissions []*Submission
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		submission, err := q.load(common.HexToHash(strings.TrimSuffix(name, ".json")))
+		if errors.Is(err, errSubmissionCorrupted) {
+			q.logger.Warnf("AvailDAWarn: ❌ submission queue: moving %s aside: %v", name, err)
+			if err := os.Rename(filepath.Join(q.dir, name), filepath.Join(q.dir, name+".corrupt")); err != nil {
+				q.logger.Warnf("AvailDAWarn: ❌ submission queue: cannot move %s aside: %v", name, err)
+			}
+			continue
+		}
+		if err != nil {
+			q.logger.Warnf("AvailDAWarn: ❌ submission queue: skipping %s: %v", name, err)
+			continue
+		}
+		submissions = append(submissions, submission)
+	}
+	sort.Slice(submissions, func(i, j int) bool {
+		return submissions[i].CreatedAt.Before(submissions[j].CreatedAt)
+	})
+	return submissions, nil
+}
@@ -0,0 +1,378 @@
+package s3_storage_service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/0xPolygon/cdk/log"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/klauspost/reedsolomon"
+	flag "github.com/spf13/pflag"
+)
+
+// ErasureStorageServiceConfig splits every blob with Reed-Solomon into one shard per
+// bucket, any DataShards of them reconstruct the blob. With 5 buckets and 3 data
+// shards the loss of any 2 buckets or providers loses no data.
+type ErasureStorageServiceConfig struct {
+	Enable bool `mapstructure:"Enable"`
+	// Number of shards a blob is reconstructed from, the other buckets hold parity
+	DataShards int `mapstructure:"DataShards"`
+	// Shards that must be stored for a put to succeed, defaults to every bucket
+	WriteQuorum int `mapstructure:"WriteQuorum"`
+	// Number of blobs read or written at once by GetMultipleByHash and PutMultiple
+	Concurrency int `mapstructure:"Concurrency"`
+	// Buckets of the shards, possibly of different providers. Shard i is always stored
+	// in bucket i, the order must never change once data is stored.
+	Buckets []S3StorageServiceConfig `mapstructure:"Buckets"`
+}
+
+var DefaultErasureStorageServiceConfig = ErasureStorageServiceConfig{
+	Enable: false,
+}
+
+func ErasureConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".Enable", DefaultErasureStorageServiceConfig.Enable, "split blobs with Reed-Solomon across the buckets of the config file")
+	f.Int(prefix+".DataShards", DefaultErasureStorageServiceConfig.DataShards, "number of shards, and buckets, a blob is reconstructed from")
+	f.Int(prefix+".WriteQuorum", DefaultErasureStorageServiceConfig.WriteQuorum, "number of shards that must be stored for a put to succeed, defaults to every bucket")
+	f.Int(prefix+".Concurrency", DefaultErasureStorageServiceConfig.Concurrency, "number of blobs read or written at once")
+}
+
+// ShardStore stores the shards of a single bucket
+type ShardStore interface {
+	Put(ctx context.Context, value []byte, timeout uint64, commitment common.Hash) error
+	GetByHash(ctx context.Context, key common.Hash) ([]byte, error)
+}
+
+// shardHeaderSize is the size of the header of every shard: the data and the total
+// shard counts, so shards of another layout are detected, and the size of the blob
+const shardHeaderSize = 1 + 1 + 8
+
+var ErrNotEnoughShards = errors.New("not enough shards to reconstruct the blob")
+
+type ErasureStorageService struct {
+	logger      Logger
+	stores      []ShardStore
+	encoder     reedsolomon.Encoder
+	dataShards  int
+	writeQuorum int
+	concurrency int
+}
+
+// NewErasureStorageService creates an S3 storage service for every bucket of the
+// config, a nil logger uses the default logger
+func NewErasureStorageService(config ErasureStorageServiceConfig, logger Logger) (*ErasureStorageService, error) {
+	if logger == nil {
+		logger = log.GetDefaultLogger()
+	}
+	stores := make([]ShardStore, 0, len(config.Buckets))
+	for i, bucketConfig := range config.Buckets {
+		store, err := NewS3StorageService(bucketConfig, logger)
+		if err != nil {
+			return nil, fmt.Errorf("shard bucket %d: %w", i, err)
+		}
+		stores = append(stores, store)
+	}
+	return NewErasureStorageServiceWithStores(config, stores, logger)
+}
+
+// NewErasureStorageServiceWithStores creates the service on top of already
+// constructed shard stores, one per bucket, the buckets of the config are ignored
+func NewErasureStorageServiceWithStores(config ErasureStorageServiceConfig, stores []ShardStore, logger Logger) (*ErasureStorageService, error) {
+	if logger == nil {
+		logger = log.GetDefaultLogger()
+	}
+	total := len(stores)
+	if config.DataShards <= 0 || config.DataShards >= total {
+		return nil, fmt.Errorf("data shards must be between 1 and %d for %d buckets, got %d", total-1, total, config.DataShards)
+	}
+	if total > 255 {
+		return nil, fmt.Errorf("at most 255 buckets are supported, got %d", total)
+	}
+	writeQuorum := config.WriteQuorum
+	if writeQuorum <= 0 {
+		writeQuorum = total
+	}
+	if writeQuorum < config.DataShards || writeQuorum > total {
+		return nil, fmt.Errorf("write quorum must be between %d and %d, got %d", config.DataShards, total, writeQuorum)
+	}
+	encoder, err := reedsolomon.New(config.DataShards, total-config.DataShards)
+	if err != nil {
+		return nil, err
+	}
+	concurrency := config.Concurrency
+	if concurrency <= 0 {
+		concurrency = 5
+	}
+	logger.Infow("avail.ErasureStorageService.New", "buckets", total, "dataShards", config.DataShards, "writeQuorum", writeQuorum)
+	return &ErasureStorageService{
+		logger:      logger,
+		stores:      stores,
+		encoder:     encoder,
+		dataShards:  config.DataShards,
+		writeQuorum: writeQuorum,
+		concurrency: concurrency,
+	}, nil
+}
+
+// Put splits the value into shards and stores shard i in bucket i
+func (e *ErasureStorageService) Put(ctx context.Context, value []byte, timeout uint64, commitment common.Hash) error {
+	payload := value
+	if len(payload) == 0 {
+		// Split needs at least a byte, the size in the header drops it again
+		payload = []byte{0}
+	}
+	shards, err := e.encoder.Split(payload)
+	if err != nil {
+		return err
+	}
+	if err := e.encoder.Encode(shards); err != nil {
+		return err
+	}
+
+	header := make([]byte, shardHeaderSize)
+	header[0] = byte(e.dataShards)
+	header[1] = byte(len(e.stores))
+	binary.BigEndian.PutUint64(header[2:], uint64(len(value)))
+
+	errs := make([]error, len(e.stores))
+	var wg sync.WaitGroup
+	for i, store := range e.stores {
+		wg.Add(1)
+		go func(i int, store ShardStore) {
+			defer wg.Done()
+			shard := append(append(make([]byte, 0, shardHeaderSize+len(shards[i])), header...), shards[i]...)
+			errs[i] = store.Put(ctx, shard, timeout, commitment)
+		}(i, store)
+	}
+	wg.Wait()
+
+	stored := 0
+	for i, err := range errs {
+		if err != nil {
+			e.logger.Warnw("avail.ErasureStorageService.Put shard failed", "key", prettyHash(commitment), "shard", i, "error", err)
+			continue
+		}
+		stored++
+	}
+	if stored < e.writeQuorum {
+		return fmt.Errorf("stored %d of %d shards, the write quorum is %d: %w", stored, len(e.stores), e.writeQuorum, errors.Join(errs...))
+	}
+	return nil
+}
+
+// GetByHash reads the shards from every bucket and reconstructs the blob as soon as
+// DataShards of them arrived. When the blob doesn't match the hash, one of the shards
+// is corrupted: the shards of the other buckets are awaited and the blob is
+// reconstructed from the other subsets of DataShards shards.
+func (e *ErasureStorageService) GetByHash(ctx context.Context, key common.Hash) ([]byte, error) {
+	type result struct {
+		index int
+		shard []byte
+		err   error
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan result, len(e.stores))
+	for i, store := range e.stores {
+		go func(i int, store ShardStore) {
+			shard, err := store.GetByHash(ctx, key)
+			results <- result{index: i, shard: shard, err: err}
+		}(i, store)
+	}
+
+	shards := make([][]byte, len(e.stores))
+	var size uint64
+	var errs []error
+	received, pending := 0, len(e.stores)
+	// receive collects shards until want of them arrived or every bucket answered
+	receive := func(want int) {
+		for received < want && pending > 0 {
+			res := <-results
+			pending--
+			if res.err == nil {
+				res.err = e.checkShardHeader(res.shard, shards, &size)
+			}
+			if res.err != nil {
+				errs = append(errs, fmt.Errorf("shard %d: %w", res.index, res.err))
+				continue
+			}
+			shards[res.index] = res.shard[shardHeaderSize:]
+			received++
+		}
+	}
+	receive(e.dataShards)
+	if received < e.dataShards {
+		return nil, fmt.Errorf("%w %s, got %d of %d: %w", ErrNotEnoughShards, key.Hex(), received, e.dataShards, errors.Join(errs...))
+	}
+
+	data, err := e.join(shards, size, key)
+	if !errors.Is(err, errBlobMismatch) {
+		return data, err
+	}
+	receive(len(e.stores))
+	e.logger.Warnw("avail.ErasureStorageService.GetByHash corrupted shard, reconstructing from other shards", "key", prettyHash(key), "shards", received)
+	return e.joinSubsets(shards, size, key)
+}
+
+var errBlobMismatch = errors.New("reconstructed blob doesn't match the hash")
+
+// maxReconstructions bounds the subsets of shards tried to get around corrupted shards
+const maxReconstructions = 256
+
+// join reconstructs the blob from the shards and checks it against the hash, the
+// shards are left untouched
+func (e *ErasureStorageService) join(shards [][]byte, size uint64, key common.Hash) ([]byte, error) {
+	shards = append([][]byte(nil), shards...)
+	if err := e.encoder.ReconstructData(shards); err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, size))
+	if err := e.encoder.Join(buf, shards, int(size)); err != nil {
+		return nil, err
+	}
+	data := buf.Bytes()
+	if commitment := crypto.Keccak256Hash(data); commitment != key {
+		return nil, fmt.Errorf("%w, expected %s, got %s", errBlobMismatch, key.Hex(), commitment.Hex())
+	}
+	return data, nil
+}
+
+// joinSubsets reconstructs the blob from every subset of DataShards of the shards
+// until one matches the hash
+func (e *ErasureStorageService) joinSubsets(shards [][]byte, size uint64, key common.Hash) ([]byte, error) {
+	var available []int
+	for i, shard := range shards {
+		if shard != nil {
+			available = append(available, i)
+		}
+	}
+	// subset holds the positions in available of the shards of the subset tried
+	subset := make([]int, e.dataShards)
+	for i := range subset {
+		subset[i] = i
+	}
+	for tries := 0; tries < maxReconstructions; tries++ {
+		picked := make([][]byte, len(shards))
+		for _, pos := range subset {
+			picked[available[pos]] = shards[available[pos]]
+		}
+		data, err := e.join(picked, size, key)
+		if !errors.Is(err, errBlobMismatch) {
+			return data, err
+		}
+		// Next combination in lexicographic order
+		i := len(subset) - 1
+		for i >= 0 && subset[i] == len(available)-len(subset)+i {
+			i--
+		}
+		if i < 0 {
+			break
+		}
+		subset[i]++
+		for j := i + 1; j < len(subset); j++ {
+			subset[j] = subset[j-1] + 1
+		}
+	}
+	return nil, fmt.Errorf("%w %s: no %d of the %d shards read reconstruct it", errBlobMismatch, key.Hex(), e.dataShards, len(available))
+}
+
+// checkShardHeader checks that the shard was written with the layout of the service
+// and has the blob size of the shards read before, shards of another length are
+// dropped before the reconstruction
+func (e *ErasureStorageService) checkShardHeader(shard []byte, shards [][]byte, size *uint64) error {
+	if len(shard) < shardHeaderSize {
+		return fmt.Errorf("shard is too short")
+	}
+	if int(shard[0]) != e.dataShards || int(shard[1]) != len(e.stores) {
+		return fmt.Errorf("shard of a %d of %d layout, expected %d of %d", shard[0], shard[1], e.dataShards, len(e.stores))
+	}
+	shardSize := binary.BigEndian.Uint64(shard[2:shardHeaderSize])
+	// Put splits at least a byte into shards of the same length
+	if want := (max(shardSize, 1) + uint64(e.dataShards) - 1) / uint64(e.dataShards); uint64(len(shard)-shardHeaderSize) != want {
+		return fmt.Errorf("shard of %d bytes of a %d bytes blob, expected %d", len(shard)-shardHeaderSize, shardSize, want)
+	}
+	for _, s := range shards {
+		if s != nil && shardSize != *size {
+			return fmt.Errorf("shard of a %d bytes blob, expected %d", shardSize, *size)
+		}
+	}
+	*size = shardSize
+	return nil
+}
+
+func (e *ErasureStorageService) GetMultipleByHash(ctx context.Context, keys []common.Hash) ([][]byte, error) {
+	data := make([][]byte, len(keys))
+	err := e.forEach(ctx, len(keys), func(i int) error {
+		var err error
+		data[i], err = e.GetByHash(ctx, keys[i])
+		return err
+	})
+	if err != nil {
+		return data, fmt.Errorf("one or more downloads failed: %w", err)
+	}
+	return data, nil
+}
+
+func (e *ErasureStorageService) PutMultiple(ctx context.Context, values [][]byte) error {
+	err := e.forEach(ctx, len(values), func(i int) error {
+		return e.Put(ctx, values[i], 0, crypto.Keccak256Hash(values[i]))
+	})
+	if err != nil {
+		return fmt.Errorf("one or more uploads failed: %w", err)
+	}
+	return nil
+}
+
+// forEach calls fn for every index, concurrency at a time, and returns the errors
+func (e *ErasureStorageService) forEach(ctx context.Context, n int, fn func(i int) error) error {
+	errs := make([]error, n)
+	sem := make(chan struct{}, e.concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// HealthCheck succeeds while at least DataShards buckets are healthy, the blobs can
+// still be read
+func (e *ErasureStorageService) HealthCheck(ctx context.Context) error {
+	var errs []error
+	for i, store := range e.stores {
+		checker, ok := store.(interface{ HealthCheck(context.Context) error })
+		if !ok {
+			continue
+		}
+		if err := checker.HealthCheck(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("shard bucket %d: %w", i, err))
+		}
+	}
+	if healthy := len(e.stores) - len(errs); healthy < e.dataShards {
+		return fmt.Errorf("%d of %d shard buckets are healthy, %d are needed: %w", healthy, len(e.stores), e.dataShards, errors.Join(errs...))
+	}
+	if len(errs) > 0 {
+		e.logger.Warnw("avail.ErasureStorageService.HealthCheck degraded", "unhealthy", len(errs), "buckets", len(e.stores), "error", errors.Join(errs...))
+	}
+	return nil
+}
+
+func (e *ErasureStorageService) String() string {
+	return fmt.Sprintf("ErasureStorageService(%d of %d)", e.dataShards, len(e.stores))
+}
@@ -0,0 +1,114 @@
+package s3_storage_service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryShardStore is an in-memory bucket of shards
+type memoryShardStore struct {
+	mu     sync.Mutex
+	shards map[common.Hash][]byte
+}
+
+func newMemoryShardStores(n int) []ShardStore {
+	stores := make([]ShardStore, n)
+	for i := range stores {
+		stores[i] = &memoryShardStore{shards: make(map[common.Hash][]byte)}
+	}
+	return stores
+}
+
+func (s *memoryShardStore) Put(ctx context.Context, value []byte, timeout uint64, commitment common.Hash) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shards[commitment] = append([]byte(nil), value...)
+	return nil
+}
+
+func (s *memoryShardStore) GetByHash(ctx context.Context, key common.Hash) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	shard, ok := s.shards[key]
+	if !ok {
+		return nil, fmt.Errorf("shard %s not found", key.Hex())
+	}
+	return shard, nil
+}
+
+// corrupt flips a byte of the payload of the shard, its header stays valid
+func (s *memoryShardStore) corrupt(key common.Hash) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shards[key][shardHeaderSize] ^= 0xff
+}
+
+// truncate drops the last byte of the shard, its header stays valid
+func (s *memoryShardStore) truncate(key common.Hash) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shards[key] = s.shards[key][:len(s.shards[key])-1]
+}
+
+// ✅ Test blobs are reconstructed from the parity shards when shards are corrupted
+func TestErasureCorruptedShard(t *testing.T) {
+	ctx := context.Background()
+	stores := newMemoryShardStores(5)
+	e, err := NewErasureStorageServiceWithStores(ErasureStorageServiceConfig{DataShards: 3}, stores, nil)
+	require.NoError(t, err)
+
+	blob := bytes.Repeat([]byte("batch-1"), 100)
+	key := crypto.Keccak256Hash(blob)
+	require.NoError(t, e.Put(ctx, blob, 0, key))
+
+	for i := range stores {
+		stores[i].(*memoryShardStore).corrupt(key)
+		data, err := e.GetByHash(ctx, key)
+		require.NoError(t, err, "shard %d corrupted", i)
+		assert.Equal(t, blob, data)
+		stores[i].(*memoryShardStore).corrupt(key)
+	}
+
+	// Two corrupted shards leave one subset of valid shards
+	stores[0].(*memoryShardStore).corrupt(key)
+	stores[3].(*memoryShardStore).corrupt(key)
+	data, err := e.GetByHash(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, blob, data)
+
+	// ❌ Three corrupted shards can't be got around
+	stores[4].(*memoryShardStore).corrupt(key)
+	_, err = e.GetByHash(ctx, key)
+	assert.ErrorIs(t, err, errBlobMismatch)
+}
+
+// ✅ Test shards of the wrong length are dropped before reconstructing the blob
+func TestErasureTruncatedShard(t *testing.T) {
+	ctx := context.Background()
+	stores := newMemoryShardStores(5)
+	e, err := NewErasureStorageServiceWithStores(ErasureStorageServiceConfig{DataShards: 3}, stores, nil)
+	require.NoError(t, err)
+
+	blob := bytes.Repeat([]byte("batch-1"), 100)
+	key := crypto.Keccak256Hash(blob)
+	require.NoError(t, e.Put(ctx, blob, 0, key))
+
+	stores[0].(*memoryShardStore).truncate(key)
+	stores[2].(*memoryShardStore).truncate(key)
+	data, err := e.GetByHash(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, blob, data)
+
+	// ❌ Three truncated shards leave too few shards
+	stores[4].(*memoryShardStore).truncate(key)
+	_, err = e.GetByHash(ctx, key)
+	assert.ErrorIs(t, err, ErrNotEnoughShards)
+}
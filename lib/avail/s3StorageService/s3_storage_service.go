@@ -3,9 +3,11 @@ package s3_storage_service
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"math"
+	"slices"
 	"sync"
 	"time"
 
@@ -15,13 +17,27 @@ import (
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 
 	flag "github.com/spf13/pflag"
+
+	"github.com/availproject/cdk-avail-da-server/pkg/s3object"
+	"github.com/availproject/cdk-avail-da-server/pkg/storagekey"
 )
 
+var ErrReadOnly = errors.New("S3 storage service uses anonymous access and is read-only")
+
+// Logger is the structured logger used by the service, *log.Logger implements it
+type Logger interface {
+	Debugw(msg string, kv ...interface{})
+	Infow(msg string, kv ...interface{})
+	Warnw(msg string, kv ...interface{})
+	Errorw(msg string, kv ...interface{})
+}
+
 type S3Uploader interface {
 	Upload(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error)
 }
@@ -39,53 +55,228 @@ type S3StorageServiceConfig struct {
 	SecretKey           string `mapstructure:"SecretKey"`
 	DiscardAfterTimeout bool   `mapstructure:"DiscardAfterTimeout"`
 	Concurrency         int    `mapstructure:"Concurrency"`
+	// Multipart upload and ranged download tuning for large sequence blobs
+	UploadPartSize      int64 `mapstructure:"UploadPartSize"`
+	UploadConcurrency   int   `mapstructure:"UploadConcurrency"`
+	DownloadPartSize    int64 `mapstructure:"DownloadPartSize"`
+	DownloadConcurrency int   `mapstructure:"DownloadConcurrency"`
+	// Send unsigned requests, for reading public buckets. Writes are rejected.
+	Anonymous bool `mapstructure:"Anonymous"`
+	// Object key layout, flat (default) or sharded
+	KeyLayout string `mapstructure:"KeyLayout"`
+	// Upload options, empty values keep the bucket defaults
+	ServerSideEncryption string `mapstructure:"ServerSideEncryption"`
+	SSEKMSKeyId          string `mapstructure:"SSEKMSKeyId"`
+	StorageClass         string `mapstructure:"StorageClass"`
+	ChecksumAlgorithm    string `mapstructure:"ChecksumAlgorithm"`
+	// Replica read when the primary bucket fails, the region defaults to Region
+	SecondaryBucket string `mapstructure:"SecondaryBucket"`
+	SecondaryRegion string `mapstructure:"SecondaryRegion"`
+	// Network and ChainID resolve the {network} and {chainid} placeholders of
+	// ObjectPrefix, so networks sharing a bucket store their objects apart
+	Network string `mapstructure:"Network"`
+	ChainID uint64 `mapstructure:"ChainID"`
+}
+
+// UploadOptions are applied to every uploaded object
+type UploadOptions struct {
+	ServerSideEncryption string
+	SSEKMSKeyId          string
+	StorageClass         string
+	ChecksumAlgorithm    string
+}
+
+// Validate checks the options against the values supported by S3
+func (o UploadOptions) Validate() error {
+	if o.ServerSideEncryption != "" && !slices.Contains(types.ServerSideEncryption("").Values(), types.ServerSideEncryption(o.ServerSideEncryption)) {
+		return fmt.Errorf("invalid server side encryption %q, expected one of %v", o.ServerSideEncryption, types.ServerSideEncryption("").Values())
+	}
+	if o.SSEKMSKeyId != "" && types.ServerSideEncryption(o.ServerSideEncryption) != types.ServerSideEncryptionAwsKms {
+		return fmt.Errorf("a KMS key id requires server side encryption %s", types.ServerSideEncryptionAwsKms)
+	}
+	if o.StorageClass != "" && !slices.Contains(types.StorageClass("").Values(), types.StorageClass(o.StorageClass)) {
+		return fmt.Errorf("invalid storage class %q, expected one of %v", o.StorageClass, types.StorageClass("").Values())
+	}
+	if o.ChecksumAlgorithm != "" && !slices.Contains(types.ChecksumAlgorithm("").Values(), types.ChecksumAlgorithm(o.ChecksumAlgorithm)) {
+		return fmt.Errorf("invalid checksum algorithm %q, expected one of %v", o.ChecksumAlgorithm, types.ChecksumAlgorithm("").Values())
+	}
+	return nil
+}
+
+// Apply sets the options on the upload input
+func (o UploadOptions) Apply(input *s3.PutObjectInput) {
+	if o.ServerSideEncryption != "" {
+		input.ServerSideEncryption = types.ServerSideEncryption(o.ServerSideEncryption)
+	}
+	if o.SSEKMSKeyId != "" {
+		input.SSEKMSKeyId = aws.String(o.SSEKMSKeyId)
+	}
+	if o.StorageClass != "" {
+		input.StorageClass = types.StorageClass(o.StorageClass)
+	}
+	if o.ChecksumAlgorithm != "" {
+		input.ChecksumAlgorithm = types.ChecksumAlgorithm(o.ChecksumAlgorithm)
+	}
 }
 
+// Object key layouts, aliases of the storagekey layouts
+const (
+	KeyLayoutFlat    = storagekey.LayoutFlat
+	KeyLayoutSharded = storagekey.LayoutSharded
+)
+
 var DefaultS3StorageServiceConfig = S3StorageServiceConfig{
-	Enable: false,
+	Enable:              false,
+	UploadPartSize:      manager.DefaultUploadPartSize,
+	UploadConcurrency:   manager.DefaultUploadConcurrency,
+	DownloadPartSize:    manager.DefaultDownloadPartSize,
+	DownloadConcurrency: manager.DefaultDownloadConcurrency,
+	KeyLayout:           KeyLayoutFlat,
 }
 
 func S3ConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.Bool(prefix+".Enable", DefaultS3StorageServiceConfig.Enable, "enable storage/retrieval of sequencer batch data from an AWS S3 bucket")
 	f.String(prefix+".AccessKey", DefaultS3StorageServiceConfig.AccessKey, "S3 access key")
 	f.String(prefix+".Bucket", DefaultS3StorageServiceConfig.Bucket, "S3 bucket")
-	f.String(prefix+".ObjectPrefix", DefaultS3StorageServiceConfig.ObjectPrefix, "prefix to add to S3 objects")
+	f.String(prefix+".ObjectPrefix", DefaultS3StorageServiceConfig.ObjectPrefix, "prefix to add to S3 objects, {network} and {chainid} are replaced by Network and ChainID")
 	f.String(prefix+".Region", DefaultS3StorageServiceConfig.Region, "S3 region")
 	f.String(prefix+".SecretKey", DefaultS3StorageServiceConfig.SecretKey, "S3 secret key")
 	f.Bool(prefix+".DiscardAfterTimeout", DefaultS3StorageServiceConfig.DiscardAfterTimeout, "discard data after its expiry timeout")
 	f.Int(prefix+".Concurrency", DefaultS3StorageServiceConfig.Concurrency, "number of concurrent S3 requests to make when uploading/downloading multiple items")
+	f.Int64(prefix+".UploadPartSize", DefaultS3StorageServiceConfig.UploadPartSize, "part size in bytes used for multipart uploads of large objects (minimum 5MiB)")
+	f.Int(prefix+".UploadConcurrency", DefaultS3StorageServiceConfig.UploadConcurrency, "number of parts of a single object uploaded in parallel")
+	f.Int64(prefix+".DownloadPartSize", DefaultS3StorageServiceConfig.DownloadPartSize, "size in bytes of the ranges large objects are downloaded in")
+	f.Int(prefix+".DownloadConcurrency", DefaultS3StorageServiceConfig.DownloadConcurrency, "number of ranges of a single object downloaded in parallel")
+	f.Bool(prefix+".Anonymous", DefaultS3StorageServiceConfig.Anonymous, "read a public bucket without credentials, uploads are rejected")
+	f.String(prefix+".ServerSideEncryption", DefaultS3StorageServiceConfig.ServerSideEncryption, "server side encryption of uploaded objects, AES256 or aws:kms")
+	f.String(prefix+".SSEKMSKeyId", DefaultS3StorageServiceConfig.SSEKMSKeyId, "KMS key id used with aws:kms server side encryption")
+	f.String(prefix+".StorageClass", DefaultS3StorageServiceConfig.StorageClass, "storage class of uploaded objects, e.g. STANDARD_IA or GLACIER_IR")
+	f.String(prefix+".ChecksumAlgorithm", DefaultS3StorageServiceConfig.ChecksumAlgorithm, "checksum algorithm of uploaded objects, e.g. CRC32C or SHA256, validated on download")
+	f.String(prefix+".SecondaryBucket", DefaultS3StorageServiceConfig.SecondaryBucket, "replica S3 bucket read when a read from the primary bucket fails")
+	f.String(prefix+".SecondaryRegion", DefaultS3StorageServiceConfig.SecondaryRegion, "region of the replica S3 bucket, defaults to the primary region")
+	f.String(prefix+".Network", DefaultS3StorageServiceConfig.Network, "network name the {network} placeholder of the object prefix is replaced by, e.g. cardona")
+	f.Uint64(prefix+".ChainID", DefaultS3StorageServiceConfig.ChainID, "chain id the {chainid} placeholder of the object prefix is replaced by")
+	f.String(prefix+".KeyLayout", DefaultS3StorageServiceConfig.KeyLayout, "object key layout, flat (prefix/hash) or sharded (prefix/aa/bb/hash), flat keys are still read with the sharded layout")
 }
 
 type S3StorageService struct {
-	logger              *log.Logger
+	logger              Logger
 	client              *s3.Client
 	bucket              string
-	objectPrefix        string
 	uploader            S3Uploader
 	downloader          S3Downloader
 	discardAfterTimeout bool
 	concurrency         int
+	// throttle adapts the concurrency of uploads to SlowDown responses of S3
+	throttle  *Throttle
+	anonymous bool
+	// keys encodes the object keys under the prefix in the key layout
+	keys                storagekey.Codec
+	uploadOptions       UploadOptions
+	secondaryBucket     string
+	secondaryDownloader S3Downloader
 }
 
-func NewS3StorageService(config S3StorageServiceConfig, logger *log.Logger) (*S3StorageService, error) {
-	client, err := buildS3Client(config.AccessKey, config.SecretKey, config.Region)
+// NewS3StorageService creates the service, a nil logger uses the default logger
+func NewS3StorageService(config S3StorageServiceConfig, logger Logger) (*S3StorageService, error) {
+	if logger == nil {
+		logger = log.GetDefaultLogger()
+	}
+	objectPrefix, err := storagekey.ResolvePrefix(config.ObjectPrefix, config.Network, config.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := storagekey.NewCodec(objectPrefix, config.KeyLayout)
 	if err != nil {
 		return nil, err
 	}
+	client, err := buildS3Client(config.AccessKey, config.SecretKey, config.Region, config.Anonymous)
+	if err != nil {
+		return nil, err
+	}
+	uploadOptions := UploadOptions{
+		ServerSideEncryption: config.ServerSideEncryption,
+		SSEKMSKeyId:          config.SSEKMSKeyId,
+		StorageClass:         config.StorageClass,
+		ChecksumAlgorithm:    config.ChecksumAlgorithm,
+	}
+	if err := uploadOptions.Validate(); err != nil {
+		return nil, err
+	}
+	partSize := config.UploadPartSize
+	if partSize <= 0 {
+		partSize = manager.DefaultUploadPartSize
+	}
+	if partSize < manager.MinUploadPartSize {
+		return nil, fmt.Errorf("upload part size must be at least %d bytes, got %d", manager.MinUploadPartSize, partSize)
+	}
+	uploadConcurrency := config.UploadConcurrency
+	if uploadConcurrency <= 0 {
+		uploadConcurrency = manager.DefaultUploadConcurrency
+	}
+	uploader := manager.NewUploader(client, func(u *manager.Uploader) {
+		u.PartSize = partSize
+		u.Concurrency = uploadConcurrency
+	})
+	downloadPartSize := config.DownloadPartSize
+	if downloadPartSize <= 0 {
+		downloadPartSize = manager.DefaultDownloadPartSize
+	}
+	downloadConcurrency := config.DownloadConcurrency
+	if downloadConcurrency <= 0 {
+		downloadConcurrency = manager.DefaultDownloadConcurrency
+	}
+	downloaderOptions := func(d *manager.Downloader) {
+		d.PartSize = downloadPartSize
+		d.Concurrency = downloadConcurrency
+	}
+	logger.Infow("avail.S3StorageService.New", "config", config.redacted())
+	var secondaryDownloader S3Downloader
+	if config.SecondaryBucket != "" {
+		secondaryRegion := config.SecondaryRegion
+		if secondaryRegion == "" {
+			secondaryRegion = config.Region
+		}
+		secondaryClient, err := buildS3Client(config.AccessKey, config.SecretKey, secondaryRegion, config.Anonymous)
+		if err != nil {
+			return nil, err
+		}
+		secondaryDownloader = manager.NewDownloader(s3object.CheckedClient(secondaryClient), downloaderOptions)
+	}
+	concurrency := config.Concurrency
+	if concurrency <= 0 {
+		concurrency = 5
+	}
+	throttle := NewThrottle(concurrency, func(limit int, throttled bool) {
+		if throttled {
+			logger.Warnw("avail.S3StorageService throttled by S3, lowering the upload concurrency", "concurrency", limit)
+		} else {
+			logger.Infow("avail.S3StorageService raising the upload concurrency", "concurrency", limit)
+		}
+	})
 	return &S3StorageService{
 		logger:              logger,
 		client:              client,
 		bucket:              config.Bucket,
-		objectPrefix:        config.ObjectPrefix,
-		uploader:            manager.NewUploader(client),
-		downloader:          manager.NewDownloader(client),
+		uploader:            uploader,
+		downloader:          manager.NewDownloader(s3object.CheckedClient(client), downloaderOptions),
 		discardAfterTimeout: config.DiscardAfterTimeout,
 		concurrency:         config.Concurrency,
+		throttle:            throttle,
+		anonymous:           config.Anonymous,
+		keys:                keys,
+		uploadOptions:       uploadOptions,
+		secondaryBucket:     config.SecondaryBucket,
+		secondaryDownloader: secondaryDownloader,
 	}, nil
 }
 
-func buildS3Client(accessKey, secretKey, region string) (*s3.Client, error) {
+func buildS3Client(accessKey, secretKey, region string, anonymous bool) (*s3.Client, error) {
 	cfg, err := awsConfig.LoadDefaultConfig(context.TODO(), awsConfig.WithRegion(region), func(options *awsConfig.LoadOptions) error {
+		if anonymous {
+			options.Credentials = aws.AnonymousCredentials{}
+			return nil
+		}
 		// remain backward compatible with accessKey and secretKey credentials provided via cli flags
 		if accessKey != "" && secretKey != "" {
 			options.Credentials = credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")
@@ -99,14 +290,52 @@ func buildS3Client(accessKey, secretKey, region string) (*s3.Client, error) {
 }
 
 func (s3s *S3StorageService) GetByHash(ctx context.Context, key common.Hash) ([]byte, error) {
-	s3s.logger.Debugf("avail.S3StorageService.GetByHash key=%s this=%v", prettyHash(key), s3s)
+	s3s.logger.Debugw("avail.S3StorageService.GetByHash", "key", prettyHash(key), "this", s3s)
 
-	buf := manager.NewWriteAtBuffer([]byte{})
-	_, err := s3s.downloader.Download(ctx, buf, &s3.GetObjectInput{
-		Bucket: aws.String(s3s.bucket),
-		Key:    aws.String(s3s.objectPrefix + EncodeStorageServiceKey(key)),
-	})
-	return buf.Bytes(), err
+	data, err := s3s.download(ctx, s3s.downloader, s3s.bucket, key)
+	if err == nil || s3s.secondaryDownloader == nil || ctx.Err() != nil {
+		return data, err
+	}
+	s3s.logger.Warnw("avail.S3StorageService.GetByHash primary bucket failed, reading from secondary bucket", "key", prettyHash(key), "bucket", s3s.secondaryBucket, "error", err)
+	data, secondaryErr := s3s.download(ctx, s3s.secondaryDownloader, s3s.secondaryBucket, key)
+	if secondaryErr != nil {
+		return nil, fmt.Errorf("primary bucket: %w, secondary bucket: %w", err, secondaryErr)
+	}
+	return data, nil
+}
+
+// download reads the object of key from the bucket. The checksum S3 stored with the
+// object is validated by the SDK, so data corrupted on the network is rejected here.
+// Objects downloaded in ranges are only validated when they were uploaded in one part.
+// Parts shorter than their Content-Length are retried by the downloader, so truncated
+// downloads fail instead of returning short blobs.
+func (s3s *S3StorageService) download(ctx context.Context, downloader S3Downloader, bucket string, key common.Hash) ([]byte, error) {
+	var err error
+	for _, objectKey := range s3s.readKeys(key) {
+		buf := manager.NewWriteAtBuffer([]byte{})
+		_, err = downloader.Download(ctx, buf, &s3.GetObjectInput{
+			Bucket:       aws.String(bucket),
+			Key:          aws.String(objectKey),
+			ChecksumMode: types.ChecksumModeEnabled,
+		})
+		if err == nil {
+			s3s.logger.Debugw("avail.S3StorageService.download", "bucket", bucket, "objectKey", objectKey, "size", len(buf.Bytes()))
+			return buf.Bytes(), nil
+		}
+		s3s.logger.Debugw("avail.S3StorageService.download failed", "bucket", bucket, "objectKey", objectKey, "error", err)
+	}
+	return nil, err
+}
+
+// objectKey returns the key objects are written to
+func (s3s *S3StorageService) objectKey(key common.Hash) string {
+	return s3s.keys.Key(key)
+}
+
+// readKeys returns the keys an object may be stored under, objects written before
+// switching to the sharded layout are still found under the flat key
+func (s3s *S3StorageService) readKeys(key common.Hash) []string {
+	return s3s.keys.ReadKeys(key)
 }
 
 func (s3s *S3StorageService) GetMultipleByHash(ctx context.Context, keys []common.Hash) ([][]byte, error) {
@@ -163,22 +392,39 @@ func (s3s *S3StorageService) GetMultipleByHash(ctx context.Context, keys []commo
 	return data, finalErr
 }
 
+// Put uploads the value under the given commitment. Values larger than UploadPartSize
+// are sent as a multipart upload of UploadConcurrency parts at a time.
 func (s3s *S3StorageService) Put(ctx context.Context, value []byte, timeout uint64, commitment common.Hash) error {
 	logPut("avail.S3StorageService.Store", value, timeout, s3s)
+	if s3s.anonymous {
+		return ErrReadOnly
+	}
+	body := bytes.NewReader(value)
 	putObjectInput := s3.PutObjectInput{
 		Bucket: aws.String(s3s.bucket),
-		Key:    aws.String(s3s.objectPrefix + EncodeStorageServiceKey(commitment)),
-		Body:   bytes.NewReader(value)}
+		Key:    aws.String(s3s.objectKey(commitment)),
+		Body:   body}
 	if s3s.discardAfterTimeout && timeout <= math.MaxInt64 {
 		// #nosec G115
 		expires := time.Unix(int64(timeout), 0)
 		putObjectInput.Expires = &expires
 	}
-	_, err := s3s.uploader.Upload(ctx, &putObjectInput)
+	s3s.uploadOptions.Apply(&putObjectInput)
+	// A SlowDown response doesn't fail the upload, it is sent again once the throttle
+	// backed off
+	err := s3s.throttle.Do(ctx, func() error {
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		_, err := s3s.uploader.Upload(ctx, &putObjectInput)
+		return err
+	})
 	if err != nil {
-		s3s.logger.Errorf("avail.S3StorageService.Store error=%v", err)
+		s3s.logger.Errorw("avail.S3StorageService.Store", "objectKey", *putObjectInput.Key, "error", err)
+		return err
 	}
-	return err
+	s3s.logger.Debugw("avail.S3StorageService.Store uploaded", "bucket", s3s.bucket, "objectKey", *putObjectInput.Key)
+	return nil
 }
 
 func (s3s *S3StorageService) PutMultiple(ctx context.Context, values [][]byte) error {
@@ -238,27 +484,34 @@ func (s3s *S3StorageService) String() string {
 
 func (s3s *S3StorageService) HealthCheck(ctx context.Context) error {
 	_, err := s3s.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(s3s.bucket)})
+	if err != nil {
+		s3s.logger.Debugw("avail.S3StorageService.HealthCheck failed", "bucket", s3s.bucket, "error", err)
+	}
 	return err
 }
 
-func EncodeStorageServiceKey(key common.Hash) string {
-	return key.Hex()[2:]
+// redacted returns a copy of the config that is safe to log
+func (c S3StorageServiceConfig) redacted() S3StorageServiceConfig {
+	c.AccessKey = redact(c.AccessKey)
+	c.SecretKey = redact(c.SecretKey)
+	c.SSEKMSKeyId = redact(c.SSEKMSKeyId)
+	return c
 }
 
-func logPut(store string, data []byte, timeout uint64, reader *S3StorageService, more ...interface{}) {
-	if len(more) == 0 {
-		// #nosec G115
-		reader.logger.Debugf(
-			"%s message=%s timeout=%s this=%v",
-			store, firstFewBytes(data), time.Unix(int64(timeout), 0), reader,
-		)
-	} else {
-		// #nosec G115
-		reader.logger.Debugf(
-			"%s message=%s timeout=%s this=%v %v",
-			store, firstFewBytes(data), time.Unix(int64(timeout), 0), reader, more,
-		)
+func redact(secret string) string {
+	if secret == "" {
+		return ""
 	}
+	return "<redacted>"
+}
+
+// Deprecated: use storagekey.Encode.
+func EncodeStorageServiceKey(key common.Hash) string { return storagekey.Encode(key) }
+
+func logPut(store string, data []byte, timeout uint64, reader *S3StorageService, more ...interface{}) {
+	// #nosec G115
+	kv := []interface{}{"message", firstFewBytes(data), "size", len(data), "timeout", time.Unix(int64(timeout), 0), "this", reader}
+	reader.logger.Debugw(store, append(kv, more...)...)
 }
 
 func prettyHash(hash common.Hash) string {
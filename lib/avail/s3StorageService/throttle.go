@@ -0,0 +1,165 @@
+package s3_storage_service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+)
+
+// Bounds of the pause after S3 throttled a request
+const (
+	minThrottleBackoff = 500 * time.Millisecond
+	maxThrottleBackoff = 30 * time.Second
+)
+
+// maxThrottledAttempts bounds the attempts of a request S3 keeps throttling
+const maxThrottledAttempts = 10
+
+// throttleCodes are the error codes S3 and S3 compatible stores return when the
+// request rate of a prefix or of the bucket is too high
+var throttleCodes = map[string]bool{
+	"SlowDown":                 true,
+	"ServiceUnavailable":       true,
+	"RequestLimitExceeded":     true,
+	"Throttling":               true,
+	"ThrottlingException":      true,
+	"TooManyRequestsException": true,
+}
+
+// IsThrottled returns whether err is a SlowDown or 503 response of S3
+func IsThrottled(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && throttleCodes[apiErr.ErrorCode()] {
+		return true
+	}
+	var respErr *awshttp.ResponseError
+	return errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusServiceUnavailable
+}
+
+// Throttle bounds the number of concurrent S3 requests and adapts it to throttling:
+// a throttled request halves the limit and pauses every request for a growing
+// backoff, then each run of limit successful requests raises the limit by one until
+// it is back at its maximum.
+type Throttle struct {
+	mu        sync.Mutex
+	max       int
+	limit     int
+	inFlight  int
+	successes int
+	backoff   time.Duration
+	pausedTo  time.Time
+	// changed is closed and replaced when a slot is released or the limit changes
+	changed chan struct{}
+	// onAdjust is called with the new limit when it changes, may be nil
+	onAdjust func(limit int, throttled bool)
+}
+
+// NewThrottle returns a throttle allowing up to maxConcurrency concurrent requests,
+// onAdjust is called when throttling lowers the limit and when it is raised again
+func NewThrottle(maxConcurrency int, onAdjust func(limit int, throttled bool)) *Throttle {
+	if maxConcurrency <= 0 {
+		maxConcurrency = 1
+	}
+	return &Throttle{max: maxConcurrency, limit: maxConcurrency, changed: make(chan struct{}), onAdjust: onAdjust}
+}
+
+// Limit returns the current number of concurrent requests allowed
+func (t *Throttle) Limit() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limit
+}
+
+// Do calls fn in one of the slots of the throttle. Throttled calls are retried after
+// the backoff, other errors are returned as they are.
+func (t *Throttle) Do(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 0; attempt < maxThrottledAttempts; attempt++ {
+		if err := t.acquire(ctx); err != nil {
+			return err
+		}
+		err = fn()
+		throttled := IsThrottled(err)
+		t.release(throttled)
+		if !throttled {
+			return err
+		}
+	}
+	return err
+}
+
+func (t *Throttle) acquire(ctx context.Context) error {
+	for {
+		t.mu.Lock()
+		wait := time.Until(t.pausedTo)
+		if wait <= 0 && t.inFlight < t.limit {
+			t.inFlight++
+			t.mu.Unlock()
+			return nil
+		}
+		changed := t.changed
+		t.mu.Unlock()
+
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			expired = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return ctx.Err()
+		case <-changed:
+		case <-expired:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (t *Throttle) release(throttled bool) {
+	t.mu.Lock()
+	t.inFlight--
+	adjusted := false
+	if throttled {
+		// Requests already in flight were sent at the old rate, a single pause and
+		// halving per backoff keeps a burst of SlowDowns from collapsing the limit
+		if time.Now().After(t.pausedTo) {
+			t.backoff = min(max(2*t.backoff, minThrottleBackoff), maxThrottleBackoff)
+			t.pausedTo = time.Now().Add(t.backoff)
+			t.limit = max(t.limit/2, 1)
+			t.successes = 0
+			adjusted = true
+		}
+	} else {
+		t.successes++
+		if t.limit < t.max && t.successes >= t.limit {
+			t.limit++
+			t.successes = 0
+			adjusted = true
+		}
+		if t.limit == t.max {
+			t.backoff = 0
+		}
+	}
+	limit := t.limit
+	close(t.changed)
+	t.changed = make(chan struct{})
+	t.mu.Unlock()
+
+	if adjusted && t.onAdjust != nil {
+		t.onAdjust(limit, throttled)
+	}
+}
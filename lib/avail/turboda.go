@@ -0,0 +1,104 @@
+package avail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	turboDASubmitPath   = "/v1/submit_raw_data"
+	turboDAPreImagePath = "/v1/get_pre_image"
+	turboDARequestLimit = time.Duration(60) * time.Second
+)
+
+var ErrTurboDANotConfigured = errors.New("TurboDA api url is not configured")
+
+// TurboDAClient submits and reads sequences through the TurboDA service, which takes
+// care of posting the data on Avail.
+type TurboDAClient interface {
+	// SubmitRawData returns the id TurboDA assigned to the submission.
+	SubmitRawData(ctx context.Context, data []byte) (string, error)
+	// GetPreImage returns the data of a submission.
+	GetPreImage(ctx context.Context, submissionID string) ([]byte, error)
+}
+
+type turboDASubmitResponse struct {
+	SubmissionID string `json:"submission_id"`
+}
+
+type turboDAHTTPClient struct {
+	apiUrl string
+	apiKey string
+	client *http.Client
+}
+
+// NewTurboDAClient returns a TurboDAClient talking to the TurboDA http api.
+func NewTurboDAClient(apiUrl string, apiKey string) TurboDAClient {
+	return newTurboDAClient(apiUrl, apiKey, http.DefaultTransport)
+}
+
+func newTurboDAClient(apiUrl string, apiKey string, transport http.RoundTripper) TurboDAClient {
+	return &turboDAHTTPClient{
+		apiUrl: apiUrl,
+		apiKey: apiKey,
+		client: &http.Client{Transport: transport, Timeout: turboDARequestLimit},
+	}
+}
+
+func (c *turboDAHTTPClient) SubmitRawData(ctx context.Context, data []byte) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiUrl+turboDASubmitPath, bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("x-api-key", c.apiKey)
+
+	body, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+
+	var resp turboDASubmitResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("cannot unmarshal TurboDA response:%w", err)
+	}
+	if resp.SubmissionID == "" {
+		return "", fmt.Errorf("TurboDA response is missing the submission id")
+	}
+	return resp.SubmissionID, nil
+}
+
+func (c *turboDAHTTPClient) GetPreImage(ctx context.Context, submissionID string) ([]byte, error) {
+	query := url.Values{"submission_id": {submissionID}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiUrl+turboDAPreImagePath+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("x-api-key", c.apiKey)
+
+	return c.do(req)
+}
+
+func (c *turboDAHTTPClient) do(req *http.Request) ([]byte, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("TurboDA request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read body:%w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("TurboDA request failed, status: %d, body: %s", resp.StatusCode, body)
+	}
+	return body, nil
+}
@@ -1,6 +1,7 @@
 package avail
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
 	"reflect"
@@ -17,12 +18,94 @@ var (
 	byte32ArrayType = abi.Type{T: abi.SliceTy, Elem: &abi.Type{T: abi.FixedBytesTy, Size: 32}}
 	uint256Type     = abi.Type{Size: 256, T: abi.UintTy}
 	bytesType       = abi.Type{T: abi.BytesTy}
+	stringType      = abi.Type{T: abi.StringTy}
 )
 
 // -------------------- Envelope --------------------
 const (
 	DAM_TYPE_BLOB_POINTER = 0x01
 	DAM_TYPE_MERKLE_PROOF = 0x02
+	// Sequence submitted through TurboDA, referenced by submission id
+	DAM_TYPE_TURBO_SUBMISSION = 0x03
+)
+
+// Envelope versions
+//
+// Version 0 is the original (messageType, payload) layout and carries no version
+// field, version 1 is (version, messageType, payload). The two are told apart by the
+// second ABI word, which is the payload offset (0x40) in version 0 and the message
+// type in version 1. Message types are therefore limited to maxMessageType.
+const (
+	ENVELOPE_VERSION0 = 0x00
+	ENVELOPE_VERSION1 = 0x01
+
+	LatestEnvelopeVersion = ENVELOPE_VERSION1
+	maxMessageType        = 0x3f
+)
+
+// MessageType describes a registered data availability message type.
+type MessageType struct {
+	Name string
+	// Envelope version the type is packed with, types understood by already deployed
+	// verifiers stay on version 0
+	EnvelopeVersion uint8
+}
+
+var messageTypes = map[uint8]MessageType{
+	DAM_TYPE_BLOB_POINTER: {Name: "blob-pointer", EnvelopeVersion: ENVELOPE_VERSION0},
+	DAM_TYPE_MERKLE_PROOF: {Name: "merkle-proof", EnvelopeVersion: ENVELOPE_VERSION0},
+	// Not understood by existing verifiers, so it is only ever sent in a versioned envelope
+	DAM_TYPE_TURBO_SUBMISSION: {Name: "turbo-submission", EnvelopeVersion: ENVELOPE_VERSION1},
+}
+
+// RegisterMessageType adds a message type to the registry, it is meant to be called
+// from init functions.
+func RegisterMessageType(msgType uint8, info MessageType) error {
+	if msgType == 0 || msgType > maxMessageType {
+		return fmt.Errorf("message type %d out of range [1, %d]", msgType, maxMessageType)
+	}
+	if info.EnvelopeVersion > LatestEnvelopeVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedEnvelopeVersion, info.EnvelopeVersion)
+	}
+	if existing, ok := messageTypes[msgType]; ok {
+		return fmt.Errorf("message type %d already registered as %s", msgType, existing.Name)
+	}
+	messageTypes[msgType] = info
+	return nil
+}
+
+// LookupMessageType returns the registered description of msgType.
+func LookupMessageType(msgType uint8) (MessageType, bool) {
+	info, ok := messageTypes[msgType]
+	return info, ok
+}
+
+// Envelope is a decoded data availability message.
+type Envelope struct {
+	Version uint8
+	MsgType uint8
+	Payload []byte
+}
+
+const (
+	abiWordSize = 32
+	// uint8 word + bytes offset word + bytes length word
+	minEnvelopeSize = 3 * abiWordSize
+	// uint8 + uint32 + uint32 + bytes32, all static
+	blobPointerSize = 4 * abiWordSize
+	// tuple offset word + 8 head words + 2 empty array length words
+	minMerkleProofInputSize = 11 * abiWordSize
+	// Merkle proofs are bounded by the tree depth, anything above is malformed
+	maxMerkleProofLength = 64
+)
+
+var (
+	ErrInvalidEnvelope            = errors.New("invalid data availability message envelope")
+	ErrUnsupportedEnvelopeVersion = errors.New("unsupported data availability message envelope version")
+	ErrUnknownMessageType         = errors.New("unknown data availability message type")
+	ErrInvalidBlobPointer         = errors.New("invalid blob pointer")
+	ErrInvalidMerkleProofInput    = errors.New("invalid merkle proof input")
+	ErrInvalidTurboSubmission     = errors.New("invalid turbo submission")
 )
 
 var envelopeArgs = abi.Arguments{
@@ -30,6 +113,12 @@ var envelopeArgs = abi.Arguments{
 	{Type: bytesType}, // payload
 }
 
+var versionedEnvelopeArgs = abi.Arguments{
+	{Type: unit8Type}, // version
+	{Type: unit8Type}, // messageType
+	{Type: bytesType}, // payload
+}
+
 // -------------------- MerkleProofInput --------------------
 type MerkleProofInput struct {
 	DataRootProof [][32]byte `abi:"dataRootProof"`
@@ -99,15 +188,29 @@ func (m *MerkleProofInput) EnodeToBinary() ([]byte, error) {
 	return merkleProofInputArguments.Pack(m)
 }
 
-func (m *MerkleProofInput) DecodeFromBinary(data []byte) error {
+func (m *MerkleProofInput) DecodeFromBinary(data []byte) (err error) {
+	if len(data) < minMerkleProofInputSize || len(data)%abiWordSize != 0 {
+		return fmt.Errorf("%w: unexpected length %d", ErrInvalidMerkleProofInput, len(data))
+	}
+	defer recoverDecodePanic(ErrInvalidMerkleProofInput, &err)
+
 	unpackedData, err := merkleProofInputArguments.Unpack(data)
 	if err != nil {
-		return fmt.Errorf("unable to convert the data bytes to merkleProofInput. error:%w", err)
+		return fmt.Errorf("%w: unable to convert the data bytes to merkleProofInput. error:%w", ErrInvalidMerkleProofInput, err)
+	}
+	if len(unpackedData) != 1 {
+		return fmt.Errorf("%w: expected 1 value, got %d", ErrInvalidMerkleProofInput, len(unpackedData))
 	}
 
 	decoded, ok := unpackedData[0].(MerkleProofInput)
 	if !ok {
-		return fmt.Errorf("unexpected type in unpacked data")
+		return fmt.Errorf("%w: unexpected type in unpacked data", ErrInvalidMerkleProofInput)
+	}
+	if decoded.DataRootIndex == nil || decoded.LeafIndex == nil {
+		return fmt.Errorf("%w: missing data root or leaf index", ErrInvalidMerkleProofInput)
+	}
+	if len(decoded.DataRootProof) > maxMerkleProofLength || len(decoded.LeafProof) > maxMerkleProofLength {
+		return fmt.Errorf("%w: proof too long, data_root_proof=%d leaf_proof=%d", ErrInvalidMerkleProofInput, len(decoded.DataRootProof), len(decoded.LeafProof))
 	}
 
 	*m = decoded
@@ -153,15 +256,35 @@ func (b *BlobPointer) MarshalToBinary() ([]byte, error) {
 	return packedData, nil
 }
 
-func (b *BlobPointer) UnmarshalFromBinary(data []byte) error {
+func (b *BlobPointer) UnmarshalFromBinary(data []byte) (err error) {
+	if len(data) != blobPointerSize {
+		return fmt.Errorf("%w: expected %d bytes, got %d", ErrInvalidBlobPointer, blobPointerSize, len(data))
+	}
+	defer recoverDecodePanic(ErrInvalidBlobPointer, &err)
+
 	unpackedData, err := blobPointerArguments.UnpackValues(data)
 	if err != nil {
-		return fmt.Errorf("unable to covert the data bytes into blobPointer and getting error:%w", err)
+		return fmt.Errorf("%w: unable to covert the data bytes into blobPointer and getting error:%w", ErrInvalidBlobPointer, err)
+	}
+	if len(unpackedData) != len(blobPointerArguments) {
+		return fmt.Errorf("%w: expected %d values, got %d", ErrInvalidBlobPointer, len(blobPointerArguments), len(unpackedData))
+	}
+
+	version, ok1 := unpackedData[0].(uint8)
+	blockHeight, ok2 := unpackedData[1].(uint32)
+	extrinsicIndex, ok3 := unpackedData[2].(uint32)
+	commitment, ok4 := unpackedData[3].([32]uint8)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return fmt.Errorf("%w: unexpected types in unpacked data", ErrInvalidBlobPointer)
+	}
+	if version > BLOBPOINTER_VERSION4 {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidBlobPointer, version)
 	}
-	b.Version = unpackedData[0].(uint8)
-	b.BlockHeight = unpackedData[1].(uint32)
-	b.ExtrinsicIndex = unpackedData[2].(uint32)
-	b.BlobDataKeccak265H = unpackedData[3].([32]uint8)
+
+	b.Version = version
+	b.BlockHeight = blockHeight
+	b.ExtrinsicIndex = extrinsicIndex
+	b.BlobDataKeccak265H = commitment
 	return nil
 }
 
@@ -175,19 +298,172 @@ func (bp *BlobPointer) String() string {
 	)
 }
 
+// -------------------- TurboSubmission --------------------
+// TurboSubmission version
+const (
+	TURBO_SUBMISSION_VERSION0 = 0x00
+)
+
+// Submission ids are uuids, anything far longer is malformed
+const maxTurboSubmissionIDLength = 128
+
+// TurboSubmission references a sequence submitted to Avail through TurboDA
+type TurboSubmission struct {
+	Version      uint8
+	SubmissionID string      // id returned by TurboDA for the submission
+	Commitment   common.Hash // Keccak256(blobData) to verify the data returned by TurboDA
+}
+
+var turboSubmissionArguments = abi.Arguments{
+	{Type: unit8Type}, {Type: stringType}, {Type: byte32Type},
+}
+
+func NewTurboSubmission(submissionID string, dataCommitment common.Hash) *TurboSubmission {
+	return &TurboSubmission{
+		Version:      TURBO_SUBMISSION_VERSION0,
+		SubmissionID: submissionID,
+		Commitment:   dataCommitment,
+	}
+}
+
+func (t *TurboSubmission) MarshalToBinary() ([]byte, error) {
+	packedData, err := turboSubmissionArguments.Pack(t.Version, t.SubmissionID, [32]byte(t.Commitment))
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert the turbo submission into bytes: %w", err)
+	}
+	return packedData, nil
+}
+
+func (t *TurboSubmission) UnmarshalFromBinary(data []byte) (err error) {
+	// uint8 + string offset + bytes32 + string length words
+	if len(data) < 4*abiWordSize || len(data)%abiWordSize != 0 {
+		return fmt.Errorf("%w: unexpected length %d", ErrInvalidTurboSubmission, len(data))
+	}
+	defer recoverDecodePanic(ErrInvalidTurboSubmission, &err)
+
+	unpackedData, err := turboSubmissionArguments.Unpack(data)
+	if err != nil {
+		return fmt.Errorf("%w: unable to convert the data bytes into turbo submission: %w", ErrInvalidTurboSubmission, err)
+	}
+	if len(unpackedData) != len(turboSubmissionArguments) {
+		return fmt.Errorf("%w: expected %d values, got %d", ErrInvalidTurboSubmission, len(turboSubmissionArguments), len(unpackedData))
+	}
+
+	version, ok1 := unpackedData[0].(uint8)
+	submissionID, ok2 := unpackedData[1].(string)
+	commitment, ok3 := unpackedData[2].([32]uint8)
+	if !ok1 || !ok2 || !ok3 {
+		return fmt.Errorf("%w: unexpected types in unpacked data", ErrInvalidTurboSubmission)
+	}
+	if version > TURBO_SUBMISSION_VERSION0 {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidTurboSubmission, version)
+	}
+	if submissionID == "" || len(submissionID) > maxTurboSubmissionIDLength {
+		return fmt.Errorf("%w: invalid submission id length %d", ErrInvalidTurboSubmission, len(submissionID))
+	}
+
+	t.Version = version
+	t.SubmissionID = submissionID
+	t.Commitment = commitment
+	return nil
+}
+
+func (t *TurboSubmission) String() string {
+	return fmt.Sprintf("SubmissionID: %s,  Commitment: %s", t.SubmissionID, t.Commitment.Hex())
+}
+
 // -------------------- Envelope helpers --------------------
+
+// PackEnvelopeWithMsgType packs the payload with the envelope version registered for
+// the message type.
 func PackEnvelopeWithMsgType(msgType uint8, payload []byte) ([]byte, error) {
-	return envelopeArgs.Pack(msgType, payload)
+	info, ok := LookupMessageType(msgType)
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownMessageType, msgType)
+	}
+	return PackEnvelope(info.EnvelopeVersion, msgType, payload)
+}
+
+func PackEnvelope(version uint8, msgType uint8, payload []byte) ([]byte, error) {
+	switch version {
+	case ENVELOPE_VERSION0:
+		return envelopeArgs.Pack(msgType, payload)
+	case ENVELOPE_VERSION1:
+		return versionedEnvelopeArgs.Pack(version, msgType, payload)
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedEnvelopeVersion, version)
+	}
 }
 
 func UnpackEnvelopeForMsgType(data []byte) (uint8, []byte, error) {
-	unpacked, err := envelopeArgs.Unpack(data)
+	envelope, err := UnpackEnvelope(data)
 	if err != nil {
-		return 0, nil, fmt.Errorf("unpack envelope failed: %w", err)
+		return 0, nil, err
+	}
+	return envelope.MsgType, envelope.Payload, nil
+}
+
+// UnpackEnvelope decodes an envelope of any supported version. Message types that
+// are not registered are returned together with ErrUnknownMessageType so callers can
+// still inspect them.
+func UnpackEnvelope(data []byte) (envelope Envelope, err error) {
+	if len(data) < minEnvelopeSize || len(data)%abiWordSize != 0 {
+		return Envelope{}, fmt.Errorf("%w: unexpected length %d", ErrInvalidEnvelope, len(data))
+	}
+	defer recoverDecodePanic(ErrInvalidEnvelope, &err)
+
+	legacyOffset := new(big.Int).SetUint64(2 * abiWordSize)
+	if new(big.Int).SetBytes(data[abiWordSize:2*abiWordSize]).Cmp(legacyOffset) == 0 {
+		unpacked, err := envelopeArgs.Unpack(data)
+		if err != nil {
+			return Envelope{}, fmt.Errorf("%w: unpack envelope failed: %w", ErrInvalidEnvelope, err)
+		}
+		if len(unpacked) != len(envelopeArgs) {
+			return Envelope{}, fmt.Errorf("%w: expected %d values, got %d", ErrInvalidEnvelope, len(envelopeArgs), len(unpacked))
+		}
+		msgType, ok1 := unpacked[0].(uint8)
+		payload, ok2 := unpacked[1].([]byte)
+		if !ok1 || !ok2 {
+			return Envelope{}, fmt.Errorf("%w: unexpected types in unpacked data", ErrInvalidEnvelope)
+		}
+		envelope = Envelope{Version: ENVELOPE_VERSION0, MsgType: msgType, Payload: payload}
+	} else {
+		if len(data) < minEnvelopeSize+abiWordSize {
+			return Envelope{}, fmt.Errorf("%w: unexpected length %d", ErrInvalidEnvelope, len(data))
+		}
+		version := new(big.Int).SetBytes(data[:abiWordSize])
+		if !version.IsUint64() || version.Uint64() != ENVELOPE_VERSION1 {
+			return Envelope{}, fmt.Errorf("%w: %s", ErrUnsupportedEnvelopeVersion, version)
+		}
+		unpacked, err := versionedEnvelopeArgs.Unpack(data)
+		if err != nil {
+			return Envelope{}, fmt.Errorf("%w: unpack envelope failed: %w", ErrInvalidEnvelope, err)
+		}
+		if len(unpacked) != len(versionedEnvelopeArgs) {
+			return Envelope{}, fmt.Errorf("%w: expected %d values, got %d", ErrInvalidEnvelope, len(versionedEnvelopeArgs), len(unpacked))
+		}
+		msgType, ok1 := unpacked[1].(uint8)
+		payload, ok2 := unpacked[2].([]byte)
+		if !ok1 || !ok2 {
+			return Envelope{}, fmt.Errorf("%w: unexpected types in unpacked data", ErrInvalidEnvelope)
+		}
+		envelope = Envelope{Version: ENVELOPE_VERSION1, MsgType: msgType, Payload: payload}
+	}
+
+	if len(envelope.Payload) == 0 {
+		return Envelope{}, fmt.Errorf("%w: empty payload", ErrInvalidEnvelope)
+	}
+	if _, ok := LookupMessageType(envelope.MsgType); !ok {
+		return envelope, fmt.Errorf("%w: %d", ErrUnknownMessageType, envelope.MsgType)
+	}
+	return envelope, nil
+}
+
+// recoverDecodePanic turns a panic raised while decoding untrusted bytes into an error
+func recoverDecodePanic(kind error, err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("%w: malformed data: %v", kind, r)
 	}
-	msgType := unpacked[0].(uint8)
-	payload := unpacked[1].([]byte)
-	return msgType, payload, nil
 }
 
 // -------------------- Helpers --------------------
@@ -0,0 +1,62 @@
+package avail
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/availproject/cdk-avail-da-server/lib/avail/availattestation"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+)
+
+// vectorxABI is the part of the VectorX ABI read by the backend
+const vectorxABI = `[{"inputs":[{"internalType":"bytes32","name":"","type":"bytes32"}],"name":"dataRootCommitments","outputs":[{"internalType":"bytes32","name":"","type":"bytes32"}],"stateMutability":"view","type":"function"}]`
+
+// vectorxContract reads the data root commitments of the VectorX contract used by the
+// attestation contract. Its address is read from the attestation contract on first
+// use, so creating the backend doesn't need L1.
+type vectorxContract struct {
+	attestation *availattestation.Availattestation
+	backend     bind.ContractBackend
+
+	mu       sync.Mutex
+	contract *bind.BoundContract
+}
+
+func newVectorxContract(attestation *availattestation.Availattestation, backend bind.ContractBackend) *vectorxContract {
+	return &vectorxContract{attestation: attestation, backend: backend}
+}
+
+func (v *vectorxContract) bound(opts *bind.CallOpts) (*bind.BoundContract, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.contract != nil {
+		return v.contract, nil
+	}
+	address, err := v.attestation.Vectorx(opts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get VectorX address: %w", err)
+	}
+	parsed, err := abi.JSON(strings.NewReader(vectorxABI))
+	if err != nil {
+		return nil, err
+	}
+	v.contract = bind.NewBoundContract(address, parsed, v.backend, v.backend, v.backend)
+	return v.contract, nil
+}
+
+// DataRootCommitments returns the data root commitment of the range, zero when
+// VectorX has no commitment for it.
+func (v *vectorxContract) DataRootCommitments(opts *bind.CallOpts, rangeHash [32]byte) ([32]byte, error) {
+	contract, err := v.bound(opts)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	var out []interface{}
+	if err := contract.Call(opts, &out, "dataRootCommitments", rangeHash); err != nil {
+		return [32]byte{}, err
+	}
+	return *abi.ConvertType(out[0], new([32]byte)).(*[32]byte), nil
+}
@@ -0,0 +1,128 @@
+// Package logging holds the log level of the server and its per subsystem debug
+// traces, which can be changed at runtime through the admin API, so operators can
+// capture verbose traces of a problem without restarting and losing the repro.
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	cdklog "github.com/0xPolygon/cdk/log"
+	smithylogging "github.com/aws/smithy-go/logging"
+)
+
+// Log levels. The logs of the server are at info level, debug adds the traces of
+// every subsystem.
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+)
+
+// Subsystems whose debug traces can be enabled on their own
+const (
+	// RPC traces the params and the results of the JSON-RPC and REST requests
+	RPC = "rpc"
+	// S3 traces the responses and the retries of the S3 requests
+	S3 = "s3"
+	// Avail traces the blocks read from Avail and enables the debug logs of the Avail
+	// client
+	Avail = "avail"
+	// Bridge traces the attestations read from the L1 bridge contract
+	Bridge = "bridge"
+)
+
+// Subsystems returns the subsystems with debug traces
+func Subsystems() []string {
+	return []string{RPC, S3, Avail, Bridge}
+}
+
+var (
+	// ErrUnknownLevel is returned for levels other than debug and info
+	ErrUnknownLevel = errors.New("unknown log level, expected debug or info")
+	// ErrUnknownSubsystem is returned for subsystems without debug traces
+	ErrUnknownSubsystem = fmt.Errorf("unknown log subsystem, expected one of %v", Subsystems())
+)
+
+var (
+	// debug holds whether the traces of each subsystem are enabled
+	debug = map[string]*atomic.Bool{RPC: {}, S3: {}, Avail: {}, Bridge: {}}
+	// mu serializes the changes, so the Avail client logger follows the last one
+	mu sync.Mutex
+)
+
+// Status is the log level and the subsystems whose debug traces are enabled
+type Status struct {
+	Level string          `json:"level"`
+	Debug map[string]bool `json:"debug"`
+}
+
+// SetLevel sets the level of subsystems, of every subsystem when none is given. The
+// debug level enables their traces, info disables them.
+func SetLevel(level string, subsystems ...string) error {
+	if level != LevelDebug && level != LevelInfo {
+		return fmt.Errorf("%w: %q", ErrUnknownLevel, level)
+	}
+	for _, subsystem := range subsystems {
+		if _, ok := debug[subsystem]; !ok {
+			return fmt.Errorf("%w: %q", ErrUnknownSubsystem, subsystem)
+		}
+	}
+	if len(subsystems) == 0 {
+		subsystems = Subsystems()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, subsystem := range subsystems {
+		debug[subsystem].Store(level == LevelDebug)
+	}
+	if slices.Contains(subsystems, Avail) {
+		// The Avail client logs with its own leveled logger
+		cdklog.Init(cdklog.Config{
+			Environment: cdklog.EnvironmentDevelopment,
+			Level:       level,
+			Outputs:     []string{"stderr"},
+		})
+	}
+	log.Printf("Log level set to %s for %v", level, subsystems)
+	return nil
+}
+
+// State returns the log level, debug when the traces of every subsystem are enabled,
+// and the subsystems whose traces are enabled
+func State() Status {
+	status := Status{Level: LevelDebug, Debug: make(map[string]bool)}
+	for _, subsystem := range Subsystems() {
+		enabled := debug[subsystem].Load()
+		status.Debug[subsystem] = enabled
+		if !enabled {
+			status.Level = LevelInfo
+		}
+	}
+	return status
+}
+
+// Enabled returns whether the debug traces of subsystem are enabled
+func Enabled(subsystem string) bool {
+	enabled, ok := debug[subsystem]
+	return ok && enabled.Load()
+}
+
+// Debugf logs a debug trace of subsystem when its traces are enabled
+func Debugf(subsystem, format string, v ...any) {
+	if Enabled(subsystem) {
+		log.Printf("[debug %s] "+format, append([]any{subsystem}, v...)...)
+	}
+}
+
+// SDKLogger returns the logger of the AWS SDK clients, logging the debug traces of
+// subsystem when they are enabled
+func SDKLogger(subsystem string) smithylogging.Logger {
+	return smithylogging.LoggerFunc(func(classification smithylogging.Classification, format string, v ...any) {
+		Debugf(subsystem, "%s "+format, append([]any{classification}, v...)...)
+	})
+}
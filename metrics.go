@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "avail_da"
+
+// metrics are the Prometheus metrics of the reads and writes of the storage tiers and
+// of the bytes served per tenant. Every metric is labeled with the chain id of the
+// rollup the server serves, so dashboards and SLOs can be built per rollup.
+type metrics struct {
+	registry *prometheus.Registry
+
+	operations  *prometheus.CounterVec
+	latency     *prometheus.HistogramVec
+	bytes       *prometheus.CounterVec
+	bytesServed *prometheus.CounterVec
+	reconnects  *prometheus.CounterVec
+	panics      *prometheus.CounterVec
+	ingested    *prometheus.CounterVec
+}
+
+func newMetrics(chainID uint64) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "backend_operations_total",
+			Help:      "Reads and writes of the batch data by backend, operation and result: ok, not_found or error",
+		}, []string{"backend", "op", "result"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "backend_operation_duration_seconds",
+			Help:      "Duration of the reads and writes of the batch data by backend, operation and result",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"backend", "op", "result"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "backend_bytes_total",
+			Help:      "Bytes of batch data read from and written to the backends",
+		}, []string{"backend", "op"}),
+		bytesServed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "bytes_served_total",
+			Help:      "Bytes of batch data served to the clients by tenant",
+		}, []string{"tenant"}),
+		reconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "reconnects_total",
+			Help:      "Rebuilds of the L1 and Avail clients by the watchdog, by client",
+		}, []string{"client"}),
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "handler_panics_total",
+			Help:      "Panics recovered while serving requests, by route pattern",
+		}, []string{"pattern"}),
+		ingested: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "ingested_batches_total",
+			Help:      "Batches of the sequences on L1 mirrored from Avail by result: ok, skipped when already stored, or failed",
+		}, []string{"result"}),
+	}
+	// The chain id is the same for every metric of the server, zero when it isn't set
+	var registerer prometheus.Registerer = m.registry
+	if chainID != 0 {
+		registerer = prometheus.WrapRegistererWith(prometheus.Labels{"chain_id": strconv.FormatUint(chainID, 10)}, m.registry)
+	}
+	registerer.MustRegister(m.operations, m.latency, m.bytes, m.bytesServed, m.reconnects, m.panics, m.ingested)
+	m.registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return m
+}
+
+// observe records a read or a write of a backend, it is a da.Observer
+func (m *metrics) observe(backend, op string, size int, duration time.Duration, err error) {
+	result := "ok"
+	if errors.Is(err, da.ErrNotFound) {
+		result = "not_found"
+	} else if err != nil {
+		result = "error"
+	}
+	m.operations.WithLabelValues(backend, op, result).Inc()
+	m.latency.WithLabelValues(backend, op, result).Observe(duration.Seconds())
+	if err == nil {
+		m.bytes.WithLabelValues(backend, op).Add(float64(size))
+	}
+}
+
+// observeServed records the bytes served to a tenant
+func (m *metrics) observeServed(tenant string, bytes int) {
+	m.bytesServed.WithLabelValues(tenant).Add(float64(bytes))
+}
+
+// observeReconnect records a rebuild of a client by the watchdog
+func (m *metrics) observeReconnect(client string) {
+	m.reconnects.WithLabelValues(client).Inc()
+}
+
+// observePanic records a panic recovered while serving a request
+func (m *metrics) observePanic(pattern string) {
+	m.panics.WithLabelValues(pattern).Inc()
+}
+
+// observeIngest records the batches of a sequence mirrored by the ingestion
+func (m *metrics) observeIngest(result string, batches int) {
+	m.ingested.WithLabelValues(result).Add(float64(batches))
+}
+
+// serve exposes the metrics on addr until ctx is done
+func (m *metrics) serve(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	go func() {
+		log.Printf("Serving metrics on %s/metrics", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Metrics server stopped: %v", err)
+		}
+	}()
+}
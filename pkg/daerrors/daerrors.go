@@ -0,0 +1,40 @@
+// Package daerrors is the taxonomy of the errors of the data availability layer. The
+// backends wrap these errors, so the RPC layer can tell clients whether data is truly
+// missing or the request may succeed when retried.
+package daerrors
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+var (
+	// ErrNotFound is returned when no backend holds the data, retrying won't help
+	ErrNotFound = errors.New("data not found")
+	// ErrBackendUnavailable is returned when a backend failed or isn't ready, the
+	// request may succeed later
+	ErrBackendUnavailable = errors.New("backend unavailable")
+	// ErrIntegrityMismatch is returned when stored data doesn't match its hash
+	ErrIntegrityMismatch = errors.New("data doesn't match its hash")
+	// ErrUnauthorized is returned for requests without the credentials they need
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrTimeout is returned when a backend didn't answer in time, the request may
+	// succeed later
+	ErrTimeout = errors.New("timeout")
+)
+
+// Kind returns the error of the taxonomy err wraps, nil when it wraps none. Context
+// deadlines and network timeouts are ErrTimeout.
+func Kind(err error) error {
+	for _, kind := range []error{ErrNotFound, ErrIntegrityMismatch, ErrUnauthorized, ErrTimeout, ErrBackendUnavailable} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return ErrTimeout
+	}
+	return nil
+}
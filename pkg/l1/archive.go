@@ -0,0 +1,116 @@
+package l1
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// prunedErrors are the error messages of nodes that no longer serve the state or the
+// history of old blocks
+var prunedErrors = []string{
+	"missing trie node",
+	"pruned",
+	"state is not available",
+	"state not available",
+	"historical state unavailable",
+	"history is not available",
+}
+
+// IsPruned returns whether err is returned by a node that pruned the requested block
+func IsPruned(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, p := range prunedErrors {
+		if strings.Contains(msg, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Client is the L1 client of the server and the migration. Requests for old blocks
+// the primary endpoint pruned are sent again to the archive endpoint when there is one.
+type Client struct {
+	*ethclient.Client
+	archive  *ethclient.Client
+	fallback sync.Once
+}
+
+// NewClient returns a client sending requests to primary, archive may be nil
+func NewClient(primary, archive *ethclient.Client) *Client {
+	return &Client{Client: primary, archive: archive}
+}
+
+// withArchive calls fn with the primary client, and once more with the archive
+// client when the primary one pruned the block
+func withArchive[T any](c *Client, fn func(*ethclient.Client) (T, error)) (T, error) {
+	res, err := fn(c.Client)
+	if c.archive == nil || !IsPruned(err) {
+		return res, err
+	}
+	c.fallback.Do(func() {
+		log.Printf("📚 L1 RPC pruned old blocks, falling back to the archive RPC: %v", err)
+	})
+	return fn(c.archive)
+}
+
+func (c *Client) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return withArchive(c, func(client *ethclient.Client) ([]types.Log, error) {
+		return client.FilterLogs(ctx, q)
+	})
+}
+
+func (c *Client) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	type result struct {
+		tx        *types.Transaction
+		isPending bool
+	}
+	res, err := withArchive(c, func(client *ethclient.Client) (result, error) {
+		tx, isPending, err := client.TransactionByHash(ctx, hash)
+		return result{tx, isPending}, err
+	})
+	return res.tx, res.isPending, err
+}
+
+func (c *Client) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return withArchive(c, func(client *ethclient.Client) (*types.Header, error) {
+		return client.HeaderByNumber(ctx, number)
+	})
+}
+
+func (c *Client) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return withArchive(c, func(client *ethclient.Client) ([]byte, error) {
+		return client.CallContract(ctx, msg, blockNumber)
+	})
+}
+
+// SafeHead returns the latest block with at least confirmations blocks on top of it,
+// blocks above it may still be reorged
+func (c *Client) SafeHead(ctx context.Context, confirmations uint64) (uint64, error) {
+	head, err := c.BlockNumber(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if head < confirmations {
+		return 0, nil
+	}
+	return head - confirmations, nil
+}
+
+// Close closes the primary and the archive clients
+func (c *Client) Close() {
+	c.Client.Close()
+	if c.archive != nil {
+		c.archive.Close()
+	}
+}
@@ -0,0 +1,96 @@
+package l1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ✅ Test only the errors of pruned blocks are recognized
+func TestIsPruned(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: nil},
+		{err: errors.New("missing trie node 1a2b (path )"), want: true},
+		{err: errors.New("State Not Available"), want: true},
+		{err: fmt.Errorf("call: %w", errors.New("historical state unavailable")), want: true},
+		{err: errors.New("header not found")},
+		{err: errors.New("connection refused")},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, IsPruned(tt.err), "%v", tt.err)
+	}
+}
+
+// rpcServer serves eth_call with result, or with the error message errMsg when set
+func rpcServer(t *testing.T, result, errMsg string, calls *atomic.Int32) *ethclient.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var req struct {
+			ID json.RawMessage `json:"id"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		if errMsg != "" {
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"error":{"code":-32000,"message":%q}}`, req.ID, errMsg)
+			return
+		}
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":%q}`, req.ID, result)
+	}))
+	t.Cleanup(srv.Close)
+	client, err := ethclient.Dial(srv.URL)
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	return client
+}
+
+// ✅ Test requests for pruned blocks are sent again to the archive endpoint
+func TestClientArchiveFallback(t *testing.T) {
+	var primaryCalls, archiveCalls atomic.Int32
+	archive := rpcServer(t, "0x02", "", &archiveCalls)
+
+	c := &Client{Client: rpcServer(t, "", "missing trie node 1a2b", &primaryCalls), archive: archive}
+	res, err := c.CallContract(context.Background(), ethereum.CallMsg{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x02}, res)
+	assert.Equal(t, int32(1), primaryCalls.Load())
+	assert.Equal(t, int32(1), archiveCalls.Load())
+
+	// ❌ Other errors are returned as is
+	c = &Client{Client: rpcServer(t, "", "execution reverted", &primaryCalls), archive: archive}
+	_, err = c.CallContract(context.Background(), ethereum.CallMsg{}, nil)
+	assert.ErrorContains(t, err, "execution reverted")
+	assert.Equal(t, int32(1), archiveCalls.Load())
+
+	// ❌ There is no archive endpoint
+	c = NewClient(rpcServer(t, "", "missing trie node 1a2b", &primaryCalls), nil)
+	_, err = c.CallContract(context.Background(), ethereum.CallMsg{}, nil)
+	assert.True(t, IsPruned(err))
+	assert.Equal(t, int32(1), archiveCalls.Load())
+}
+
+// ✅ Test the safe head leaves the confirmations below the head
+func TestClientSafeHead(t *testing.T) {
+	var calls atomic.Int32
+	c := NewClient(rpcServer(t, "0x64", "", &calls), nil)
+	head, err := c.SafeHead(context.Background(), 12)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(88), head)
+
+	// Heads below the confirmations have no safe block
+	head, err = c.SafeHead(context.Background(), 200)
+	require.NoError(t, err)
+	assert.Zero(t, head)
+}
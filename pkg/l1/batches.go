@@ -0,0 +1,237 @@
+package l1
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ABI fragment for sequenceBatchesValidium of the Etrog, Elderberry and Banana forks.
+// The overloads are renamed by the ABI parser, so methods are matched on RawName.
+const PolygonValidiumABI = `
+[
+  {
+    "inputs": [
+      {
+        "components": [
+          { "internalType": "bytes32", "name": "transactionsHash", "type": "bytes32" },
+          { "internalType": "bytes32", "name": "forcedGlobalExitRoot", "type": "bytes32" },
+          { "internalType": "uint64", "name": "forcedTimestamp", "type": "uint64" },
+          { "internalType": "bytes32", "name": "forcedBlockHashL1", "type": "bytes32" }
+        ],
+        "internalType": "struct PolygonValidiumEtrog.ValidiumBatchData[]",
+        "name": "batches",
+        "type": "tuple[]"
+      },
+      { "internalType": "address", "name": "l2Coinbase", "type": "address" },
+      { "internalType": "bytes", "name": "dataAvailabilityMessage", "type": "bytes" }
+    ],
+    "name": "sequenceBatchesValidium",
+    "outputs": [],
+    "stateMutability": "nonpayable",
+    "type": "function"
+  },
+  {
+    "inputs": [
+      {
+        "components": [
+          { "internalType": "bytes32", "name": "transactionsHash", "type": "bytes32" },
+          { "internalType": "bytes32", "name": "forcedGlobalExitRoot", "type": "bytes32" },
+          { "internalType": "uint64", "name": "forcedTimestamp", "type": "uint64" },
+          { "internalType": "bytes32", "name": "forcedBlockHashL1", "type": "bytes32" }
+        ],
+        "internalType": "struct PolygonValidiumEtrog.ValidiumBatchData[]",
+        "name": "batches",
+        "type": "tuple[]"
+      },
+      { "internalType": "uint64", "name": "maxSequenceTimestamp", "type": "uint64" },
+      { "internalType": "uint64", "name": "initSequencedBatch", "type": "uint64" },
+      { "internalType": "address", "name": "l2Coinbase", "type": "address" },
+      { "internalType": "bytes", "name": "dataAvailabilityMessage", "type": "bytes" }
+    ],
+    "name": "sequenceBatchesValidium",
+    "outputs": [],
+    "stateMutability": "nonpayable",
+    "type": "function"
+  },
+  {
+    "inputs": [
+      {
+        "components": [
+          { "internalType": "bytes32", "name": "transactionsHash", "type": "bytes32" },
+          { "internalType": "bytes32", "name": "forcedGlobalExitRoot", "type": "bytes32" },
+          { "internalType": "uint64", "name": "forcedTimestamp", "type": "uint64" },
+          { "internalType": "bytes32", "name": "forcedBlockHashL1", "type": "bytes32" }
+        ],
+        "internalType": "struct PolygonValidiumEtrog.ValidiumBatchData[]",
+        "name": "batches",
+        "type": "tuple[]"
+      },
+      { "internalType": "uint32", "name": "l1InfoTreeLeafCount", "type": "uint32" },
+      { "internalType": "uint64", "name": "maxSequenceTimestamp", "type": "uint64" },
+      { "internalType": "bytes32", "name": "expectedFinalAccInputHash", "type": "bytes32" },
+      { "internalType": "address", "name": "l2Coinbase", "type": "address" },
+      { "internalType": "bytes", "name": "dataAvailabilityMessage", "type": "bytes" }
+    ],
+    "name": "sequenceBatchesValidium",
+    "outputs": [],
+    "stateMutability": "nonpayable",
+    "type": "function"
+  }
+]`
+
+type ValidiumBatchData struct {
+	TransactionsHash     [32]byte
+	ForcedGlobalExitRoot [32]byte
+	ForcedTimestamp      uint64
+	ForcedBlockHashL1    [32]byte
+}
+
+// SequenceBatches event signatures emitted by the validium contract when batches are
+// sequenced, before and since the Etrog fork
+var SequenceBatchesTopics = []common.Hash{
+	crypto.Keccak256Hash([]byte("SequenceBatches(uint64)")),
+	crypto.Keccak256Hash([]byte("SequenceBatches(uint64,bytes32)")),
+}
+
+// Sequence is a sequenceBatchesValidium call, the data availability message points to
+// where the data of the batches was posted when the rollup uses Avail
+type Sequence struct {
+	TxHash                  common.Hash
+	BatchHashes             []common.Hash
+	DataAvailabilityMessage []byte
+	// LastBatch is the number of the last batch of the sequence, from the indexed
+	// numBatch of the SequenceBatches event. The batches are numbered consecutively.
+	LastBatch uint64
+}
+
+// BatchNumbers returns the number of every batch of the sequence, in the order of
+// BatchHashes
+func (s Sequence) BatchNumbers() []uint64 {
+	numbers := make([]uint64, len(s.BatchHashes))
+	for i := range numbers {
+		numbers[i] = s.LastBatch - uint64(len(numbers)-1-i)
+	}
+	return numbers
+}
+
+// QueryBatchHashesFromL1ByRange returns the batch hashes sequenced in the inclusive
+// block range keyed by block number. Sequencing transactions are found with
+// eth_getLogs and only their calldata is fetched, instead of downloading every block.
+func QueryBatchHashesFromL1ByRange(ctx context.Context, client *Client, contractAbi abi.ABI, contractAddr common.Address, from, to *big.Int) (map[uint64][]common.Hash, error) {
+	sequences, err := QuerySequencesFromL1ByRange(ctx, client, contractAbi, contractAddr, from, to)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[uint64][]common.Hash, len(sequences))
+	for block, seqs := range sequences {
+		for _, seq := range seqs {
+			res[block] = append(res[block], seq.BatchHashes...)
+		}
+	}
+	return res, nil
+}
+
+// QuerySequencesFromL1ByRange returns the sequences of the inclusive block range keyed
+// by block number, in the order they were sequenced
+func QuerySequencesFromL1ByRange(ctx context.Context, client *Client, contractAbi abi.ABI, contractAddr common.Address, from, to *big.Int) (map[uint64][]Sequence, error) {
+	logs, err := client.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: from,
+		ToBlock:   to,
+		Addresses: []common.Address{contractAddr},
+		Topics:    [][]common.Hash{SequenceBatchesTopics},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SequenceBatches logs for blocks %v..%v: %w", from, to, err)
+	}
+
+	res := make(map[uint64][]Sequence)
+	seen := make(map[common.Hash]bool)
+	for _, l := range logs {
+		if l.Removed || seen[l.TxHash] {
+			continue
+		}
+		seen[l.TxHash] = true
+
+		tx, _, err := client.TransactionByHash(ctx, l.TxHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get tx %s: %w", l.TxHash.Hex(), err)
+		}
+		seq, err := decodeSequence(contractAbi, tx)
+		if err != nil {
+			return nil, err
+		}
+		if seq == nil {
+			log.Printf("Tx %s emitted SequenceBatches but doesn't call sequenceBatchesValidium directly, skipping", tx.Hash().Hex())
+			continue
+		}
+		if len(l.Topics) > 1 {
+			seq.LastBatch = new(big.Int).SetBytes(l.Topics[1].Bytes()).Uint64()
+		}
+		res[l.BlockNumber] = append(res[l.BlockNumber], *seq)
+	}
+	return res, nil
+}
+
+// SequenceOfTx returns the sequence of the sequenceBatchesValidium transaction txHash,
+// without the number of its last batch, which is only known from its event
+func SequenceOfTx(ctx context.Context, client *Client, contractAbi abi.ABI, txHash common.Hash) (*Sequence, error) {
+	tx, _, err := client.TransactionByHash(ctx, txHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tx %s: %w", txHash.Hex(), err)
+	}
+	seq, err := decodeSequence(contractAbi, tx)
+	if err != nil {
+		return nil, err
+	}
+	if seq == nil {
+		return nil, fmt.Errorf("tx %s doesn't call sequenceBatchesValidium", txHash.Hex())
+	}
+	return seq, nil
+}
+
+// decodeSequence decodes a sequenceBatchesValidium call, nil is returned for other
+// transactions
+func decodeSequence(contractAbi abi.ABI, tx *types.Transaction) (*Sequence, error) {
+	data := tx.Data()
+	if len(data) < 4 {
+		return nil, nil
+	}
+	method, _ := contractAbi.MethodById(data[:4])
+	if method == nil || method.RawName != "sequenceBatchesValidium" {
+		return nil, nil
+	}
+	log.Printf("Tx: %s", tx.Hash().Hex())
+	log.Printf("Method: %s", method.Sig)
+	inputs, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack inputs for tx %s: %w", tx.Hash().Hex(), err)
+	}
+
+	// batches is the first and dataAvailabilityMessage the last argument of every fork
+	batches, ok := abi.ConvertType(inputs[0], new([]ValidiumBatchData)).(*[]ValidiumBatchData)
+	if !ok {
+		return nil, fmt.Errorf("failed to convert batches of tx %s", tx.Hash().Hex())
+	}
+	message, ok := inputs[len(inputs)-1].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("failed to convert the data availability message of tx %s", tx.Hash().Hex())
+	}
+
+	seq := &Sequence{
+		TxHash:                  tx.Hash(),
+		BatchHashes:             make([]common.Hash, 0, len(*batches)),
+		DataAvailabilityMessage: message,
+	}
+	for _, batch := range *batches {
+		seq.BatchHashes = append(seq.BatchHashes, common.BytesToHash(batch.TransactionsHash[:]))
+	}
+	return seq, nil
+}
@@ -0,0 +1,177 @@
+package l1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sequenceTx returns a transaction calling the sequenceBatchesValidium overload with
+// the arguments args
+func sequenceTx(t *testing.T, contractAbi abi.ABI, args ...interface{}) *types.Transaction {
+	for _, method := range contractAbi.Methods {
+		if method.RawName != "sequenceBatchesValidium" || len(method.Inputs) != len(args) {
+			continue
+		}
+		input, err := method.Inputs.Pack(args...)
+		require.NoError(t, err)
+		return types.NewTx(&types.LegacyTx{Data: append(method.ID, input...)})
+	}
+	t.Fatalf("no sequenceBatchesValidium overload with %d arguments", len(args))
+	return nil
+}
+
+// ✅ Test the batches and the message of every fork are decoded
+func TestDecodeSequence(t *testing.T) {
+	contractAbi, err := abi.JSON(strings.NewReader(PolygonValidiumABI))
+	require.NoError(t, err)
+
+	batches := []ValidiumBatchData{{TransactionsHash: [32]byte{1}}, {TransactionsHash: [32]byte{2}}}
+	coinbase := common.HexToAddress("0x5b06837a43bdc3dd9f114558daf4b26ed49842ed")
+	message := []byte("data availability message")
+
+	tests := []struct {
+		name string
+		tx   *types.Transaction
+	}{
+		{name: "etrog", tx: sequenceTx(t, contractAbi, batches, coinbase, message)},
+		{name: "elderberry", tx: sequenceTx(t, contractAbi, batches, uint64(1700000000), uint64(41), coinbase, message)},
+		{name: "banana", tx: sequenceTx(t, contractAbi, batches, uint32(7), uint64(1700000000), [32]byte{3}, coinbase, message)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seq, err := decodeSequence(contractAbi, tt.tx)
+			require.NoError(t, err)
+			require.NotNil(t, seq)
+			assert.Equal(t, tt.tx.Hash(), seq.TxHash)
+			assert.Equal(t, []common.Hash{{1}, {2}}, seq.BatchHashes)
+			assert.Equal(t, message, seq.DataAvailabilityMessage)
+		})
+	}
+
+	// Other calls are skipped
+	seq, err := decodeSequence(contractAbi, types.NewTx(&types.LegacyTx{Data: []byte{0xa9, 0x05, 0x9c, 0xbb, 0x00}}))
+	require.NoError(t, err)
+	assert.Nil(t, seq)
+	seq, err = decodeSequence(contractAbi, types.NewTx(&types.LegacyTx{}))
+	require.NoError(t, err)
+	assert.Nil(t, seq)
+
+	// ❌ Truncated calldata
+	tx := sequenceTx(t, contractAbi, batches, coinbase, message)
+	_, err = decodeSequence(contractAbi, types.NewTx(&types.LegacyTx{Data: tx.Data()[:40]}))
+	assert.Error(t, err)
+}
+
+// ✅ Test the batches of a sequence are numbered up to its last batch
+func TestBatchNumbers(t *testing.T) {
+	seq := Sequence{BatchHashes: []common.Hash{{1}, {2}, {3}}, LastBatch: 12}
+	assert.Equal(t, []uint64{10, 11, 12}, seq.BatchNumbers())
+	assert.Empty(t, Sequence{LastBatch: 12}.BatchNumbers())
+}
+
+// logNode serves eth_getLogs with logs and eth_getTransactionByHash with txs
+func logNode(t *testing.T, logs []types.Log, txs ...*types.Transaction) *Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		var result interface{}
+		switch req.Method {
+		case "eth_getLogs":
+			result = logs
+		case "eth_getTransactionByHash":
+			var hash common.Hash
+			json.Unmarshal(req.Params[0], &hash)
+			for _, tx := range txs {
+				if tx.Hash() == hash {
+					result = tx
+				}
+			}
+		}
+		res, _ := json.Marshal(result)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":%s}`, req.ID, res)
+	}))
+	t.Cleanup(srv.Close)
+	client, err := ethclient.Dial(srv.URL)
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	return NewClient(client, nil)
+}
+
+// ✅ Test the sequences of a block range are found from their SequenceBatches logs
+func TestQuerySequencesFromL1ByRange(t *testing.T) {
+	contractAbi, err := abi.JSON(strings.NewReader(PolygonValidiumABI))
+	require.NoError(t, err)
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	sign := func(nonce uint64, data []byte) *types.Transaction {
+		tx, err := types.SignTx(types.NewTx(&types.LegacyTx{Nonce: nonce, Data: data}), types.HomesteadSigner{}, key)
+		require.NoError(t, err)
+		return tx
+	}
+	coinbase := common.Address{1}
+	first := sign(0, sequenceTx(t, contractAbi, []ValidiumBatchData{{TransactionsHash: [32]byte{1}}, {TransactionsHash: [32]byte{2}}}, coinbase, []byte("first")).Data())
+	second := sign(1, sequenceTx(t, contractAbi, []ValidiumBatchData{{TransactionsHash: [32]byte{3}}}, coinbase, []byte("second")).Data())
+	// A contract calling the validium contract emits the event too
+	indirect := sign(2, []byte{0xde, 0xad, 0xbe, 0xef})
+
+	contract := common.Address{2}
+	event := func(block uint64, tx *types.Transaction, lastBatch int64, removed bool) types.Log {
+		return types.Log{
+			Address:     contract,
+			Topics:      []common.Hash{SequenceBatchesTopics[1], common.BigToHash(big.NewInt(lastBatch))},
+			BlockNumber: block,
+			TxHash:      tx.Hash(),
+			Removed:     removed,
+		}
+	}
+	logs := []types.Log{
+		event(10, first, 2, false),
+		// Logged twice by the same transaction
+		event(10, first, 2, false),
+		event(12, indirect, 3, false),
+		event(13, second, 9, true),
+		event(14, second, 3, false),
+	}
+	client := logNode(t, logs, first, second, indirect)
+
+	sequences, err := QuerySequencesFromL1ByRange(context.Background(), client, contractAbi, contract, big.NewInt(10), big.NewInt(14))
+	require.NoError(t, err)
+	require.Len(t, sequences, 2)
+	require.Len(t, sequences[10], 1)
+	assert.Equal(t, first.Hash(), sequences[10][0].TxHash)
+	assert.Equal(t, []byte("first"), sequences[10][0].DataAvailabilityMessage)
+	assert.Equal(t, []uint64{1, 2}, sequences[10][0].BatchNumbers())
+	require.Len(t, sequences[14], 1)
+	assert.Equal(t, []uint64{3}, sequences[14][0].BatchNumbers())
+
+	hashes, err := QueryBatchHashesFromL1ByRange(context.Background(), client, contractAbi, contract, big.NewInt(10), big.NewInt(14))
+	require.NoError(t, err)
+	assert.Equal(t, map[uint64][]common.Hash{10: {{1}, {2}}, 14: {{3}}}, hashes)
+
+	seq, err := SequenceOfTx(context.Background(), client, contractAbi, second.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, []common.Hash{{3}}, seq.BatchHashes)
+
+	// ❌ The transaction doesn't call sequenceBatchesValidium
+	_, err = SequenceOfTx(context.Background(), client, contractAbi, indirect.Hash())
+	assert.ErrorContains(t, err, "doesn't call sequenceBatchesValidium")
+}
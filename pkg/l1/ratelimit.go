@@ -0,0 +1,121 @@
+package l1
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/time/rate"
+)
+
+const (
+	rateLimitBaseDelay = 1 * time.Second
+	rateLimitMaxDelay  = 60 * time.Second
+)
+
+// rateLimitedTransport limits the requests per second sent to the RPC endpoint and
+// retries requests rejected with 429 Too Many Requests, honoring Retry-After. Every
+// attempt is bounded by timeout when it is set.
+type rateLimitedTransport struct {
+	next       http.RoundTripper
+	limiter    *rate.Limiter
+	maxRetries int
+	timeout    time.Duration
+}
+
+// cancelBody cancels the context of the request when the response body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The body is read up front so it can be sent again on retries
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		if t.limiter != nil {
+			if err := t.limiter.Wait(req.Context()); err != nil {
+				return nil, err
+			}
+		}
+
+		ctx, cancel := req.Context(), context.CancelFunc(func() {})
+		if t.timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		}
+		r := req.Clone(ctx)
+		if body != nil {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+		}
+		resp, err := t.next.RoundTrip(r)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= t.maxRetries {
+			resp.Body = cancelBody{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		}
+		cancel()
+
+		delay := retryAfter(resp, rateLimitBaseDelay<<attempt)
+		resp.Body.Close()
+		log.Printf("⏳ L1 RPC rate limited, retrying in %v (attempt %d/%d)", delay, attempt+1, t.maxRetries)
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// retryAfter returns the delay requested by the Retry-After header, or def when it is
+// missing, capped at rateLimitMaxDelay
+func retryAfter(resp *http.Response, def time.Duration) time.Duration {
+	delay := def
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+			delay = time.Duration(seconds) * time.Second
+		} else if at, err := http.ParseTime(v); err == nil {
+			delay = time.Until(at)
+		}
+	}
+	return min(max(delay, 0), rateLimitMaxDelay)
+}
+
+// Dial connects to an HTTP RPC endpoint sending at most rps requests per second, zero
+// disables the limit. Requests rejected with 429 are retried up to maxRetries times and
+// every request is bounded by timeout, zero disables it.
+func Dial(ctx context.Context, url string, rps float64, maxRetries int, timeout time.Duration) (*ethclient.Client, error) {
+	transport := &rateLimitedTransport{next: http.DefaultTransport, maxRetries: maxRetries, timeout: timeout}
+	if rps > 0 {
+		transport.limiter = rate.NewLimiter(rate.Limit(rps), max(1, int(rps)))
+	}
+	client, err := rpc.DialOptions(ctx, url, rpc.WithHTTPClient(&http.Client{Transport: transport}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %w", url, err)
+	}
+	return ethclient.NewClient(client), nil
+}
@@ -0,0 +1,76 @@
+package l1
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ✅ Test requests rejected with 429 are sent again with their body
+func TestRateLimitedTransportRetries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if calls.Add(1) <= 2 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &rateLimitedTransport{next: http.DefaultTransport, maxRetries: 2, timeout: time.Second}}
+	resp, err := client.Post(srv.URL, "application/json", strings.NewReader(`{"method":"eth_blockNumber"}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"method":"eth_blockNumber"}`, string(body))
+	assert.Equal(t, int32(3), calls.Load())
+
+	// ❌ The retries are used up, the 429 is returned
+	calls.Store(0)
+	client.Transport.(*rateLimitedTransport).maxRetries = 1
+	resp, err = client.Post(srv.URL, "application/json", strings.NewReader(`{}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+// ✅ Test the delay of Retry-After is honored and capped
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "missing", want: 2 * time.Second},
+		{name: "seconds", value: "5", want: 5 * time.Second},
+		{name: "capped", value: "3600", want: rateLimitMaxDelay},
+		{name: "date in the past", value: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), want: 0},
+		{name: "invalid", value: "soon", want: 2 * time.Second},
+		{name: "negative", value: "-1", want: 2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tt.value != "" {
+				resp.Header.Set("Retry-After", tt.value)
+			}
+			assert.Equal(t, tt.want, retryAfter(resp, 2*time.Second))
+		})
+	}
+
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)}}}
+	assert.InDelta(t, float64(time.Minute), float64(retryAfter(resp, 0)), float64(2*time.Second))
+}
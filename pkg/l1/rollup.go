@@ -0,0 +1,86 @@
+package l1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ABI fragment of the PolygonRollupManager. Only the leading static outputs of
+// rollupIDToRollupData are declared, they are laid out the same in every fork.
+const PolygonRollupManagerABI = `
+[
+  {
+    "inputs": [{ "internalType": "uint64", "name": "chainID", "type": "uint64" }],
+    "name": "chainIDToRollupID",
+    "outputs": [{ "internalType": "uint32", "name": "rollupID", "type": "uint32" }],
+    "stateMutability": "view",
+    "type": "function"
+  },
+  {
+    "inputs": [{ "internalType": "uint32", "name": "rollupID", "type": "uint32" }],
+    "name": "rollupIDToRollupData",
+    "outputs": [
+      { "internalType": "address", "name": "rollupContract", "type": "address" },
+      { "internalType": "uint64", "name": "chainID", "type": "uint64" },
+      { "internalType": "address", "name": "verifier", "type": "address" },
+      { "internalType": "uint64", "name": "forkID", "type": "uint64" }
+    ],
+    "stateMutability": "view",
+    "type": "function"
+  }
+]`
+
+// RollupData is the registration of a rollup in the rollup manager
+type RollupData struct {
+	RollupID       uint32
+	RollupContract common.Address
+	ChainID        uint64
+	Verifier       common.Address
+	ForkID         uint64
+}
+
+// DiscoverRollup reads the rollup contract and fork id from the rollup manager. The
+// rollup is looked up by chainID when rollupID is zero.
+func DiscoverRollup(ctx context.Context, client *Client, rollupManager common.Address, rollupID uint32, chainID uint64) (RollupData, error) {
+	managerAbi, err := abi.JSON(strings.NewReader(PolygonRollupManagerABI))
+	if err != nil {
+		return RollupData{}, err
+	}
+	manager := bind.NewBoundContract(rollupManager, managerAbi, client, nil, nil)
+	opts := &bind.CallOpts{Context: ctx}
+
+	if rollupID == 0 {
+		if chainID == 0 {
+			return RollupData{}, fmt.Errorf("a rollup id or chain id is required to discover the rollup")
+		}
+		var out []interface{}
+		if err := manager.Call(opts, &out, "chainIDToRollupID", chainID); err != nil {
+			return RollupData{}, fmt.Errorf("failed to get rollup id of chain %d: %w", chainID, err)
+		}
+		rollupID = *abi.ConvertType(out[0], new(uint32)).(*uint32)
+		if rollupID == 0 {
+			return RollupData{}, fmt.Errorf("chain %d is not registered in rollup manager %s", chainID, rollupManager.Hex())
+		}
+	}
+
+	var out []interface{}
+	if err := manager.Call(opts, &out, "rollupIDToRollupData", rollupID); err != nil {
+		return RollupData{}, fmt.Errorf("failed to get data of rollup %d: %w", rollupID, err)
+	}
+	data := RollupData{
+		RollupID:       rollupID,
+		RollupContract: *abi.ConvertType(out[0], new(common.Address)).(*common.Address),
+		ChainID:        *abi.ConvertType(out[1], new(uint64)).(*uint64),
+		Verifier:       *abi.ConvertType(out[2], new(common.Address)).(*common.Address),
+		ForkID:         *abi.ConvertType(out[3], new(uint64)).(*uint64),
+	}
+	if data.RollupContract == (common.Address{}) {
+		return RollupData{}, fmt.Errorf("rollup %d is not registered in rollup manager %s", rollupID, rollupManager.Hex())
+	}
+	return data, nil
+}
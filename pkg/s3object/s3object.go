@@ -0,0 +1,126 @@
+// Package s3object reads S3 objects and detects truncated downloads. A body shorter
+// than the Content-Length of its response is resumed from where it stopped instead of
+// being returned as a short blob. The server, the Avail fallback storage and the
+// migration tool read the objects of a bucket with it.
+package s3object
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// DefaultAttempts is the number of reads of an object body, the first included
+const DefaultAttempts = 3
+
+// ErrTruncated is returned when an object body is still shorter than its
+// Content-Length after every attempt
+var ErrTruncated = errors.New("truncated S3 object")
+
+// GetObjectAPI is the S3 client objects are read with, *s3.Client implements it
+type GetObjectAPI interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// Read reads the object of input. The body is checked against the Content-Length of
+// the response, a read that fails or ends early is resumed with a range request of the
+// same object version, up to attempts reads. The checksum S3 validates is the one of
+// the first response, so the data of resumed reads must be checked by the caller, e.g.
+// against its hash. The errors of the first GetObject are returned as they are, so
+// missing objects can be told apart. The output of the first response is returned
+// with its body closed.
+func Read(ctx context.Context, client GetObjectAPI, input *s3.GetObjectInput, attempts int) ([]byte, *s3.GetObjectOutput, error) {
+	out, err := client.GetObject(ctx, input)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := io.ReadAll(Checked(out.Body, out.ContentLength))
+	out.Body.Close()
+	size := aws.ToInt64(out.ContentLength)
+	key := aws.ToString(input.Key)
+
+	for attempt := 1; err != nil && attempt < attempts && ctx.Err() == nil; attempt++ {
+		if out.ContentLength == nil {
+			// Without length there is nothing to resume against
+			break
+		}
+		resume := *input
+		if int64(len(data)) < size {
+			resume.Range = aws.String(fmt.Sprintf("bytes=%d-", len(data)))
+		} else {
+			// The whole body was read but rejected, e.g. by the checksum, it is read again
+			data = data[:0]
+		}
+		if resume.VersionId == nil {
+			resume.IfMatch = out.ETag
+		}
+		part, getErr := client.GetObject(ctx, &resume)
+		if getErr != nil {
+			err = fmt.Errorf("failed to resume object %s at byte %d: %w", key, len(data), getErr)
+			continue
+		}
+		var rest []byte
+		rest, err = io.ReadAll(Checked(part.Body, part.ContentLength))
+		part.Body.Close()
+		data = append(data, rest...)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: read %d of %d bytes of object %s: %w", ErrTruncated, len(data), size, key, err)
+	}
+	if out.ContentLength != nil && int64(len(data)) != size {
+		return nil, nil, fmt.Errorf("%w: read %d of %d bytes of object %s", ErrTruncated, len(data), size, key)
+	}
+	return data, out, nil
+}
+
+// Checked returns the body failing with io.ErrUnexpectedEOF when it ends before
+// contentLength bytes, a nil length isn't checked
+func Checked(body io.Reader, contentLength *int64) io.Reader {
+	if contentLength == nil {
+		return body
+	}
+	return &checkedReader{body: body, remaining: *contentLength}
+}
+
+type checkedReader struct {
+	body      io.Reader
+	remaining int64
+}
+
+func (r *checkedReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.remaining -= int64(n)
+	if errors.Is(err, io.EOF) && r.remaining > 0 {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// CheckedClient returns the client whose object bodies fail with io.ErrUnexpectedEOF
+// when they end before their Content-Length, so downloaders reading objects in parts
+// retry the truncated parts
+func CheckedClient(client GetObjectAPI) GetObjectAPI {
+	return checkedClient{client}
+}
+
+type checkedClient struct {
+	GetObjectAPI
+}
+
+func (c checkedClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	out, err := c.GetObjectAPI.GetObject(ctx, params, optFns...)
+	if err != nil {
+		return nil, err
+	}
+	out.Body = checkedBody{Reader: Checked(out.Body, out.ContentLength), Closer: out.Body}
+	return out, nil
+}
+
+type checkedBody struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,106 @@
+package s3object
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClient serves data, cutting the first truncate bodies after cut bytes
+type fakeClient struct {
+	data     []byte
+	truncate int
+	cut      int
+	requests []*s3.GetObjectInput
+}
+
+func (c *fakeClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	c.requests = append(c.requests, params)
+	body := c.data
+	if params.Range != nil {
+		var start int
+		if _, err := fmt.Sscanf(*params.Range, "bytes=%d-", &start); err != nil {
+			return nil, err
+		}
+		body = body[start:]
+	}
+	length := int64(len(body))
+	if c.truncate > 0 {
+		c.truncate--
+		body = body[:min(c.cut, len(body))]
+	}
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: aws.Int64(length),
+		ETag:          aws.String(`"etag"`),
+	}, nil
+}
+
+var testInput = &s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key")}
+
+// ✅ Test a complete body is read with a single request
+func TestReadComplete(t *testing.T) {
+	client := &fakeClient{data: []byte("0123456789")}
+	data, out, err := Read(context.Background(), client, testInput, DefaultAttempts)
+	require.NoError(t, err)
+	assert.Equal(t, client.data, data)
+	assert.Equal(t, int64(10), aws.ToInt64(out.ContentLength))
+	assert.Len(t, client.requests, 1)
+}
+
+// ✅ Test a truncated body is resumed from where it stopped, of the same object
+func TestReadResumes(t *testing.T) {
+	client := &fakeClient{data: []byte("0123456789"), truncate: 2, cut: 4}
+	data, _, err := Read(context.Background(), client, testInput, DefaultAttempts)
+	require.NoError(t, err)
+	assert.Equal(t, client.data, data)
+	require.Len(t, client.requests, 3)
+	assert.Equal(t, "bytes=4-", aws.ToString(client.requests[1].Range))
+	assert.Equal(t, "bytes=8-", aws.ToString(client.requests[2].Range))
+	assert.Equal(t, `"etag"`, aws.ToString(client.requests[2].IfMatch))
+}
+
+// ❌ Test a body still truncated after every attempt is an error, not a short blob
+func TestReadTruncated(t *testing.T) {
+	client := &fakeClient{data: []byte("0123456789"), truncate: 3, cut: 1}
+	data, _, err := Read(context.Background(), client, testInput, DefaultAttempts)
+	assert.ErrorIs(t, err, ErrTruncated)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Nil(t, data)
+}
+
+// ❌ Test the errors of the first request are returned as they are
+func TestReadError(t *testing.T) {
+	failing := errors.New("no such key")
+	_, _, err := Read(context.Background(), errorClient{failing}, testInput, DefaultAttempts)
+	assert.Equal(t, failing, err)
+}
+
+type errorClient struct{ err error }
+
+func (c errorClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return nil, c.err
+}
+
+// ✅ Test the checked client fails truncated bodies so downloaders retry them
+func TestCheckedClient(t *testing.T) {
+	client := CheckedClient(&fakeClient{data: []byte("0123456789"), truncate: 1, cut: 4})
+	out, err := client.GetObject(context.Background(), testInput)
+	require.NoError(t, err)
+	_, err = io.ReadAll(out.Body)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	out, err = client.GetObject(context.Background(), testInput)
+	require.NoError(t, err)
+	data, err := io.ReadAll(out.Body)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("0123456789"), data)
+}
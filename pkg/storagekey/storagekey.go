@@ -0,0 +1,155 @@
+// Package storagekey encodes the hashes of batch data into S3 object keys. The server,
+// the Avail fallback storage and the migration tool share the objects of a bucket, so
+// they all encode and decode keys with this package.
+package storagekey
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Object key layouts. The sharded layout spreads objects over prefix/aa/bb/hash to
+// avoid hot partitions and allow listing by prefix.
+const (
+	LayoutFlat    = "flat"
+	LayoutSharded = "sharded"
+)
+
+// ErrInvalidKey is returned for keys that aren't the key of a hash
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Encode returns the canonical encoding of hash in keys: lower case hex without 0x
+func Encode(hash common.Hash) string {
+	return hex.EncodeToString(hash.Bytes())
+}
+
+// Decode returns the hash of its canonical encoding, other encodings are rejected so
+// every hash has a single key
+func Decode(encoded string) (common.Hash, error) {
+	if len(encoded) != 2*common.HashLength || strings.ToLower(encoded) != encoded {
+		return common.Hash{}, fmt.Errorf("%w: %q", ErrInvalidKey, encoded)
+	}
+	b, err := hex.DecodeString(encoded)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("%w: %q", ErrInvalidKey, encoded)
+	}
+	return common.BytesToHash(b), nil
+}
+
+// Parse returns the hash of an encoding of older tools, with or without 0x and in any
+// case, to migrate objects and archives to the canonical encoding
+func Parse(s string) (common.Hash, error) {
+	encoded := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	return Decode(strings.ToLower(encoded))
+}
+
+// Placeholders of the object prefixes, so the networks sharing a bucket store their
+// objects apart with the same prefix setting, e.g. "{network}/{chainid}/"
+const (
+	PlaceholderNetwork = "{network}"
+	PlaceholderChainID = "{chainid}"
+)
+
+// ErrInvalidPrefix is returned for prefixes with unknown or unresolved placeholders
+var ErrInvalidPrefix = errors.New("invalid object prefix")
+
+// placeholderRegexp matches the placeholders of a prefix
+var placeholderRegexp = regexp.MustCompile(`\{[^{}]*\}`)
+
+// ResolvePrefix returns the prefix with its placeholders replaced by the network and
+// the chain id. A placeholder without value fails, so networks can't silently share
+// the keys of a prefix.
+func ResolvePrefix(prefix, network string, chainID uint64) (string, error) {
+	var err error
+	resolved := placeholderRegexp.ReplaceAllStringFunc(prefix, func(placeholder string) string {
+		switch {
+		case placeholder == PlaceholderNetwork && network != "":
+			return network
+		case placeholder == PlaceholderChainID && chainID != 0:
+			return strconv.FormatUint(chainID, 10)
+		case placeholder == PlaceholderNetwork, placeholder == PlaceholderChainID:
+			err = fmt.Errorf("%w: %q has %s but no value is set for it", ErrInvalidPrefix, prefix, placeholder)
+		default:
+			err = fmt.Errorf("%w: %q has unknown placeholder %s, expected %s or %s", ErrInvalidPrefix, prefix, placeholder, PlaceholderNetwork, PlaceholderChainID)
+		}
+		return placeholder
+	})
+	if err != nil {
+		return "", err
+	}
+	return resolved, nil
+}
+
+// Codec encodes the keys of a bucket, under an object prefix in a layout
+type Codec struct {
+	// Prefix is prepended to every key as is, e.g. "batches/"
+	Prefix string
+	Layout string
+}
+
+// NewCodec returns the codec of the prefix and the layout, an empty layout is flat
+func NewCodec(prefix, layout string) (Codec, error) {
+	switch layout {
+	case "":
+		layout = LayoutFlat
+	case LayoutFlat, LayoutSharded:
+	default:
+		return Codec{}, fmt.Errorf("invalid key layout %q, expected %s or %s", layout, LayoutFlat, LayoutSharded)
+	}
+	return Codec{Prefix: prefix, Layout: layout}, nil
+}
+
+// Key returns the key the object of hash is written to
+func (c Codec) Key(hash common.Hash) string {
+	return c.Prefix + encodeWithLayout(hash, c.Layout)
+}
+
+// ReadKeys returns the keys the object of hash is read from. Objects written before
+// switching to the sharded layout are still found under the flat key.
+func (c Codec) ReadKeys(hash common.Hash) []string {
+	if c.Layout == LayoutSharded {
+		return []string{c.Key(hash), c.Prefix + Encode(hash)}
+	}
+	return []string{c.Key(hash)}
+}
+
+// Hash returns the hash of a key under the prefix, in either layout. The keys of other
+// objects under the prefix, e.g. indexes, return ErrInvalidKey.
+func (c Codec) Hash(key string) (common.Hash, error) {
+	name, ok := strings.CutPrefix(key, c.Prefix)
+	if !ok {
+		return common.Hash{}, fmt.Errorf("%w: %q isn't under prefix %q", ErrInvalidKey, key, c.Prefix)
+	}
+	hash, err := Decode(name[strings.LastIndex(name, "/")+1:])
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if name != encodeWithLayout(hash, LayoutFlat) && name != encodeWithLayout(hash, LayoutSharded) {
+		return common.Hash{}, fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return hash, nil
+}
+
+// LegacyKeys returns the other keys older tools may have written the object of hash
+// to: the key of the other layout and the 0x prefixed hash
+func (c Codec) LegacyKeys(hash common.Hash) []string {
+	other := LayoutSharded
+	if c.Layout == LayoutSharded {
+		other = LayoutFlat
+	}
+	return []string{c.Prefix + encodeWithLayout(hash, other), c.Prefix + hash.Hex()}
+}
+
+func encodeWithLayout(hash common.Hash, layout string) string {
+	encoded := Encode(hash)
+	if layout == LayoutSharded {
+		return encoded[0:2] + "/" + encoded[2:4] + "/" + encoded
+	}
+	return encoded
+}
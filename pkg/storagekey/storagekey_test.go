@@ -0,0 +1,92 @@
+package storagekey
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testHash = common.HexToHash("0xABCDEF0123456789abcdef0123456789abcdef0123456789abcdef0123456789")
+
+// ✅ Test the canonical encoding is lower case hex without 0x and round-trips
+func TestEncodeDecode(t *testing.T) {
+	encoded := Encode(testHash)
+	assert.Equal(t, "abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789", encoded)
+
+	decoded, err := Decode(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, testHash, decoded)
+
+	for _, other := range []string{"0x" + encoded, "ABCDEF0123456789abcdef0123456789abcdef0123456789abcdef0123456789", encoded[2:], "zz" + encoded[2:]} {
+		_, err := Decode(other)
+		assert.ErrorIs(t, err, ErrInvalidKey, other)
+	}
+}
+
+// ✅ Test Parse accepts the encodings of older tools
+func TestParse(t *testing.T) {
+	for _, s := range []string{Encode(testHash), testHash.Hex(), "0xABCDEF0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789"} {
+		hash, err := Parse(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, testHash, hash)
+	}
+}
+
+// ✅ Test keys of both layouts under a prefix
+func TestCodecKeys(t *testing.T) {
+	_, err := NewCodec("batches/", "nested")
+	require.Error(t, err)
+
+	flat, err := NewCodec("batches/", "")
+	require.NoError(t, err)
+	assert.Equal(t, LayoutFlat, flat.Layout)
+	assert.Equal(t, "batches/"+Encode(testHash), flat.Key(testHash))
+	assert.Equal(t, []string{flat.Key(testHash)}, flat.ReadKeys(testHash))
+
+	sharded, err := NewCodec("batches/", LayoutSharded)
+	require.NoError(t, err)
+	assert.Equal(t, "batches/ab/cd/"+Encode(testHash), sharded.Key(testHash))
+	assert.Equal(t, []string{sharded.Key(testHash), flat.Key(testHash)}, sharded.ReadKeys(testHash))
+	assert.Equal(t, []string{flat.Key(testHash), "batches/" + testHash.Hex()}, sharded.LegacyKeys(testHash))
+}
+
+// ✅ Test Hash decodes the keys of the prefix in either layout and nothing else
+func TestCodecHash(t *testing.T) {
+	codec, err := NewCodec("batches/", LayoutSharded)
+	require.NoError(t, err)
+
+	for _, key := range []string{"batches/" + Encode(testHash), "batches/ab/cd/" + Encode(testHash)} {
+		hash, err := codec.Hash(key)
+		require.NoError(t, err, key)
+		assert.Equal(t, testHash, hash)
+	}
+	for _, key := range []string{
+		Encode(testHash),
+		"batches/" + testHash.Hex(),
+		"batches/aliases/sha256/" + Encode(testHash),
+		"batches/ff/cd/" + Encode(testHash),
+	} {
+		_, err := codec.Hash(key)
+		assert.ErrorIs(t, err, ErrInvalidKey, key)
+	}
+}
+
+// ✅ Test the placeholders of a prefix are resolved, and fail without value
+func TestResolvePrefix(t *testing.T) {
+	prefix, err := ResolvePrefix("{network}/{chainid}/", "cardona", 2442)
+	require.NoError(t, err)
+	assert.Equal(t, "cardona/2442/", prefix)
+
+	prefix, err = ResolvePrefix("batches/", "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "batches/", prefix)
+
+	_, err = ResolvePrefix("{network}/{chainid}/", "cardona", 0)
+	assert.ErrorIs(t, err, ErrInvalidPrefix)
+	_, err = ResolvePrefix("{network}/", "", 2442)
+	assert.ErrorIs(t, err, ErrInvalidPrefix)
+	_, err = ResolvePrefix("{rollup}/", "cardona", 2442)
+	assert.ErrorIs(t, err, ErrInvalidPrefix)
+}
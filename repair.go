@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/availproject/cdk-avail-da-server/audit"
+	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/availproject/cdk-avail-da-server/lease"
+	"github.com/availproject/cdk-avail-da-server/service"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// repairJob is the client of the audit log entries of the repair worker
+const repairJob = "repair-worker"
+
+// repairReport is the part of the verification report of the migration tool the
+// objects to repair are read from
+type repairReport struct {
+	Missing []struct {
+		Hash common.Hash `json:"hash"`
+	} `json:"missing"`
+	Corrupted []struct {
+		Hash common.Hash `json:"hash"`
+	} `json:"corrupted"`
+}
+
+// repairWorker restores the objects a verification report found missing or corrupted
+// from Avail, at most budget objects every run
+type repairWorker struct {
+	avail    *da.AvailBackend
+	storage  da.DAProvider
+	auditLog *audit.Logger
+	report   string
+	budget   int
+	// done holds the hashes that were repaired or can't be repaired, they are skipped
+	// when the report is read again
+	done map[common.Hash]bool
+}
+
+// runRepairs repairs the objects of REPAIR_REPORT_FILE every REPAIR_INTERVAL until ctx
+// is done. The report is read again on every run, so a new verification report is
+// picked up without restarting the server. With leases only the server holding the
+// repair lease repairs.
+func runRepairs(ctx context.Context, cfg serverConfig, a *da.AvailBackend, storage da.DAProvider, auditLog *audit.Logger, leases *lease.Leases) {
+	w := &repairWorker{
+		avail:    a,
+		storage:  storage,
+		auditLog: auditLog,
+		report:   cfg.RepairReportFile,
+		budget:   cfg.RepairBudget,
+		done:     make(map[common.Hash]bool),
+	}
+	go func() {
+		ticker := time.NewTicker(cfg.RepairInterval)
+		defer ticker.Stop()
+		for {
+			leases.Run(ctx, lease.JobRepair, 2*cfg.RepairInterval, w.run)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (w *repairWorker) run(ctx context.Context) {
+	hashes, err := w.readReport()
+	if err != nil {
+		log.Printf("Skipping repairs: %v", err)
+		return
+	}
+
+	start := time.Now()
+	attempts, repaired, failed, pending := 0, 0, 0, 0
+	for _, hash := range hashes {
+		if w.done[hash] {
+			continue
+		}
+		if attempts == w.budget || ctx.Err() != nil {
+			pending++
+			continue
+		}
+		attempts++
+
+		size, err := service.RepairObject(w.avail, w.storage, hash)
+		w.record(hash, size, err)
+		switch {
+		case err == nil:
+			repaired++
+			w.done[hash] = true
+		case errors.Is(err, da.ErrNotFound):
+			// Data without attestation can't be read from Avail, it is never retried
+			failed++
+			w.done[hash] = true
+		default:
+			failed++
+		}
+	}
+	if attempts > 0 || pending > 0 {
+		log.Printf("Repaired %d objects of %s, %d failed, %d left for the next run (duration %v)",
+			repaired, w.report, failed, pending, time.Since(start))
+	}
+}
+
+// readReport returns the missing and corrupted hashes of the report
+func (w *repairWorker) readReport() ([]common.Hash, error) {
+	data, err := os.ReadFile(w.report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the repair report: %w", err)
+	}
+	var report repairReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("invalid repair report %s: %w", w.report, err)
+	}
+	hashes := make([]common.Hash, 0, len(report.Missing)+len(report.Corrupted))
+	for _, entry := range report.Missing {
+		hashes = append(hashes, entry.Hash)
+	}
+	for _, entry := range report.Corrupted {
+		hashes = append(hashes, entry.Hash)
+	}
+	return hashes, nil
+}
+
+func (w *repairWorker) record(hash common.Hash, size int, err error) {
+	result := audit.ResultOK
+	if errors.Is(err, da.ErrNotFound) {
+		result = audit.ResultNotFound
+	} else if err != nil {
+		result = audit.ResultError
+	}
+	entry := audit.Entry{Action: audit.ActionRepair, Method: repairJob, Hash: hash, Backend: da.BackendOf(w.storage), Size: size, Result: result}
+	if err := w.auditLog.RecordJob(repairJob, entry); err != nil {
+		log.Printf("Failed to write the audit log: %v", err)
+	}
+}
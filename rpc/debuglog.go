@@ -0,0 +1,128 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// debugHexRegexp matches the long hex strings of JSON payloads, the batch data and
+// hashes, which are summarized in the debug log
+var debugHexRegexp = regexp.MustCompile(`0x[0-9a-fA-F]{32,}`)
+
+// NewDebugLogger logs the request and the response of a sampleRate share of the
+// requests to next, to diagnose client incompatibilities. At most maxPayload bytes of
+// the payloads are logged, binary payloads and the hex data of JSON payloads are
+// summarized by their first bytes. Headers are never logged, they hold the API keys.
+func NewDebugLogger(next http.Handler, sampleRate float64, maxPayload int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rand.Float64() >= sampleRate {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		req := &captureBody{ReadCloser: r.Body, max: maxPayload}
+		r.Body = req
+		resp := &captureWriter{ResponseWriter: w, status: http.StatusOK, max: maxPayload}
+		next.ServeHTTP(resp, r)
+
+		log.Printf("Debug request %s %s from %s: %s", r.Method, r.URL.RequestURI(), r.RemoteAddr, summarizePayload(req.head, req.size))
+		log.Printf("Debug response %s %s: status %d, %s (duration %v)", r.Method, r.URL.Path, resp.status, summarizePayload(resp.head, resp.size), time.Since(start))
+	})
+}
+
+// debugTraceMaxPayload is the most bytes of the JSON of the params and results traced
+// with the rpc debug traces
+const debugTraceMaxPayload = 1024
+
+// debugJSON returns the JSON of v for the rpc debug traces, with its hex data
+// summarized
+func debugJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", err)
+	}
+	return summarizePayload(data[:min(len(data), debugTraceMaxPayload)], len(data))
+}
+
+// captureBody keeps the first max bytes of the request body read by the handler
+type captureBody struct {
+	io.ReadCloser
+	max  int
+	head []byte
+	size int
+}
+
+func (c *captureBody) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.head = appendHead(c.head, p[:n], c.max)
+	c.size += n
+	return n, err
+}
+
+// captureWriter keeps the status and the first max bytes of the response
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	max    int
+	head   []byte
+	size   int
+}
+
+func (c *captureWriter) WriteHeader(status int) {
+	c.status = status
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *captureWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.head = appendHead(c.head, p[:n], c.max)
+	c.size += n
+	return n, err
+}
+
+func appendHead(head, p []byte, max int) []byte {
+	if room := max - len(head); room > 0 {
+		head = append(head, p[:min(room, len(p))]...)
+	}
+	return head
+}
+
+// summarizePayload returns the JSON text of a payload with its hex data summarized,
+// or the first bytes of a binary payload
+func summarizePayload(head []byte, size int) string {
+	if size == 0 {
+		return "empty"
+	}
+	trimmed := bytes.TrimSpace(head)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return fmt.Sprintf("%s (%d bytes)", firstFewBytes(head), size)
+	}
+	truncated := size > len(head)
+	text := debugHexRegexp.ReplaceAllStringFunc(string(trimmed), func(h string) string {
+		// The size of hex data cut by the truncation is unknown
+		if truncated && bytes.HasSuffix(trimmed, []byte(h)) {
+			return h[:18]
+		}
+		return fmt.Sprintf("%s…(%d bytes)", h[:18], (len(h)-2)/2)
+	})
+	if truncated {
+		return fmt.Sprintf("%s… (%d bytes)", text, size)
+	}
+	return text
+}
+
+// firstFewBytes returns the first bytes of b in hex, like the logs of the Avail
+// fallback storage
+func firstFewBytes(b []byte) string {
+	if len(b) < 9 {
+		return fmt.Sprintf("[% x]", b)
+	}
+	return fmt.Sprintf("[% x ... ]", b[:8])
+}
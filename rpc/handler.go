@@ -1,30 +1,59 @@
 package rpc
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/availproject/cdk-avail-da-server/audit"
 	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/availproject/cdk-avail-da-server/logging"
+	"github.com/availproject/cdk-avail-da-server/pkg/daerrors"
 	"github.com/availproject/cdk-avail-da-server/service"
+	"github.com/availproject/cdk-avail-da-server/signature"
+	"github.com/availproject/cdk-avail-da-server/usage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 type RPCRequest struct {
-	JSONRPC string        `json:"jsonrpc"`
-	Method  string        `json:"method"`
-	Params  []interface{} `json:"params"`
-	ID      int           `json:"id"`
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  []interface{}   `json:"params"`
+	ID      json.RawMessage `json:"id"`
 }
 
 type RPCResponse struct {
-	JSONRPC string      `json:"jsonrpc"`
-	Result  interface{} `json:"result,omitempty"`
-	Error   interface{} `json:"error,omitempty"`
-	ID      int         `json:"id"`
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
 }
 
-func NewHandler(a *da.AvailBackend, s *da.S3Backend) http.Handler {
+// methodAliases maps the method names used by other DAC clients to the method
+// serving them, so the server can replace a committee member endpoint
+var methodAliases = map[string]string{
+	"datacom_getOffChainData":  "sync_getOffChainData",
+	"sync_getOffChainDataList": "sync_listOffChainData",
+	"datacom_listOffChainData": "sync_listOffChainData",
+}
+
+// NewHandler serves the JSON-RPC methods, every hash read or stored is recorded in
+// auditLog and the bytes read are accounted to the tenant of the request in meter.
+// Data is stored and returned by the digest of the commitment scheme of the tenant,
+// identified by usage.HeaderTenantKey on store requests. Store requests must carry
+// writeAPIKey and admin requests adminAPIKey as bearer token, an empty key disables them, and the signature of the sequencer checked by
+// signatures when it isn't nil. Batches are resolved by number with batches, nil
+// disables it. Responses with more than maxResponseSize bytes of data are refused,
+// the data is read in parts instead, zero allows any size.
+func NewHandler(a *da.AvailBackend, s da.DAProvider, batches *service.BatchIndex, auditLog *audit.Logger, meter *usage.Meter, signatures *signature.Verifier, writeAPIKey, adminAPIKey string, maxResponseSize int) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
@@ -38,14 +67,259 @@ func NewHandler(a *da.AvailBackend, s *da.S3Backend) http.Handler {
 		var result interface{}
 		var err error
 
-		switch req.Method {
+		method := req.Method
+		if alias, ok := methodAliases[method]; ok {
+			method = alias
+		}
+
+		// The params are only summarized when traced, they hold the batch data
+		if logging.Enabled(logging.RPC) {
+			logging.Debugf(logging.RPC, "RPC request [%s] from %s, params:%s", req.Method, r.RemoteAddr, debugJSON(req.Params))
+		}
+
+		tenant := meter.Tenant(r)
+		switch method {
 		case "sync_getOffChainData":
+			// The data availability message of the sequence is an optional second param
+			if len(req.Params) != 1 && len(req.Params) != 2 {
+				err = ErrInvalidParams
+				break
+			}
+			var dam []byte
+			if len(req.Params) == 2 {
+				encoded, _ := req.Params[1].(string)
+				if dam, err = hexutil.Decode(encoded); err != nil {
+					err = ErrInvalidParams
+					break
+				}
+			}
+			if err = quotaError(meter.Allow(tenant)); err != nil {
+				break
+			}
+			hash, _ := req.Params[0].(string)
+			var data string
+			data, err = service.GetOffChainData(a, s, hash, dam)
+			if err == nil {
+				err = service.CheckResponseSize(hexSize(data), maxResponseSize)
+			}
+			recordAccess(auditLog, r, audit.ActionGet, da.BackendOf(s), req.Method, common.HexToHash(hash), hexSize(data), err)
+			if err != nil {
+				break
+			}
+			result = data
+			meter.Add(tenant, hexSize(data))
+		case "sync_getOffChainDataRange":
+			if len(req.Params) != 3 {
+				err = ErrInvalidParams
+				break
+			}
+			hash, _ := req.Params[0].(string)
+			offset, okOffset := uintParam(req.Params[1])
+			length, okLength := uintParam(req.Params[2])
+			if !okOffset || !okLength {
+				err = ErrInvalidParams
+				break
+			}
+			if err = quotaError(meter.Allow(tenant)); err != nil {
+				break
+			}
+			var part service.DataRange
+			part, err = service.GetOffChainDataRange(s, hash, offset, length, maxResponseSize)
+			if errors.Is(err, service.ErrInvalidRange) {
+				err = &RPCError{Code: ErrInvalidParams.Code, Message: err.Error()}
+			}
+			recordAccess(auditLog, r, audit.ActionGet, da.BackendOf(s), req.Method, common.HexToHash(hash), hexSize(part.Data), err)
+			if err != nil {
+				break
+			}
+			result = part
+			meter.Add(tenant, hexSize(part.Data))
+		case "da_getBlobInfo":
 			if len(req.Params) != 1 {
 				err = ErrInvalidParams
 				break
 			}
 			hash, _ := req.Params[0].(string)
-			result, err = service.GetOffChainData(a, s, hash)
+			if _, ok := parseHash(hash); !ok {
+				err = ErrInvalidParams
+				break
+			}
+			result, err = service.GetBlobInfo(s, hash)
+		case "sync_listOffChainData":
+			if len(req.Params) != 1 {
+				err = ErrInvalidParams
+				break
+			}
+			hashes, ok := stringParams(req.Params[0])
+			if !ok {
+				err = ErrInvalidParams
+				break
+			}
+			if err = quotaError(meter.Allow(tenant)); err != nil {
+				break
+			}
+			var list map[common.Hash]string
+			list, err = service.ListOffChainData(a, s, hashes)
+			if err == nil {
+				size := 0
+				for _, data := range list {
+					size += hexSize(data)
+				}
+				err = service.CheckResponseSize(size, maxResponseSize)
+			}
+			result = list
+			if err == nil {
+				for _, hash := range hashes {
+					h := common.HexToHash(hash)
+					data, ok := list[h]
+					var missing error
+					if !ok {
+						missing = da.ErrNotFound
+					}
+					meter.Add(tenant, hexSize(data))
+					recordAccess(auditLog, r, audit.ActionGet, da.BackendOf(s), req.Method, h, hexSize(data), missing)
+				}
+			}
+		case "sync_getOffChainDataByBatchNum":
+			if len(req.Params) != 2 {
+				err = ErrInvalidParams
+				break
+			}
+			start, okStart := uintParam(req.Params[0])
+			end, okEnd := uintParam(req.Params[1])
+			if !okStart || !okEnd {
+				err = ErrInvalidParams
+				break
+			}
+			if err = quotaError(meter.Allow(tenant)); err != nil {
+				break
+			}
+			var list []service.BatchData
+			list, err = service.GetOffChainDataByBatchNum(batches, s, start, end)
+			if err == nil {
+				size := 0
+				for _, batch := range list {
+					size += hexSize(batch.Data)
+				}
+				if err = service.CheckResponseSize(size, maxResponseSize); err != nil {
+					list = nil
+				}
+			}
+			result = list
+			for _, batch := range list {
+				meter.Add(tenant, hexSize(batch.Data))
+				recordAccess(auditLog, r, audit.ActionGet, da.BackendOf(s), req.Method, batch.Hash, hexSize(batch.Data), nil)
+			}
+		case "sync_storeOffChainData":
+			if !authorized(r, writeAPIKey) {
+				err = ErrUnauthorized
+				break
+			}
+			if len(req.Params) < 1 || len(req.Params) > 2 {
+				err = ErrInvalidParams
+				break
+			}
+			var data []byte
+			var hash *common.Hash
+			data, hash, err = storeParams(req.Params)
+			if err != nil {
+				break
+			}
+			var writer string
+			if writer, err = meter.WriteTenant(r); err != nil {
+				err = &RPCError{Code: ErrCodeUnauthorized, Message: err.Error()}
+				break
+			}
+			var claim *signature.Claim
+			if claim, err = signatures.Verify(r, crypto.Keccak256Hash(data)); err != nil {
+				err = &RPCError{Code: ErrCodeUnauthorized, Message: err.Error()}
+				break
+			}
+			var stored common.Hash
+			stored, err = service.StoreOffChainData(s, data, hash, meter.Scheme(writer))
+			claim.Done(err)
+			result = stored
+			if errors.Is(err, service.ErrHashMismatch) || errors.Is(err, service.ErrDataTooLarge) {
+				err = &RPCError{Code: ErrInvalidParams.Code, Message: err.Error()}
+			}
+			recordAccess(auditLog, r, audit.ActionPut, da.BackendOf(s), req.Method, stored, len(data), err)
+		case "admin_repairObject":
+			if !authorized(r, adminAPIKey) {
+				err = ErrAdminUnauthorized
+				break
+			}
+			if len(req.Params) != 1 {
+				err = ErrInvalidParams
+				break
+			}
+			str, _ := req.Params[0].(string)
+			hash, ok := parseHash(str)
+			if !ok {
+				err = ErrInvalidParams
+				break
+			}
+			var size int
+			size, err = service.RepairObject(a, s, hash)
+			result = RepairResult{Hash: hash, Size: size}
+			recordAccess(auditLog, r, audit.ActionRepair, da.BackendOf(s), req.Method, hash, size, err)
+		case "admin_undeleteObject":
+			if !authorized(r, adminAPIKey) {
+				err = ErrAdminUnauthorized
+				break
+			}
+			if len(req.Params) != 1 {
+				err = ErrInvalidParams
+				break
+			}
+			str, _ := req.Params[0].(string)
+			hash, ok := parseHash(str)
+			if !ok {
+				err = ErrInvalidParams
+				break
+			}
+			err = service.UndeleteObject(s, hash)
+			result = UndeleteResult{Hash: hash}
+			recordAccess(auditLog, r, audit.ActionUndelete, da.BackendOf(s), req.Method, hash, 0, err)
+		case "admin_trainDictionary":
+			if !authorized(r, adminAPIKey) {
+				err = ErrAdminUnauthorized
+				break
+			}
+			if len(req.Params) > 1 {
+				err = ErrInvalidParams
+				break
+			}
+			samples := uint64(service.DefaultDictionarySamples)
+			if len(req.Params) == 1 {
+				var ok bool
+				samples, ok = uintParam(req.Params[0])
+				if !ok || samples == 0 {
+					err = ErrInvalidParams
+					break
+				}
+			}
+			result, err = service.TrainDictionary(s, int(samples))
+		case "admin_setLogLevel":
+			if !authorized(r, adminAPIKey) {
+				err = ErrAdminUnauthorized
+				break
+			}
+			params, ok := stringParams(req.Params)
+			if !ok || len(params) == 0 {
+				err = ErrInvalidParams
+				break
+			}
+			if setErr := logging.SetLevel(params[0], params[1:]...); setErr != nil {
+				err = &RPCError{Code: ErrInvalidParams.Code, Message: setErr.Error()}
+				break
+			}
+			result = logging.State()
+		case "admin_getUsage":
+			if !authorized(r, adminAPIKey) {
+				err = ErrAdminUnauthorized
+				break
+			}
+			result = meter.Usage()
 		default:
 			err = ErrMethodNotFound
 		}
@@ -53,9 +327,13 @@ func NewHandler(a *da.AvailBackend, s *da.S3Backend) http.Handler {
 		resp := RPCResponse{JSONRPC: "2.0", ID: req.ID}
 		if err != nil {
 			log.Printf("RPC request failed [%s]: %v (duration %v)", req.Method, err, time.Since(start))
-			resp.Error = err.Error()
+			// Errors are JSON-RPC error objects, which DAC clients decode
+			resp.Error = rpcError(err)
 		} else {
 			log.Printf("RPC request succeeded [%s] (duration %v)", req.Method, time.Since(start))
+			if logging.Enabled(logging.RPC) {
+				logging.Debugf(logging.RPC, "RPC response [%s] result:%s", req.Method, debugJSON(result))
+			}
 			resp.Result = result
 		}
 
@@ -66,11 +344,172 @@ func NewHandler(a *da.AvailBackend, s *da.S3Backend) http.Handler {
 	})
 }
 
+// recordAccess appends the read or the store of hash in backend to the audit log
+func recordAccess(auditLog *audit.Logger, r *http.Request, action, backend, method string, hash common.Hash, size int, err error) {
+	result := audit.ResultOK
+	if errors.Is(err, da.ErrNotFound) {
+		result = audit.ResultNotFound
+	} else if err != nil {
+		result = audit.ResultError
+	}
+	entry := audit.Entry{Action: action, Method: method, Hash: hash, Backend: backend, Size: size, Result: result}
+	if err := auditLog.Record(r, entry); err != nil {
+		log.Printf("Failed to write the audit log: %v", err)
+	}
+}
+
+// rpcError returns the JSON-RPC error of err, with the code of its kind in daerrors so
+// clients can tell missing data from a request to retry
+func rpcError(err error) *RPCError {
+	if rpcErr, ok := err.(*RPCError); ok {
+		return rpcErr
+	}
+	if errors.Is(err, service.ErrResponseTooLarge) {
+		return &RPCError{Code: ErrCodeResponseTooLarge, Message: err.Error()}
+	}
+	code := ErrCodeServer
+	switch daerrors.Kind(err) {
+	case daerrors.ErrNotFound:
+		code = ErrCodeNotFound
+	case daerrors.ErrBackendUnavailable:
+		code = ErrCodeBackendUnavailable
+	case daerrors.ErrIntegrityMismatch:
+		code = ErrCodeIntegrityMismatch
+	case daerrors.ErrUnauthorized:
+		code = ErrCodeUnauthorized
+	case daerrors.ErrTimeout:
+		code = ErrCodeTimeout
+	}
+	return &RPCError{Code: code, Message: err.Error()}
+}
+
+// quotaError returns the JSON-RPC error of a request over the quota of its tenant
+func quotaError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RPCError{Code: ErrCodeQuotaExceeded, Message: err.Error()}
+}
+
+// hexSize returns the size of the 0x prefixed hex encoded data
+func hexSize(data string) int {
+	if len(data) < 2 {
+		return 0
+	}
+	return (len(data) - 2) / 2
+}
+
+// stringParams returns the param as a list of strings
+func stringParams(param interface{}) ([]string, bool) {
+	items, ok := param.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	strs := make([]string, 0, len(items))
+	for _, item := range items {
+		str, ok := item.(string)
+		if !ok {
+			return nil, false
+		}
+		strs = append(strs, str)
+	}
+	return strs, true
+}
+
+// uintParam returns an unsigned integer param, e.g. a batch number or an offset, a
+// JSON number or a decimal or 0x prefixed hex string
+func uintParam(param interface{}) (uint64, bool) {
+	switch v := param.(type) {
+	case float64:
+		if v < 0 || v != math.Trunc(v) || v > 1<<53 {
+			return 0, false
+		}
+		return uint64(v), true
+	case string:
+		if n, err := hexutil.DecodeUint64(v); err == nil {
+			return n, true
+		}
+		n, err := strconv.ParseUint(v, 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// storeParams returns the hex encoded data of a store request and the hash it was
+// sent with, nil when the client left it to the server
+func storeParams(params []interface{}) ([]byte, *common.Hash, error) {
+	encoded, ok := params[0].(string)
+	if !ok {
+		return nil, nil, ErrInvalidParams
+	}
+	data, err := hexutil.Decode(encoded)
+	if err != nil {
+		return nil, nil, ErrInvalidParams
+	}
+	if len(params) == 1 {
+		return data, nil, nil
+	}
+	str, _ := params[1].(string)
+	hash, ok := parseHash(str)
+	if !ok {
+		return nil, nil, ErrInvalidParams
+	}
+	return data, &hash, nil
+}
+
+// authorized returns whether the request carries key as bearer token, never when key
+// is empty
+func authorized(r *http.Request, key string) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && key != "" && subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1
+}
+
+const (
+	// ErrCodeServer is the code of the errors returned while serving a request that
+	// have no other code
+	ErrCodeServer = -32000
+	// ErrCodeUnauthorized is the code of the requests without the api key they need
+	ErrCodeUnauthorized = -32001
+	// ErrCodeBackendUnavailable is the code of the requests that failed on a backend,
+	// they may succeed when retried
+	ErrCodeBackendUnavailable = -32003
+	// ErrCodeNotFound is the code of the requests of data no backend holds
+	ErrCodeNotFound = -32004
+	// ErrCodeQuotaExceeded is the code of the requests of a tenant over its monthly
+	// bandwidth quota
+	ErrCodeQuotaExceeded = -32005
+	// ErrCodeIntegrityMismatch is the code of the requests of stored data that doesn't
+	// match its hash
+	ErrCodeIntegrityMismatch = -32006
+	// ErrCodeTimeout is the code of the requests a backend didn't answer in time, they
+	// may succeed when retried
+	ErrCodeTimeout = -32008
+	// ErrCodeResponseTooLarge is the code of the requests whose data is over the
+	// response size limit, it is read in parts with sync_getOffChainDataRange
+	ErrCodeResponseTooLarge = -32009
+)
+
 var (
 	ErrInvalidParams  = &RPCError{Code: -32602, Message: "Invalid params"}
 	ErrMethodNotFound = &RPCError{Code: -32601, Message: "Method not found"}
+	ErrUnauthorized   = &RPCError{Code: ErrCodeUnauthorized, Message: "Unauthorized, store requests need the write api key"}
+	// ErrAdminUnauthorized is returned for admin requests without the admin api key
+	ErrAdminUnauthorized = &RPCError{Code: ErrCodeUnauthorized, Message: "Unauthorized, admin requests need the admin api key"}
 )
 
+// RepairResult is the result of admin_repairObject, the hash rewritten into the
+// storage and the size of its data
+type RepairResult struct {
+	Hash common.Hash `json:"hash"`
+	Size int         `json:"size"`
+}
+
+// UndeleteResult is the result of admin_undeleteObject, the hash restored into the
+// storage
+type UndeleteResult struct {
+	Hash common.Hash `json:"hash"`
+}
+
 type RPCError struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
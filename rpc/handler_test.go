@@ -0,0 +1,168 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/availproject/cdk-avail-da-server/da/mock"
+	"github.com/availproject/cdk-avail-da-server/usage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testWriteAPIKey = "write-key"
+
+func newTestMeter(t *testing.T) *usage.Meter {
+	meter, err := usage.New([]usage.Tenant{
+		{Name: "rollup-a", APIKey: "key-a"},
+		{Name: "rollup-b", APIKey: "key-b", Scheme: da.SchemeSHA256},
+	}, "")
+	require.NoError(t, err)
+	return meter
+}
+
+// rpcCall sends the JSON-RPC request to the handler with the headers
+func rpcCall(t *testing.T, h http.Handler, method string, params []interface{}, headers map[string]string) RPCResponse {
+	body, err := json.Marshal(RPCRequest{JSONRPC: "2.0", Method: method, Params: params, ID: json.RawMessage("1")})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/rpc", bytes.NewReader(body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var resp RPCResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return resp
+}
+
+// ✅ Test store requests are answered in the commitment scheme of the tenant of their tenant key
+func TestStoreOffChainDataTenantScheme(t *testing.T) {
+	data := []byte("batch-1")
+	keccak := crypto.Keccak256Hash(data)
+	sha := common.Hash(sha256.Sum256(data))
+	h := NewHandler(nil, mock.New(), nil, nil, newTestMeter(t), nil, testWriteAPIKey, "", 0)
+	bearer := "Bearer " + testWriteAPIKey
+
+	resp := rpcCall(t, h, "sync_storeOffChainData", []interface{}{hexutil.Encode(data)}, map[string]string{"Authorization": bearer})
+	require.Nil(t, resp.Error)
+	assert.Equal(t, keccak.Hex(), resp.Result)
+
+	resp = rpcCall(t, h, "sync_storeOffChainData", []interface{}{hexutil.Encode(data), sha.Hex()},
+		map[string]string{"Authorization": bearer, usage.HeaderTenantKey: "key-b"})
+	require.Nil(t, resp.Error)
+	assert.Equal(t, sha.Hex(), resp.Result)
+
+	// ❌ The sha256 digest isn't the keccak256 of another tenant
+	resp = rpcCall(t, h, "sync_storeOffChainData", []interface{}{hexutil.Encode(data), sha.Hex()},
+		map[string]string{"Authorization": bearer, usage.HeaderTenantKey: "key-a"})
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, ErrInvalidParams.Code, resp.Error.Code)
+
+	// ❌ Tenant key of no tenant
+	resp = rpcCall(t, h, "sync_storeOffChainData", []interface{}{hexutil.Encode(data)},
+		map[string]string{"Authorization": bearer, usage.HeaderTenantKey: "key-c"})
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, ErrCodeUnauthorized, resp.Error.Code)
+
+	// ❌ The tenant key doesn't replace the write api key
+	resp = rpcCall(t, h, "sync_storeOffChainData", []interface{}{hexutil.Encode(data)},
+		map[string]string{"Authorization": "Bearer key-b", usage.HeaderTenantKey: "key-b"})
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, ErrCodeUnauthorized, resp.Error.Code)
+}
+
+// ✅ Test REST stores are checked and answered in the commitment scheme of the tenant
+func TestStoreHandlerTenantScheme(t *testing.T) {
+	data := []byte("batch-1")
+	sha := common.Hash(sha256.Sum256(data))
+	h := NewStoreHandler(mock.New(), nil, newTestMeter(t), nil, testWriteAPIKey)
+
+	put := func(hash common.Hash, tenantKey string) *httptest.ResponseRecorder {
+		mux := http.NewServeMux()
+		mux.Handle("PUT /data/{hash}", h)
+		req := httptest.NewRequest(http.MethodPut, "/data/"+hash.Hex(), bytes.NewReader(data))
+		req.Header.Set("Authorization", "Bearer "+testWriteAPIKey)
+		if tenantKey != "" {
+			req.Header.Set(usage.HeaderTenantKey, tenantKey)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := put(sha, "key-b")
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var body map[string]common.Hash
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, sha, body["hash"])
+
+	// ❌ Without tenant key the sha256 digest doesn't match
+	assert.Equal(t, http.StatusBadRequest, put(sha, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, put(sha, "key-c").Code)
+}
+
+// ✅ Test the data read over JSON-RPC is accounted to the tenant and its quota enforced
+func TestGetOffChainDataQuota(t *testing.T) {
+	data := make([]byte, 60)
+	hash := crypto.Keccak256Hash(data)
+	s := mock.New()
+	require.NoError(t, s.Put(context.Background(), hash, data))
+	meter, err := usage.New([]usage.Tenant{{Name: "rollup-a", APIKey: "key-a", QuotaBytes: 100}}, "")
+	require.NoError(t, err)
+	h := NewHandler(nil, s, nil, nil, meter, nil, "", "", 0)
+	tenant := map[string]string{"Authorization": "Bearer key-a"}
+
+	for i := 0; i < 2; i++ {
+		resp := rpcCall(t, h, "sync_getOffChainData", []interface{}{hash.Hex()}, tenant)
+		require.Nil(t, resp.Error)
+		assert.Equal(t, hexutil.Encode(data), resp.Result)
+	}
+	assert.Equal(t, uint64(120), meter.Usage()["rollup-a"].Bytes)
+
+	// ❌ The quota is used, also through the method aliases
+	resp := rpcCall(t, h, "sync_getOffChainData", []interface{}{hash.Hex()}, tenant)
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, ErrCodeQuotaExceeded, resp.Error.Code)
+	resp = rpcCall(t, h, "datacom_getOffChainData", []interface{}{hash.Hex()}, tenant)
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, ErrCodeQuotaExceeded, resp.Error.Code)
+
+	resp = rpcCall(t, h, "sync_getOffChainData", []interface{}{hash.Hex()}, nil)
+	require.Nil(t, resp.Error)
+	assert.Equal(t, uint64(60), meter.Usage()[usage.Anonymous].Bytes)
+}
+
+// ✅ Test only the bytes of the parts returned are accounted to the tenant
+func TestGetOffChainDataRangeQuota(t *testing.T) {
+	data := make([]byte, 60)
+	hash := crypto.Keccak256Hash(data)
+	s := mock.New()
+	require.NoError(t, s.Put(context.Background(), hash, data))
+	meter := newTestMeter(t)
+	h := NewHandler(nil, s, nil, nil, meter, nil, "", "", 0)
+	tenant := map[string]string{"Authorization": "Bearer key-a"}
+
+	resp := rpcCall(t, h, "sync_getOffChainDataRange", []interface{}{hash.Hex(), 50, 20}, tenant)
+	require.Nil(t, resp.Error)
+	assert.Equal(t, uint64(10), meter.Usage()["rollup-a"].Bytes, "the part is cut at the end of the data")
+
+	// ❌ Failed reads aren't accounted
+	resp = rpcCall(t, h, "sync_getOffChainDataRange", []interface{}{hash.Hex(), 61, 20}, tenant)
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, ErrInvalidParams.Code, resp.Error.Code)
+	resp = rpcCall(t, h, "sync_getOffChainDataRange", []interface{}{common.Hash{1}.Hex(), 0, 20}, tenant)
+	require.NotNil(t, resp.Error)
+	assert.Nil(t, resp.Result)
+	assert.Equal(t, uint64(10), meter.Usage()["rollup-a"].Bytes)
+}
@@ -0,0 +1,73 @@
+package rpc
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// ErrCodeInternal is the code of the requests whose handler panicked
+const ErrCodeInternal = -32603
+
+// NewRecoverer recovers the panics of next, so a bug fails the request instead of
+// dropping the connection. The panic is logged with its stack trace and the request,
+// and passed to onPanic with the route pattern of the request, e.g. to count it in
+// the metrics. Requests of the RPC endpoint are answered with a JSON-RPC internal
+// error, the others with a 500.
+func NewRecoverer(next http.Handler, onPanic func(pattern string)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tracked := &headerWriter{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// ErrAbortHandler aborts the response on purpose, net/http handles it
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			pattern := r.Pattern
+			if pattern == "" {
+				pattern = r.URL.Path
+			}
+			log.Printf("Panic serving %s %s from %s: %v\n%s", r.Method, r.URL.RequestURI(), r.RemoteAddr, v, debug.Stack())
+			if onPanic != nil {
+				onPanic(pattern)
+			}
+			// The status is already sent when the handler started the response
+			if tracked.wroteHeader {
+				return
+			}
+			if r.URL.Path != "/rpc" {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+			// Like the other errors of the handler it is sent with a 200, which DAC
+			// clients expect. The id of the request was read by the handler, it can't be
+			// echoed.
+			resp := RPCResponse{JSONRPC: "2.0", Error: &RPCError{Code: ErrCodeInternal, Message: "Internal error"}, ID: json.RawMessage("null")}
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(resp); err != nil {
+				log.Printf("Failed to encode response: %v", err)
+			}
+		}()
+		next.ServeHTTP(tracked, r)
+	})
+}
+
+// headerWriter records whether the response was started
+type headerWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (h *headerWriter) WriteHeader(status int) {
+	h.wroteHeader = true
+	h.ResponseWriter.WriteHeader(status)
+}
+
+func (h *headerWriter) Write(p []byte) (int, error) {
+	h.wroteHeader = true
+	return h.ResponseWriter.Write(p)
+}
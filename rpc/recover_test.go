@@ -0,0 +1,51 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ✅ Test panics fail the request they happened in
+func TestRecoverer(t *testing.T) {
+	var panics []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /rpc", func(w http.ResponseWriter, r *http.Request) { panic("bug") })
+	mux.HandleFunc("GET /data/{hash}", func(w http.ResponseWriter, r *http.Request) { panic("bug") })
+	mux.HandleFunc("GET /started", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		panic("bug")
+	})
+	mux.HandleFunc("GET /abort", func(w http.ResponseWriter, r *http.Request) { panic(http.ErrAbortHandler) })
+	h := NewRecoverer(mux, func(pattern string) { panics = append(panics, pattern) })
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	// JSON-RPC clients get an internal error with a 200
+	rec := serve(http.MethodPost, "/rpc")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp RPCResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.NotNil(t, resp.Error)
+	assert.Equal(t, ErrCodeInternal, resp.Error.Code)
+
+	assert.Equal(t, http.StatusInternalServerError, serve(http.MethodGet, "/data/0x01").Code)
+	// The status already sent is kept
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/started").Code)
+	assert.Equal(t, []string{"POST /rpc", "GET /data/{hash}", "GET /started"}, panics)
+
+	// ❌ Aborted responses are left to net/http
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() { serve(http.MethodGet, "/abort") })
+	assert.Len(t, panics, 3)
+
+	// Requests that don't panic are untouched
+	mux.HandleFunc("GET /ok", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodGet, "/ok").Code)
+}
@@ -0,0 +1,202 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/availproject/cdk-avail-da-server/audit"
+	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/availproject/cdk-avail-da-server/logging"
+	"github.com/availproject/cdk-avail-da-server/service"
+	"github.com/availproject/cdk-avail-da-server/signature"
+	"github.com/availproject/cdk-avail-da-server/usage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// dataCacheControl lets CDNs and reverse proxies cache the data forever, it is
+// addressed by its hash and never changes
+const dataCacheControl = "public, max-age=31536000, immutable"
+
+// NewDataHandler serves the data of a hash on GET /data/{hash}, its keccak256 or
+// sha256. The hash is the ETag of the data, so requests with a matching If-None-Match
+// are answered with 304, and those with If-None-Match * once the data is found. Range
+// requests are answered with the parts of the data they
+// ask for. Every read of the bucket is recorded in auditLog and
+// accounted to the tenant of the request in meter.
+func NewDataHandler(s da.DAProvider, auditLog *audit.Logger, meter *usage.Meter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		hash, ok := parseHash(r.PathValue("hash"))
+		if !ok {
+			http.Error(w, "invalid hash", http.StatusBadRequest)
+			return
+		}
+		etag := `"` + hash.Hex() + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", dataCacheControl)
+
+		// The data of a hash never changes, a client holding its ETag needs no lookup
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		tenant := meter.Tenant(r)
+		if err := meter.Allow(tenant); err != nil {
+			w.Header().Del("ETag")
+			w.Header().Set("Cache-Control", "no-store")
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+
+		logging.Debugf(logging.RPC, "Data request [%s] from %s, tenant:%s, range:%q", hash.Hex(), r.RemoteAddr, tenant, r.Header.Get("Range"))
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+		data, err := service.Lookup(ctx, s, hash)
+		recordAccess(auditLog, r, audit.ActionGet, da.BackendOf(s), "rest", hash, len(data), err)
+		if errors.Is(err, da.ErrNotFound) {
+			// Missing data may still be uploaded, it must not be cached
+			w.Header().Del("ETag")
+			w.Header().Set("Cache-Control", "no-store")
+			http.Error(w, "data not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Data request failed [%s]: %v (duration %v)", hash.Hex(), err, time.Since(start))
+			w.Header().Del("ETag")
+			w.Header().Set("Cache-Control", "no-store")
+			http.Error(w, "failed to retrieve the data from off-chain DA", http.StatusInternalServerError)
+			return
+		}
+		// Cached responses are never checked again, corrupted data is never served
+		if err := service.Verify(hash, data); err != nil {
+			log.Printf("Data request failed [%s]: %v", hash.Hex(), err)
+			w.Header().Del("ETag")
+			w.Header().Set("Cache-Control", "no-store")
+			http.Error(w, "stored data doesn't match the hash", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Data request succeeded [%s] (duration %v)", hash.Hex(), time.Since(start))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		// Range requests read large data in parts, only the bytes sent are accounted.
+		// ServeContent answers If-None-Match * with 304 now that the data exists.
+		counter := &countWriter{ResponseWriter: w}
+		http.ServeContent(counter, r, "", time.Time{}, bytes.NewReader(data))
+		meter.Add(tenant, counter.size)
+	})
+}
+
+// countWriter counts the bytes of the response body
+type countWriter struct {
+	http.ResponseWriter
+	size int
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.size += n
+	return n, err
+}
+
+// parseHash parses a 32 byte hex hash, with or without 0x prefix
+func parseHash(s string) (common.Hash, bool) {
+	s = strings.TrimPrefix(strings.ToLower(s), "0x")
+	if len(s) != 2*common.HashLength {
+		return common.Hash{}, false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return common.Hash{}, false
+		}
+	}
+	return common.HexToHash(s), true
+}
+
+// etagMatches returns whether the If-None-Match header lists etag. Weak validators
+// match too, the comparison of If-None-Match is weak. * doesn't match, it only holds
+// when the data exists.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if strings.EqualFold(candidate, etag) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewStoreHandler stores the request body on PUT /data/{hash} and POST /data, and
+// answers with the digest of the body in the commitment scheme of the tenant of the
+// request in meter, identified by usage.HeaderTenantKey. A PUT whose hash doesn't
+// match the body is rejected. Requests
+// must carry writeAPIKey as bearer token, and the signature of the sequencer checked
+// by signatures when it isn't nil.
+func NewStoreHandler(s da.DAProvider, auditLog *audit.Logger, meter *usage.Meter, signatures *signature.Verifier, writeAPIKey string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		if !authorized(r, writeAPIKey) {
+			http.Error(w, "unauthorized, store requests need the write api key", http.StatusUnauthorized)
+			return
+		}
+		tenant, err := meter.WriteTenant(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		var hash *common.Hash
+		if param := r.PathValue("hash"); param != "" {
+			h, ok := parseHash(param)
+			if !ok {
+				http.Error(w, "invalid hash", http.StatusBadRequest)
+				return
+			}
+			hash = &h
+		}
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, service.MaxStoreOffChainData))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		logging.Debugf(logging.RPC, "Store request from %s, size:%d, signed:%t", r.RemoteAddr, len(data), r.Header.Get(signature.HeaderSignature) != "")
+		claim, err := signatures.Verify(r, crypto.Keccak256Hash(data))
+		if err != nil {
+			logging.Debugf(logging.RPC, "Store request from %s refused: %v", r.RemoteAddr, err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		stored, err := service.StoreOffChainData(s, data, hash, meter.Scheme(tenant))
+		claim.Done(err)
+		recordAccess(auditLog, r, audit.ActionPut, da.BackendOf(s), "rest", stored, len(data), err)
+		switch {
+		case errors.Is(err, service.ErrHashMismatch):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, da.ErrReadOnly):
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case err != nil:
+			log.Printf("Store request failed [%s]: %v (duration %v)", stored.Hex(), err, time.Since(start))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Store request succeeded [%s] (duration %v)", stored.Hex(), time.Since(start))
+		w.Header().Set("Location", "/data/"+stored.Hex())
+		w.Header().Set("ETag", `"`+stored.Hex()+`"`)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]common.Hash{"hash": stored})
+	})
+}
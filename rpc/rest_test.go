@@ -0,0 +1,99 @@
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/availproject/cdk-avail-da-server/da/mock"
+	"github.com/availproject/cdk-avail-da-server/usage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ✅ Test the bytes served over REST are accounted to the tenant and its quota enforced
+func TestDataHandlerQuota(t *testing.T) {
+	data := make([]byte, 60)
+	hash := crypto.Keccak256Hash(data)
+	s := mock.New()
+	require.NoError(t, s.Put(context.Background(), hash, data))
+	meter, err := usage.New([]usage.Tenant{{Name: "rollup-a", APIKey: "key-a", QuotaBytes: 100}}, "")
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /data/{hash}", NewDataHandler(s, nil, meter))
+	get := func(hash common.Hash, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/data/"+hash.Hex(), nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	tenant := map[string]string{"Authorization": "Bearer key-a"}
+
+	rec := get(hash, tenant)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, data, rec.Body.Bytes())
+	assert.Equal(t, uint64(60), meter.Usage()["rollup-a"].Bytes)
+
+	// Only the bytes of a range are accounted
+	rec = get(hash, map[string]string{"Authorization": "Bearer key-a", "Range": "bytes=0-9"})
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, uint64(70), meter.Usage()["rollup-a"].Bytes)
+
+	// Missing data isn't accounted
+	assert.Equal(t, http.StatusNotFound, get(common.Hash{1}, tenant).Code)
+	assert.Equal(t, uint64(70), meter.Usage()["rollup-a"].Bytes)
+
+	rec = get(hash, tenant)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, uint64(130), meter.Usage()["rollup-a"].Bytes)
+
+	// ❌ The quota is used, the refusal must not be cached
+	rec = get(hash, tenant)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	assert.Empty(t, rec.Header().Get("ETag"))
+
+	// Other tenants aren't limited by it
+	assert.Equal(t, http.StatusOK, get(hash, nil).Code)
+	assert.Equal(t, uint64(60), meter.Usage()[usage.Anonymous].Bytes)
+}
+
+// ✅ Test If-None-Match is answered with 304 only for the ETag or for data that exists
+func TestDataHandlerIfNoneMatch(t *testing.T) {
+	data := []byte("batch-1")
+	hash := crypto.Keccak256Hash(data)
+	s := mock.New()
+	require.NoError(t, s.Put(context.Background(), hash, data))
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /data/{hash}", NewDataHandler(s, nil, nil))
+	tests := []struct {
+		name        string
+		hash        common.Hash
+		ifNoneMatch string
+		want        int
+	}{
+		{name: "etag", hash: hash, ifNoneMatch: `"` + hash.Hex() + `"`, want: http.StatusNotModified},
+		{name: "weak etag", hash: hash, ifNoneMatch: `"0x01", W/"` + hash.Hex() + `"`, want: http.StatusNotModified},
+		{name: "other etag", hash: hash, ifNoneMatch: `"0x01"`, want: http.StatusOK},
+		{name: "any", hash: hash, ifNoneMatch: "*", want: http.StatusNotModified},
+		// ❌ * doesn't hold for unknown data
+		{name: "any unknown", hash: common.Hash{1}, ifNoneMatch: "*", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/data/"+tt.hash.Hex(), nil)
+			req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/availproject/cdk-avail-da-server/lib/avail"
+	"github.com/availproject/cdk-avail-da-server/pkg/l1"
+)
+
+// backfillStats counts the outcome of a backfill run
+type backfillStats struct {
+	mu        sync.Mutex
+	sequences int
+	batches   int
+	restored  int
+	existing  int
+	failed    int
+}
+
+func (s *backfillStats) add(batches, restored, existing, failed int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sequences++
+	s.batches += batches
+	s.restored += restored
+	s.existing += existing
+	s.failed += failed
+}
+
+// newAvailReader builds the lib/avail backend the sequences are read back with. It
+// never reads the fallback bucket, which is the one being backfilled.
+func newAvailReader(cfg *config) (*avail.AvailBackend, error) {
+	appID, err := cfg.uint("AVAIL_APP_ID", 32)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.get("AVAIL_RPC_URL") == "" || cfg.get("AVAIL_SEED") == "" {
+		return nil, fmt.Errorf("please set AVAIL_RPC_URL and AVAIL_SEED to read sequences from Avail")
+	}
+	config := avail.Config{
+		Seed:       cfg.get("AVAIL_SEED"),
+		AppID:      int(appID),
+		HttpApiUrl: cfg.get("AVAIL_RPC_URL"),
+		TurboDA: avail.TurboDAConfig{
+			ApiUrl: cfg.get("TURBO_DA_URL"),
+			ApiKey: cfg.get("API_KEY"),
+		},
+		ReadPriority: string(avail.ReadPriorityAvailFirst),
+		ProxyUrl:     cfg.get("PROXY_URL"),
+	}
+	attestationAddr := common.HexToAddress(cfg.get("AVAIL_ATTESTATION_ADDRESS"))
+	return avail.New(cfg.get("RPC_URL"), attestationAddr, config, nil)
+}
+
+// backfill repopulates S3 with the batches of the block range, read back from Avail
+// or Turbo DA through the data availability message of every sequence
+func (m *MigrationService) backfill(reader *avail.AvailBackend) error {
+	start, end := m.startBlock.Uint64(), m.endBlock.Uint64()
+	begin := time.Now()
+	stats := &backfillStats{}
+	slots := make(chan struct{}, m.batchConcurrency)
+
+	next := start
+	for from := start; from <= end && m.ctx.Err() == nil && !m.stopping(); from += m.logRangeSize {
+		to := min(from+m.logRangeSize-1, end)
+
+		var sequences map[uint64][]l1.Sequence
+		err := retry(m.ctx, m.maxAttempts, 1*time.Second, func() error {
+			var e error
+			sequences, e = l1.QuerySequencesFromL1ByRange(m.ctx, m.client, m.contractAbi, m.contractAddr, new(big.Int).SetUint64(from), new(big.Int).SetUint64(to))
+			return e
+		})
+		if err != nil {
+			log.Printf("🟦 Blocks %d..%d: error querying sequences from L1: %v", from, to, err)
+			m.recordFailure(failedBatch{Block: from, ToBlock: to, Index: -1, Reason: fmt.Sprintf("L1 query failed: %v", err)})
+			next = to + 1
+			continue
+		}
+
+		blocks := make([]uint64, 0, len(sequences))
+		for block := range sequences {
+			blocks = append(blocks, block)
+		}
+		slices.Sort(blocks)
+
+		var wg sync.WaitGroup
+	schedule:
+		for _, block := range blocks {
+			for _, seq := range sequences[block] {
+				select {
+				case slots <- struct{}{}:
+				case <-m.stop:
+					break schedule
+				case <-m.ctx.Done():
+					break schedule
+				}
+				wg.Add(1)
+				go func(block uint64, seq l1.Sequence) {
+					defer wg.Done()
+					defer func() { <-slots }()
+					m.backfillSequence(reader, block, seq, stats)
+				}(block, seq)
+			}
+		}
+		wg.Wait()
+		if !m.stopping() {
+			next = to + 1
+		}
+		log.Printf("📈 Progress: blocks %d..%d done (%d sequences, %d/%d batches restored, %v elapsed)",
+			start, to, stats.sequences, stats.restored, stats.batches, time.Since(begin).Round(time.Second))
+	}
+
+	if m.stopping() && next <= end {
+		log.Printf("🛑 Backfill interrupted, continue with --start-block %d", next)
+	}
+	log.Printf("🏁 Backfill finished: %d sequences, %d/%d batches restored, %d already in S3, %d failed in %v",
+		stats.sequences, stats.restored, stats.batches, stats.existing, stats.failed, time.Since(begin).Round(time.Second))
+	if stats.failed > 0 {
+		return fmt.Errorf("%d batches couldn't be restored, see %s", stats.failed, m.failures.path)
+	}
+	return nil
+}
+
+// backfillSequence reads the batches of the sequence back from Avail and uploads the
+// ones missing in S3
+func (m *MigrationService) backfillSequence(reader *avail.AvailBackend, block uint64, seq l1.Sequence, stats *backfillStats) {
+	prefix := fmt.Sprintf("🟦 Block %d ➡️ Sequence [Tx: %s]", block, seq.TxHash.Hex())
+	total := len(seq.BatchHashes)
+	if total == 0 {
+		return
+	}
+	if len(seq.DataAvailabilityMessage) == 0 {
+		log.Printf("%s ⏭️ No data availability message, the sequence wasn't posted to Avail", prefix)
+		stats.add(total, 0, 0, 0)
+		return
+	}
+
+	missing := seq.BatchHashes
+	if m.skipExisting {
+		missing = nil
+		for _, h := range seq.BatchHashes {
+			var exists bool
+			err := retry(m.ctx, m.maxAttempts, 1*time.Second, func() error {
+				return m.withTimeout(m.rpcTimeout, func(ctx context.Context) error {
+					var e error
+					exists, e = m.DABackend.Exists(ctx, h, false)
+					return e
+				})
+			})
+			if err != nil || !exists {
+				missing = append(missing, h)
+			}
+		}
+		if len(missing) == 0 {
+			log.Printf("%s ⏭️ All %d batches are already in S3", prefix, total)
+			stats.add(total, 0, total, 0)
+			return
+		}
+	}
+
+	var batchesData [][]byte
+	err := retry(m.ctx, m.maxAttempts, 1*time.Second, func() error {
+		return m.withTimeout(m.rpcTimeout, func(ctx context.Context) error {
+			var e error
+			batchesData, e = reader.GetSequence(ctx, seq.BatchHashes, seq.DataAvailabilityMessage)
+			if e == nil && len(batchesData) != total {
+				e = fmt.Errorf("got %d batches, the sequence has %d", len(batchesData), total)
+			}
+			return e
+		})
+	})
+	if err != nil {
+		log.Printf("%s ⛔ Could not read the sequence from Avail: %v", prefix, err)
+		for i, h := range seq.BatchHashes {
+			if slices.Contains(missing, h) {
+				m.recordFailure(failedBatch{Block: block, Index: i, Hash: &h, Reason: fmt.Sprintf("Avail read failed: %v", err)})
+			}
+		}
+		stats.add(total, 0, total-len(missing), len(missing))
+		return
+	}
+	log.Printf("%s ✅ Read %d batches from Avail", prefix, total)
+
+	restored, failed := 0, 0
+	for i, h := range seq.BatchHashes {
+		if !slices.Contains(missing, h) {
+			continue
+		}
+		batchPrefix := fmt.Sprintf("🟦 Block %d ➡️ Batch %d [Hash: %s]", block, i, h.Hex())
+		data := batchesData[i]
+		if hash := crypto.Keccak256Hash(data); hash != h {
+			log.Printf("%s ⛔ Batch hash mismatch!", batchPrefix)
+			m.recordFailure(failedBatch{Block: block, Index: i, Hash: &h, Reason: fmt.Sprintf("hash mismatch: got %s", hash.Hex())})
+			failed++
+			continue
+		}
+		err := retry(m.ctx, m.maxAttempts, 1*time.Second, func() error {
+			return m.withTimeout(m.uploadTimeout, func(ctx context.Context) error {
+				return m.DABackend.PostDataToDA(ctx, h, data)
+			})
+		})
+		if err != nil {
+			log.Printf("%s ❌ S3 upload failed: %v", batchPrefix, err)
+			m.recordFailure(failedBatch{Block: block, Index: i, Hash: &h, Reason: fmt.Sprintf("S3 upload failed: %v", err)})
+			failed++
+			continue
+		}
+		log.Printf("%s ✅ Restored to S3", batchPrefix)
+		m.metrics.batches.WithLabelValues("ok").Inc()
+		m.metrics.bytesUploaded.Add(float64(len(data)))
+		restored++
+	}
+	stats.add(total, restored, total-len(missing), failed)
+}
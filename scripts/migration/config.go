@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/joho/godotenv"
+	"github.com/spf13/pflag"
+)
+
+// setting is a configuration value that can be set with a flag, an environment
+// variable or the config file
+type setting struct {
+	flag  string
+	env   string
+	def   string
+	usage string
+}
+
+var settings = []setting{
+	{"rpc-url", "RPC_URL", "", "L1 RPC URL"},
+	{"archive-rpc-url", "ARCHIVE_RPC_URL", "", "archive L1 RPC URL used for old blocks the RPC_URL node pruned"},
+	{"proxy-url", "PROXY_URL", "", "proxy the L1, DAC, Turbo DA and Avail requests are sent through, HTTP_PROXY and HTTPS_PROXY are used when empty"},
+	{"dac-url", "DAC_URL", "", "comma separated DAC member RPC URLs the batch data is read from, tried in turn on failure"},
+	{"dac-username", "DAC_USERNAME", "", "username of the basic authentication sent to the DAC members"},
+	{"dac-password", "DAC_PASSWORD", "", "password of the basic authentication sent to the DAC members"},
+	{"dac-bearer-token", "DAC_BEARER_TOKEN", "", "bearer token sent to the DAC members"},
+	{"dac-headers", "DAC_HEADERS", "", "comma separated Name: value headers sent to the DAC members"},
+	{"contract-address", "CONTRACT_ADDRESS", "", "validium contract address"},
+	{"rollup-manager-address", "ROLLUP_MANAGER_ADDRESS", "", "rollup manager the validium contract is discovered from when contract-address is not set"},
+	{"rollup-id", "ROLLUP_ID", "", "rollup id in the rollup manager"},
+	{"rollup-chain-id", "ROLLUP_CHAIN_ID", "", "rollup chain id in the rollup manager, used when rollup-id is not set"},
+	{"start-block", "START_BLOCK", "", "first L1 block of the range"},
+	{"end-block", "END_BLOCK", "", "last L1 block of the range"},
+	{"da-targets", "DA_TARGETS", "turboda,s3", "comma separated DA targets the batches are posted to: turboda, avail and s3"},
+	{"turbo-da-url", "TURBO_DA_URL", "", "Turbo DA API URL"},
+	{"api-key", "API_KEY", "", "Turbo DA API key"},
+	{"avail-rpc-url", "AVAIL_RPC_URL", "", "Avail RPC URL used by the avail target"},
+	{"avail-seed", "AVAIL_SEED", "", "seed of the Avail account used by the avail target"},
+	{"avail-app-id", "AVAIL_APP_ID", "", "Avail app id used by the avail target"},
+	{"avail-attestation-address", "AVAIL_ATTESTATION_ADDRESS", "", "Avail attestation contract on L1, used by backfill to read sequences posted with a bridge proof"},
+	{"avail-bridge-api-url", "AVAIL_BRIDGE_API_URL", "", "Avail bridge API, only checked by --selftest"},
+	{"s3-bucket", "S3_BUCKET", "", "S3 bucket"},
+	{"s3-region", "S3_REGION", "", "S3 region"},
+	{"s3-access-key", "S3_ACCESS_KEY", "", "S3 access key"},
+	{"s3-secret-key", "S3_SECRET_KEY", "", "S3 secret key"},
+	{"s3-object-prefix", "S3_OBJECT_PREFIX", "", "prefix of the S3 object keys, {network} and {chainid} are replaced by NETWORK and ROLLUP_CHAIN_ID"},
+	{"network", "NETWORK", "", "network name the {network} placeholder of s3-object-prefix is replaced by, defaults to the profile name"},
+	{"s3-key-layout", "S3_KEY_LAYOUT", "flat", "S3 key layout shared with the server, flat (prefix/hash) or sharded (prefix/aa/bb/hash)"},
+	{"s3-sse", "S3_SSE", "", "server side encryption of uploaded objects, AES256 or aws:kms"},
+	{"s3-sse-kms-key-id", "S3_SSE_KMS_KEY_ID", "", "KMS key id used with aws:kms server side encryption"},
+	{"s3-storage-class", "S3_STORAGE_CLASS", "", "storage class of uploaded objects, e.g. STANDARD_IA or GLACIER_IR"},
+	{"s3-checksum-algorithm", "S3_CHECKSUM_ALGORITHM", "", "checksum algorithm of uploaded objects, e.g. CRC32 or SHA256"},
+	{"max-attempts", "MAX_ATTEMPTS", "5", "attempts of every L1, DAC and upload request"},
+	{"rpc-timeout", "RPC_TIMEOUT", "30", "seconds a single L1, DAC or S3 read may take, 0 disables the deadline"},
+	{"upload-timeout", "UPLOAD_TIMEOUT", "300", "seconds the upload of a batch to the DA targets may take, 0 disables the deadline"},
+	{"concurrency", "CONCURRENCY", "4", "number of blocks and batches processed in parallel"},
+	{"batch-concurrency", "BATCH_CONCURRENCY", "0", "number of batches fetched and uploaded in parallel across all blocks, 0 uses CONCURRENCY"},
+	{"dac-batch-size", "DAC_BATCH_SIZE", "100", "hashes of a block fetched with a single sync_listOffChainData request, 0 or 1 fetches them one by one"},
+	{"dac-rps", "DAC_RPS", "0", "maximum DAC requests per second, 0 disables the limit"},
+	{"log-range-size", "LOG_RANGE_SIZE", "1000", "number of blocks queried with a single eth_getLogs request"},
+	{"rpc-rps", "RPC_RPS", "0", "maximum L1 RPC requests per second, 0 disables the limit"},
+	{"rpc-max-retries", "RPC_MAX_RETRIES", "5", "retries of L1 RPC requests rejected with 429 Too Many Requests"},
+	{"skip-existing", "SKIP_EXISTING", "true", "skip batches already stored in S3"},
+	{"check-turbo-da", "CHECK_TURBO_DA", "false", "with skip-existing, also require the Turbo DA submission recorded on the S3 object to exist"},
+	{"submissions-file", "SUBMISSIONS_FILE", "turboda-submissions.jsonl", "JSON lines file the Turbo DA submission id of every batch is appended to, empty disables it"},
+	{"confirmations", "CONFIRMATIONS", "12", "blocks on top of a block before it is migrated, blocks closer to the head are left for later"},
+	{"reorg-depth", "REORG_DEPTH", "64", "blocks migrated again in follow mode when a reorg is detected"},
+	{"follow", "FOLLOW", "false", "keep migrating new blocks after the end block (or the head when it is not set) is reached"},
+	{"follow-poll-interval", "FOLLOW_POLL_INTERVAL", "60", "seconds between polls for new L1 blocks in follow mode"},
+	{"state-file", "STATE_FILE", "migration-state.json", "file the progress of a run is saved to, used by resume"},
+	{"metrics-addr", "METRICS_ADDR", "", "address Prometheus metrics are served on at /metrics, e.g. :9090, empty disables it"},
+	{"pushgateway-url", "PUSHGATEWAY_URL", "", "Prometheus push gateway metrics are pushed to, empty disables it"},
+	{"pushgateway-job", "PUSHGATEWAY_JOB", "cdk-migration", "job name of the pushed metrics"},
+	{"failed-batches-file", "FAILED_BATCHES_FILE", "failed-batches.jsonl", "JSON lines file batches that couldn't be migrated are appended to, empty disables it"},
+	{"profiles", "PROFILES", "", "comma separated names of the rollup profiles defined with <NAME>_ prefixed settings"},
+}
+
+// addSettingsFlags registers a flag for every setting
+func addSettingsFlags(f *pflag.FlagSet) {
+	for _, s := range settings {
+		usage := fmt.Sprintf("%s (env %s)", s.usage, s.env)
+		// settings defaulting to a boolean are switches
+		if def, err := strconv.ParseBool(s.def); err == nil {
+			f.Bool(s.flag, def, usage)
+			continue
+		}
+		f.String(s.flag, s.def, usage)
+	}
+	f.String("config", "", "file with KEY=VALUE settings, read after flags and environment variables")
+	f.String("profile", "", "comma separated profiles to run, or all for every profile in PROFILES")
+}
+
+// config resolves settings from overrides, flags, environment variables, the config
+// file and defaults, in that order. The settings of a profile are looked up in the
+// environment and the config file with the profile prefix first.
+type config struct {
+	flags     *pflag.FlagSet
+	file      map[string]string
+	overrides map[string]string
+	profile   string
+}
+
+func loadConfig(flags *pflag.FlagSet) (*config, error) {
+	// Load .env file
+	if err := godotenv.Load(".env"); err != nil {
+		log.Println("No .env file found, falling back to system env")
+	}
+
+	c := &config{flags: flags, file: map[string]string{}, overrides: map[string]string{}}
+	if path, _ := flags.GetString("config"); path != "" {
+		file, err := godotenv.Read(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+		}
+		c.file = file
+	}
+	return c, nil
+}
+
+// set overrides a setting for the rest of the run
+func (c *config) set(env, value string) {
+	c.overrides[env] = value
+}
+
+func (c *config) get(env string) string {
+	if v, ok := c.overrides[env]; ok {
+		return v
+	}
+	var s *setting
+	for i := range settings {
+		if settings[i].env == env {
+			s = &settings[i]
+		}
+	}
+	if s != nil {
+		if f := c.flags.Lookup(s.flag); f != nil && f.Changed {
+			return f.Value.String()
+		}
+	}
+	if v, ok := c.lookupProfile(env); ok {
+		return v
+	}
+	if v, ok := os.LookupEnv(env); ok {
+		return v
+	}
+	if v, ok := c.file[env]; ok {
+		return v
+	}
+	if s != nil {
+		return s.def
+	}
+	return ""
+}
+
+// lookupProfile returns the setting of the profile from the environment or the config
+// file, e.g. ZKEVM_S3_BUCKET for S3_BUCKET of the zkevm profile
+func (c *config) lookupProfile(env string) (string, bool) {
+	if c.profile == "" {
+		return "", false
+	}
+	key := profilePrefix(c.profile) + env
+	if v, ok := os.LookupEnv(key); ok {
+		return v, true
+	}
+	v, ok := c.file[key]
+	return v, ok
+}
+
+// int returns a positive integer setting, def is used when it is empty
+func (c *config) int(env string, def int) (int, error) {
+	v := c.get(env)
+	if v == "" {
+		return def, nil
+	}
+	val, err := strconv.Atoi(v)
+	if err != nil || val <= 0 {
+		return 0, fmt.Errorf("%s must be a positive integer, got %q", env, v)
+	}
+	return val, nil
+}
+
+// float returns a non-negative number setting, empty is zero
+func (c *config) float(env string) (float64, error) {
+	v := c.get(env)
+	if v == "" {
+		return 0, nil
+	}
+	val, err := strconv.ParseFloat(v, 64)
+	if err != nil || val < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative number, got %q", env, v)
+	}
+	return val, nil
+}
+
+// bool returns a boolean setting
+func (c *config) bool(env string) (bool, error) {
+	v := c.get(env)
+	if v == "" {
+		return false, nil
+	}
+	val, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false, got %q", env, v)
+	}
+	return val, nil
+}
+
+// uint returns an unsigned integer setting with the given bit size, empty is zero
+func (c *config) uint(env string, bitSize int) (uint64, error) {
+	v := c.get(env)
+	if v == "" {
+		return 0, nil
+	}
+	val, err := strconv.ParseUint(v, 10, bitSize)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an unsigned integer, got %q", env, v)
+	}
+	return val, nil
+}
+
+// applyProxy sends the requests of every default HTTP client through proxyURL, which
+// covers the L1, DAC, Turbo DA and Avail clients. Without it the HTTP_PROXY, HTTPS_PROXY
+// and NO_PROXY environment variables apply.
+func applyProxy(proxyURL string) error {
+	if proxyURL == "" {
+		return nil
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("PROXY_URL must be a URL like http://proxy:3128")
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("PROXY_URL scheme must be http, https or socks5, got %q", u.Scheme)
+	}
+	http.DefaultTransport.(*http.Transport).Proxy = http.ProxyURL(u)
+	return nil
+}
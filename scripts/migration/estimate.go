@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// estimateOptions are the prices and assumptions the estimate is computed with
+type estimateOptions struct {
+	// Fetch one out of every sample batches and extrapolate the sizes of the others
+	sample int
+	// Turbo DA credits charged per MB of submitted data
+	creditsPerMB float64
+	// S3 storage price per GB and month
+	s3PricePerGBMonth float64
+	// Expected duration of the upload of a batch to the DA targets
+	uploadLatency time.Duration
+}
+
+// estimate scans the block range without migrating and reports the size of the data
+// to migrate, the Turbo DA credits and S3 storage it needs and the expected runtime
+func (m *MigrationService) estimate(opts estimateOptions) error {
+	if opts.sample < 1 {
+		opts.sample = 1
+	}
+
+	var mu sync.Mutex
+	var seen, fetched, failed int
+	var bytes int64
+	var dacTime time.Duration
+	begin := time.Now()
+
+	p := m.walk("Estimate", nil, func(block uint64, i int, h common.Hash) bool {
+		mu.Lock()
+		seen++
+		skip := (seen-1)%opts.sample != 0
+		mu.Unlock()
+		if skip {
+			return true
+		}
+
+		var data []byte
+		start := time.Now()
+		err := retry(m.ctx, m.maxAttempts, 1*time.Second, func() error {
+			return m.withTimeout(m.rpcTimeout, func(ctx context.Context) error {
+				var e error
+				data, e = m.dac.GetDataByHash(ctx, h)
+				return e
+			})
+		})
+		elapsed := time.Since(start)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			log.Printf("🟦 Block %d ➡️ Batch %d [Hash: %s] ❌ DAC fetch failed: %v", block, i, h.Hex(), err)
+			failed++
+			return false
+		}
+		fetched++
+		bytes += int64(len(data))
+		dacTime += elapsed
+		return true
+	}, nil)
+
+	if fetched == 0 {
+		return fmt.Errorf("no batch of the range could be fetched from the DAC, %d blocks and %d batches scanned", p.blocks, p.batches)
+	}
+
+	avgSize := float64(bytes) / float64(fetched)
+	avgFetch := dacTime / time.Duration(fetched)
+	totalBytes := avgSize * float64(p.batches)
+	mb := totalBytes / (1 << 20)
+	gb := totalBytes / (1 << 30)
+	// Every batch is fetched and uploaded in one of batchConcurrency slots
+	runtime := time.Duration(float64(avgFetch+opts.uploadLatency) * float64(p.batches) / float64(m.batchConcurrency))
+
+	log.Printf("🧮 Estimate for blocks %d..%d (scanned in %v)", m.startBlock.Uint64(), m.endBlock.Uint64(), time.Since(begin).Round(time.Second))
+	log.Printf("   Blocks:            %d (%d could not be read from L1)", p.blocks, len(p.failedBlocks))
+	log.Printf("   Batches:           %d (%d fetched, %d failed)", p.batches, fetched, failed)
+	log.Printf("   Data:              %.2f MB (%.0f bytes per batch on average)", mb, avgSize)
+	log.Printf("   Turbo DA credits:  %.2f (%.4f per MB)", mb*opts.creditsPerMB, opts.creditsPerMB)
+	log.Printf("   S3 storage:        %.4f per month (%.4f per GB)", gb*opts.s3PricePerGBMonth, opts.s3PricePerGBMonth)
+	log.Printf("   Runtime:           %v (DAC fetch %v + upload %v per batch, %d in parallel)",
+		runtime.Round(time.Second), avgFetch.Round(time.Millisecond), opts.uploadLatency, m.batchConcurrency)
+	return nil
+}
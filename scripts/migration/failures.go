@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// failedBatch is a line of the failed batches file. Batches are skipped when they
+// fail, the file lists what has to be migrated again. Blocks whose batches couldn't
+// be read from L1 are recorded as a range without a hash.
+type failedBatch struct {
+	Block   uint64       `json:"block"`
+	ToBlock uint64       `json:"toBlock,omitempty"`
+	Index   int          `json:"index"`
+	Hash    *common.Hash `json:"hash,omitempty"`
+	Reason  string       `json:"reason"`
+	Time    time.Time    `json:"time"`
+}
+
+// failureLedger appends failed batches to a JSON lines file, every line is written
+// when the batch fails so the file is complete whenever the run stops
+type failureLedger struct {
+	mu    sync.Mutex
+	path  string
+	count int
+}
+
+// record appends the failure, a nil ledger or an empty path only counts it
+func (l *failureLedger) record(f failedBatch) error {
+	if l == nil {
+		return nil
+	}
+	f.Time = time.Now().UTC()
+	line, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.count++
+	if l.path == "" {
+		return nil
+	}
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// recorded returns the number of failures recorded by this run
+func (l *failureLedger) recorded() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.count
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ✅ Test failed batches and blocks are appended to the failed batches file
+func TestFailureLedger(t *testing.T) {
+	l := &failureLedger{path: filepath.Join(t.TempDir(), "failed.jsonl")}
+	hash := common.Hash{1}
+	require.NoError(t, l.record(failedBatch{Block: 10, Index: 2, Hash: &hash, Reason: "DAC fetch failed"}))
+	require.NoError(t, l.record(failedBatch{Block: 11, ToBlock: 20, Reason: "failed to get logs"}))
+	assert.Equal(t, 2, l.recorded())
+
+	file, err := os.Open(l.path)
+	require.NoError(t, err)
+	defer file.Close()
+	var lines []failedBatch
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var f failedBatch
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &f))
+		assert.False(t, f.Time.IsZero())
+		lines = append(lines, f)
+	}
+	require.Len(t, lines, 2)
+	assert.Equal(t, &hash, lines[0].Hash)
+	assert.Equal(t, 2, lines[0].Index)
+	assert.Nil(t, lines[1].Hash)
+	assert.Equal(t, uint64(20), lines[1].ToBlock)
+
+	// Without a file failures are only counted
+	l = &failureLedger{}
+	require.NoError(t, l.record(failedBatch{Block: 10}))
+	assert.Equal(t, 1, l.recorded())
+	var none *failureLedger
+	require.NoError(t, none.record(failedBatch{Block: 10}))
+	assert.Zero(t, none.recorded())
+}
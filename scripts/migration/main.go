@@ -7,191 +7,753 @@ import (
 	"math/big"
 	"math/rand"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/joho/godotenv"
+	"github.com/spf13/cobra"
 
+	"github.com/availproject/cdk-avail-da-server/pkg/l1"
 	"github.com/availproject/cdk-avail-da-server/scripts/migration/pkg/da"
 	"github.com/availproject/cdk-avail-da-server/scripts/migration/pkg/dac"
-	"github.com/availproject/cdk-avail-da-server/scripts/migration/pkg/l1"
 )
 
 type MigrationService struct {
 	ctx          context.Context
 	cancel       context.CancelFunc
-	client       *ethclient.Client
+	client       *l1.Client
 	DABackend    *da.DABackend
 	startBlock   *big.Int
 	endBlock     *big.Int
 	contractAbi  abi.ABI
 	contractAddr common.Address
-	dacURL       string
+	dac          *dac.Client
 	maxAttempts  int
+	concurrency  int
+	// batchConcurrency bounds the batches fetched and uploaded in parallel
+	batchConcurrency int
+	// dacBatchSize is the number of hashes fetched with a single DAC request
+	dacBatchSize int
+	// prefetched holds the prefetchedBatch of a batch hash until it is processed
+	prefetched sync.Map
+	// confirmations is the number of blocks on top of a block before it is processed,
+	// reorgDepth the number of blocks processed again when a reorg is detected
+	confirmations uint64
+	reorgDepth    uint64
+	// firstBlock is the start block of the run, reorgs never go back further
+	firstBlock   uint64
+	logRangeSize uint64
+	skipExisting bool
+	checkTurboDA bool
+	// stop is closed on SIGINT/SIGTERM, no new batches are started after it
+	stop     <-chan struct{}
+	failures *failureLedger
+	// deadlines of a single L1, DAC or S3 read and of a single upload
+	rpcTimeout    time.Duration
+	uploadTimeout time.Duration
+	metrics       *metrics
 }
 
 func main() {
-
-	m, err := initialize()
-	if err != nil {
-		log.Fatalf("Failed to initialize migration service: %v", err)
+	if err := newRootCmd().Execute(); err != nil {
+		os.Exit(1)
 	}
-	defer m.cancel()
+}
 
-	// Iterate over blocks, query batch hashes, fetch from DAC, and upload to S3
-	for block := new(big.Int).Set(m.startBlock); block.Cmp(m.endBlock) <= 0; block.Add(block, big.NewInt(1)) {
-		log.Printf("\n═══════════════════════════════════════════")
-		log.Printf("🟦 Processing Block %d", block.Uint64())
-		log.Printf("═══════════════════════════════════════════")
-		hashes, err := l1.QueryBatchHashesFromL1ByBlockNumber(m.ctx, m.client, m.contractAbi, m.contractAddr, block)
+func newRootCmd() *cobra.Command {
+	root := &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate CDK validium batch data from the DAC to Avail Turbo DA and S3",
+		Long: `Migrate reads the batches sequenced on L1 in a block range, fetches their data
+from the DAC and uploads it to Avail Turbo DA and an S3 fallback bucket.
+
+Every flag can also be set with the environment variable named in its usage, in a
+.env file in the working directory or in the --config file. Flags take precedence
+over environment variables, which take precedence over the config file.`,
+		SilenceUsage: true,
+	}
+	addSettingsFlags(root.PersistentFlags())
+	var runSelfTest bool
+	root.Flags().BoolVar(&runSelfTest, "selftest", false, "check the S3 bucket, the L1 and Avail RPC, the bridge API and the contracts, then exit")
+	root.RunE = func(cmd *cobra.Command, args []string) error {
+		if !runSelfTest {
+			return cmd.Help()
+		}
+		cfg, err := loadConfig(cmd.Flags())
 		if err != nil {
-			log.Printf("Error querying batch hashes from L1 for block %d: %v", block.Uint64(), err)
-			continue
+			return err
 		}
-		if len(hashes) == 0 {
-			log.Printf("ℹ️  No batch hashes found")
-			continue
+		if err := forEachProfile(cfg, selfTest); err != nil {
+			return err
 		}
+		log.Println("✅ Self-test passed")
+		return nil
+	}
+
+	run := &cobra.Command{
+		Use:   "run",
+		Short: "Migrate the block range",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(cmd.Flags())
+			if err != nil {
+				return err
+			}
+			if err := checkFollow(cfg); err != nil {
+				return err
+			}
+			return forEachProfile(cfg, migrate)
+		},
+	}
 
-		log.Printf("🔍 Found %d batch hashes", len(hashes))
-		for i, h := range hashes {
-			log.Printf("  ➡️ Batch %d [Hash: %s]", i, h.Hex())
-			var batchData []byte
-			var err error
-			// Fetch from DAC with retries
-			err = retry(m.ctx, m.maxAttempts, 1*time.Second, func() error {
-				var e error
-				batchData, e = dac.GetDataFromDACByHash(m.ctx, m.dacURL, h)
-				if e != nil {
-					log.Printf("    ❌ DAC fetch failed: %v", e)
-					return e
+	var report string
+	verify := &cobra.Command{
+		Use:   "verify",
+		Short: "Check that every batch of the block range is stored in S3 with matching contents",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(cmd.Flags())
+			if err != nil {
+				return err
+			}
+			return forEachProfile(cfg, func(cfg *config) error {
+				m, err := initialize(cfg, false)
+				if err != nil {
+					return fmt.Errorf("failed to initialize migration service: %w", err)
 				}
-				log.Printf("    ✅ DAC fetch success (size=%d bytes)", len(batchData))
-				return nil
+				defer m.cancel()
+				// Every profile writes its own report
+				path := report
+				if path != "" && cfg.profile != "" {
+					path = filepath.Join(filepath.Dir(path), cfg.profile+"-"+filepath.Base(path))
+				}
+				return m.verify(path)
 			})
+		},
+	}
+	verify.Flags().StringVar(&report, "report", "", "file the verification report is written to, stdout when empty")
+
+	resume := &cobra.Command{
+		Use:   "resume",
+		Short: "Continue an interrupted run from the block saved in the state file",
+		Long: `Resume continues the run saved in the state file from the first block that
+hasn't been processed. The end block of the saved run is used unless --end-block is set.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(cmd.Flags())
 			if err != nil {
-				log.Printf("    ⛔ Skipping batch (could not fetch from DAC)")
-				continue
+				return err
+			}
+			if err := checkFollow(cfg); err != nil {
+				return err
 			}
+			return forEachProfile(cfg, func(cfg *config) error {
+				state, err := loadState(cfg.get("STATE_FILE"))
+				if err != nil {
+					return err
+				}
+				follow, err := cfg.bool("FOLLOW")
+				if err != nil {
+					return err
+				}
+				// In follow mode the run continues to the head instead
+				if cfg.get("END_BLOCK") == "" && !follow {
+					cfg.set("END_BLOCK", strconv.FormatUint(state.EndBlock, 10))
+				}
+				end, err := cfg.uint("END_BLOCK", 64)
+				if err != nil {
+					return err
+				}
+				if state.NextBlock > end && !follow {
+					log.Printf("🏁 Nothing to resume, blocks %d..%d are done", state.StartBlock, end)
+					return nil
+				}
+				log.Printf("⏩ Resuming from block %d", state.NextBlock)
+				cfg.set("START_BLOCK", strconv.FormatUint(state.NextBlock, 10))
+				return migrate(cfg)
+			})
+		},
+	}
 
-			if hash := crypto.Keccak256Hash(batchData); hash != h {
-				log.Println("    ⛔ Batch hash mismatch!")
-				continue
+	backfill := &cobra.Command{
+		Use:   "backfill",
+		Short: "Repopulate S3 with the batches of the block range read back from Avail",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(cmd.Flags())
+			if err != nil {
+				return err
 			}
-			// Upload to S3 with retries
-			err = retry(m.ctx, m.maxAttempts, 1*time.Second, func() error {
-				e := m.DABackend.PostDataToDA(m.ctx, h, batchData)
-				if e != nil {
-					log.Printf("    ❌ DA upload failed: %v", e)
-					return e
+			return forEachProfile(cfg, func(cfg *config) error {
+				m, err := initialize(cfg, false)
+				if err != nil {
+					return fmt.Errorf("failed to initialize migration service: %w", err)
+				}
+				defer m.cancel()
+				m.failures = &failureLedger{path: cfg.get("FAILED_BATCHES_FILE")}
+
+				reader, err := newAvailReader(cfg)
+				if err != nil {
+					return fmt.Errorf("failed to initialize the Avail reader: %w", err)
 				}
-				log.Printf("    ✅ DA upload success")
-				return nil
+				defer reader.Close()
+				return m.backfill(reader)
 			})
+		},
+	}
+
+	var dryRun bool
+	repairKeys := &cobra.Command{
+		Use:   "repair-keys",
+		Short: "Move the S3 objects of the block range written with a legacy key to the key the server reads",
+		Long: `Repair-keys finds the objects of the batches in the block range that were written
+with the other S3_KEY_LAYOUT or with a 0x prefixed key and moves them to the key
+encoded for S3_KEY_LAYOUT, the encoding shared with the server.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(cmd.Flags())
 			if err != nil {
-				log.Printf("Failed to upload batch hash %s after retries: %v", h.Hex(), err)
+				return err
 			}
-		}
+			return forEachProfile(cfg, func(cfg *config) error {
+				m, err := initialize(cfg, false)
+				if err != nil {
+					return fmt.Errorf("failed to initialize migration service: %w", err)
+				}
+				defer m.cancel()
+				return m.repairKeys(dryRun)
+			})
+		},
+	}
+	repairKeys.Flags().BoolVar(&dryRun, "dry-run", false, "only log the objects that would be moved")
+
+	var archive string
+	export := &cobra.Command{
+		Use:   "export",
+		Short: "Write the S3 objects of the batches of the block range to a tar archive",
+		Long: `Export reads the batches sequenced in the block range from S3 and writes them to
+the --archive tar file, one entry named by the 0x prefixed hash per batch. Objects
+that are missing or don't match their hash are reported and left out.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(cmd.Flags())
+			if err != nil {
+				return err
+			}
+			return forEachProfile(cfg, func(cfg *config) error {
+				m, err := initialize(cfg, false)
+				if err != nil {
+					return fmt.Errorf("failed to initialize migration service: %w", err)
+				}
+				defer m.cancel()
+				// Every profile writes its own archive
+				path := archive
+				if cfg.profile != "" {
+					path = filepath.Join(filepath.Dir(path), cfg.profile+"-"+filepath.Base(path))
+				}
+				return m.exportSnapshot(path)
+			})
+		},
+	}
+	export.Flags().StringVar(&archive, "archive", "snapshot.tar", "tar file the objects are written to")
+
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Upload the objects of an export archive to the S3 bucket",
+		Long: `Import uploads every entry of the --archive tar file written by export to the
+S3 bucket, e.g. a new bucket of an operator handover or a disaster recovery drill.
+Entries are checked against the hash they are named by. Only the S3 settings are
+used, neither L1 nor the DAC are read.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(cmd.Flags())
+			if err != nil {
+				return err
+			}
+			m, err := newImporter(cfg)
+			if err != nil {
+				return fmt.Errorf("failed to initialize migration service: %w", err)
+			}
+			defer m.cancel()
+			return m.importSnapshot(archive)
+		},
+	}
+	importCmd.Flags().StringVar(&archive, "archive", "snapshot.tar", "tar file written by export")
 
+	opts := estimateOptions{}
+	estimate := &cobra.Command{
+		Use:   "estimate",
+		Short: "Report the data size, Turbo DA credits, S3 storage cost and runtime of migrating the block range",
+		Long: `Estimate scans the block range like a run without uploading anything. It fetches
+the batches from the DAC to sum their sizes, and computes the Turbo DA credits,
+the monthly S3 storage cost and the runtime at the configured BATCH_CONCURRENCY
+from them. With --sample N only one out of every N batches is fetched.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(cmd.Flags())
+			if err != nil {
+				return err
+			}
+			return forEachProfile(cfg, func(cfg *config) error {
+				m, err := initialize(cfg, false)
+				if err != nil {
+					return fmt.Errorf("failed to initialize migration service: %w", err)
+				}
+				defer m.cancel()
+				return m.estimate(opts)
+			})
+		},
 	}
+	estimate.Flags().IntVar(&opts.sample, "sample", 1, "fetch one out of every N batches and extrapolate the size of the others")
+	estimate.Flags().Float64Var(&opts.creditsPerMB, "credits-per-mb", 1, "Turbo DA credits charged per MB of data")
+	estimate.Flags().Float64Var(&opts.s3PricePerGBMonth, "s3-price-per-gb", 0.023, "S3 storage price per GB and month")
+	estimate.Flags().DurationVar(&opts.uploadLatency, "upload-latency", 500*time.Millisecond, "expected duration of the upload of a batch to the DA targets")
+
+	root.AddCommand(run, verify, resume, backfill, repairKeys, estimate, export, importCmd)
+	return root
 }
 
-func initialize() (MigrationService, error) {
-	// Load .env file
-	if err := godotenv.Load(".env"); err != nil {
-		log.Println("No .env file found, falling back to system env")
+// migrate runs the migration and saves its progress to the state file. In follow
+// mode it keeps polling L1 and migrates new blocks until it is stopped.
+func migrate(cfg *config) error {
+	follow, err := cfg.bool("FOLLOW")
+	if err != nil {
+		return err
+	}
+	pollInterval, err := cfg.int("FOLLOW_POLL_INTERVAL", 60)
+	if err != nil {
+		return err
 	}
 
-	// Read and validate environment variables
-	rpcURL := os.Getenv("RPC_URL")
-	dacURL := os.Getenv("DAC_URL")
-	contractAddr := common.HexToAddress(os.Getenv("CONTRACT_ADDRESS"))
-	startBlock := new(big.Int)
-	startBlock.SetString(os.Getenv("START_BLOCK"), 10)
-	endBlock := new(big.Int)
-	endBlock.SetString(os.Getenv("END_BLOCK"), 10)
+	m, err := initialize(cfg, true)
+	if err != nil {
+		return fmt.Errorf("failed to initialize migration service: %w", err)
+	}
+	defer m.cancel()
 
-	if rpcURL == "" || contractAddr == (common.Address{}) || startBlock.Cmp(big.NewInt(0)) == 0 || endBlock.Cmp(big.NewInt(0)) == 0 {
-		log.Println(rpcURL, contractAddr, startBlock, endBlock)
-		return MigrationService{}, fmt.Errorf("please set RPC_URL, CONTRACT_ADDRESS, START_BLOCK, and END_BLOCK environment variables")
+	// Blocks within CONFIRMATIONS of the head are never processed. Without an end
+	// block follow mode starts by catching up to the safe head.
+	safeHead, err := m.safeHead()
+	if err != nil {
+		return err
+	}
+	if m.endBlock.Sign() == 0 {
+		m.endBlock.SetUint64(max(safeHead, m.startBlock.Uint64()))
+	}
+	if end := m.endBlock.Uint64(); end > safeHead {
+		if safeHead < m.startBlock.Uint64() {
+			return fmt.Errorf("START_BLOCK %d has less than %d confirmations", m.startBlock.Uint64(), m.confirmations)
+		}
+		log.Printf("⚠️ END_BLOCK %d has less than %d confirmations, migrating up to block %d", end, m.confirmations, safeHead)
+		m.endBlock.SetUint64(safeHead)
 	}
 
-	if startBlock.Cmp(endBlock) > 0 {
-		log.Println(endBlock, startBlock)
-		return MigrationService{}, fmt.Errorf("END_BLOCK must be greater than to START_BLOCK")
+	state := migrationState{StartBlock: m.startBlock.Uint64(), EndBlock: m.endBlock.Uint64(), NextBlock: m.startBlock.Uint64()}
+	statePath := cfg.get("STATE_FILE")
+	onAdvance := func(next uint64) {
+		state.NextBlock = next
+		if err := saveState(statePath, state); err != nil {
+			log.Printf("⚠️ Failed to save state to %s: %v", statePath, err)
+		}
 	}
 
-	bucket := os.Getenv("S3_BUCKET")
-	region := os.Getenv("S3_REGION")
-	accessKey := os.Getenv("S3_ACCESS_KEY")
-	secretKey := os.Getenv("S3_SECRET_KEY")
-	objectPrefix := os.Getenv("S3_OBJECT_PREFIX")
+	p := m.run(onAdvance)
+	// Hash of the last block processed, new blocks must build on it
+	var lastHash common.Hash
+	if follow {
+		if lastHash, _, err = m.header(m.endBlock.Uint64()); err != nil {
+			log.Printf("⚠️ %v", err)
+		}
+	}
+	for follow && m.ctx.Err() == nil && !m.stopping() {
+		select {
+		case <-time.After(time.Duration(pollInterval) * time.Second):
+		case <-m.ctx.Done():
+			continue
+		case <-m.stop:
+			continue
+		}
+		head, err := m.safeHead()
+		if err != nil {
+			log.Printf("⚠️ %v", err)
+			continue
+		}
+		end := m.endBlock.Uint64()
+		if head <= end {
+			continue
+		}
+
+		start := end + 1
+		if lastHash != (common.Hash{}) {
+			reorgStart, reorged, err := m.reorgStart(start, lastHash)
+			if err != nil {
+				log.Printf("⚠️ %v", err)
+				continue
+			}
+			if reorged {
+				log.Printf("🔀 Reorg detected below block %d, re-processing from block %d", start, reorgStart)
+				start = reorgStart
+			}
+		}
+		headHash, _, err := m.header(head)
+		if err != nil {
+			log.Printf("⚠️ %v", err)
+			continue
+		}
+
+		log.Printf("👀 Following: migrating new blocks %d..%d", start, head)
+		m.startBlock.SetUint64(start)
+		m.endBlock.SetUint64(head)
+		state.EndBlock = head
+		p = m.run(onAdvance)
+		lastHash = headHash
+	}
+
+	// The state is only saved when the watermark advances, make sure the file exists
+	onAdvance(p.next)
+	if failed := m.failures.recorded(); failed > 0 {
+		log.Printf("⚠️ %d failed batches were recorded in %s", failed, m.failures.path)
+	}
+	if m.stopping() {
+		log.Printf("🛑 Shutdown complete, blocks %d..%d are done. Continue with `go run . resume`", state.StartBlock, p.next-1)
+		return nil
+	}
+	if err := m.ctx.Err(); err != nil {
+		return fmt.Errorf("migration stopped at block %d, continue with resume: %w", p.next, err)
+	}
+	return nil
+}
+
+// initialize builds the migration service, the DA targets are only used when
+// uploading, otherwise only S3 is required
+func initialize(cfg *config, upload bool) (MigrationService, error) {
+	if err := applyProxy(cfg.get("PROXY_URL")); err != nil {
+		return MigrationService{}, err
+	}
+
+	// Read and validate settings
+	rpcURL := cfg.get("RPC_URL")
+	var dacURLs []string
+	for _, u := range strings.Split(cfg.get("DAC_URL"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			dacURLs = append(dacURLs, u)
+		}
+	}
+	contractAddr := common.HexToAddress(cfg.get("CONTRACT_ADDRESS"))
+	// The validium contract can be discovered from the rollup manager instead
+	rollupManagerAddr := common.HexToAddress(cfg.get("ROLLUP_MANAGER_ADDRESS"))
+	rollupID, err := cfg.uint("ROLLUP_ID", 32)
+	if err != nil {
+		return MigrationService{}, err
+	}
+	rollupChainID, err := cfg.uint("ROLLUP_CHAIN_ID", 64)
+	if err != nil {
+		return MigrationService{}, err
+	}
+	start, err := cfg.uint("START_BLOCK", 64)
+	if err != nil {
+		return MigrationService{}, err
+	}
+	end, err := cfg.uint("END_BLOCK", 64)
+	if err != nil {
+		return MigrationService{}, err
+	}
+	startBlock := new(big.Int).SetUint64(start)
+	endBlock := new(big.Int).SetUint64(end)
 
-	if bucket == "" || region == "" || accessKey == "" || secretKey == "" {
-		return MigrationService{}, fmt.Errorf("missing required S3 configuration")
+	// Follow mode runs to the head when END_BLOCK is not set
+	follow, err := cfg.bool("FOLLOW")
+	if err != nil {
+		return MigrationService{}, err
+	}
+	if rpcURL == "" || (contractAddr == (common.Address{}) && rollupManagerAddr == (common.Address{})) || start == 0 || (end == 0 && !(follow && upload)) {
+		return MigrationService{}, fmt.Errorf("please set RPC_URL, CONTRACT_ADDRESS (or ROLLUP_MANAGER_ADDRESS), START_BLOCK, and END_BLOCK")
+	}
+	if contractAddr == (common.Address{}) && rollupID == 0 && rollupChainID == 0 {
+		return MigrationService{}, fmt.Errorf("please set ROLLUP_ID or ROLLUP_CHAIN_ID to discover the contract from ROLLUP_MANAGER_ADDRESS")
 	}
 
-	turboDAURL := os.Getenv("TURBO_DA_URL")
-	apiKey := os.Getenv("API_KEY")
-	if apiKey == "" && turboDAURL == "" {
-		return MigrationService{}, fmt.Errorf("please set API_KEY and TURBO_DA_URL environment variables")
+	if end != 0 && startBlock.Cmp(endBlock) > 0 {
+		return MigrationService{}, fmt.Errorf("END_BLOCK %d must be greater than or equal to START_BLOCK %d", end, start)
 	}
 
-	// Read MAX_ATTEMPTS env variable and parse to int
-	maxAttempts := 5
-	if maxAttemptsStr := os.Getenv("MAX_ATTEMPTS"); maxAttemptsStr != "" {
-		if val, err := strconv.Atoi(maxAttemptsStr); err == nil && val > 0 {
-			maxAttempts = val
+	// Verification only reads S3
+	targets := []string{da.TargetS3}
+	if upload {
+		targets = nil
+		for _, t := range strings.Split(cfg.get("DA_TARGETS"), ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				targets = append(targets, t)
+			}
 		}
 	}
-	maxTimeOutMins := 10
-	if maxTimeOutMinsStr := os.Getenv("MAX_TIMEOUT_MINS"); maxTimeOutMinsStr != "" {
-		if val, err := strconv.Atoi(maxTimeOutMinsStr); err == nil && val > 0 {
-			maxTimeOutMins = val
+	daConfig, err := newDAConfig(cfg, targets)
+	if err != nil {
+		return MigrationService{}, err
+	}
+	metrics := newMetrics()
+	daConfig.Observe = metrics.observeUpload
+
+	maxAttempts, err := cfg.int("MAX_ATTEMPTS", 5)
+	if err != nil {
+		return MigrationService{}, err
+	}
+	// Number of blocks and batches processed in parallel
+	concurrency, err := cfg.int("CONCURRENCY", 4)
+	if err != nil {
+		return MigrationService{}, err
+	}
+	batchConcurrency, err := cfg.int("BATCH_CONCURRENCY", 0)
+	if err != nil {
+		return MigrationService{}, err
+	}
+	if batchConcurrency <= 0 {
+		batchConcurrency = concurrency
+	}
+	daConfig.S3Concurrency = batchConcurrency
+	dacRPS, err := cfg.float("DAC_RPS")
+	if err != nil {
+		return MigrationService{}, err
+	}
+	confirmations, err := cfg.uint("CONFIRMATIONS", 64)
+	if err != nil {
+		return MigrationService{}, err
+	}
+	reorgDepth, err := cfg.uint("REORG_DEPTH", 64)
+	if err != nil {
+		return MigrationService{}, err
+	}
+	dacBatchSize, err := cfg.int("DAC_BATCH_SIZE", 100)
+	if err != nil {
+		return MigrationService{}, err
+	}
+	dacAuth := dac.Auth{
+		Username:    cfg.get("DAC_USERNAME"),
+		Password:    cfg.get("DAC_PASSWORD"),
+		BearerToken: cfg.get("DAC_BEARER_TOKEN"),
+	}
+	// Headers are a comma separated list of Name: value pairs
+	for _, h := range strings.Split(cfg.get("DAC_HEADERS"), ",") {
+		if strings.TrimSpace(h) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return MigrationService{}, fmt.Errorf("invalid DAC_HEADERS entry %q, expected Name: value", h)
 		}
+		if dacAuth.Headers == nil {
+			dacAuth.Headers = make(map[string]string)
+		}
+		dacAuth.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	// Number of blocks queried with a single eth_getLogs request
+	logRangeSize, err := cfg.int("LOG_RANGE_SIZE", 1000)
+	if err != nil {
+		return MigrationService{}, err
+	}
+	rpcTimeout, err := cfg.int("RPC_TIMEOUT", 30)
+	if err != nil {
+		return MigrationService{}, err
+	}
+	uploadTimeout, err := cfg.int("UPLOAD_TIMEOUT", 300)
+	if err != nil {
+		return MigrationService{}, err
+	}
+	rpcRPS, err := cfg.float("RPC_RPS")
+	if err != nil {
+		return MigrationService{}, err
+	}
+	rpcMaxRetries, err := cfg.int("RPC_MAX_RETRIES", 5)
+	if err != nil {
+		return MigrationService{}, err
+	}
+	skipExisting, err := cfg.bool("SKIP_EXISTING")
+	if err != nil {
+		return MigrationService{}, err
+	}
+	checkTurboDA, err := cfg.bool("CHECK_TURBO_DA")
+	if err != nil {
+		return MigrationService{}, err
 	}
 
 	// Initialization
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(maxTimeOutMins)*time.Minute)
+	dacClient, err := dac.NewClient(dacURLs, dacRPS, dacAuth)
+	if err != nil && upload {
+		return MigrationService{}, fmt.Errorf("please set DAC_URL: %w", err)
+	}
 
-	da, err := da.NewDABackend(bucket, region, accessKey, secretKey, objectPrefix, turboDAURL, apiKey)
+	// The run itself has no deadline, it ends when the range is done or on a signal
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	cancel := cancelCtx
+
+	if addr := cfg.get("METRICS_ADDR"); addr != "" {
+		metrics.serve(ctx, addr)
+	}
+	if url := cfg.get("PUSHGATEWAY_URL"); url != "" {
+		pushed := metrics.pushTo(ctx, url, cfg.get("PUSHGATEWAY_JOB"))
+		// Wait for the final push before exiting
+		cancel = func() {
+			cancelCtx()
+			<-pushed
+		}
+	}
+
+	da, err := da.NewDABackend(daConfig)
 	if err != nil {
 		cancel()
 		return MigrationService{}, fmt.Errorf("failed to initialize DA backend: %w", err)
 	}
 
-	client, err := ethclient.Dial(rpcURL)
+	primary, err := l1.Dial(ctx, rpcURL, rpcRPS, rpcMaxRetries, time.Duration(rpcTimeout)*time.Second)
 	if err != nil {
 		cancel()
 		return MigrationService{}, err
 	}
+	// Old blocks pruned by the primary endpoint are read from the archive endpoint
+	var archive *ethclient.Client
+	if url := cfg.get("ARCHIVE_RPC_URL"); url != "" {
+		if archive, err = l1.Dial(ctx, url, rpcRPS, rpcMaxRetries, time.Duration(rpcTimeout)*time.Second); err != nil {
+			cancel()
+			return MigrationService{}, err
+		}
+	}
+	client := l1.NewClient(primary, archive)
+
+	if contractAddr == (common.Address{}) {
+		rollup, err := l1.DiscoverRollup(ctx, client, rollupManagerAddr, uint32(rollupID), rollupChainID)
+		if err != nil {
+			cancel()
+			return MigrationService{}, fmt.Errorf("failed to discover the rollup contract: %w", err)
+		}
+		log.Printf("🔎 Discovered rollup %d (chain id %d): contract %s, fork id %d", rollup.RollupID, rollup.ChainID, rollup.RollupContract.Hex(), rollup.ForkID)
+		contractAddr = rollup.RollupContract
+	}
 
 	// Load ABI
-	contractAbi, err := abi.JSON(strings.NewReader(l1.PolygonValidiumEtrogABI))
+	contractAbi, err := abi.JSON(strings.NewReader(l1.PolygonValidiumABI))
 	if err != nil {
 		cancel()
 		return MigrationService{}, err
 	}
 
+	var failures *failureLedger
+	if upload {
+		failures = &failureLedger{path: cfg.get("FAILED_BATCHES_FILE")}
+	}
+
 	return MigrationService{
-		ctx:          ctx,
-		cancel:       cancel,
-		client:       client,
-		DABackend:    da,
-		startBlock:   startBlock,
-		endBlock:     endBlock,
-		contractAbi:  contractAbi,
-		contractAddr: contractAddr,
-		dacURL:       dacURL,
-		maxAttempts:  maxAttempts,
+		ctx:              ctx,
+		cancel:           cancel,
+		client:           client,
+		DABackend:        da,
+		startBlock:       startBlock,
+		endBlock:         endBlock,
+		contractAbi:      contractAbi,
+		contractAddr:     contractAddr,
+		dac:              dacClient,
+		maxAttempts:      maxAttempts,
+		concurrency:      concurrency,
+		batchConcurrency: batchConcurrency,
+		dacBatchSize:     dacBatchSize,
+		confirmations:    confirmations,
+		reorgDepth:       reorgDepth,
+		firstBlock:       start,
+		logRangeSize:     uint64(logRangeSize),
+		skipExisting:     skipExisting,
+		checkTurboDA:     checkTurboDA,
+		stop:             notifyStop(ctx),
+		failures:         failures,
+
+		rpcTimeout:    time.Duration(rpcTimeout) * time.Second,
+		uploadTimeout: time.Duration(uploadTimeout) * time.Second,
+		metrics:       metrics,
+	}, nil
+}
+
+// newDAConfig returns the settings of the DA targets
+func newDAConfig(cfg *config, targets []string) (da.Config, error) {
+	availAppID, err := cfg.uint("AVAIL_APP_ID", 32)
+	if err != nil {
+		return da.Config{}, err
+	}
+	objectPrefix, err := cfg.objectPrefix()
+	if err != nil {
+		return da.Config{}, err
+	}
+	return da.Config{
+		Targets:        targets,
+		S3Bucket:       cfg.get("S3_BUCKET"),
+		S3Region:       cfg.get("S3_REGION"),
+		S3AccessKey:    cfg.get("S3_ACCESS_KEY"),
+		S3SecretKey:    cfg.get("S3_SECRET_KEY"),
+		S3ObjectPrefix: objectPrefix,
+		S3KeyLayout:    cfg.get("S3_KEY_LAYOUT"),
+		UploadOptions: da.UploadOptions{
+			ServerSideEncryption: cfg.get("S3_SSE"),
+			SSEKMSKeyId:          cfg.get("S3_SSE_KMS_KEY_ID"),
+			StorageClass:         cfg.get("S3_STORAGE_CLASS"),
+			ChecksumAlgorithm:    cfg.get("S3_CHECKSUM_ALGORITHM"),
+		},
+		TurboDAURL:    cfg.get("TURBO_DA_URL"),
+		TurboDAAPIKey: cfg.get("API_KEY"),
+		AvailRPCURL:   cfg.get("AVAIL_RPC_URL"),
+		AvailSeed:     cfg.get("AVAIL_SEED"),
+		AvailAppID:    uint32(availAppID),
+
+		SubmissionsFile: cfg.get("SUBMISSIONS_FILE"),
 	}, nil
 }
 
+// withTimeout calls fn with a context bounded by timeout, zero disables it
+func (m *MigrationService) withTimeout(timeout time.Duration, fn func(ctx context.Context) error) error {
+	if timeout <= 0 {
+		return fn(m.ctx)
+	}
+	ctx, cancel := context.WithTimeout(m.ctx, timeout)
+	defer cancel()
+	return fn(ctx)
+}
+
+// stopRequested is set once a shutdown was requested, later profiles aren't started
+var stopRequested atomic.Bool
+
+// notifyStop returns a channel closed on the first SIGINT or SIGTERM. The signals are
+// released afterwards, so a second one terminates the process right away.
+func notifyStop(ctx context.Context) <-chan struct{} {
+	stop := make(chan struct{})
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(sigs)
+		select {
+		case sig := <-sigs:
+			log.Printf("🛑 Received %v, finishing in-flight batches. Send it again to abort", sig)
+			stopRequested.Store(true)
+			close(stop)
+		case <-ctx.Done():
+		}
+	}()
+	return stop
+}
+
+// stopping returns whether a shutdown was requested
+func (m *MigrationService) stopping() bool {
+	select {
+	case <-m.stop:
+		return true
+	default:
+		return false
+	}
+}
+
 // retry executes fn with exponential backoff and jitter
 func retry(ctx context.Context, maxAttempts int, baseDelay time.Duration, fn func() error) error {
 	var err error
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+const metricsNamespace = "migration"
+
+// pushInterval is the interval metrics are pushed to the push gateway at
+const pushInterval = 15 * time.Second
+
+// metrics are the Prometheus metrics of a run. They are registered on their own
+// registry so only migration metrics are pushed to the push gateway.
+type metrics struct {
+	registry *prometheus.Registry
+
+	blocks        prometheus.Counter
+	batches       *prometheus.CounterVec
+	bytesUploaded prometheus.Counter
+	nextBlock     prometheus.Gauge
+	endBlock      prometheus.Gauge
+	dacLatency    prometheus.Histogram
+	uploadLatency *prometheus.HistogramVec
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		blocks: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "blocks_processed_total",
+			Help:      "L1 blocks processed",
+		}),
+		batches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "batches_total",
+			Help:      "Batches processed by result: ok, skipped or failed",
+		}, []string{"result"}),
+		bytesUploaded: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "bytes_uploaded_total",
+			Help:      "Bytes of batch data uploaded to the DA targets",
+		}),
+		nextBlock: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "next_block",
+			Help:      "First block that hasn't been processed, every block below it is done",
+		}),
+		endBlock: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "end_block",
+			Help:      "Last block of the range being migrated",
+		}),
+		dacLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "dac_fetch_duration_seconds",
+			Help:      "Duration of DAC fetches",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		uploadLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "upload_duration_seconds",
+			Help:      "Duration of uploads by DA target and result",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"target", "result"}),
+	}
+	m.registry.MustRegister(m.blocks, m.batches, m.bytesUploaded, m.nextBlock, m.endBlock, m.dacLatency, m.uploadLatency)
+	return m
+}
+
+// observeUpload records the upload of a batch to a DA target
+func (m *metrics) observeUpload(target string, duration time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "failed"
+	}
+	m.uploadLatency.WithLabelValues(target, result).Observe(duration.Seconds())
+}
+
+// serve exposes the metrics on addr until ctx is done
+func (m *metrics) serve(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	go func() {
+		log.Printf("📊 Serving metrics on %s/metrics", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("⚠️ Metrics server stopped: %v", err)
+		}
+	}()
+}
+
+// pushTo pushes the metrics to the push gateway every pushInterval until ctx is done,
+// and once more when it is so the final values are kept
+func (m *metrics) pushTo(ctx context.Context, url, job string) <-chan struct{} {
+	pusher := push.New(url, job).Gatherer(m.registry)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(pushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				if err := pusher.Push(); err != nil {
+					log.Printf("⚠️ Failed to push metrics to %s: %v", url, err)
+				}
+				return
+			}
+			if err := pusher.Push(); err != nil {
+				log.Printf("⚠️ Failed to push metrics to %s: %v", url, err)
+			}
+		}
+	}()
+	return done
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/availproject/cdk-avail-da-server/pkg/l1"
+	"github.com/availproject/cdk-avail-da-server/scripts/migration/pkg/dac"
+)
+
+// blockResult is the outcome of processing all batches of a block
+type blockResult struct {
+	block   uint64
+	batches int
+	ok      int
+	err     error
+	// interrupted blocks were stopped by a shutdown before all batches were started
+	interrupted bool
+}
+
+// progress tracks the highest block below which every block has been processed,
+// blocks finish out of order when processed concurrently
+type progress struct {
+	next    uint64
+	done    map[uint64]bool
+	blocks  int
+	batches int
+	ok      int
+	failed  int
+	// blocks whose batches couldn't be read from L1
+	failedBlocks []uint64
+}
+
+func newProgress(start uint64) *progress {
+	return &progress{next: start, done: make(map[uint64]bool)}
+}
+
+// complete records the result and returns whether the watermark advanced
+func (p *progress) complete(res blockResult) bool {
+	p.blocks++
+	p.batches += res.batches
+	p.ok += res.ok
+	if res.err != nil || res.ok < res.batches {
+		p.failed++
+	}
+	if res.err != nil {
+		p.failedBlocks = append(p.failedBlocks, res.block)
+	}
+	p.done[res.block] = true
+
+	advanced := false
+	for p.done[p.next] {
+		delete(p.done, p.next)
+		p.next++
+		advanced = true
+	}
+	return advanced
+}
+
+// batchFunc handles a single batch of a block and returns whether it succeeded
+type batchFunc func(block uint64, i int, h common.Hash) bool
+
+// blockFunc is called with all batches of a block before they are handled
+type blockFunc func(block uint64, hashes []common.Hash)
+
+// run migrates the block range, onAdvance is called with the first block that
+// hasn't been processed whenever it advances
+func (m *MigrationService) run(onAdvance func(next uint64)) *progress {
+	return m.walk("Migration", m.prefetchBlock, m.processBatch, onAdvance)
+}
+
+// blockRange is an inclusive range of L1 blocks
+type blockRange struct {
+	from, to uint64
+}
+
+// walk calls fn for every batch of the block range with a pool of workers. Ranges of
+// blocks are read from L1 concurrently and the batches of all blocks share the same
+// number of DAC and upload slots.
+func (m *MigrationService) walk(name string, prefetch blockFunc, fn batchFunc, onAdvance func(next uint64)) *progress {
+	start, end := m.startBlock.Uint64(), m.endBlock.Uint64()
+	begin := time.Now()
+
+	ranges := make(chan blockRange)
+	results := make(chan blockResult)
+	batchSlots := make(chan struct{}, m.batchConcurrency)
+
+	var wg sync.WaitGroup
+	for i := 0; i < m.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range ranges {
+				m.processRange(r, batchSlots, prefetch, fn, results)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(ranges)
+		for from := start; from <= end; from += m.logRangeSize {
+			to := min(from+m.logRangeSize-1, end)
+			select {
+			case ranges <- blockRange{from: from, to: to}:
+			case <-m.ctx.Done():
+				return
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	p := newProgress(start)
+	total := end - start + 1
+	m.metrics.nextBlock.Set(float64(start))
+	m.metrics.endBlock.Set(float64(end))
+	for res := range results {
+		// Interrupted blocks aren't done, resume starts again from the first of them
+		if res.interrupted {
+			continue
+		}
+		m.metrics.blocks.Inc()
+		if p.complete(res) {
+			m.metrics.nextBlock.Set(float64(p.next))
+			if onAdvance != nil {
+				onAdvance(p.next)
+			}
+			log.Printf("📈 Progress: blocks %d..%d done (%d/%d blocks, %d/%d batches ok, %v elapsed)",
+				start, p.next-1, p.blocks, total, p.ok, p.batches, time.Since(begin).Round(time.Second))
+		}
+	}
+
+	if err := m.ctx.Err(); err != nil {
+		log.Printf("⛔ %s stopped at block %d: %v", name, p.next, err)
+	} else if m.stopping() && p.next <= end {
+		log.Printf("🛑 %s interrupted at block %d", name, p.next)
+	}
+	log.Printf("🏁 %s finished: %d/%d blocks processed, %d with failures, %d/%d batches ok in %v",
+		name, p.blocks, total, p.failed, p.ok, p.batches, time.Since(begin).Round(time.Second))
+	return p
+}
+
+// processRange reads the batches sequenced in the range from L1 and sends the result
+// of every block of the range
+func (m *MigrationService) processRange(r blockRange, batchSlots chan struct{}, prefetch blockFunc, fn batchFunc, results chan<- blockResult) {
+	var hashes map[uint64][]common.Hash
+	err := retry(m.ctx, m.maxAttempts, 1*time.Second, func() error {
+		var e error
+		hashes, e = l1.QueryBatchHashesFromL1ByRange(m.ctx, m.client, m.contractAbi, m.contractAddr, new(big.Int).SetUint64(r.from), new(big.Int).SetUint64(r.to))
+		return e
+	})
+	if err != nil {
+		log.Printf("🟦 Blocks %d..%d: error querying batch hashes from L1: %v", r.from, r.to, err)
+		m.recordFailure(failedBatch{Block: r.from, ToBlock: r.to, Index: -1, Reason: fmt.Sprintf("L1 query failed: %v", err)})
+	}
+	for block := r.from; block <= r.to; block++ {
+		// Blocks that aren't sent are left for resume
+		if m.stopping() {
+			return
+		}
+		if err != nil {
+			results <- blockResult{block: block, err: err}
+			continue
+		}
+		results <- m.processBlock(block, hashes[block], batchSlots, prefetch, fn)
+	}
+}
+
+// processBlock calls fn for all batches sequenced in the block, after prefetch when
+// it is set
+func (m *MigrationService) processBlock(block uint64, hashes []common.Hash, batchSlots chan struct{}, prefetch blockFunc, fn batchFunc) blockResult {
+	res := blockResult{block: block}
+	if len(hashes) == 0 {
+		return res
+	}
+
+	log.Printf("🟦 Block %d: 🔍 Found %d batch hashes", block, len(hashes))
+	res.batches = len(hashes)
+	if prefetch != nil {
+		prefetch(block, hashes)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, h := range hashes {
+		select {
+		case batchSlots <- struct{}{}:
+		case <-m.ctx.Done():
+			wg.Wait()
+			res.err = m.ctx.Err()
+			return res
+		case <-m.stop:
+			wg.Wait()
+			res.interrupted = true
+			return res
+		}
+		wg.Add(1)
+		go func(i int, h common.Hash) {
+			defer wg.Done()
+			defer func() { <-batchSlots }()
+
+			if fn(block, i, h) {
+				mu.Lock()
+				res.ok++
+				mu.Unlock()
+			}
+		}(i, h)
+	}
+	wg.Wait()
+	return res
+}
+
+// processBatch fetches the batch from the DAC and uploads it, returning whether the
+// batch was migrated
+func (m *MigrationService) processBatch(block uint64, i int, h common.Hash) bool {
+	prefix := fmt.Sprintf("🟦 Block %d ➡️ Batch %d [Hash: %s]", block, i, h.Hex())
+
+	var pre prefetchedBatch
+	if v, ok := m.prefetched.LoadAndDelete(h); ok {
+		pre = v.(prefetchedBatch)
+	}
+
+	if m.skipExisting {
+		exists, err := pre.exists, error(nil)
+		if !pre.checked {
+			exists, err = m.exists(h)
+		}
+		if err != nil {
+			log.Printf("%s ❌ Existence check failed, migrating: %v", prefix, err)
+		} else if exists {
+			log.Printf("%s ⏭️ Already migrated", prefix)
+			m.metrics.batches.WithLabelValues("skipped").Inc()
+			return true
+		}
+	}
+
+	batchData := pre.data
+	var err error
+	if batchData != nil {
+		log.Printf("%s ✅ DAC fetch success (size=%d bytes, batched)", prefix, len(batchData))
+	} else {
+		// Fetch from DAC with retries
+		err = retry(m.ctx, m.maxAttempts, 1*time.Second, func() error {
+			start := time.Now()
+			e := m.withTimeout(m.rpcTimeout, func(ctx context.Context) error {
+				var e error
+				batchData, e = m.dac.GetDataByHash(ctx, h)
+				return e
+			})
+			m.metrics.dacLatency.Observe(time.Since(start).Seconds())
+			if e != nil {
+				log.Printf("%s ❌ DAC fetch failed: %v", prefix, e)
+				return e
+			}
+			log.Printf("%s ✅ DAC fetch success (size=%d bytes)", prefix, len(batchData))
+			return nil
+		})
+	}
+	if errors.Is(err, dac.ErrHashMismatch) {
+		log.Printf("%s ⛔ Skipping batch (DAC data doesn't match the transactionsHash sequenced on L1)", prefix)
+		m.recordFailure(failedBatch{Block: block, Index: i, Hash: &h, Reason: fmt.Sprintf("corrupted DAC data: %v", err)})
+		return false
+	}
+	if err != nil {
+		log.Printf("%s ⛔ Skipping batch (could not fetch from DAC)", prefix)
+		m.recordFailure(failedBatch{Block: block, Index: i, Hash: &h, Reason: fmt.Sprintf("DAC fetch failed: %v", err)})
+		return false
+	}
+
+	// The DAC client checks the hash already, this guards the upload against any
+	// other source of corruption
+	if hash := crypto.Keccak256Hash(batchData); hash != h {
+		log.Printf("%s ⛔ Batch hash mismatch!", prefix)
+		m.recordFailure(failedBatch{Block: block, Index: i, Hash: &h, Reason: fmt.Sprintf("hash mismatch: got %s", hash.Hex())})
+		return false
+	}
+	// Upload to S3 with retries
+	err = retry(m.ctx, m.maxAttempts, 1*time.Second, func() error {
+		e := m.withTimeout(m.uploadTimeout, func(ctx context.Context) error {
+			return m.DABackend.PostDataToDA(ctx, h, batchData)
+		})
+		if e != nil {
+			log.Printf("%s ❌ DA upload failed: %v", prefix, e)
+			return e
+		}
+		log.Printf("%s ✅ DA upload success", prefix)
+		return nil
+	})
+	if err != nil {
+		log.Printf("%s Failed to upload batch after retries: %v", prefix, err)
+		m.recordFailure(failedBatch{Block: block, Index: i, Hash: &h, Reason: fmt.Sprintf("DA upload failed: %v", err)})
+		return false
+	}
+	m.metrics.batches.WithLabelValues("ok").Inc()
+	m.metrics.bytesUploaded.Add(float64(len(batchData)))
+	return true
+}
+
+// exists checks with retries whether the batch has already been migrated
+func (m *MigrationService) exists(h common.Hash) (bool, error) {
+	var exists bool
+	err := retry(m.ctx, m.maxAttempts, 1*time.Second, func() error {
+		return m.withTimeout(m.rpcTimeout, func(ctx context.Context) error {
+			var e error
+			exists, e = m.DABackend.Exists(ctx, h, m.checkTurboDA)
+			return e
+		})
+	})
+	return exists, err
+}
+
+// prefetchedBatch is what prefetchBlock learned about a batch before it is processed
+type prefetchedBatch struct {
+	checked bool
+	exists  bool
+	data    []byte
+}
+
+// prefetchBlock fetches the batches of the block that still have to be migrated from
+// the DAC with sync_listOffChainData requests of up to dacBatchSize hashes, instead
+// of a roundtrip per batch. Batches that aren't prefetched are fetched one by one.
+func (m *MigrationService) prefetchBlock(block uint64, hashes []common.Hash) {
+	if m.dacBatchSize <= 1 || len(hashes) < 2 {
+		return
+	}
+
+	var missing []common.Hash
+	for _, h := range hashes {
+		if !m.skipExisting {
+			missing = append(missing, h)
+			continue
+		}
+		exists, err := m.exists(h)
+		if err != nil {
+			// Checked again when the batch is processed
+			missing = append(missing, h)
+			continue
+		}
+		m.prefetched.Store(h, prefetchedBatch{checked: true, exists: exists})
+		if !exists {
+			missing = append(missing, h)
+		}
+	}
+
+	for from := 0; from < len(missing); from += m.dacBatchSize {
+		chunk := missing[from:min(from+m.dacBatchSize, len(missing))]
+		var list map[common.Hash][]byte
+		start := time.Now()
+		err := retry(m.ctx, m.maxAttempts, 1*time.Second, func() error {
+			return m.withTimeout(m.rpcTimeout, func(ctx context.Context) error {
+				var e error
+				list, e = m.dac.ListDataByHashes(ctx, chunk)
+				if errors.Is(e, dac.ErrMethodNotFound) {
+					// Not worth retrying
+					return nil
+				}
+				return e
+			})
+		})
+		m.metrics.dacLatency.Observe(time.Since(start).Seconds())
+		if err != nil {
+			log.Printf("🟦 Block %d: ⚠️ Batched DAC fetch failed, fetching one by one: %v", block, err)
+			return
+		}
+		if list == nil {
+			return
+		}
+		log.Printf("🟦 Block %d: ✅ Batched DAC fetch returned %d/%d batches", block, len(list), len(chunk))
+		for h, data := range list {
+			pre := prefetchedBatch{data: data}
+			if v, ok := m.prefetched.Load(h); ok {
+				pre.checked, pre.exists = v.(prefetchedBatch).checked, v.(prefetchedBatch).exists
+			}
+			m.prefetched.Store(h, pre)
+		}
+	}
+}
+
+// recordFailure appends the failure to the failed batches file
+func (m *MigrationService) recordFailure(f failedBatch) {
+	if f.Hash != nil {
+		m.metrics.batches.WithLabelValues("failed").Inc()
+	}
+	if err := m.failures.record(f); err != nil {
+		log.Printf("⚠️ Failed to record failed batch to %s: %v", m.failures.path, err)
+	}
+}
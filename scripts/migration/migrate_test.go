@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ✅ Test the progress only advances past blocks once every block below is processed
+func TestProgress(t *testing.T) {
+	p := newProgress(10)
+
+	// Blocks finish out of order
+	assert.False(t, p.complete(blockResult{block: 11, batches: 2, ok: 2}))
+	assert.False(t, p.complete(blockResult{block: 13}))
+	assert.Equal(t, uint64(10), p.next)
+	assert.True(t, p.complete(blockResult{block: 10, batches: 1, ok: 1}))
+	assert.Equal(t, uint64(12), p.next)
+
+	// ❌ Failed blocks advance the progress too, they are reported
+	assert.True(t, p.complete(blockResult{block: 12, batches: 3, ok: 1}))
+	assert.Equal(t, uint64(14), p.next)
+	p.complete(blockResult{block: 14, err: errors.New("failed to get logs")})
+	assert.Equal(t, uint64(15), p.next)
+
+	assert.Equal(t, 5, p.blocks)
+	assert.Equal(t, 6, p.batches)
+	assert.Equal(t, 4, p.ok)
+	assert.Equal(t, 2, p.failed)
+	assert.Equal(t, []uint64{14}, p.failedBlocks)
+	assert.Empty(t, p.done)
+}
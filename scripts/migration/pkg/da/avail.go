@@ -0,0 +1,47 @@
+package da
+
+import (
+	"fmt"
+	"sync"
+
+	avail_sdk "github.com/availproject/avail-go-sdk/sdk"
+	"github.com/vedhavyas/go-subkey/v2"
+)
+
+// availSubmitter submits data directly to Avail with the avail-go-sdk
+type availSubmitter struct {
+	// submissions are serialized, concurrent transactions of the same account would
+	// be signed with the same nonce
+	mu      sync.Mutex
+	sdk     avail_sdk.SDK
+	account subkey.KeyPair
+	appID   uint32
+}
+
+func newAvailSubmitter(url, seed string, appID uint32) (*availSubmitter, error) {
+	sdk, err := avail_sdk.NewSDK(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Avail at %s: %w", url, err)
+	}
+	account, err := avail_sdk.Account.NewKeyPair(seed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AVAIL_SEED: %w", err)
+	}
+	return &availSubmitter{sdk: sdk, account: account, appID: appID}, nil
+}
+
+// submit submits the data and waits for finalization of the extrinsic
+func (a *availSubmitter) submit(data []byte) (avail_sdk.TransactionDetails, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	tx := a.sdk.Tx.DataAvailability.SubmitData(data)
+	details, err := tx.ExecuteAndWatchFinalization(a.account, avail_sdk.NewTransactionOptions().WithAppId(a.appID))
+	if err != nil {
+		return avail_sdk.TransactionDetails{}, err
+	}
+	if !details.IsSuccessful().UnwrapOr(false) {
+		return avail_sdk.TransactionDetails{}, fmt.Errorf("extrinsic %s failed on Avail", details.TxHash.ToHuman())
+	}
+	return details, nil
+}
@@ -3,78 +3,313 @@ package da
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/ethereum/go-ethereum/common"
+
+	s3_storage_service "github.com/availproject/cdk-avail-da-server/lib/avail/s3StorageService"
+	"github.com/availproject/cdk-avail-da-server/pkg/s3object"
+	"github.com/availproject/cdk-avail-da-server/pkg/storagekey"
 )
 
+// ErrNotFound is returned when no object is stored for the hash
+var ErrNotFound = errors.New("object not found in S3")
+
+// DA targets the batches are posted to
+const (
+	TargetTurboDA = "turboda"
+	TargetAvail   = "avail"
+	TargetS3      = "s3"
+)
+
+// Config selects the DA targets and holds the settings of each of them
+type Config struct {
+	// Targets are posted to in the order turboda, avail, s3
+	Targets []string
+
+	S3Bucket       string
+	S3Region       string
+	S3AccessKey    string
+	S3SecretKey    string
+	S3ObjectPrefix string
+	// S3KeyLayout is the key layout shared with the server, flat or sharded
+	S3KeyLayout   string
+	UploadOptions UploadOptions
+	// S3Concurrency is the most uploads sent to S3 at once, it is lowered while S3
+	// responds with SlowDown
+	S3Concurrency int
+
+	TurboDAURL    string
+	TurboDAAPIKey string
+
+	AvailRPCURL string
+	AvailSeed   string
+	AvailAppID  uint32
+
+	// SubmissionsFile records the Turbo DA submission id of every batch, empty
+	// disables it
+	SubmissionsFile string
+
+	// Observe is called after every post to a target, e.g. to record metrics
+	Observe func(target string, duration time.Duration, err error)
+}
+
+// Enabled returns whether the target is selected
+func (c Config) Enabled(target string) bool {
+	return slices.Contains(c.Targets, target)
+}
+
+func (c Config) validate() error {
+	if len(c.Targets) == 0 {
+		return fmt.Errorf("at least one DA target is required")
+	}
+	for _, target := range c.Targets {
+		switch target {
+		case TargetTurboDA:
+			if c.TurboDAURL == "" || c.TurboDAAPIKey == "" {
+				return fmt.Errorf("please set TURBO_DA_URL and API_KEY for the %s target", target)
+			}
+		case TargetAvail:
+			if c.AvailRPCURL == "" || c.AvailSeed == "" {
+				return fmt.Errorf("please set AVAIL_RPC_URL and AVAIL_SEED for the %s target", target)
+			}
+		case TargetS3:
+			if c.S3Bucket == "" || c.S3Region == "" || c.S3AccessKey == "" || c.S3SecretKey == "" {
+				return fmt.Errorf("missing required S3 configuration for the %s target", target)
+			}
+		default:
+			return fmt.Errorf("unknown DA target %q, expected %s, %s or %s", target, TargetTurboDA, TargetAvail, TargetS3)
+		}
+	}
+	if _, err := storagekey.NewCodec(c.S3ObjectPrefix, c.S3KeyLayout); err != nil {
+		return err
+	}
+	return c.UploadOptions.validate()
+}
+
 type DABackend struct {
-	s3Client     *s3.Client
-	bucket       string
-	objectPrefix string
-	turboDAURL   string
-	apiKey       string
+	config        Config
+	s3Client      *s3.Client
+	bucket        string
+	objectPrefix  string
+	keys          storagekey.Codec
+	uploadOptions UploadOptions
+	s3Throttle    *s3_storage_service.Throttle
+	turboDAURL    string
+	apiKey        string
+	avail         *availSubmitter
+	submissions   *submissionLedger
 }
 
-func NewDABackend(bucket, region, accessKey, secretKey, objectPrefix, turboDAURL, apiKey string) (*DABackend, error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(region),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")),
-	)
-	if err != nil {
-		log.Printf("Failed to load AWS config for bucket %s in region %s, err: %v", bucket, region, err)
+// UploadOptions are applied to every object uploaded to S3, empty values keep the
+// bucket defaults
+type UploadOptions struct {
+	ServerSideEncryption string
+	SSEKMSKeyId          string
+	StorageClass         string
+	ChecksumAlgorithm    string
+	Metadata             map[string]string
+}
+
+// S3 object metadata keys recording where else the batch was posted
+const (
+	turboDASubmissionIDMetadata = "turbo-da-submission-id"
+	availBlockNumberMetadata    = "avail-block-number"
+	availTxHashMetadata         = "avail-tx-hash"
+)
+
+type turboDASubmitResponse struct {
+	SubmissionID string `json:"submission_id"`
+}
+
+func (o UploadOptions) validate() error {
+	if o.ServerSideEncryption != "" && !slices.Contains(types.ServerSideEncryption("").Values(), types.ServerSideEncryption(o.ServerSideEncryption)) {
+		return fmt.Errorf("invalid S3_SSE %q, expected one of %v", o.ServerSideEncryption, types.ServerSideEncryption("").Values())
+	}
+	if o.SSEKMSKeyId != "" && types.ServerSideEncryption(o.ServerSideEncryption) != types.ServerSideEncryptionAwsKms {
+		return fmt.Errorf("S3_SSE_KMS_KEY_ID requires S3_SSE=%s", types.ServerSideEncryptionAwsKms)
+	}
+	if o.StorageClass != "" && !slices.Contains(types.StorageClass("").Values(), types.StorageClass(o.StorageClass)) {
+		return fmt.Errorf("invalid S3_STORAGE_CLASS %q, expected one of %v", o.StorageClass, types.StorageClass("").Values())
+	}
+	if o.ChecksumAlgorithm != "" && !slices.Contains(types.ChecksumAlgorithm("").Values(), types.ChecksumAlgorithm(o.ChecksumAlgorithm)) {
+		return fmt.Errorf("invalid S3_CHECKSUM_ALGORITHM %q, expected one of %v", o.ChecksumAlgorithm, types.ChecksumAlgorithm("").Values())
+	}
+	return nil
+}
+
+func (o UploadOptions) apply(input *s3.PutObjectInput) {
+	if o.ServerSideEncryption != "" {
+		input.ServerSideEncryption = types.ServerSideEncryption(o.ServerSideEncryption)
+	}
+	if o.SSEKMSKeyId != "" {
+		input.SSEKMSKeyId = aws.String(o.SSEKMSKeyId)
+	}
+	if o.StorageClass != "" {
+		input.StorageClass = types.StorageClass(o.StorageClass)
+	}
+	if o.ChecksumAlgorithm != "" {
+		input.ChecksumAlgorithm = types.ChecksumAlgorithm(o.ChecksumAlgorithm)
+	}
+	if len(o.Metadata) > 0 {
+		input.Metadata = o.Metadata
+	}
+}
+
+func NewDABackend(config Config) (*DABackend, error) {
+	if err := config.validate(); err != nil {
 		return nil, err
 	}
-	s3Client := s3.NewFromConfig(cfg)
 
-	return &DABackend{
-		s3Client:     s3Client,
-		turboDAURL:   turboDAURL,
-		apiKey:       apiKey,
-		bucket:       bucket,
-		objectPrefix: objectPrefix,
-	}, nil
+	backend := &DABackend{
+		config:        config,
+		turboDAURL:    config.TurboDAURL,
+		apiKey:        config.TurboDAAPIKey,
+		bucket:        config.S3Bucket,
+		objectPrefix:  config.S3ObjectPrefix,
+		uploadOptions: config.UploadOptions,
+	}
+
+	// The key layout was validated with the config
+	backend.keys, _ = storagekey.NewCodec(config.S3ObjectPrefix, config.S3KeyLayout)
+
+	if config.Enabled(TargetS3) {
+		cfg, err := awsconfig.LoadDefaultConfig(context.TODO(),
+			awsconfig.WithRegion(config.S3Region),
+			awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(config.S3AccessKey, config.S3SecretKey, "")),
+		)
+		if err != nil {
+			log.Printf("Failed to load AWS config for bucket %s in region %s, err: %v", config.S3Bucket, config.S3Region, err)
+			return nil, err
+		}
+		backend.s3Client = s3.NewFromConfig(cfg)
+		backend.s3Throttle = s3_storage_service.NewThrottle(config.S3Concurrency, func(limit int, throttled bool) {
+			if throttled {
+				log.Printf("🐢 S3 is throttling uploads, lowering the S3 upload concurrency to %d", limit)
+			} else {
+				log.Printf("🐇 Raising the S3 upload concurrency to %d", limit)
+			}
+		})
+	}
+
+	if config.Enabled(TargetTurboDA) && config.SubmissionsFile != "" {
+		backend.submissions = &submissionLedger{path: config.SubmissionsFile}
+	}
+
+	if config.Enabled(TargetAvail) {
+		avail, err := newAvailSubmitter(config.AvailRPCURL, config.AvailSeed, config.AvailAppID)
+		if err != nil {
+			return nil, err
+		}
+		backend.avail = avail
+	}
+	return backend, nil
+}
+
+// objectKey returns the key the batch is written to, encoded like the server and the
+// Avail fallback storage read it
+func (s *DABackend) objectKey(hash common.Hash) string {
+	return s.keys.Key(hash)
+}
+
+// legacyKeys returns the other keys the batch may have been written to: the key of
+// the other layout and the 0x prefixed hash some tools used
+func (s *DABackend) legacyKeys(hash common.Hash) []string {
+	return s.keys.LegacyKeys(hash)
 }
 
-func encodeKey(hash common.Hash) string {
-	return hash.Hex()[2:] // strip 0x
+// readKeys returns the keys the batch is read from. Like the server, flat keys are
+// still read with the sharded layout.
+func (s *DABackend) readKeys(hash common.Hash) []string {
+	return s.keys.ReadKeys(hash)
 }
 
+// PostDataToDA posts the data to every selected target. The Turbo DA submission id
+// and the Avail transaction are recorded on the S3 object so re-runs can check them.
 func (s *DABackend) PostDataToDA(ctx context.Context, hash common.Hash, data []byte) error {
-	// First post to Turbo DA
-	_, err := PostDataToTurboDA(ctx, s.turboDAURL, s.apiKey, data)
-	if err != nil {
-		log.Printf("Failed to post data to Turbo DA for hash %s: %v", hash.Hex(), err)
-		return err
+	metadata := map[string]string{}
+
+	if s.config.Enabled(TargetTurboDA) {
+		start := time.Now()
+		submissionID, err := PostDataToTurboDA(ctx, s.turboDAURL, s.apiKey, data)
+		s.observe(TargetTurboDA, start, err)
+		if err != nil {
+			log.Printf("Failed to post data to Turbo DA for hash %s: %v", hash.Hex(), err)
+			return err
+		}
+		metadata[turboDASubmissionIDMetadata] = submissionID
+		if s.submissions != nil {
+			if err := s.submissions.record(hash, submissionID); err != nil {
+				log.Printf("Failed to record Turbo DA submission %s of hash %s: %v", submissionID, hash.Hex(), err)
+			}
+		}
 	}
-	// Then upload to S3
-	err = PostDataToS3(ctx, s.s3Client, s.objectPrefix, s.bucket, hash, data)
-	if err != nil {
-		log.Printf("Failed to upload data to S3 for hash %s: %v", hash.Hex(), err)
-		return err
+
+	if s.config.Enabled(TargetAvail) {
+		start := time.Now()
+		tx, err := s.avail.submit(data)
+		s.observe(TargetAvail, start, err)
+		if err != nil {
+			log.Printf("Failed to submit data to Avail for hash %s: %v", hash.Hex(), err)
+			return err
+		}
+		log.Printf("Successfully submitted data to Avail, hash:%s, block:%d, tx:%s", hash.Hex(), tx.BlockNumber, tx.TxHash.ToHuman())
+		metadata[availBlockNumberMetadata] = strconv.FormatUint(uint64(tx.BlockNumber), 10)
+		metadata[availTxHashMetadata] = tx.TxHash.ToHuman()
+	}
+
+	if s.config.Enabled(TargetS3) {
+		uploadOptions := s.uploadOptions
+		if len(metadata) > 0 {
+			uploadOptions.Metadata = metadata
+		}
+		start := time.Now()
+		// SlowDown responses are sent again at a lower concurrency instead of failing
+		// the batch
+		err := s.s3Throttle.Do(ctx, func() error {
+			return PostDataToS3(ctx, s.s3Client, s.bucket, s.objectKey(hash), hash, data, uploadOptions)
+		})
+		s.observe(TargetS3, start, err)
+		if err != nil {
+			log.Printf("Failed to upload data to S3 for hash %s: %v", hash.Hex(), err)
+			return err
+		}
 	}
 	return nil
 }
 
-func PostDataToS3(ctx context.Context, s3Client *s3.Client, objectPrefix string, bucket string, hash common.Hash, data []byte) error {
+func (s *DABackend) observe(target string, start time.Time, err error) {
+	if s.config.Observe != nil {
+		s.config.Observe(target, time.Since(start), err)
+	}
+}
+
+func PostDataToS3(ctx context.Context, s3Client *s3.Client, bucket string, key string, hash common.Hash, data []byte, uploadOptions UploadOptions) error {
 	start := time.Now()
-	key := objectPrefix + encodeKey(hash)
 	log.Printf("Uploading data to S3, bucket:%s, key:%s, hash:%s, size:%d bytes", bucket, key, hash.Hex(), len(data))
 
 	// PutObject API call
-	_, err := s3Client.PutObject(ctx, &s3.PutObjectInput{
+	input := &s3.PutObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
 		Body:   bytes.NewReader(data),
-	})
+	}
+	uploadOptions.apply(input)
+	_, err := s3Client.PutObject(ctx, input)
 	if err != nil {
 		log.Printf("Failed to upload object to S3, bucket:%s, key:%s, hash:%s, err:%v", bucket, key, hash.Hex(), err)
 		return fmt.Errorf("failed to upload object to S3: %w", err)
@@ -86,11 +321,192 @@ func PostDataToS3(ctx context.Context, s3Client *s3.Client, objectPrefix string,
 	return nil
 }
 
-func PostDataToTurboDA(ctx context.Context, url string, apiKey string, data []byte) ([]byte, error) {
+// Exists returns whether the batch has already been migrated. The S3 object must
+// exist and, with checkTurboDA, carry the id of a submission Turbo DA still serves.
+func (s *DABackend) Exists(ctx context.Context, hash common.Hash, checkTurboDA bool) (bool, error) {
+	// Without S3 there is nothing that records what was migrated
+	if s.s3Client == nil {
+		return false, nil
+	}
+	out, _, err := s.head(ctx, s.readKeys(hash))
+	if err != nil {
+		return false, err
+	}
+	if out == nil {
+		return false, nil
+	}
+	if !checkTurboDA {
+		return true, nil
+	}
+
+	submissionID := out.Metadata[turboDASubmissionIDMetadata]
+	if submissionID == "" {
+		return false, nil
+	}
+	query := url.Values{"submission_id": {submissionID}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.turboDAURL+"/v1/get_pre_image?"+query.Encode(), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("x-api-key", s.apiKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to check Turbo DA submission %s: %w", submissionID, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return true, nil
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to check Turbo DA submission %s, status: %d", submissionID, resp.StatusCode)
+	}
+}
+
+// GetDataFromS3 reads the object stored for the hash, ErrNotFound is returned when
+// it doesn't exist
+func (s *DABackend) GetDataFromS3(ctx context.Context, hash common.Hash) ([]byte, error) {
+	keys := s.readKeys(hash)
+	for _, key := range keys {
+		// Truncated bodies are resumed, and fail rather than returning a short blob
+		data, _, err := s3object.Read(ctx, s.s3Client, &s3.GetObjectInput{
+			Bucket:       aws.String(s.bucket),
+			Key:          aws.String(key),
+			ChecksumMode: types.ChecksumModeEnabled,
+		}, s3object.DefaultAttempts)
+		if err != nil {
+			var noSuchKey *types.NoSuchKey
+			if errors.As(err, &noSuchKey) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read object %s from S3: %w", key, err)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("%w: key %s", ErrNotFound, keys[0])
+}
+
+// Canary writes the data to a canary object, reads it back and deletes it, to check
+// the bucket and the credentials before a run
+func (s *DABackend) Canary(ctx context.Context, data []byte) error {
+	key := fmt.Sprintf("%sselftest-canary-%x", s.objectPrefix, data[:8])
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	}
+	s.uploadOptions.apply(input)
+	if _, err := s.s3Client.PutObject(ctx, input); err != nil {
+		return fmt.Errorf("failed to write canary %s: %w", key, err)
+	}
+	out, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:       aws.String(s.bucket),
+		Key:          aws.String(key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read canary %s: %w", key, err)
+	}
+	read, err := io.ReadAll(out.Body)
+	out.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read canary %s: %w", key, err)
+	}
+	if !bytes.Equal(read, data) {
+		return fmt.Errorf("canary %s read back differs from the data written", key)
+	}
+	_, err = s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete canary %s: %w", key, err)
+	}
+	return nil
+}
+
+// head returns the metadata of the first of the keys that exists, nil is returned
+// when none does
+func (s *DABackend) head(ctx context.Context, keys []string) (*s3.HeadObjectOutput, string, error) {
+	for _, key := range keys {
+		out, err := s.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			var notFound *types.NotFound
+			if errors.As(err, &notFound) {
+				continue
+			}
+			return nil, "", fmt.Errorf("failed to check object %s in S3: %w", key, err)
+		}
+		return out, key, nil
+	}
+	return nil, "", nil
+}
+
+// RepairKey moves the object of the hash from a legacy key to the key the server
+// reads and returns whether it was moved. ErrNotFound is returned when the object
+// exists under none of the keys.
+func (s *DABackend) RepairKey(ctx context.Context, hash common.Hash, dryRun bool) (bool, error) {
+	key := s.objectKey(hash)
+	out, _, err := s.head(ctx, []string{key})
+	if err != nil {
+		return false, err
+	}
+	if out != nil {
+		return false, nil
+	}
+
+	out, legacyKey, err := s.head(ctx, s.legacyKeys(hash))
+	if err != nil {
+		return false, err
+	}
+	if out == nil {
+		return false, fmt.Errorf("%w: key %s", ErrNotFound, key)
+	}
+	if dryRun {
+		log.Printf("Would move object of hash %s from %s to %s", hash.Hex(), legacyKey, key)
+		return true, nil
+	}
+
+	// The copy keeps the metadata, storage class and encryption are set again
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(s.bucket),
+		Key:        aws.String(key),
+		CopySource: aws.String((&url.URL{Path: s.bucket + "/" + legacyKey}).EscapedPath()),
+	}
+	if s.uploadOptions.ServerSideEncryption != "" {
+		input.ServerSideEncryption = types.ServerSideEncryption(s.uploadOptions.ServerSideEncryption)
+	}
+	if s.uploadOptions.SSEKMSKeyId != "" {
+		input.SSEKMSKeyId = aws.String(s.uploadOptions.SSEKMSKeyId)
+	}
+	if s.uploadOptions.StorageClass != "" {
+		input.StorageClass = types.StorageClass(s.uploadOptions.StorageClass)
+	}
+	if _, err := s.s3Client.CopyObject(ctx, input); err != nil {
+		return false, fmt.Errorf("failed to copy object %s to %s: %w", legacyKey, key, err)
+	}
+	if _, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(legacyKey),
+	}); err != nil {
+		return true, fmt.Errorf("copied object %s to %s but failed to delete it: %w", legacyKey, key, err)
+	}
+	log.Printf("Moved object of hash %s from %s to %s", hash.Hex(), legacyKey, key)
+	return true, nil
+}
+
+// PostDataToTurboDA submits the data and returns the submission id assigned by Turbo
+// DA. Error statuses and responses without a submission id are failures.
+func PostDataToTurboDA(ctx context.Context, url string, apiKey string, data []byte) (string, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url+"/v1/submit_raw_data", bytes.NewReader(data))
 	if err != nil {
 		log.Printf("Failed to create request to Turbo DA: %v", err)
-		return nil, err
+		return "", err
 	}
 	req.Header.Set("Content-Type", "application/octet-stream")
 	req.Header.Set("x-api-key", apiKey)
@@ -98,16 +514,27 @@ func PostDataToTurboDA(ctx context.Context, url string, apiKey string, data []by
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		log.Printf("Failed to post data to Turbo DA: %v", err)
-		return nil, err
+		return "", err
 	}
 	defer resp.Body.Close()
 
 	respData, err := io.ReadAll(resp.Body)
 	if err != nil {
 		log.Printf("Failed to read response from Turbo DA: %v", err)
-		return nil, err
+		return "", err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("turbo DA request failed, status: %d, body: %s", resp.StatusCode, respData)
+	}
+
+	var submitResp turboDASubmitResponse
+	if err := json.Unmarshal(respData, &submitResp); err != nil {
+		return "", fmt.Errorf("cannot unmarshal Turbo DA response: %w", err)
+	}
+	if submitResp.SubmissionID == "" {
+		return "", fmt.Errorf("turbo DA response is missing the submission id: %s", respData)
 	}
 
-	log.Printf("Successfully posted data to Turbo DA")
-	return respData, nil
+	log.Printf("Successfully posted data to Turbo DA, submission id: %s", submitResp.SubmissionID)
+	return submitResp.SubmissionID, nil
 }
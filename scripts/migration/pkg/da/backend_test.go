@@ -0,0 +1,332 @@
+package da
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	s3_storage_service "github.com/availproject/cdk-avail-da-server/lib/avail/s3StorageService"
+	"github.com/availproject/cdk-avail-da-server/pkg/storagekey"
+)
+
+const testBucket = "test-bucket"
+
+// fakeS3 is an in-memory S3 bucket served over the S3 REST api, path style
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]fakeObject
+}
+
+type fakeObject struct {
+	body   []byte
+	header http.Header
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/"+testBucket+"/")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+			source, _ = url.PathUnescape(source)
+			object, ok := f.objects[strings.TrimPrefix(source, testBucket+"/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			f.objects[key] = object
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><CopyObjectResult><ETag>"etag"</ETag></CopyObjectResult>`)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		header := http.Header{}
+		for k, v := range r.Header {
+			if strings.HasPrefix(k, "X-Amz-Meta-") {
+				header[k] = v
+			}
+		}
+		f.objects[key] = fakeObject{body: body, header: header}
+	case http.MethodGet, http.MethodHead:
+		object, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+			}
+			return
+		}
+		for k, v := range object.header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.body)))
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			w.Write(object.body)
+		}
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) object(key string) (fakeObject, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	object, ok := f.objects[key]
+	return object, ok
+}
+
+// newTestBackend returns a backend posting to the targets of config, S3 is a fake
+// bucket and Turbo DA is served by turboDA
+func newTestBackend(t *testing.T, config Config, turboDA http.Handler) (*DABackend, *fakeS3) {
+	bucket := &fakeS3{objects: make(map[string]fakeObject)}
+	s3Srv := httptest.NewServer(bucket)
+	t.Cleanup(s3Srv.Close)
+	keys, err := storagekey.NewCodec(config.S3ObjectPrefix, config.S3KeyLayout)
+	require.NoError(t, err)
+
+	backend := &DABackend{
+		config: config,
+		s3Client: s3.New(s3.Options{
+			Region:                     "us-east-1",
+			BaseEndpoint:               aws.String(s3Srv.URL),
+			UsePathStyle:               true,
+			Credentials:                aws.AnonymousCredentials{},
+			RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+			ResponseChecksumValidation: aws.ResponseChecksumValidationWhenRequired,
+		}),
+		bucket:       testBucket,
+		objectPrefix: config.S3ObjectPrefix,
+		keys:         keys,
+		s3Throttle:   s3_storage_service.NewThrottle(1, nil),
+		apiKey:       "api-key",
+	}
+	if turboDA != nil {
+		srv := httptest.NewServer(turboDA)
+		t.Cleanup(srv.Close)
+		backend.turboDAURL = srv.URL
+	}
+	return backend, bucket
+}
+
+// ✅ Test batches already in S3 are recognized, with their Turbo DA submission
+func TestExists(t *testing.T) {
+	ctx := context.Background()
+	var status int
+	turboDA := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/get_pre_image", r.URL.Path)
+		assert.Equal(t, "api-key", r.Header.Get("x-api-key"))
+		if r.URL.Query().Get("submission_id") != "submission-1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(status)
+	})
+	s, _ := newTestBackend(t, Config{Targets: []string{TargetS3}, S3ObjectPrefix: "batches/"}, turboDA)
+
+	migrated, submitted, missing := []byte("batch-1"), []byte("batch-2"), []byte("batch-3")
+	require.NoError(t, PostDataToS3(ctx, s.s3Client, s.bucket, s.objectKey(crypto.Keccak256Hash(migrated)), crypto.Keccak256Hash(migrated), migrated, UploadOptions{}))
+	require.NoError(t, PostDataToS3(ctx, s.s3Client, s.bucket, s.objectKey(crypto.Keccak256Hash(submitted)), crypto.Keccak256Hash(submitted), submitted,
+		UploadOptions{Metadata: map[string]string{turboDASubmissionIDMetadata: "submission-1"}}))
+
+	tests := []struct {
+		name         string
+		data         []byte
+		checkTurboDA bool
+		status       int
+		want         bool
+		err          bool
+	}{
+		{name: "in S3", data: migrated, want: true},
+		{name: "missing", data: missing},
+		{name: "without a submission", data: migrated, checkTurboDA: true},
+		{name: "with a submission", data: submitted, checkTurboDA: true, status: http.StatusOK, want: true},
+		{name: "submission expired", data: submitted, checkTurboDA: true, status: http.StatusNotFound},
+		{name: "Turbo DA failing", data: submitted, checkTurboDA: true, status: http.StatusBadGateway, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status = tt.status
+			exists, err := s.Exists(ctx, crypto.Keccak256Hash(tt.data), tt.checkTurboDA)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, exists)
+		})
+	}
+
+	// Without S3 nothing records what was migrated
+	s.s3Client = nil
+	exists, err := s.Exists(ctx, crypto.Keccak256Hash(migrated), false)
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+// ✅ Test Turbo DA responses are only accepted with a submission id
+func TestPostDataToTurboDA(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+		err    string
+	}{
+		{name: "submitted", status: http.StatusOK, body: `{"submission_id":"submission-1"}`, want: "submission-1"},
+		{name: "created", status: http.StatusCreated, body: `{"submission_id":"submission-1"}`, want: "submission-1"},
+		{name: "error status", status: http.StatusUnauthorized, body: `invalid api key`, err: "status: 401, body: invalid api key"},
+		{name: "not JSON", status: http.StatusOK, body: `<html>`, err: "cannot unmarshal"},
+		{name: "no submission id", status: http.StatusOK, body: `{"error":"queue full"}`, err: "missing the submission id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/v1/submit_raw_data", r.URL.Path)
+				assert.Equal(t, "api-key", r.Header.Get("x-api-key"))
+				body, _ := io.ReadAll(r.Body)
+				assert.Equal(t, "batch-1", string(body))
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer srv.Close()
+			id, err := PostDataToTurboDA(context.Background(), srv.URL, "api-key", []byte("batch-1"))
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, id)
+		})
+	}
+}
+
+// ✅ Test the Turbo DA submission of a batch is recorded on its object and in the ledger
+func TestPostDataToDASubmission(t *testing.T) {
+	ctx := context.Background()
+	turboDA := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"submission_id":"submission-1"}`)
+	})
+	s, bucket := newTestBackend(t, Config{Targets: []string{TargetTurboDA, TargetS3}}, turboDA)
+	s.submissions = &submissionLedger{path: filepath.Join(t.TempDir(), "submissions.jsonl")}
+
+	data := []byte("batch-1")
+	hash := crypto.Keccak256Hash(data)
+	require.NoError(t, s.PostDataToDA(ctx, hash, data))
+	object, ok := bucket.object(s.objectKey(hash))
+	require.True(t, ok)
+	assert.Equal(t, data, object.body)
+	assert.Equal(t, "submission-1", object.header.Get("X-Amz-Meta-"+turboDASubmissionIDMetadata))
+
+	ledger, err := os.ReadFile(s.submissions.path)
+	require.NoError(t, err)
+	var submission Submission
+	require.NoError(t, json.Unmarshal(ledger, &submission))
+	assert.Equal(t, hash, submission.Hash)
+	assert.Equal(t, "submission-1", submission.SubmissionID)
+
+	// ❌ Nothing is uploaded to S3 when Turbo DA fails
+	s, bucket = newTestBackend(t, Config{Targets: []string{TargetTurboDA, TargetS3}}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	assert.Error(t, s.PostDataToDA(ctx, hash, data))
+	_, ok = bucket.object(s.objectKey(hash))
+	assert.False(t, ok)
+}
+
+// ✅ Test objects of legacy keys are moved to the key the server reads
+func TestRepairKey(t *testing.T) {
+	ctx := context.Background()
+	s, bucket := newTestBackend(t, Config{Targets: []string{TargetS3}, S3ObjectPrefix: "batches/", S3KeyLayout: storagekey.LayoutSharded}, nil)
+	data := []byte("batch-1")
+	hash := crypto.Keccak256Hash(data)
+
+	for _, legacyKey := range s.legacyKeys(hash) {
+		require.NoError(t, PostDataToS3(ctx, s.s3Client, s.bucket, legacyKey, hash, data, UploadOptions{Metadata: map[string]string{turboDASubmissionIDMetadata: "submission-1"}}))
+
+		// A dry run only reports the move
+		moved, err := s.RepairKey(ctx, hash, true)
+		require.NoError(t, err)
+		assert.True(t, moved)
+		_, ok := bucket.object(s.objectKey(hash))
+		assert.False(t, ok)
+
+		moved, err = s.RepairKey(ctx, hash, false)
+		require.NoError(t, err)
+		assert.True(t, moved)
+		object, ok := bucket.object(s.objectKey(hash))
+		require.True(t, ok, legacyKey)
+		assert.Equal(t, data, object.body)
+		assert.Equal(t, "submission-1", object.header.Get("X-Amz-Meta-"+turboDASubmissionIDMetadata))
+		_, ok = bucket.object(legacyKey)
+		assert.False(t, ok)
+		got, err := s.GetDataFromS3(ctx, hash)
+		require.NoError(t, err)
+		assert.Equal(t, data, got)
+
+		// Objects under the right key are left alone
+		moved, err = s.RepairKey(ctx, hash, false)
+		require.NoError(t, err)
+		assert.False(t, moved)
+		bucket.mu.Lock()
+		delete(bucket.objects, s.objectKey(hash))
+		bucket.mu.Unlock()
+	}
+
+	// ❌ The object is under no key
+	_, err := s.RepairKey(ctx, hash, false)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = s.GetDataFromS3(ctx, hash)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+// ✅ Test every selected target needs its settings
+func TestConfigValidate(t *testing.T) {
+	s3 := Config{Targets: []string{TargetS3}, S3Bucket: "bucket", S3Region: "us-east-1", S3AccessKey: "key", S3SecretKey: "secret"}
+	tests := []struct {
+		name   string
+		config Config
+		err    string
+	}{
+		{name: "s3", config: s3},
+		{name: "turboda", config: Config{Targets: []string{TargetTurboDA}, TurboDAURL: "http://turbo", TurboDAAPIKey: "key"}},
+		{name: "avail", config: Config{Targets: []string{TargetAvail}, AvailRPCURL: "ws://avail", AvailSeed: "seed"}},
+		{name: "no target", config: Config{}, err: "at least one DA target"},
+		{name: "unknown target", config: Config{Targets: []string{"celestia"}}, err: `unknown DA target "celestia"`},
+		{name: "turboda without api key", config: Config{Targets: []string{TargetTurboDA}, TurboDAURL: "http://turbo"}, err: "TURBO_DA_URL and API_KEY"},
+		{name: "avail without seed", config: Config{Targets: []string{TargetAvail}, AvailRPCURL: "ws://avail"}, err: "AVAIL_RPC_URL and AVAIL_SEED"},
+		{name: "s3 without bucket", config: Config{Targets: []string{TargetS3}}, err: "missing required S3 configuration"},
+		{name: "invalid layout", config: Config{Targets: []string{TargetTurboDA}, TurboDAURL: "http://turbo", TurboDAAPIKey: "key", S3KeyLayout: "nested"}, err: "nested"},
+		{name: "invalid storage class", config: Config{Targets: []string{TargetTurboDA}, TurboDAURL: "http://turbo", TurboDAAPIKey: "key", UploadOptions: UploadOptions{StorageClass: "COLD"}}, err: "invalid S3_STORAGE_CLASS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package da
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Submission is a line of the submissions file, mapping a batch hash to the Turbo DA
+// submission its data was posted in
+type Submission struct {
+	Hash         common.Hash `json:"hash"`
+	SubmissionID string      `json:"submissionId"`
+	Time         time.Time   `json:"time"`
+}
+
+// submissionLedger appends submissions to a JSON lines file for later reconciliation
+type submissionLedger struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (l *submissionLedger) record(hash common.Hash, submissionID string) error {
+	line, err := json.Marshal(Submission{Hash: hash, SubmissionID: submissionID, Time: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -3,14 +3,18 @@ package dac
 import (
 	"bytes"
 	"context"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
+	"net/url"
+	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/time/rate"
 )
 
 // JSON-RPC request format
@@ -34,12 +38,198 @@ type rpcError struct {
 	Message string `json:"message"`
 }
 
-func GetDataFromDACByHash(ctx context.Context, dacURL string, hash common.Hash) ([]byte, error) {
+// JSON-RPC error code of unknown methods
+const methodNotFoundCode = -32601
+
+// ErrMethodNotFound is returned when a member doesn't implement the method
+var ErrMethodNotFound = errors.New("method not found")
+
+// ErrNotFound is returned when every member answered the request with an error, e.g.
+// because none of them has the data
+var ErrNotFound = errors.New("no member has the data")
+
+// errRPC is the error of a member answering with a JSON-RPC error
+var errRPC = errors.New("rpc error")
+
+// ErrHashMismatch is returned when a member returns data whose keccak256 isn't the
+// requested hash, e.g. a corrupted or truncated response
+var ErrHashMismatch = errors.New("data hash mismatch")
+
+// Auth holds the credentials sent to committee members whose sync endpoint requires
+// authentication. Credentials in the userinfo of a member url are used for that
+// member when no Authorization header is set.
+type Auth struct {
+	Username    string
+	Password    string
+	BearerToken string
+	// Headers are set on every request, e.g. an api key header
+	Headers map[string]string
+}
+
+func (a Auth) apply(req *http.Request) {
+	for k, v := range a.Headers {
+		req.Header.Set(k, v)
+	}
+	if a.Username != "" {
+		req.SetBasicAuth(a.Username, a.Password)
+	}
+	if a.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+a.BearerToken)
+	}
+}
+
+// Client reads batch data from the members of the data availability committee. A
+// request goes to the member that last answered and rotates through the others when
+// it fails, since members go offline while the data is still on the others.
+type Client struct {
+	urls      []string
+	preferred atomic.Uint32
+	limiter   *rate.Limiter
+	auth      Auth
+	// listUnsupported is set once no member implements sync_listOffChainData
+	listUnsupported atomic.Bool
+}
+
+// NewClient creates a client sending at most rps requests per second to the
+// committee, zero disables the limit
+func NewClient(urls []string, rps float64, auth Auth) (*Client, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("at least one DAC url is required")
+	}
+	c := &Client{urls: urls, auth: auth}
+	if rps > 0 {
+		c.limiter = rate.NewLimiter(rate.Limit(rps), max(1, int(rps)))
+	}
+	return c, nil
+}
+
+// GetDataByHash returns the data of the hash from the first member that has it
+func (c *Client) GetDataByHash(ctx context.Context, hash common.Hash) ([]byte, error) {
+	start := int(c.preferred.Load())
+	var errs []error
+	answered := 0
+	for i := range c.urls {
+		idx := (start + i) % len(c.urls)
+		if c.limiter != nil {
+			if err := c.limiter.Wait(ctx); err != nil {
+				errs = append(errs, err)
+				break
+			}
+		}
+		data, err := GetDataFromDACByHash(ctx, c.urls[idx], hash, c.auth)
+		if errors.Is(err, errRPC) {
+			answered++
+		}
+		if err == nil && crypto.Keccak256Hash(data) != hash {
+			err = fmt.Errorf("%w, got %s", ErrHashMismatch, crypto.Keccak256Hash(data).Hex())
+		}
+		if err == nil {
+			// #nosec G115
+			c.preferred.Store(uint32(idx))
+			return data, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", redactURL(c.urls[idx]), err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if answered == len(c.urls) {
+		return nil, fmt.Errorf("%w: %w", ErrNotFound, errors.Join(errs...))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// ListDataByHashes returns the data of the hashes with a single request to the first
+// member that answers. Hashes whose data is missing or doesn't match are left out of
+// the result, callers fetch them one by one. ErrMethodNotFound is returned when no
+// member implements the list request.
+func (c *Client) ListDataByHashes(ctx context.Context, hashes []common.Hash) (map[common.Hash][]byte, error) {
+	if c.listUnsupported.Load() {
+		return nil, ErrMethodNotFound
+	}
+	start := int(c.preferred.Load())
+	var errs []error
+	unsupported := 0
+	for i := range c.urls {
+		idx := (start + i) % len(c.urls)
+		if c.limiter != nil {
+			if err := c.limiter.Wait(ctx); err != nil {
+				errs = append(errs, err)
+				break
+			}
+		}
+		list, err := ListDataFromDACByHashes(ctx, c.urls[idx], hashes, c.auth)
+		if err == nil {
+			for h, data := range list {
+				if crypto.Keccak256Hash(data) != h {
+					delete(list, h)
+				}
+			}
+			return list, nil
+		}
+		if errors.Is(err, ErrMethodNotFound) {
+			unsupported++
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", redactURL(c.urls[idx]), err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if unsupported == len(c.urls) {
+		c.listUnsupported.Store(true)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// redactURL hides the password of the url in logs
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Redacted()
+}
+
+// GetDataFromDACByHash reads the data of the hash from a committee member, auth may be
+// empty for members without authentication
+func GetDataFromDACByHash(ctx context.Context, dacURL string, hash common.Hash, auth Auth) ([]byte, error) {
+	result, err := call(ctx, dacURL, "sync_getOffChainData", []interface{}{hash}, auth)
+	if err != nil {
+		return nil, err
+	}
+	var data hexutil.Bytes
+	if err := json.Unmarshal(result, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode result: %w", err)
+	}
+	return data, nil
+}
+
+// ListDataFromDACByHashes reads the data of all hashes from a committee member in a
+// single sync_listOffChainData request. Hashes the member doesn't have are missing
+// from the result.
+func ListDataFromDACByHashes(ctx context.Context, dacURL string, hashes []common.Hash, auth Auth) (map[common.Hash][]byte, error) {
+	result, err := call(ctx, dacURL, "sync_listOffChainData", []interface{}{hashes}, auth)
+	if err != nil {
+		return nil, err
+	}
+	var list map[common.Hash]hexutil.Bytes
+	if err := json.Unmarshal(result, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode result: %w", err)
+	}
+	res := make(map[common.Hash][]byte, len(list))
+	for h, data := range list {
+		res[h] = data
+	}
+	return res, nil
+}
+
+// call sends a JSON-RPC request to the member and returns its result
+func call(ctx context.Context, dacURL string, method string, params []interface{}, auth Auth) (json.RawMessage, error) {
 	// Build request
 	reqBody := rpcRequest{
 		JSONRPC: "2.0",
-		Method:  "sync_getOffChainData",
-		Params:  []interface{}{hash},
+		Method:  method,
+		Params:  params,
 		ID:      1,
 	}
 	bodyBytes, err := json.Marshal(reqBody)
@@ -53,6 +243,7 @@ func GetDataFromDACByHash(ctx context.Context, dacURL string, hash common.Hash)
 		return nil, fmt.Errorf("create http request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	auth.apply(req)
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
@@ -73,15 +264,10 @@ func GetDataFromDACByHash(ctx context.Context, dacURL string, hash common.Hash)
 
 	// Handle error or result
 	if rpcResp.Error != nil {
-		fmt.Printf("RPC Error: code=%d, msg=%s\n", rpcResp.Error.Code, rpcResp.Error.Message)
-		return nil, fmt.Errorf("rpc error code=%d msg=%s", rpcResp.Error.Code, rpcResp.Error.Message)
-	}
-
-	resData := strings.Trim(string(rpcResp.Result), "\"")
-	decoded, err := hex.DecodeString(resData[2:])
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode result: %w", err)
+		if rpcResp.Error.Code == methodNotFoundCode {
+			return nil, fmt.Errorf("%w: %s", ErrMethodNotFound, method)
+		}
+		return nil, fmt.Errorf("%w code=%d msg=%s", errRPC, rpcResp.Error.Code, rpcResp.Error.Message)
 	}
-
-	return decoded, nil
+	return rpcResp.Result, nil
 }
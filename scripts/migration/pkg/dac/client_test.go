@@ -0,0 +1,236 @@
+package dac
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMember is a committee member serving sync_getOffChainData from memory
+type fakeMember struct {
+	mu      sync.Mutex
+	data    map[common.Hash][]byte
+	offline bool
+	// list is set when the member implements sync_listOffChainData
+	list  bool
+	calls int
+}
+
+func newFakeMember(t *testing.T, data ...[]byte) (*fakeMember, string) {
+	m := &fakeMember{data: make(map[common.Hash][]byte)}
+	for _, d := range data {
+		m.data[crypto.Keccak256Hash(d)] = d
+	}
+	srv := httptest.NewServer(m)
+	t.Cleanup(srv.Close)
+	return m, srv.URL
+}
+
+// setOffline makes the member fail every request with 502
+func (m *fakeMember) setOffline() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.offline = true
+}
+
+// requests returns the number of requests the member received
+func (m *fakeMember) requests() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls
+}
+
+func (m *fakeMember) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if m.offline {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	var req struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	resp := rpcResponse{JSONRPC: "2.0", ID: 1}
+	switch req.Method {
+	case "sync_getOffChainData":
+		var hash common.Hash
+		json.Unmarshal(req.Params[0], &hash)
+		if data, ok := m.data[hash]; ok {
+			resp.Result, _ = json.Marshal(hexutil.Bytes(data))
+		} else {
+			resp.Error = &rpcError{Code: -32000, Message: "data not found"}
+		}
+	case "sync_listOffChainData":
+		if !m.list {
+			resp.Error = &rpcError{Code: methodNotFoundCode, Message: "method not found"}
+			break
+		}
+		var hashes []common.Hash
+		json.Unmarshal(req.Params[0], &hashes)
+		list := make(map[common.Hash]hexutil.Bytes)
+		for _, hash := range hashes {
+			if data, ok := m.data[hash]; ok {
+				list[hash] = data
+			}
+		}
+		resp.Result, _ = json.Marshal(list)
+	default:
+		resp.Error = &rpcError{Code: methodNotFoundCode, Message: "method not found"}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ✅ Test requests rotate to the members that have the data and stick to them
+func TestClientRotation(t *testing.T) {
+	ctx := context.Background()
+	data := []byte("batch-1")
+	hash := crypto.Keccak256Hash(data)
+	offline, offlineURL := newFakeMember(t, data)
+	offline.setOffline()
+	empty, emptyURL := newFakeMember(t)
+	member, memberURL := newFakeMember(t, data)
+
+	c, err := NewClient([]string{offlineURL, emptyURL, memberURL}, 0, Auth{})
+	require.NoError(t, err)
+	got, err := c.GetDataByHash(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	assert.Equal(t, []int{1, 1, 1}, []int{offline.requests(), empty.requests(), member.requests()})
+
+	// The member that answered is asked first
+	_, err = c.GetDataByHash(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 1, 2}, []int{offline.requests(), empty.requests(), member.requests()})
+
+	// ❌ No member has the data
+	c, err = NewClient([]string{emptyURL, memberURL}, 0, Auth{})
+	require.NoError(t, err)
+	_, err = c.GetDataByHash(ctx, common.Hash{1})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// ❌ A member is offline, the data may still be on it
+	c, err = NewClient([]string{offlineURL, emptyURL}, 0, Auth{})
+	require.NoError(t, err)
+	_, err = c.GetDataByHash(ctx, hash)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNotFound)
+
+	_, err = NewClient(nil, 0, Auth{})
+	assert.Error(t, err)
+}
+
+// ✅ Test data that doesn't match its hash is reported and read from another member
+func TestClientHashMismatch(t *testing.T) {
+	ctx := context.Background()
+	data := []byte("batch-1")
+	hash := crypto.Keccak256Hash(data)
+	corrupted, corruptedURL := newFakeMember(t)
+	corrupted.data[hash] = data[:4]
+	member, memberURL := newFakeMember(t, data)
+
+	c, err := NewClient([]string{corruptedURL, memberURL}, 0, Auth{})
+	require.NoError(t, err)
+	got, err := c.GetDataByHash(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	assert.Equal(t, 1, member.requests())
+
+	// ❌ Only corrupted data is left
+	c, err = NewClient([]string{corruptedURL}, 0, Auth{})
+	require.NoError(t, err)
+	_, err = c.GetDataByHash(ctx, hash)
+	assert.ErrorIs(t, err, ErrHashMismatch)
+	assert.NotErrorIs(t, err, ErrNotFound)
+}
+
+// ✅ Test the credentials sent to members
+func TestAuth(t *testing.T) {
+	tests := []struct {
+		name string
+		auth Auth
+		want http.Header
+	}{
+		{name: "none", want: http.Header{}},
+		{name: "basic", auth: Auth{Username: "user", Password: "pass"}, want: http.Header{"Authorization": {"Basic dXNlcjpwYXNz"}}},
+		{name: "bearer", auth: Auth{BearerToken: "token"}, want: http.Header{"Authorization": {"Bearer token"}}},
+		{name: "headers", auth: Auth{Headers: map[string]string{"x-api-key": "key"}}, want: http.Header{"X-Api-Key": {"key"}}},
+		{name: "bearer over a header", auth: Auth{BearerToken: "token", Headers: map[string]string{"Authorization": "Basic other"}}, want: http.Header{"Authorization": {"Bearer token"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			tt.auth.apply(req)
+			assert.Equal(t, tt.want, req.Header)
+		})
+	}
+
+	// Credentials of the member url are sent when no Authorization header is set
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+	memberURL := "http://user:secret@" + srv.Listener.Addr().String()
+	c, err := NewClient([]string{memberURL}, 0, Auth{})
+	require.NoError(t, err)
+	_, err = c.GetDataByHash(context.Background(), common.Hash{1})
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret", "the password must not be logged")
+
+	c, err = NewClient([]string{memberURL}, 0, Auth{BearerToken: "token"})
+	require.NoError(t, err)
+	_, err = c.GetDataByHash(context.Background(), common.Hash{1})
+	require.Error(t, err)
+	assert.Equal(t, []string{"Basic dXNlcjpzZWNyZXQ=", "Bearer token"}, got)
+}
+
+// ✅ Test the data of several hashes is read with a single request
+func TestListDataByHashes(t *testing.T) {
+	ctx := context.Background()
+	one, two := []byte("batch-1"), []byte("batch-2")
+	member, memberURL := newFakeMember(t, one, two)
+	member.list = true
+	member.data[common.Hash{3}] = []byte("corrupted")
+
+	c, err := NewClient([]string{memberURL}, 0, Auth{})
+	require.NoError(t, err)
+	hashes := []common.Hash{crypto.Keccak256Hash(one), crypto.Keccak256Hash(two), {3}, {4}}
+	list, err := c.ListDataByHashes(ctx, hashes)
+	require.NoError(t, err)
+	// Missing and corrupted data is left out
+	assert.Equal(t, map[common.Hash][]byte{hashes[0]: one, hashes[1]: two}, list)
+	assert.Equal(t, 1, member.requests())
+
+	// Members that don't implement it are skipped
+	old, oldURL := newFakeMember(t, one)
+	c, err = NewClient([]string{oldURL, memberURL}, 0, Auth{})
+	require.NoError(t, err)
+	list, err = c.ListDataByHashes(ctx, hashes[:1])
+	require.NoError(t, err)
+	assert.Equal(t, map[common.Hash][]byte{hashes[0]: one}, list)
+
+	// ❌ No member implements the request, it isn't sent again
+	c, err = NewClient([]string{oldURL}, 0, Auth{})
+	require.NoError(t, err)
+	_, err = c.ListDataByHashes(ctx, hashes)
+	assert.ErrorIs(t, err, ErrMethodNotFound)
+	_, err = c.ListDataByHashes(ctx, hashes)
+	assert.ErrorIs(t, err, ErrMethodNotFound)
+	assert.Equal(t, 2, old.requests())
+}
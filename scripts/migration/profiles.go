@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/availproject/cdk-avail-da-server/pkg/storagekey"
+)
+
+var profileNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// profileFiles are the settings naming files a run writes to. Profiles that don't
+// set them get their own file, prefixed with the profile name, so runs of different
+// rollups never share their state.
+var profileFiles = []string{"STATE_FILE", "FAILED_BATCHES_FILE", "SUBMISSIONS_FILE"}
+
+// profilePrefix is the prefix of the settings of a profile, e.g. ZKEVM_ for the
+// S3_BUCKET of the zkevm profile is ZKEVM_S3_BUCKET
+func profilePrefix(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+}
+
+// profiles returns the profiles selected with --profile, all of PROFILES for "all".
+// Without --profile the settings aren't scoped to a profile and nil is returned.
+func (c *config) profiles() ([]string, error) {
+	selected, _ := c.flags.GetString("profile")
+	if selected == "" {
+		return nil, nil
+	}
+	defined := splitList(c.get("PROFILES"))
+	if selected == "all" {
+		if len(defined) == 0 {
+			return nil, fmt.Errorf("--profile all needs the profiles listed in PROFILES")
+		}
+		return defined, nil
+	}
+
+	var names []string
+	for _, name := range splitList(selected) {
+		if !profileNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("invalid profile name %q, only letters, digits, - and _ are allowed", name)
+		}
+		if len(defined) > 0 && !slices.Contains(defined, name) {
+			return nil, fmt.Errorf("profile %q is not listed in PROFILES %q", name, c.get("PROFILES"))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// forProfile returns the config of the profile: the PREFIX_ settings of the profile
+// take precedence over the shared environment and config file settings
+func (c *config) forProfile(name string) *config {
+	p := &config{flags: c.flags, file: c.file, overrides: map[string]string{}, profile: name}
+	for k, v := range c.overrides {
+		p.overrides[k] = v
+	}
+	for _, env := range profileFiles {
+		if _, ok := p.lookupProfile(env); ok {
+			continue
+		}
+		if path := c.get(env); path != "" {
+			p.overrides[env] = filepath.Join(filepath.Dir(path), name+"-"+filepath.Base(path))
+		}
+	}
+	if _, ok := p.lookupProfile("PUSHGATEWAY_JOB"); !ok {
+		p.overrides["PUSHGATEWAY_JOB"] = c.get("PUSHGATEWAY_JOB") + "-" + name
+	}
+	return p
+}
+
+// forEachProfile calls fn with the config of every selected profile in turn, or
+// once with the shared config without --profile. A failing profile doesn't stop
+// the others, their errors are returned together.
+func forEachProfile(cfg *config, fn func(cfg *config) error) error {
+	names, err := cfg.profiles()
+	if err != nil {
+		return err
+	}
+	if names == nil {
+		return fn(cfg)
+	}
+
+	if err := checkPrefixes(cfg, names); err != nil {
+		return err
+	}
+
+	var errs []error
+	for i, name := range names {
+		if stopRequested.Load() {
+			log.Printf("🛑 Shutdown requested, skipping profiles %s", strings.Join(names[i:], ", "))
+			break
+		}
+		log.Printf("🗂️ Profile %s", name)
+		if err := fn(cfg.forProfile(name)); err != nil {
+			log.Printf("⛔ Profile %s failed: %v", name, err)
+			errs = append(errs, fmt.Errorf("profile %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkFollow rejects follow mode with several profiles, a follow run never ends so
+// the profiles after the first would never be migrated
+func checkFollow(cfg *config) error {
+	names, err := cfg.profiles()
+	if err != nil || len(names) < 2 {
+		return err
+	}
+	for _, name := range names {
+		follow, err := cfg.forProfile(name).bool("FOLLOW")
+		if err != nil {
+			return err
+		}
+		if follow {
+			return fmt.Errorf("profile %s follows L1, follow mode runs a single profile per process", name)
+		}
+	}
+	return nil
+}
+
+// objectPrefix returns S3_OBJECT_PREFIX with its placeholders resolved, {network}
+// from NETWORK or the profile name and {chainid} from ROLLUP_CHAIN_ID
+func (c *config) objectPrefix() (string, error) {
+	network := c.get("NETWORK")
+	if network == "" {
+		network = c.profile
+	}
+	chainID, err := c.uint("ROLLUP_CHAIN_ID", 64)
+	if err != nil {
+		return "", err
+	}
+	prefix, err := storagekey.ResolvePrefix(c.get("S3_OBJECT_PREFIX"), network, chainID)
+	if err != nil {
+		return "", fmt.Errorf("S3_OBJECT_PREFIX: %w, set NETWORK and ROLLUP_CHAIN_ID", err)
+	}
+	return prefix, nil
+}
+
+// checkPrefixes rejects profiles storing their batches under the same prefix of the
+// same bucket, whose objects and reports would be mixed up
+func checkPrefixes(cfg *config, names []string) error {
+	used := make(map[string]string)
+	for _, name := range names {
+		p := cfg.forProfile(name)
+		bucket := p.get("S3_BUCKET")
+		if bucket == "" {
+			continue
+		}
+		prefix, err := p.objectPrefix()
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+		location := "s3://" + bucket + "/" + prefix
+		if other, ok := used[location]; ok {
+			return fmt.Errorf("profiles %s and %s both store their batches under %s, give them their own S3_OBJECT_PREFIX, e.g. {network}/{chainid}/", other, name, location)
+		}
+		used[location] = name
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testConfig returns a config of the settings of a config file, with the flags args
+func testConfig(t *testing.T, file map[string]string, args ...string) *config {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	addSettingsFlags(flags)
+	require.NoError(t, flags.Parse(args))
+	return &config{flags: flags, file: file, overrides: map[string]string{}}
+}
+
+// ✅ Test the profiles selected with --profile
+func TestProfiles(t *testing.T) {
+	file := map[string]string{"PROFILES": "zkevm, cardona"}
+	tests := []struct {
+		name    string
+		file    map[string]string
+		profile string
+		want    []string
+		err     string
+	}{
+		{name: "no profile", file: file},
+		{name: "all", file: file, profile: "all", want: []string{"zkevm", "cardona"}},
+		{name: "listed", file: file, profile: "cardona", want: []string{"cardona"}},
+		{name: "without PROFILES", profile: "zk-evm,other_1", want: []string{"zk-evm", "other_1"}},
+		{name: "not listed", file: file, profile: "zkevm,bali", err: `profile "bali" is not listed`},
+		{name: "invalid name", profile: "../zkevm", err: "invalid profile name"},
+		{name: "all without PROFILES", profile: "all", err: "needs the profiles listed in PROFILES"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var args []string
+			if tt.profile != "" {
+				args = append(args, "--profile", tt.profile)
+			}
+			names, err := testConfig(t, tt.file, args...).profiles()
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, names)
+		})
+	}
+}
+
+// ✅ Test the settings of a profile take precedence and its files are its own
+func TestForProfile(t *testing.T) {
+	assert.Equal(t, "ZK_EVM_", profilePrefix("zk-evm"))
+
+	cfg := testConfig(t, map[string]string{
+		"S3_BUCKET":                  "shared",
+		"ZK_EVM_S3_BUCKET":           "zkevm-bucket",
+		"STATE_FILE":                 filepath.Join("data", "state.json"),
+		"ZK_EVM_FAILED_BATCHES_FILE": "zkevm-failed.jsonl",
+	})
+	p := cfg.forProfile("zk-evm")
+	assert.Equal(t, "zkevm-bucket", p.get("S3_BUCKET"))
+	assert.Equal(t, filepath.Join("data", "zk-evm-state.json"), p.get("STATE_FILE"))
+	assert.Equal(t, "zkevm-failed.jsonl", p.get("FAILED_BATCHES_FILE"))
+	assert.Equal(t, "zk-evm-turboda-submissions.jsonl", p.get("SUBMISSIONS_FILE"))
+	assert.Equal(t, "cdk-migration-zk-evm", p.get("PUSHGATEWAY_JOB"))
+
+	// Other profiles and the shared config are untouched
+	assert.Equal(t, "shared", cfg.forProfile("cardona").get("S3_BUCKET"))
+	assert.Equal(t, "shared", cfg.get("S3_BUCKET"))
+	assert.Equal(t, filepath.Join("data", "state.json"), cfg.get("STATE_FILE"))
+}
+
+// ✅ Test profiles can't store their batches under the same prefix
+func TestCheckPrefixes(t *testing.T) {
+	names := []string{"zkevm", "cardona"}
+	cfg := testConfig(t, map[string]string{"S3_BUCKET": "batches", "S3_OBJECT_PREFIX": "{network}/"})
+	require.NoError(t, checkPrefixes(cfg, names))
+	prefix, err := cfg.forProfile("zkevm").objectPrefix()
+	require.NoError(t, err)
+	assert.Equal(t, "zkevm/", prefix)
+
+	// Profiles of other buckets may share a prefix
+	cfg = testConfig(t, map[string]string{"ZKEVM_S3_BUCKET": "zkevm", "CARDONA_S3_BUCKET": "cardona", "S3_OBJECT_PREFIX": "batches/"})
+	require.NoError(t, checkPrefixes(cfg, names))
+
+	// ❌ Both profiles store their batches under batches/
+	cfg = testConfig(t, map[string]string{"S3_BUCKET": "batches", "S3_OBJECT_PREFIX": "batches/"})
+	assert.ErrorContains(t, checkPrefixes(cfg, names), "profiles zkevm and cardona both store their batches under s3://batches/batches/")
+
+	// ❌ The chain id of the prefix isn't set
+	cfg = testConfig(t, map[string]string{"S3_BUCKET": "batches", "S3_OBJECT_PREFIX": "{chainid}/"})
+	assert.ErrorContains(t, checkPrefixes(cfg, names), "profile zkevm")
+}
+
+// ✅ Test empty items of comma separated lists are dropped
+func TestSplitList(t *testing.T) {
+	assert.Equal(t, []string{"a", "b"}, splitList(" a, ,b,"))
+	assert.Nil(t, splitList(""))
+}
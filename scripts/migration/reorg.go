@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// safeHead returns the latest L1 block with at least confirmations blocks on top of
+// it, blocks above it may still be reorged and are never processed
+func (m *MigrationService) safeHead() (uint64, error) {
+	var head uint64
+	err := m.withTimeout(m.rpcTimeout, func(ctx context.Context) error {
+		var e error
+		head, e = m.client.BlockNumber(ctx)
+		return e
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the L1 head: %w", err)
+	}
+	if head < m.confirmations {
+		return 0, nil
+	}
+	return head - m.confirmations, nil
+}
+
+// header returns the hash and the parent hash of the block
+func (m *MigrationService) header(number uint64) (hash, parent common.Hash, err error) {
+	err = m.withTimeout(m.rpcTimeout, func(ctx context.Context) error {
+		h, e := m.client.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+		if e != nil {
+			return e
+		}
+		hash, parent = h.Hash(), h.ParentHash
+		return nil
+	})
+	if err != nil {
+		return common.Hash{}, common.Hash{}, fmt.Errorf("failed to get L1 block %d: %w", number, err)
+	}
+	return hash, parent, nil
+}
+
+// reorgStart checks that block next still builds on lastHash, the hash block next-1
+// had when it was processed. When it doesn't, the last reorgDepth blocks may have
+// been replaced and the first of them is returned to be processed again.
+func (m *MigrationService) reorgStart(next uint64, lastHash common.Hash) (uint64, bool, error) {
+	_, parent, err := m.header(next)
+	if err != nil {
+		return 0, false, err
+	}
+	if parent == lastHash {
+		return next, false, nil
+	}
+	start := m.firstBlock
+	if next > m.reorgDepth && next-m.reorgDepth > start {
+		start = next - m.reorgDepth
+	}
+	return start, true, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/availproject/cdk-avail-da-server/pkg/l1"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeL1 is an L1 node serving the head and the headers of its chain
+type fakeL1 struct {
+	mu      sync.Mutex
+	headers []*types.Header
+}
+
+// newFakeL1 returns a client of a chain of length blocks
+func newFakeL1(t *testing.T, length int) (*fakeL1, *l1.Client) {
+	f := &fakeL1{}
+	f.extend(length, 0)
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	client, err := ethclient.Dial(srv.URL)
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	return f, l1.NewClient(client, nil)
+}
+
+// extend appends blocks to the chain, fork tells apart the blocks of different forks
+func (f *fakeL1) extend(blocks int, fork byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := 0; i < blocks; i++ {
+		h := &types.Header{Number: big.NewInt(int64(len(f.headers))), Difficulty: big.NewInt(0), Extra: []byte{fork}}
+		if len(f.headers) > 0 {
+			h.ParentHash = f.headers[len(f.headers)-1].Hash()
+		}
+		f.headers = append(f.headers, h)
+	}
+}
+
+// reorg replaces the blocks from number on with the same number of blocks of a fork
+func (f *fakeL1) reorg(number int, fork byte) {
+	f.mu.Lock()
+	blocks := len(f.headers) - number
+	f.headers = f.headers[:number]
+	f.mu.Unlock()
+	f.extend(blocks, fork)
+}
+
+func (f *fakeL1) hash(number int) common.Hash {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.headers[number].Hash()
+}
+
+func (f *fakeL1) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     json.RawMessage   `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var result interface{}
+	switch req.Method {
+	case "eth_blockNumber":
+		result = fmt.Sprintf("%#x", len(f.headers)-1)
+	case "eth_getBlockByNumber":
+		var hex string
+		json.Unmarshal(req.Params[0], &hex)
+		number, _ := strconv.ParseUint(hex, 0, 64)
+		if number < uint64(len(f.headers)) {
+			result = f.headers[number]
+		}
+	}
+	res, _ := json.Marshal(result)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":%s}`, req.ID, res)
+}
+
+// ✅ Test only blocks with enough confirmations are processed
+func TestSafeHead(t *testing.T) {
+	chain, client := newFakeL1(t, 101)
+	m := &MigrationService{ctx: context.Background(), client: client, confirmations: 12}
+	head, err := m.safeHead()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(88), head)
+
+	chain.extend(2, 0)
+	head, err = m.safeHead()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(90), head)
+
+	// The chain is shorter than the confirmations
+	_, client = newFakeL1(t, 5)
+	m.client = client
+	head, err = m.safeHead()
+	require.NoError(t, err)
+	assert.Zero(t, head)
+}
+
+// ✅ Test reorged blocks are processed again from reorgDepth blocks back
+func TestReorgStart(t *testing.T) {
+	chain, client := newFakeL1(t, 101)
+	m := &MigrationService{ctx: context.Background(), client: client, reorgDepth: 10, firstBlock: 50}
+
+	// Block 100 builds on the processed block 99
+	lastHash := chain.hash(99)
+	start, reorged, err := m.reorgStart(100, lastHash)
+	require.NoError(t, err)
+	assert.False(t, reorged)
+	assert.Equal(t, uint64(100), start)
+
+	// ❌ Block 99 was replaced
+	chain.reorg(98, 1)
+	start, reorged, err = m.reorgStart(100, lastHash)
+	require.NoError(t, err)
+	assert.True(t, reorged)
+	assert.Equal(t, uint64(90), start)
+
+	// Runs never go back before their first block
+	start, reorged, err = m.reorgStart(55, chain.hash(40))
+	require.NoError(t, err)
+	assert.True(t, reorged)
+	assert.Equal(t, uint64(50), start)
+
+	// ❌ The block doesn't exist yet
+	_, _, err = m.reorgStart(200, lastHash)
+	assert.Error(t, err)
+}
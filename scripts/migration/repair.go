@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/availproject/cdk-avail-da-server/scripts/migration/pkg/da"
+)
+
+// repairKeys moves the objects of the block range stored under a legacy key to the
+// key the server reads
+func (m *MigrationService) repairKeys(dryRun bool) error {
+	var moved, missing atomic.Int64
+	p := m.walk("Key repair", nil, func(block uint64, i int, h common.Hash) bool {
+		prefix := fmt.Sprintf("🟦 Block %d ➡️ Batch %d [Hash: %s]", block, i, h.Hex())
+		var repaired, notFound bool
+		err := retry(m.ctx, m.maxAttempts, 1*time.Second, func() error {
+			var e error
+			repaired, e = m.DABackend.RepairKey(m.ctx, h, dryRun)
+			// a missing object is a result, not a reason to retry
+			notFound = errors.Is(e, da.ErrNotFound)
+			if notFound {
+				return nil
+			}
+			return e
+		})
+		switch {
+		case err != nil:
+			log.Printf("%s ❌ Key repair failed: %v", prefix, err)
+			return false
+		case notFound:
+			log.Printf("%s ⚠️ Not found in S3 under any key", prefix)
+			missing.Add(1)
+		case repaired:
+			log.Printf("%s 🔧 Moved to the server key", prefix)
+			moved.Add(1)
+		}
+		return true
+	}, nil)
+
+	log.Printf("🏁 Key repair finished: %d objects moved, %d batches not found in S3", moved.Load(), missing.Load())
+	if p.ok < p.batches || len(p.failedBlocks) > 0 {
+		return fmt.Errorf("%d batches couldn't be repaired", p.batches-p.ok)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/availproject/cdk-avail-da-server/scripts/migration/pkg/da"
+	"github.com/availproject/cdk-avail-da-server/selftest"
+)
+
+// selfTest checks the S3 bucket, the L1 and Avail RPC, the bridge API and the
+// contracts of the settings, and prints the report to stderr. An error is returned
+// when a check failed.
+func selfTest(cfg *config) error {
+	if err := applyProxy(cfg.get("PROXY_URL")); err != nil {
+		return err
+	}
+	var report selftest.Report
+	defer report.Print(os.Stderr)
+
+	if cfg.get("S3_BUCKET") != "" {
+		report.Check("s3", func(ctx context.Context) error {
+			daConfig, err := newDAConfig(cfg, []string{da.TargetS3})
+			if err != nil {
+				return err
+			}
+			backend, err := da.NewDABackend(daConfig)
+			if err != nil {
+				return err
+			}
+			return backend.Canary(ctx, selftest.Canary())
+		})
+	} else {
+		report.Skip("s3", "S3_BUCKET is not set")
+	}
+
+	if rpcURL := cfg.get("RPC_URL"); rpcURL != "" {
+		contracts := make(map[string]common.Address)
+		for name, env := range map[string]string{
+			"validium contract":    "CONTRACT_ADDRESS",
+			"rollup manager":       "ROLLUP_MANAGER_ADDRESS",
+			"attestation contract": "AVAIL_ATTESTATION_ADDRESS",
+		} {
+			if addr := cfg.get(env); common.IsHexAddress(addr) {
+				contracts[name] = common.HexToAddress(addr)
+			}
+		}
+		report.Check("l1-rpc", selftest.L1(rpcURL, contracts))
+	} else {
+		report.Skip("l1-rpc", "RPC_URL is not set")
+	}
+	if availURL := cfg.get("AVAIL_RPC_URL"); availURL != "" {
+		report.Check("avail-rpc", selftest.AvailRPC(availURL))
+	} else {
+		report.Skip("avail-rpc", "AVAIL_RPC_URL is not set")
+	}
+	if bridgeURL := cfg.get("AVAIL_BRIDGE_API_URL"); bridgeURL != "" {
+		report.Check("bridge-api", selftest.BridgeAPI(bridgeURL))
+	} else {
+		report.Skip("bridge-api", "AVAIL_BRIDGE_API_URL is not set")
+	}
+	return report.Err()
+}
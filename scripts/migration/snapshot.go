@@ -0,0 +1,273 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/availproject/cdk-avail-da-server/pkg/storagekey"
+	"github.com/availproject/cdk-avail-da-server/scripts/migration/pkg/da"
+)
+
+// maxSnapshotObject is the size of the largest object read from an archive, larger
+// entries aren't batch data
+const maxSnapshotObject = 64 << 20
+
+// exportSnapshot writes the S3 objects of the batches of the block range to a tar
+// archive at archivePath, one entry named by the 0x prefixed hash per batch
+func (m *MigrationService) exportSnapshot(archivePath string) error {
+	file, err := os.Create(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to create the archive: %w", err)
+	}
+	defer file.Close()
+	tw := tar.NewWriter(file)
+
+	// Batches are read in parallel, the entries are written one at a time
+	var mu sync.Mutex
+	written := make(map[common.Hash]bool)
+	var bytes atomic.Int64
+	var writeErr error
+	p := m.walk("Export", nil, func(block uint64, i int, h common.Hash) bool {
+		prefix := fmt.Sprintf("🟦 Block %d ➡️ Batch %d [Hash: %s]", block, i, h.Hex())
+		var data []byte
+		err := retry(m.ctx, m.maxAttempts, 1*time.Second, func() error {
+			return m.withTimeout(m.rpcTimeout, func(ctx context.Context) error {
+				var e error
+				data, e = m.DABackend.GetDataFromS3(ctx, h)
+				return e
+			})
+		})
+		if err != nil {
+			log.Printf("%s ❌ S3 read failed: %v", prefix, err)
+			return false
+		}
+		if actual := crypto.Keccak256Hash(data); actual != h {
+			log.Printf("%s ⛔ Corrupted in S3 (keccak256 %s), not exported", prefix, actual.Hex())
+			return false
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if writeErr != nil {
+			return false
+		}
+		if written[h] {
+			return true
+		}
+		header := &tar.Header{
+			Name:    h.Hex(),
+			Mode:    0o644,
+			Size:    int64(len(data)),
+			ModTime: time.Now().UTC(),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			writeErr = err
+			return false
+		}
+		if _, err := tw.Write(data); err != nil {
+			writeErr = err
+			return false
+		}
+		written[h] = true
+		bytes.Add(int64(len(data)))
+		log.Printf("%s 📦 Exported", prefix)
+		return true
+	}, nil)
+
+	if writeErr != nil {
+		return fmt.Errorf("failed to write the archive: %w", writeErr)
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write the archive: %w", err)
+	}
+	log.Printf("🏁 Export finished: %d objects, %d bytes written to %s", len(written), bytes.Load(), archivePath)
+	if p.ok < p.batches || len(p.failedBlocks) > 0 {
+		return fmt.Errorf("%d batches and %d blocks couldn't be exported", p.batches-p.ok, len(p.failedBlocks))
+	}
+	return nil
+}
+
+// importSnapshot uploads the objects of the tar archive at archivePath to S3. Every
+// entry is checked against the hash it is named by, entries that don't match are
+// rejected.
+func (m *MigrationService) importSnapshot(archivePath string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open the archive: %w", err)
+	}
+	defer file.Close()
+	tr := tar.NewReader(file)
+
+	begin := time.Now()
+	var imported, existing, failed atomic.Int64
+	slots := make(chan struct{}, m.batchConcurrency)
+	var wg sync.WaitGroup
+	var readErr error
+	for !m.stopping() && m.ctx.Err() == nil {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		h, ok := snapshotHash(header.Name)
+		if !ok || header.Size > maxSnapshotObject {
+			log.Printf("⚠️ Skipping archive entry %s, it isn't batch data", header.Name)
+			failed.Add(1)
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			readErr = err
+			break
+		}
+
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			switch result := m.importObject(h, data); result {
+			case "ok":
+				imported.Add(1)
+			case "skipped":
+				existing.Add(1)
+			default:
+				failed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if readErr != nil {
+		return fmt.Errorf("failed to read the archive: %w", readErr)
+	}
+	if m.stopping() {
+		log.Printf("🛑 Import interrupted")
+	}
+	log.Printf("🏁 Import finished: %d objects imported, %d already in S3, %d failed in %v",
+		imported.Load(), existing.Load(), failed.Load(), time.Since(begin).Round(time.Second))
+	if failed.Load() > 0 {
+		return fmt.Errorf("%d objects couldn't be imported", failed.Load())
+	}
+	return nil
+}
+
+// importObject uploads the object of an archive entry and returns ok, skipped or
+// failed
+func (m *MigrationService) importObject(h common.Hash, data []byte) string {
+	prefix := fmt.Sprintf("📦 [Hash: %s]", h.Hex())
+	if actual := crypto.Keccak256Hash(data); actual != h {
+		log.Printf("%s ⛔ Data doesn't match the hash (keccak256 %s)", prefix, actual.Hex())
+		return "failed"
+	}
+	if m.skipExisting {
+		var exists bool
+		err := retry(m.ctx, m.maxAttempts, 1*time.Second, func() error {
+			return m.withTimeout(m.rpcTimeout, func(ctx context.Context) error {
+				var e error
+				exists, e = m.DABackend.Exists(ctx, h, false)
+				return e
+			})
+		})
+		if err == nil && exists {
+			log.Printf("%s ⏭️ Already in S3", prefix)
+			return "skipped"
+		}
+	}
+	err := retry(m.ctx, m.maxAttempts, 1*time.Second, func() error {
+		return m.withTimeout(m.uploadTimeout, func(ctx context.Context) error {
+			return m.DABackend.PostDataToDA(ctx, h, data)
+		})
+	})
+	if err != nil {
+		log.Printf("%s ❌ S3 upload failed: %v", prefix, err)
+		return "failed"
+	}
+	log.Printf("%s ✅ Imported", prefix)
+	m.metrics.batches.WithLabelValues("ok").Inc()
+	m.metrics.bytesUploaded.Add(float64(len(data)))
+	return "ok"
+}
+
+// snapshotHash returns the hash an archive entry is named by
+func snapshotHash(name string) (common.Hash, bool) {
+	hash, err := storagekey.Parse(path.Base(name))
+	return hash, err == nil
+}
+
+// newImporter returns a service uploading to the S3 bucket of cfg, imports need
+// neither L1 nor the DAC
+func newImporter(cfg *config) (MigrationService, error) {
+	daConfig, err := newDAConfig(cfg, []string{da.TargetS3})
+	if err != nil {
+		return MigrationService{}, err
+	}
+	metrics := newMetrics()
+	daConfig.Observe = metrics.observeUpload
+
+	maxAttempts, err := cfg.int("MAX_ATTEMPTS", 5)
+	if err != nil {
+		return MigrationService{}, err
+	}
+	concurrency, err := cfg.int("CONCURRENCY", 4)
+	if err != nil {
+		return MigrationService{}, err
+	}
+	batchConcurrency, err := cfg.int("BATCH_CONCURRENCY", 0)
+	if err != nil {
+		return MigrationService{}, err
+	}
+	if batchConcurrency <= 0 {
+		batchConcurrency = concurrency
+	}
+	daConfig.S3Concurrency = batchConcurrency
+	rpcTimeout, err := cfg.int("RPC_TIMEOUT", 30)
+	if err != nil {
+		return MigrationService{}, err
+	}
+	uploadTimeout, err := cfg.int("UPLOAD_TIMEOUT", 300)
+	if err != nil {
+		return MigrationService{}, err
+	}
+	skipExisting, err := cfg.bool("SKIP_EXISTING")
+	if err != nil {
+		return MigrationService{}, err
+	}
+
+	backend, err := da.NewDABackend(daConfig)
+	if err != nil {
+		return MigrationService{}, fmt.Errorf("failed to initialize DA backend: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return MigrationService{
+		ctx:              ctx,
+		cancel:           cancel,
+		DABackend:        backend,
+		maxAttempts:      maxAttempts,
+		batchConcurrency: batchConcurrency,
+		skipExisting:     skipExisting,
+		stop:             notifyStop(ctx),
+
+		rpcTimeout:    time.Duration(rpcTimeout) * time.Second,
+		uploadTimeout: time.Duration(uploadTimeout) * time.Second,
+		metrics:       metrics,
+	}, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// migrationState is the progress of a run saved to the state file. Every block
+// below NextBlock has been processed.
+type migrationState struct {
+	StartBlock uint64    `json:"startBlock"`
+	EndBlock   uint64    `json:"endBlock"`
+	NextBlock  uint64    `json:"nextBlock"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+func loadState(path string) (migrationState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return migrationState{}, fmt.Errorf("failed to read state file: %w", err)
+	}
+	var state migrationState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return migrationState{}, fmt.Errorf("failed to decode state file %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// saveState writes the state to a temporary file and renames it, so a crash never
+// leaves a truncated state file behind
+func saveState(path string, state migrationState) error {
+	state.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
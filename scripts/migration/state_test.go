@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ✅ Test the progress of a run is saved and resumed
+func TestState(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	state := migrationState{StartBlock: 100, EndBlock: 200, NextBlock: 150}
+	require.NoError(t, saveState(path, state))
+	state.NextBlock = 160
+	require.NoError(t, saveState(path, state))
+
+	loaded, err := loadState(path)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(100), loaded.StartBlock)
+	assert.Equal(t, uint64(200), loaded.EndBlock)
+	assert.Equal(t, uint64(160), loaded.NextBlock)
+	assert.False(t, loaded.UpdatedAt.IsZero())
+
+	// No temporary file is left behind
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// ❌ There is no state to resume
+	_, err = loadState(filepath.Join(dir, "missing.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// ❌ The state file is truncated
+	require.NoError(t, os.WriteFile(path, []byte(`{"startBlock":100,`), 0o600))
+	_, err = loadState(path)
+	assert.ErrorContains(t, err, "failed to decode state file")
+}
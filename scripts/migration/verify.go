@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/availproject/cdk-avail-da-server/scripts/migration/pkg/da"
+)
+
+// Batch statuses of the verification report
+const (
+	VerifyStatusMissing   = "missing"
+	VerifyStatusCorrupted = "corrupted"
+	VerifyStatusError     = "error"
+)
+
+var ErrVerificationFailed = errors.New("verification found missing or corrupted batches")
+
+// VerifyEntry is a batch whose S3 object is missing, corrupted or couldn't be read
+type VerifyEntry struct {
+	Block      uint64      `json:"block"`
+	Index      int         `json:"index"`
+	Hash       common.Hash `json:"hash"`
+	Status     string      `json:"status"`
+	ActualHash common.Hash `json:"actualHash,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// VerifyReport is the machine-readable result of a verification run
+type VerifyReport struct {
+	StartBlock uint64    `json:"startBlock"`
+	EndBlock   uint64    `json:"endBlock"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Blocks     int       `json:"blocks"`
+	// Blocks whose batches couldn't be read from L1 and weren't verified
+	FailedBlocks  []uint64      `json:"failedBlocks"`
+	Batches       int           `json:"batches"`
+	VerifiedCount int           `json:"verified"`
+	Missing       []VerifyEntry `json:"missing"`
+	Corrupted     []VerifyEntry `json:"corrupted"`
+	Errors        []VerifyEntry `json:"errors"`
+}
+
+// verify walks the block range and checks that every batch sequenced on L1 is stored
+// in S3 with matching contents. The report is written to reportPath, or stdout when
+// it is empty.
+func (m *MigrationService) verify(reportPath string) error {
+	report := VerifyReport{
+		StartBlock: m.startBlock.Uint64(),
+		EndBlock:   m.endBlock.Uint64(),
+		StartedAt:  time.Now().UTC(),
+		Missing:    []VerifyEntry{},
+		Corrupted:  []VerifyEntry{},
+		Errors:     []VerifyEntry{},
+	}
+
+	var mu sync.Mutex
+	p := m.walk("Verification", nil, func(block uint64, i int, h common.Hash) bool {
+		entry := m.verifyBatch(block, i, h)
+		if entry == nil {
+			return true
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch entry.Status {
+		case VerifyStatusMissing:
+			report.Missing = append(report.Missing, *entry)
+		case VerifyStatusCorrupted:
+			report.Corrupted = append(report.Corrupted, *entry)
+		default:
+			report.Errors = append(report.Errors, *entry)
+		}
+		return false
+	}, nil)
+
+	report.FinishedAt = time.Now().UTC()
+	report.Blocks = p.blocks
+	report.FailedBlocks = append([]uint64{}, p.failedBlocks...)
+	report.Batches = p.batches
+	report.VerifiedCount = p.ok
+
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if reportPath == "" {
+		fmt.Println(string(out))
+	} else if err := os.WriteFile(reportPath, out, 0o644); err != nil {
+		return fmt.Errorf("failed to write verification report: %w", err)
+	}
+	log.Printf("📝 Verification report: %d verified, %d missing, %d corrupted, %d errors, %d failed blocks",
+		report.VerifiedCount, len(report.Missing), len(report.Corrupted), len(report.Errors), len(report.FailedBlocks))
+
+	if m.ctx.Err() != nil {
+		return m.ctx.Err()
+	}
+	if len(report.Missing)+len(report.Corrupted)+len(report.Errors)+len(report.FailedBlocks) > 0 {
+		return ErrVerificationFailed
+	}
+	return nil
+}
+
+// verifyBatch checks the S3 object of the batch, nil is returned when it matches
+func (m *MigrationService) verifyBatch(block uint64, i int, h common.Hash) *VerifyEntry {
+	prefix := fmt.Sprintf("🟦 Block %d ➡️ Batch %d [Hash: %s]", block, i, h.Hex())
+	entry := &VerifyEntry{Block: block, Index: i, Hash: h}
+
+	var data []byte
+	missing := false
+	err := retry(m.ctx, m.maxAttempts, 1*time.Second, func() error {
+		e := m.withTimeout(m.rpcTimeout, func(ctx context.Context) error {
+			var e error
+			data, e = m.DABackend.GetDataFromS3(ctx, h)
+			return e
+		})
+		// a missing object is a result, not a reason to retry
+		missing = errors.Is(e, da.ErrNotFound)
+		if missing {
+			return nil
+		}
+		return e
+	})
+	if err != nil {
+		log.Printf("%s ❌ S3 read failed: %v", prefix, err)
+		entry.Status = VerifyStatusError
+		entry.Error = err.Error()
+		return entry
+	}
+	if missing {
+		log.Printf("%s ⛔ Missing in S3", prefix)
+		entry.Status = VerifyStatusMissing
+		return entry
+	}
+
+	if actual := crypto.Keccak256Hash(data); actual != h {
+		log.Printf("%s ⛔ Corrupted in S3 (keccak256 %s)", prefix, actual.Hex())
+		entry.Status = VerifyStatusCorrupted
+		entry.ActualHash = actual
+		return entry
+	}
+	log.Printf("%s ✅ Verified", prefix)
+	return nil
+}
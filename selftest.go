@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/availproject/cdk-avail-da-server/selftest"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// runSelfTest checks the storage, the L1 and Avail RPC, the bridge API and the
+// attestation contract, and prints the report to stderr. An error is returned when a
+// check failed.
+func runSelfTest(cfg serverConfig) error {
+	var report selftest.Report
+	defer report.Print(os.Stderr)
+
+	storage, err := intializeStorage(context.Background(), cfg)
+	if err != nil {
+		report.Check("storage", func(context.Context) error { return err })
+	} else if canary, ok := storage.(da.Canary); ok && !cfg.S3Anonymous {
+		report.Check("storage", func(ctx context.Context) error {
+			return canary.Canary(ctx, selftest.Canary())
+		})
+	} else {
+		report.Skip("storage", "anonymous buckets are read-only")
+	}
+
+	if cfg.L1RPCURL != "" {
+		contracts := make(map[string]common.Address)
+		if common.IsHexAddress(cfg.AttestationContractAddress) {
+			contracts["attestation contract"] = common.HexToAddress(cfg.AttestationContractAddress)
+		}
+		if common.IsHexAddress(cfg.ValidiumContractAddress) {
+			contracts["validium contract"] = common.HexToAddress(cfg.ValidiumContractAddress)
+		}
+		report.Check("l1-rpc", selftest.L1(cfg.L1RPCURL, contracts))
+	} else {
+		report.Skip("l1-rpc", "L1_RPC_URL is not set")
+	}
+	if cfg.AvailRPCURL != "" {
+		report.Check("avail-rpc", selftest.AvailRPC(cfg.AvailRPCURL))
+	} else {
+		report.Skip("avail-rpc", "AVAIL_RPC_URL is not set")
+	}
+	if cfg.BridgeAPIURL != "" {
+		report.Check("bridge-api", selftest.BridgeAPI(cfg.BridgeAPIURL))
+	} else {
+		report.Skip("bridge-api", "AVAIL_BRIDGE_API_URL is not set")
+	}
+
+	return report.Err()
+}
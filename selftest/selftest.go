@@ -0,0 +1,164 @@
+// Package selftest checks the dependencies of the server and the migration tool on
+// --selftest, so a misconfigured deployment fails before it serves or migrates
+// anything.
+package selftest
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	avail_sdk "github.com/availproject/avail-go-sdk/sdk"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// checkTimeout is the time a single check may take
+const checkTimeout = 30 * time.Second
+
+// ErrFailed is returned by Report.Err when a check failed
+var ErrFailed = errors.New("self-test failed")
+
+// Result is the outcome of a check, a skipped check wasn't configured
+type Result struct {
+	Name     string
+	Err      error
+	Skipped  string
+	Duration time.Duration
+}
+
+// Report collects the results of the checks
+type Report struct {
+	Results []Result
+}
+
+// Check runs fn and records its result
+func (r *Report) Check(name string, fn func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	start := time.Now()
+	err := fn(ctx)
+	r.Results = append(r.Results, Result{Name: name, Err: err, Duration: time.Since(start)})
+}
+
+// Skip records a check that isn't run, with the reason
+func (r *Report) Skip(name, reason string) {
+	r.Results = append(r.Results, Result{Name: name, Skipped: reason})
+}
+
+// Print writes the diagnostic report, one line per check
+func (r *Report) Print(w io.Writer) {
+	for _, result := range r.Results {
+		switch {
+		case result.Skipped != "":
+			fmt.Fprintf(w, "SKIP %-22s %s\n", result.Name, result.Skipped)
+		case result.Err != nil:
+			fmt.Fprintf(w, "FAIL %-22s %v (%v)\n", result.Name, result.Err, result.Duration.Round(time.Millisecond))
+		default:
+			fmt.Fprintf(w, "OK   %-22s (%v)\n", result.Name, result.Duration.Round(time.Millisecond))
+		}
+	}
+}
+
+// Err returns ErrFailed with the number of failed checks, nil when none failed
+func (r *Report) Err() error {
+	failed, run := 0, 0
+	for _, result := range r.Results {
+		if result.Skipped == "" {
+			run++
+		}
+		if result.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d checks failed", ErrFailed, failed, run)
+	}
+	return nil
+}
+
+// Canary returns random data to write, read back and delete in a storage
+func Canary() []byte {
+	data := make([]byte, 64)
+	rand.Read(data)
+	return data
+}
+
+// L1 checks that the RPC at url answers and that every contract has code
+func L1(url string, contracts map[string]common.Address) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		client, err := ethclient.DialContext(ctx, url)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		if _, err := client.BlockNumber(ctx); err != nil {
+			return err
+		}
+		for name, addr := range contracts {
+			code, err := client.CodeAt(ctx, addr, nil)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			if len(code) == 0 {
+				return fmt.Errorf("%s: no contract code at %s", name, addr.Hex())
+			}
+		}
+		return nil
+	}
+}
+
+// AvailRPC checks that the Avail node at url answers and isn't syncing. The SDK takes
+// no context, a call that doesn't answer in time is left behind.
+func AvailRPC(url string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		done := make(chan error, 1)
+		go func() {
+			sdk, err := avail_sdk.NewSDK(url)
+			if err != nil {
+				done <- err
+				return
+			}
+			health, err := sdk.Client.Rpc.System.Health()
+			switch {
+			case err != nil:
+				done <- err
+			case health.IsSyncing:
+				done <- errors.New("the node is syncing")
+			case health.ShouldHavePeers && health.Peers == 0:
+				done <- errors.New("the node has no peers")
+			default:
+				done <- nil
+			}
+		}()
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// BridgeAPI checks that the Avail bridge API at url answers without server error
+func BridgeAPI(url string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("bridge api responded with status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
@@ -3,50 +3,196 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/availproject/cdk-avail-da-server/audit"
 	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/availproject/cdk-avail-da-server/lease"
+	avail "github.com/availproject/cdk-avail-da-server/lib/avail"
+	"github.com/availproject/cdk-avail-da-server/logging"
 	"github.com/availproject/cdk-avail-da-server/rpc"
-	"github.com/joho/godotenv"
+	"github.com/availproject/cdk-avail-da-server/signature"
+	"github.com/availproject/cdk-avail-da-server/usage"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 func main() {
+	selfTest := flag.Bool("selftest", false, "check the storage, the L1 and Avail RPC, the bridge API and the attestation contract, then exit")
+	flag.Parse()
+
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	if err := godotenv.Load(".env"); err != nil {
-		log.Printf("Error loading .env file: %v", err)
+	if err := loadEnvFile(); err != nil {
+		log.Printf("%v", err)
+		os.Exit(1)
+	}
+
+	cfg, err := loadServerConfig()
+	if err != nil {
+		log.Printf("%v", err)
+		os.Exit(1)
+	}
+	// The level was checked with the config, debug traces can be added at info level
+	logging.SetLevel(cfg.LogLevel)
+	if len(cfg.LogDebug) > 0 && cfg.LogLevel == logging.LevelInfo {
+		logging.SetLevel(logging.LevelDebug, cfg.LogDebug...)
+	}
+	if *selfTest {
+		if err := runSelfTest(cfg); err != nil {
+			log.Printf("%v", err)
+			os.Exit(1)
+		}
+		log.Println("Self-test passed")
+		return
+	}
+
+	meter, err := usage.New(cfg.Tenants, cfg.UsageFile)
+	if err != nil {
+		log.Printf("Failed to initialize server: %v", err)
+		os.Exit(1)
+	}
+	meter.Run(ctx, time.Minute)
+
+	var observe da.Observer
+	var onReconnect func(client string)
+	var onPanic func(pattern string)
+	var onIngest func(result string, batches int)
+	if cfg.MetricsAddr != "" {
+		m := newMetrics(cfg.ChainID)
+		m.serve(ctx, cfg.MetricsAddr)
+		observe = m.observe
+		onReconnect = m.observeReconnect
+		onPanic = m.observePanic
+		onIngest = m.observeIngest
+		meter.Observe(m.observeServed)
+	}
+
+	leases, err := intializeLeases(cfg)
+	if err != nil {
+		log.Printf("Failed to initialize server: %v", err)
+		os.Exit(1)
+	}
+	defer leases.Close()
+
+	availBackend, storage, err := intializeServer(ctx, cfg, observe, leases)
+	if err != nil {
+		log.Printf("Failed to initialize server: %v", err)
+		os.Exit(1)
+	}
+
+	auditLog, err := audit.Open(cfg.AuditLogFile)
+	if err != nil {
+		log.Printf("Failed to initialize server: %v", err)
 		os.Exit(1)
 	}
+	defer auditLog.Close()
 
-	availBackend, s3Backend, err := intializeServer()
+	if availBackend != nil && cfg.WatchdogInterval > 0 {
+		runWatchdog(ctx, cfg, availBackend, onReconnect)
+	}
+	if cfg.RepairReportFile != "" {
+		runRepairs(ctx, cfg, availBackend, storage, auditLog, leases)
+	}
+	batches, err := newBatchIndex(ctx, cfg, storage)
 	if err != nil {
 		log.Printf("Failed to initialize server: %v", err)
 		os.Exit(1)
 	}
+	if cfg.Ingest {
+		if err := runIngestion(ctx, cfg, storage, leases, onIngest); err != nil {
+			log.Printf("Failed to initialize server: %v", err)
+			os.Exit(1)
+		}
+	}
+	if cfg.AttestationWatch {
+		if err := runAttestationWatch(ctx, cfg, availBackend, storage, leases); err != nil {
+			log.Printf("Failed to initialize server: %v", err)
+			os.Exit(1)
+		}
+	}
 
 	// Set up the HTTP server with the RPC handler
 	log.Println("Setting up HTTP server...")
 	mux := http.NewServeMux()
-	mux.Handle("/rpc", rpc.NewHandler(availBackend, s3Backend))
+	var signatures *signature.Verifier
+	if len(cfg.SequencerAddresses) > 0 {
+		signatures = signature.New(cfg.ChainID, cfg.SequencerAddresses, cfg.SignatureMaxAge)
+		log.Printf("Store requests must be signed by one of %d sequencers", len(cfg.SequencerAddresses))
+	}
+	mux.Handle("/rpc", rpc.NewHandler(availBackend, storage, batches, auditLog, meter, signatures, cfg.WriteAPIKey, cfg.AdminAPIKey, cfg.MaxResponseSize))
+	mux.Handle("GET /data/{hash}", rpc.NewDataHandler(storage, auditLog, meter))
+	if cfg.WriteAPIKey != "" {
+		store := rpc.NewStoreHandler(storage, auditLog, meter, signatures, cfg.WriteAPIKey)
+		mux.Handle("PUT /data/{hash}", store)
+		mux.Handle("POST /data", store)
+	}
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
+	// Not ready until the cache is warmed up, CDK nodes are only sent once it is
+	var warmingUp atomic.Bool
+	if cfg.WarmUpBlocks > 0 {
+		warmingUp.Store(true)
+		go func() {
+			defer warmingUp.Store(false)
+			if err := warmUp(ctx, cfg, storage); err != nil {
+				log.Printf("Cache warm-up failed: %v", err)
+			}
+		}()
+	}
+
+	// Not ready while the cache is warming up or the Avail node used for recovery is
+	// syncing
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		if warmingUp.Load() {
+			http.Error(w, "warming up the cache", http.StatusServiceUnavailable)
+			return
+		}
+		if availBackend != nil {
+			if err := availBackend.CheckSync(); err != nil {
+				log.Printf("Not ready: %v", err)
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+
+	// Panics are recovered inside the debug logger, so it logs the error response
+	handler := rpc.NewRecoverer(mux, onPanic)
+	if cfg.DebugLogSampleRate > 0 {
+		handler = rpc.NewDebugLogger(handler, cfg.DebugLogSampleRate, cfg.DebugLogMaxPayload)
+	}
 
 	server := &http.Server{
-		Addr:    ":8080",
-		Handler: mux,
+		Addr:              cfg.ListenAddr,
+		Handler:           handler,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+	}
+	server.SetKeepAlivesEnabled(cfg.HTTPKeepAlive)
+	if cfg.HTTP2 {
+		// The server has no TLS, HTTP/2 is negotiated with prior knowledge or an h2c upgrade
+		h2 := &http2.Server{
+			MaxConcurrentStreams: cfg.HTTP2MaxConcurrentStreams,
+			IdleTimeout:          cfg.HTTPIdleTimeout,
+		}
+		server.Handler = h2c.NewHandler(handler, h2)
 	}
 
 	go func() {
-		log.Println("Starting RPC server on :8080")
+		log.Printf("Starting RPC server on %s", cfg.ListenAddr)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Printf("Server error: %v", err)
 			stop()
@@ -61,73 +207,225 @@ func main() {
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Printf("Graceful shutdown failed: %v", err)
 	}
+	if err := meter.Save(); err != nil {
+		log.Printf("Failed to save the usage: %v", err)
+	}
+	leases.Release(shutdownCtx)
 	log.Println("Server stopped")
 }
 
-func intializeServer() (*da.AvailBackend, *da.S3Backend, error) {
+// intializeServer returns the Avail backend and the storage tiers, every read and
+// write of a tier is passed to observe when it is set
+func intializeServer(ctx context.Context, cfg serverConfig, observe da.Observer, leases *lease.Leases) (*da.AvailBackend, da.DAProvider, error) {
 	log.Println("Initializing server...")
 
-	// Disabled support for L1 recovery thru Avail chain
-	// a, err := intializeAvailBackend()
-	// if err != nil {
-	// 	log.Printf("Failed to initialize Avail backend: %v", err)
-	// 	return nil, nil, err
-	// }
-	var a *da.AvailBackend = nil
-
-	bucket := os.Getenv("S3_BUCKET")
-	region := os.Getenv("S3_REGION")
-	accessKey := os.Getenv("S3_ACCESS_KEY")
-	secretKey := os.Getenv("S3_SECRET_KEY")
-	objectPrefix := os.Getenv("S3_OBJECT_PREFIX")
+	// Avail recovery is only used as cold tier of the storage
+	var a *da.AvailBackend
+	if cfg.ColdTier {
+		var err error
+		a, err = intializeAvailBackend(cfg)
+		if err != nil {
+			log.Printf("Failed to initialize Avail backend: %v", err)
+			return nil, nil, err
+		}
+	}
 
-	if bucket == "" || region == "" || accessKey == "" || secretKey == "" {
-		log.Printf("Missing required S3 configuration")
-		return nil, nil, errors.New("missing required S3 configuration")
+	s, err := intializeStorage(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	s, err := da.NewS3Backend(bucket, region, accessKey, secretKey, objectPrefix)
+	hot, err := intializeCache(cfg)
 	if err != nil {
-		log.Printf("Failed to initialize S3 backend: %v", err)
 		return nil, nil, err
 	}
+	replicas, err := intializeReplicas(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	var mirror *da.DACBackend
+	if len(cfg.DACMirrorURLs) > 0 {
+		mirror, err = da.NewDACBackend(cfg.DACMirrorURLs)
+		if err != nil {
+			log.Printf("Failed to initialize DAC mirror: %v", err)
+			return nil, nil, err
+		}
+		log.Printf("Batches missing from the storage are copied from %d DAC members", len(cfg.DACMirrorURLs))
+	}
+	var tiered *da.TieredProvider
+	if hot != nil || a != nil || len(replicas) > 0 || mirror != nil || observe != nil {
+		tiered = da.NewTieredProvider(hot, s, a, replicas...)
+		if mirror != nil {
+			tiered.Mirror(mirror)
+		}
+		if observe != nil {
+			tiered.Observe(observe)
+		}
+		tiered.UseLeases(leases)
+		s = tiered
+	}
+	if a != nil {
+		if err := useResolvers(ctx, cfg, a, s); err != nil {
+			return nil, nil, err
+		}
+	}
+	// The eviction resolves the locations of the data, it starts once the resolvers
+	// are set
+	if tiered != nil && cfg.WarmRetention > 0 {
+		if err := tiered.RunEviction(ctx, cfg.WarmRetention, cfg.DeleteGrace, cfg.EvictionInterval); err != nil {
+			return nil, nil, err
+		}
+	}
 
 	log.Println("Server initialized successfully")
 
 	return a, s, nil
 }
 
-func intializeAvailBackend() (*da.AvailBackend, error) {
+// intializeLeases returns the leases of LEASE_BACKEND, nil when every server runs
+// the jobs
+func intializeLeases(cfg serverConfig) (*lease.Leases, error) {
+	if cfg.LeaseBackend != leaseRedis {
+		return nil, nil
+	}
+	l, err := lease.New(cfg.RedisURL)
+	if err != nil {
+		log.Printf("Failed to initialize the leases: %v", err)
+		return nil, err
+	}
+	log.Printf("The ingestion, eviction and repairs run on the server holding their lease, this server is %s", l.Holder())
+	return l, nil
+}
+
+// intializeCache returns the hot cache of CACHE_BACKEND, nil when it is disabled
+func intializeCache(cfg serverConfig) (da.HotCache, error) {
+	switch cfg.Cache {
+	case cacheMemory:
+		return da.NewMemoryCache(cfg.CacheMaxSizeMB<<20, cfg.CacheTTL), nil
+	case cacheRedis:
+		c, err := da.NewRedisCache(cfg.RedisURL, cfg.CacheTTL)
+		if err != nil {
+			log.Printf("Failed to initialize Redis cache: %v", err)
+			return nil, err
+		}
+		return c, nil
+	}
+	return nil, nil
+}
 
-	isBridgeEnabled, err := strconv.ParseBool(os.Getenv("IS_BRIDGE_ENABLED"))
+// intializeStorage returns the backend of STORAGE_BACKEND the batch data is read from
+func intializeStorage(ctx context.Context, cfg serverConfig) (da.DAProvider, error) {
+	if cfg.Storage == storagePostgres {
+		p, err := da.NewPostgresBackend(cfg.PostgresURL, cfg.PostgresTable, cfg.PostgresMaxConns)
+		if err != nil {
+			log.Printf("Failed to initialize Postgres backend: %v", err)
+			return nil, err
+		}
+		return p, nil
+	}
+
+	s, err := da.NewS3Backend(cfg.S3Bucket, cfg.S3Region, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3ObjectPrefix, cfg.S3KeyLayout, cfg.S3ChecksumAlgorithm)
 	if err != nil {
-		log.Printf("Invalid boolean value for IS_BRIDGE_ENABLED: %v", err)
+		log.Printf("Failed to initialize S3 backend: %v", err)
 		return nil, err
 	}
-	var a *da.AvailBackend
+	if cfg.S3Bootstrap {
+		if err := s.Bootstrap(ctx, cfg.S3Region, cfg.S3NoncurrentVersionDays); err != nil {
+			log.Printf("Failed to bootstrap the S3 bucket: %v", err)
+			return nil, err
+		}
+	}
+	if cfg.S3LegacyKeys {
+		s.ResolveLegacyKeys(true)
+	}
+	if cfg.S3Compression == da.CompressionZstd {
+		if err := s.Compress(ctx); err != nil {
+			log.Printf("Failed to load the compression dictionaries: %v", err)
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// intializeReplicas returns the read-only replicas of S3_REPLICAS, labeled with their
+// region
+func intializeReplicas(ctx context.Context, cfg serverConfig) ([]da.Replica, error) {
+	var replicas []da.Replica
+	for _, r := range cfg.S3Replicas {
+		s, err := da.NewS3Backend(r.Bucket, r.Region, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3ObjectPrefix, cfg.S3KeyLayout, cfg.S3ChecksumAlgorithm)
+		if err != nil {
+			log.Printf("Failed to initialize S3 replica %s: %v", r.Bucket, err)
+			return nil, err
+		}
+		if cfg.S3LegacyKeys {
+			s.ResolveLegacyKeys(false)
+		}
+		if cfg.S3Compression == da.CompressionZstd {
+			if err := s.Compress(ctx); err != nil {
+				log.Printf("Failed to load the compression dictionaries of S3 replica %s: %v", r.Bucket, err)
+				return nil, err
+			}
+		}
+		replicas = append(replicas, da.Replica{Backend: da.BackendS3 + "-" + r.Region, Provider: s})
+	}
+	return replicas, nil
+}
+
+// useResolvers sets the resolvers of AVAIL_RESOLVERS the Avail backend finds the data
+// of the hashes with, the index resolver reads the index of the storage and the dam
+// resolver scans L1 with DAM_SCAN_START_BLOCK
+func useResolvers(ctx context.Context, cfg serverConfig, a *da.AvailBackend, s da.DAProvider) error {
+	var resolvers []da.Resolver
+	for _, name := range cfg.AvailResolvers {
+		switch name {
+		case da.ResolverAttestation:
+			resolvers = append(resolvers, a.AttestationResolver())
+		case da.ResolverIndex:
+			index := da.IndexOf(s)
+			if index == nil {
+				return errors.New("the index resolver needs a storage with an index")
+			}
+			resolvers = append(resolvers, da.NewIndexResolver(index))
+		case da.ResolverTurboDA:
+			client := avail.NewTurboDAClient(cfg.TurboDAURL, cfg.TurboDAAPIKey)
+			resolvers = append(resolvers, da.NewTurboDAResolver(cfg.TurboDASubmissionsFile, client))
+		case da.ResolverDAM:
+			source, err := newDAMSource(ctx, cfg, s)
+			if err != nil {
+				return err
+			}
+			resolvers = append(resolvers, da.NewDAMResolver(source))
+		}
+	}
+	a.UseResolvers(resolvers...)
+	log.Printf("Batch locations are resolved with %v", cfg.AvailResolvers)
+	return nil
+}
+
+func intializeAvailBackend(cfg serverConfig) (*da.AvailBackend, error) {
 	var attestorAddr, l1_rpc_url = "", ""
-	if isBridgeEnabled {
+	if cfg.IsBridgeEnabled {
 		log.Println("Avail Bridge is enabled")
-		attestorAddr = os.Getenv("ATTESTATION_CONTRACT_ADDRESS")
+		attestorAddr = cfg.AttestationContractAddress
 		if attestorAddr == "" {
 			log.Printf("ATTESTATION_CONTRACT_ADDRESS is not set")
 			return nil, errors.New("ATTESTATION_CONTRACT_ADDRESS is not set")
 		}
 
-		l1_rpc_url = os.Getenv("L1_RPC_URL")
+		l1_rpc_url = cfg.L1RPCURL
 		if l1_rpc_url == "" {
 			log.Printf("L1_RPC_URL is not set")
 			return nil, errors.New("L1_RPC_URL is not set")
 		}
 	}
 
-	avail_rpc_url := os.Getenv("AVAIL_RPC_URL")
+	avail_rpc_url := cfg.AvailRPCURL
 	if avail_rpc_url == "" {
 		log.Printf("AVAIL_RPC_URL is not set")
 		return nil, errors.New("AVAIL_RPC_URL is not set")
 	}
 
-	a, err = da.NewAvailBackend(isBridgeEnabled, attestorAddr, l1_rpc_url, avail_rpc_url)
+	a, err := da.NewAvailBackend(cfg.IsBridgeEnabled, attestorAddr, l1_rpc_url, avail_rpc_url, cfg.AvailMinFinalizedHeight, cfg.AvailMaxFetches)
 	if err != nil {
 		log.Printf("Failed to initialize Avail backend: %v", err)
 		return nil, err
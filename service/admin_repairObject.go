@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ErrRepairUnavailable is returned when the server has no Avail backend to repair
+// objects from
+var ErrRepairUnavailable = errors.New("repairs need Avail recovery, set COLD_TIER")
+
+// RepairObject reads the data of hash from Avail at the location its resolvers found and
+// rewrites it into the storage, for objects found missing by a reconciliation. The
+// size of the repaired data is returned.
+func RepairObject(a *da.AvailBackend, s da.DAProvider, hash common.Hash) (int, error) {
+	if a == nil {
+		return 0, ErrRepairUnavailable
+	}
+
+	log.Printf("Repairing object for hash: %s", hash.Hex())
+	data, err := a.GetDataFromAvail(context.Background(), hash)
+	if err != nil {
+		log.Printf("Failed to read the object to repair from Avail: %v", err)
+		return 0, err
+	}
+	if crypto.Keccak256Hash(data) != hash {
+		return 0, fmt.Errorf("data read from Avail doesn't match the hash %s", hash.Hex())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := s.Put(ctx, hash, data); err != nil {
+		log.Printf("Failed to write the repaired object: %v", err)
+		return 0, err
+	}
+
+	log.Printf("Successfully repaired object for hash: %s, size: %d", hash.Hex(), len(data))
+	return len(data), nil
+}
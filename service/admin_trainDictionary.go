@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/availproject/cdk-avail-da-server/da"
+)
+
+// DefaultDictionarySamples is the number of stored objects dictionaries are trained on
+// by default
+const DefaultDictionarySamples = 1000
+
+// TrainDictionary trains a zstd dictionary on samples stored objects, the data stored
+// from then on is compressed with it. It returns da.ErrCompressionDisabled when the
+// storage isn't compressed.
+func TrainDictionary(s da.DAProvider, samples int) (da.Dictionary, error) {
+	trainer := da.DictionaryTrainerOf(s)
+	if trainer == nil {
+		return da.Dictionary{}, da.ErrCompressionDisabled
+	}
+
+	log.Printf("Training a dictionary on %d objects", samples)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	dictionary, err := trainer.TrainDictionary(ctx, samples)
+	if errors.Is(err, da.ErrCompressionDisabled) {
+		return da.Dictionary{}, err
+	}
+	if err != nil {
+		log.Printf("Failed to train the dictionary: %v", err)
+		return da.Dictionary{}, err
+	}
+	return dictionary, nil
+}
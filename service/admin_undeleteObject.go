@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrUndeleteUnavailable is returned when the storage keeps no deleted data
+var ErrUndeleteUnavailable = errors.New("the storage keeps no deleted data, set DELETE_GRACE_DAYS")
+
+// UndeleteObject restores the data of hash evicted from the storage during the grace
+// period of DELETE_GRACE_DAYS, for data deleted by a misconfigured retention
+func UndeleteObject(s da.DAProvider, hash common.Hash) error {
+	undeleter := da.UndeleterOf(s)
+	if undeleter == nil {
+		return ErrUndeleteUnavailable
+	}
+
+	log.Printf("Undeleting object for hash: %s", hash.Hex())
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := undeleter.Undelete(ctx, hash); err != nil {
+		log.Printf("Failed to undelete the object: %v", err)
+		return err
+	}
+
+	log.Printf("Successfully undeleted object for hash: %s", hash.Hex())
+	return nil
+}
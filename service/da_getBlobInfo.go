@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// GetBlobInfo returns the metadata of the data whose keccak256 or sha256 is hash in
+// every tier, without reading the data. The hash of the result is the keccak256 the
+// data is stored under.
+func GetBlobInfo(s da.DAProvider, hash string) (da.BlobInfo, error) {
+	log.Printf("Getting blob info for hash: %s", hash)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	hexHash := common.HexToHash(hash)
+	info, err := da.Inspect(ctx, s, hexHash)
+	if index := da.IndexOf(s); errors.Is(err, da.ErrNotFound) && index != nil {
+		canonical, aliasErr := index.GetAlias(ctx, da.SchemeSHA256, hexHash)
+		if aliasErr == nil {
+			info, err = da.Inspect(ctx, s, canonical)
+		} else if !errors.Is(aliasErr, da.ErrNotFound) {
+			err = aliasErr
+		}
+	}
+	if errors.Is(err, da.ErrNotFound) {
+		return da.BlobInfo{}, fmt.Errorf("%w: %s", da.ErrNotFound, hexHash.Hex())
+	}
+	if err != nil {
+		log.Printf("Failed to get blob info: %v", err)
+		return da.BlobInfo{}, fmt.Errorf("%w: failed to get the blob info", kindOf(err))
+	}
+	return info, nil
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/availproject/cdk-avail-da-server/pkg/l1"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// DAMScanner finds the data availability message of the sequence of a batch hash in
+// the calldata of its sequenceBatchesValidium transaction on L1, so the cold tier
+// recovers batches from Avail without the bridge and without the message being
+// supplied. The transaction of every batch found is recorded in the index of the
+// storage, the sequences of the validium contract are scanned on L1 from the start
+// block on demand for the others, every block once per process. Blocks within
+// confirmations of the head may still be reorged and are only scanned once they are
+// deep enough.
+type DAMScanner struct {
+	client        *l1.Client
+	abi           abi.ABI
+	contract      common.Address
+	confirmations uint64
+	index         da.Index
+
+	// mu serializes the scans, next is the first L1 block not scanned yet
+	mu   sync.Mutex
+	next uint64
+}
+
+// NewDAMScanner returns the scanner of the sequences of contract since the L1 block
+// start with confirmations blocks on top of them, recording their transactions in the
+// index of s
+func NewDAMScanner(client *l1.Client, contract common.Address, start, confirmations uint64, s da.DAProvider) (*DAMScanner, error) {
+	index := da.IndexOf(s)
+	if index == nil {
+		return nil, fmt.Errorf("the storage has no index to record sequence transactions in")
+	}
+	contractAbi, err := abi.JSON(strings.NewReader(l1.PolygonValidiumABI))
+	if err != nil {
+		return nil, err
+	}
+	return &DAMScanner{client: client, abi: contractAbi, contract: contract, confirmations: confirmations, index: index, next: start}, nil
+}
+
+// DataAvailabilityMessage returns the data availability message of the sequence of
+// hash, ErrNotFound when it isn't sequenced yet or its sequence isn't confirmed yet
+func (d *DAMScanner) DataAvailabilityMessage(ctx context.Context, hash common.Hash) ([]byte, error) {
+	dam, err := d.indexed(ctx, hash)
+	if !errors.Is(err, da.ErrNotFound) {
+		return dam, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Another request may have scanned the batch while this one waited
+	dam, err = d.indexed(ctx, hash)
+	if !errors.Is(err, da.ErrNotFound) {
+		return dam, err
+	}
+	head, err := d.client.SafeHead(ctx, d.confirmations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the L1 head: %w", err)
+	}
+	for d.next <= head {
+		end := min(d.next+batchScanRangeSize-1, head)
+		dam, err := d.scan(ctx, d.next, end, hash)
+		if err != nil {
+			return nil, err
+		}
+		d.next = end + 1
+		if dam != nil {
+			return dam, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: batch %s isn't sequenced", da.ErrNotFound, hash.Hex())
+}
+
+// indexed returns the data availability message of the sequence transaction recorded
+// for hash
+func (d *DAMScanner) indexed(ctx context.Context, hash common.Hash) ([]byte, error) {
+	txHash, err := d.index.GetAlias(ctx, da.SchemeSequenceTx, hash)
+	if err != nil {
+		return nil, err
+	}
+	seq, err := l1.SequenceOfTx(ctx, d.client, d.abi, txHash)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(seq.BatchHashes, hash) {
+		return nil, fmt.Errorf("sequence tx %s recorded for %s doesn't hold it", txHash.Hex(), hash.Hex())
+	}
+	log.Printf("Data availability message of %s read from tx %s", hash.Hex(), txHash.Hex())
+	return seq.DataAvailabilityMessage, nil
+}
+
+// scan records the sequence transactions of the batches sequenced in the inclusive
+// block range and returns the data availability message of the wanted batch when it
+// was found
+func (d *DAMScanner) scan(ctx context.Context, from, to uint64, wanted common.Hash) ([]byte, error) {
+	blocks, err := l1.QuerySequencesFromL1ByRange(ctx, d.client, d.abi, d.contract,
+		new(big.Int).SetUint64(from), new(big.Int).SetUint64(to))
+	if err != nil {
+		return nil, err
+	}
+	var found []byte
+	for _, sequences := range blocks {
+		for _, seq := range sequences {
+			for _, hash := range seq.BatchHashes {
+				if err := d.index.PutAlias(ctx, da.SchemeSequenceTx, hash, seq.TxHash); err != nil {
+					return nil, fmt.Errorf("failed to index the sequence tx of %s: %w", hash.Hex(), err)
+				}
+				if hash == wanted {
+					log.Printf("Data availability message of %s found in tx %s", hash.Hex(), seq.TxHash.Hex())
+					found = seq.DataAvailabilityMessage
+				}
+			}
+		}
+	}
+	return found, nil
+}
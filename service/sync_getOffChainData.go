@@ -1,15 +1,58 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
+	"time"
 
 	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/availproject/cdk-avail-da-server/pkg/daerrors"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 )
 
-func GetOffChainData(a *da.AvailBackend, s *da.S3Backend, hash string) (string, error) {
+// Lookup returns the data whose keccak256 or sha256 is hash. The data is stored under
+// its keccak256, a sha256 is resolved to it through the index of the storage.
+func Lookup(ctx context.Context, s da.DAProvider, hash common.Hash) ([]byte, error) {
+	data, err := s.Get(ctx, hash)
+	index := da.IndexOf(s)
+	if !errors.Is(err, da.ErrNotFound) || index == nil {
+		return data, err
+	}
+	canonical, aliasErr := index.GetAlias(ctx, da.SchemeSHA256, hash)
+	if errors.Is(aliasErr, da.ErrNotFound) {
+		return nil, err
+	}
+	if aliasErr != nil {
+		return nil, aliasErr
+	}
+	return s.Get(ctx, canonical)
+}
+
+// Verify returns ErrIntegrityMismatch when hash is neither the keccak256 nor the
+// sha256 of the data read for it
+func Verify(hash common.Hash, data []byte) error {
+	if Digest(da.SchemeKeccak256, data) != hash && Digest(da.SchemeSHA256, data) != hash {
+		return fmt.Errorf("%w: stored data of %s", daerrors.ErrIntegrityMismatch, hash.Hex())
+	}
+	return nil
+}
+
+// kindOf returns the kind of the error of a backend in the taxonomy of daerrors. A
+// backend failing for a reason of no kind is unavailable to the client.
+func kindOf(err error) error {
+	if kind := daerrors.Kind(err); kind != nil {
+		return kind
+	}
+	return daerrors.ErrBackendUnavailable
+}
+
+// GetOffChainData returns the hex encoded data of hash. The data availability message
+// dam of its sequence, optional, finds the data in Avail through the dam resolver when
+// it is missing from the storage.
+func GetOffChainData(a *da.AvailBackend, s da.DAProvider, hash string, dam []byte) (string, error) {
 	log.Printf("Getting off-chain data for hash: %s", hash)
 
 	hexHash := common.HexToHash(hash)
@@ -28,10 +71,23 @@ func GetOffChainData(a *da.AvailBackend, s *da.S3Backend, hash string) (string,
 	// }
 
 	log.Println("Retrieving off-chain data from S3")
-	data, err := s.GetDataFromS3(hexHash)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if len(dam) > 0 {
+		ctx = da.WithDataAvailabilityMessage(ctx, dam)
+	}
+	data, err := Lookup(ctx, s, hexHash)
+	if errors.Is(err, da.ErrNotFound) {
+		log.Printf("Off-chain data not found in S3: %v", err)
+		return "", fmt.Errorf("%w: %s", da.ErrNotFound, hexHash.Hex())
+	}
 	if err != nil {
 		log.Printf("Failed to retrieve off-chain data from S3: %v", err)
-		return "", errors.New("failed to retrieve the data from off-chain DA")
+		return "", fmt.Errorf("%w: failed to retrieve the data from off-chain DA", kindOf(err))
+	}
+	if err := Verify(hexHash, data); err != nil {
+		log.Printf("Off-chain data in S3 is corrupted: %v", err)
+		return "", err
 	}
 
 	log.Println("Successfully retrieved off-chain data")
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/availproject/cdk-avail-da-server/pkg/l1"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	// MaxBatchNumRange is the maximum number of batches of a single request by batch
+	// number
+	MaxBatchNumRange = 100
+	// batchScanRangeSize is the number of L1 blocks queried with a single eth_getLogs
+	// request while indexing
+	batchScanRangeSize = 1000
+)
+
+// ErrBatchIndexUnavailable is returned when the server doesn't index batch numbers
+var ErrBatchIndexUnavailable = errors.New("batch numbers aren't indexed, set BATCH_INDEX_START_BLOCK")
+
+// BatchData is the data of a batch returned by its number
+type BatchData struct {
+	Number uint64      `json:"number"`
+	Hash   common.Hash `json:"hash"`
+	Data   string      `json:"data"`
+}
+
+// BatchIndex resolves batch numbers to the hash of their data. The sequences of the
+// validium contract are scanned on L1 from the start block on demand, and the batch
+// numbers found are recorded in the index of the storage, so every block is scanned
+// once per process and resolved batches are never scanned again. Blocks within
+// confirmations of the head may still be reorged and are only scanned once they are
+// deep enough.
+type BatchIndex struct {
+	client        *l1.Client
+	abi           abi.ABI
+	contract      common.Address
+	confirmations uint64
+	index         da.Index
+
+	// mu serializes the scans, next is the first L1 block not scanned yet
+	mu   sync.Mutex
+	next uint64
+}
+
+// NewBatchIndex returns the index of the batches sequenced by contract since the L1
+// block start with confirmations blocks on top of them, recorded in the index of s
+func NewBatchIndex(client *l1.Client, contract common.Address, start, confirmations uint64, s da.DAProvider) (*BatchIndex, error) {
+	index := da.IndexOf(s)
+	if index == nil {
+		return nil, fmt.Errorf("the storage has no index to record batch numbers in")
+	}
+	contractAbi, err := abi.JSON(strings.NewReader(l1.PolygonValidiumABI))
+	if err != nil {
+		return nil, err
+	}
+	return &BatchIndex{client: client, abi: contractAbi, contract: contract, confirmations: confirmations, index: index, next: start}, nil
+}
+
+// Resolve returns the hash of the batch, ErrNotFound when it isn't sequenced yet or
+// its sequence isn't confirmed yet
+func (b *BatchIndex) Resolve(ctx context.Context, number uint64) (common.Hash, error) {
+	key := common.BigToHash(new(big.Int).SetUint64(number))
+	hash, err := b.index.GetAlias(ctx, da.SchemeBatchNumber, key)
+	if !errors.Is(err, da.ErrNotFound) {
+		return hash, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// Another request may have scanned the batch while this one waited
+	hash, err = b.index.GetAlias(ctx, da.SchemeBatchNumber, key)
+	if !errors.Is(err, da.ErrNotFound) {
+		return hash, err
+	}
+	head, err := b.client.SafeHead(ctx, b.confirmations)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to get the L1 head: %w", err)
+	}
+	for b.next <= head {
+		end := min(b.next+batchScanRangeSize-1, head)
+		found, err := b.scan(ctx, b.next, end, number)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		b.next = end + 1
+		if found != (common.Hash{}) {
+			return found, nil
+		}
+	}
+	return common.Hash{}, fmt.Errorf("%w: batch %d isn't sequenced", da.ErrNotFound, number)
+}
+
+// scan records the batch numbers sequenced in the inclusive block range and returns
+// the hash of the wanted batch when it was found
+func (b *BatchIndex) scan(ctx context.Context, from, to, wanted uint64) (common.Hash, error) {
+	blocks, err := l1.QuerySequencesFromL1ByRange(ctx, b.client, b.abi, b.contract,
+		new(big.Int).SetUint64(from), new(big.Int).SetUint64(to))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	var found common.Hash
+	for _, sequences := range blocks {
+		for _, seq := range sequences {
+			// Sequences without a batch number can't be indexed
+			if seq.LastBatch == 0 {
+				continue
+			}
+			for i, number := range seq.BatchNumbers() {
+				key := common.BigToHash(new(big.Int).SetUint64(number))
+				if err := b.index.PutAlias(ctx, da.SchemeBatchNumber, key, seq.BatchHashes[i]); err != nil {
+					return common.Hash{}, fmt.Errorf("failed to index batch %d: %w", number, err)
+				}
+				if number == wanted {
+					found = seq.BatchHashes[i]
+				}
+			}
+		}
+	}
+	return found, nil
+}
+
+// GetOffChainDataByBatchNum returns the data of the batches numbered start to end,
+// inclusive. Batches that aren't sequenced or whose data isn't found are left out.
+func GetOffChainDataByBatchNum(b *BatchIndex, s da.DAProvider, start, end uint64) ([]BatchData, error) {
+	if b == nil {
+		return nil, ErrBatchIndexUnavailable
+	}
+	if end < start || end-start >= MaxBatchNumRange {
+		return nil, fmt.Errorf("invalid batch range %d to %d, at most %d batches are allowed", start, end, MaxBatchNumRange)
+	}
+	log.Printf("Getting off-chain data of batches %d to %d", start, end)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	var batches []BatchData
+	for number := start; number <= end; number++ {
+		hash, err := b.Resolve(ctx, number)
+		if errors.Is(err, da.ErrNotFound) {
+			log.Printf("Batch %d isn't sequenced yet", number)
+			break
+		}
+		if err != nil {
+			log.Printf("Failed to resolve batch %d: %v", number, err)
+			return nil, fmt.Errorf("%w: failed to resolve batch %d", kindOf(err), number)
+		}
+		data, err := Lookup(ctx, s, hash)
+		if err == nil {
+			err = Verify(hash, data)
+		}
+		if err != nil {
+			log.Printf("Failed to retrieve off-chain data of batch %d (%s): %v", number, hash.Hex(), err)
+			continue
+		}
+		batches = append(batches, BatchData{Number: number, Hash: hash, Data: hexutil.Encode(data)})
+	}
+
+	log.Printf("Successfully retrieved off-chain data of %d/%d batches", len(batches), end-start+1)
+	return batches, nil
+}
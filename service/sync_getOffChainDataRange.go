@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// ErrInvalidRange is returned for ranges starting past the end of the data or longer
+// than the response size limit
+var ErrInvalidRange = errors.New("invalid range")
+
+// ErrResponseTooLarge is returned when the data of a request is larger than the
+// response size limit, clients read it in parts with sync_getOffChainDataRange
+var ErrResponseTooLarge = errors.New("response too large, read the data in parts with sync_getOffChainDataRange")
+
+// DataRange is a part of the data of a hash
+type DataRange struct {
+	// Offset is the offset of the part in the data
+	Offset uint64 `json:"offset"`
+	// Size is the size of the whole data
+	Size int    `json:"size"`
+	Data string `json:"data"`
+}
+
+// GetOffChainDataRange returns at most length bytes of the data of hash from offset
+// on, the part is shorter at the end of the data. A length over maxLength is
+// rejected, zero allows any length.
+func GetOffChainDataRange(s da.DAProvider, hash string, offset, length uint64, maxLength int) (DataRange, error) {
+	if length == 0 {
+		return DataRange{}, fmt.Errorf("%w: length is 0", ErrInvalidRange)
+	}
+	if maxLength > 0 && length > uint64(maxLength) {
+		return DataRange{}, fmt.Errorf("%w: length %d is over the limit of %d bytes", ErrInvalidRange, length, maxLength)
+	}
+	log.Printf("Getting %d bytes of the off-chain data of hash %s from offset %d", length, hash, offset)
+
+	hexHash := common.HexToHash(hash)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	data, err := Lookup(ctx, s, hexHash)
+	if errors.Is(err, da.ErrNotFound) {
+		return DataRange{}, fmt.Errorf("%w: %s", da.ErrNotFound, hexHash.Hex())
+	}
+	if err != nil {
+		log.Printf("Failed to retrieve off-chain data from S3: %v", err)
+		return DataRange{}, fmt.Errorf("%w: failed to retrieve the data from off-chain DA", kindOf(err))
+	}
+	if err := Verify(hexHash, data); err != nil {
+		log.Printf("Off-chain data in S3 is corrupted: %v", err)
+		return DataRange{}, err
+	}
+	if offset > uint64(len(data)) {
+		return DataRange{}, fmt.Errorf("%w: offset %d is past the end of the %d bytes of data", ErrInvalidRange, offset, len(data))
+	}
+	end := uint64(len(data))
+	if length < end-offset {
+		end = offset + length
+	}
+	return DataRange{Offset: offset, Size: len(data), Data: hexutil.Encode(data[offset:end])}, nil
+}
+
+// CheckResponseSize returns ErrResponseTooLarge when size is over maxSize, zero
+// allows any size
+func CheckResponseSize(size, maxSize int) error {
+	if maxSize > 0 && size > maxSize {
+		return fmt.Errorf("%w: %d bytes, the limit is %d", ErrResponseTooLarge, size, maxSize)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// MaxListOffChainData is the maximum number of hashes of a single list request
+const MaxListOffChainData = 100
+
+// ListOffChainData returns the data of every hash found in S3, keyed by hash like the
+// sync_listOffChainData of the DAC nodes. Hashes that aren't found are left out.
+func ListOffChainData(a *da.AvailBackend, s da.DAProvider, hashes []string) (map[common.Hash]string, error) {
+	log.Printf("Listing off-chain data for %d hashes", len(hashes))
+	if len(hashes) > MaxListOffChainData {
+		return nil, fmt.Errorf("too many hashes requested, at most %d are allowed", MaxListOffChainData)
+	}
+
+	list := make(map[common.Hash]string, len(hashes))
+	for _, hash := range hashes {
+		hexHash := common.HexToHash(hash)
+		if _, ok := list[hexHash]; ok {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		data, err := Lookup(ctx, s, hexHash)
+		cancel()
+		if err == nil {
+			err = Verify(hexHash, data)
+		}
+		if err != nil {
+			log.Printf("Failed to retrieve off-chain data of %s from S3: %v", hexHash.Hex(), err)
+			continue
+		}
+		list[hexHash] = hexutil.Encode(data)
+	}
+
+	log.Printf("Successfully retrieved off-chain data of %d/%d hashes", len(list), len(hashes))
+	return list, nil
+}
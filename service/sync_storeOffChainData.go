@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// MaxStoreOffChainData is the maximum size of the data of a single store request
+const MaxStoreOffChainData = 8 << 20
+
+var (
+	// ErrHashMismatch is returned when the hash sent with the data isn't its digest
+	ErrHashMismatch = errors.New("hash doesn't match the digest of the data")
+	// ErrDataTooLarge is returned for data larger than MaxStoreOffChainData
+	ErrDataTooLarge = fmt.Errorf("data is larger than %d bytes", MaxStoreOffChainData)
+)
+
+// Digest returns the digest of the data in the commitment scheme, empty is keccak256
+func Digest(scheme string, data []byte) common.Hash {
+	if scheme == da.SchemeSHA256 {
+		return sha256.Sum256(data)
+	}
+	return crypto.Keccak256Hash(data)
+}
+
+// StoreOffChainData stores the data in S3 under its keccak256 and its sha256 as alias
+// in the index, and returns its digest in scheme. The digest is always computed here,
+// a hash sent by the client is only checked against it, so no entry is ever stored
+// under a key that isn't the hash of its data. A nil hash skips the check. The digest
+// of the data is returned with the errors too.
+func StoreOffChainData(s da.DAProvider, data []byte, hash *common.Hash, scheme string) (common.Hash, error) {
+	if len(data) > MaxStoreOffChainData {
+		return common.Hash{}, ErrDataTooLarge
+	}
+	if scheme == "" {
+		scheme = da.SchemeKeccak256
+	}
+	canonical := crypto.Keccak256Hash(data)
+	digest := Digest(scheme, data)
+	if hash != nil && *hash != digest {
+		log.Printf("Rejected off-chain data sent for hash %s, its %s is %s", hash.Hex(), scheme, digest.Hex())
+		return digest, fmt.Errorf("%w: got %s, data hashes to %s with %s", ErrHashMismatch, hash.Hex(), digest.Hex(), scheme)
+	}
+
+	log.Printf("Storing off-chain data for hash: %s, size: %d", canonical.Hex(), len(data))
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := s.Put(ctx, canonical, data); err != nil {
+		log.Printf("Failed to store off-chain data in S3: %v", err)
+		if errors.Is(err, da.ErrReadOnly) {
+			return digest, err
+		}
+		return digest, fmt.Errorf("%w: failed to store the data in off-chain DA", kindOf(err))
+	}
+	if index := da.IndexOf(s); index != nil {
+		if err := index.PutAlias(ctx, da.SchemeSHA256, Digest(da.SchemeSHA256, data), canonical); err != nil {
+			log.Printf("Failed to store the sha256 alias of %s: %v", canonical.Hex(), err)
+			return digest, fmt.Errorf("%w: failed to store the sha256 alias in off-chain DA", kindOf(err))
+		}
+	}
+
+	log.Println("Successfully stored off-chain data")
+	return digest, nil
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/availproject/cdk-avail-da-server/da/mock"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// indexedBackend is an in-memory storage with an index of aliases
+type indexedBackend struct {
+	*mock.Backend
+	mu      sync.Mutex
+	aliases map[string]common.Hash
+}
+
+func newIndexedBackend() *indexedBackend {
+	return &indexedBackend{Backend: mock.New(), aliases: make(map[string]common.Hash)}
+}
+
+func (b *indexedBackend) PutAlias(ctx context.Context, scheme string, digest, hash common.Hash) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.aliases[scheme+digest.Hex()] = hash
+	return nil
+}
+
+func (b *indexedBackend) GetAlias(ctx context.Context, scheme string, digest common.Hash) (common.Hash, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	hash, ok := b.aliases[scheme+digest.Hex()]
+	if !ok {
+		return common.Hash{}, fmt.Errorf("%w: alias %s", da.ErrNotFound, digest.Hex())
+	}
+	return hash, nil
+}
+
+// ✅ Test data is only stored under the digest of its data
+func TestStoreOffChainData(t *testing.T) {
+	data := []byte("batch-1")
+	keccak := crypto.Keccak256Hash(data)
+	sha := common.Hash(sha256.Sum256(data))
+	other := crypto.Keccak256Hash([]byte("batch-2"))
+
+	tests := []struct {
+		name   string
+		hash   *common.Hash
+		scheme string
+		digest common.Hash
+		err    error
+	}{
+		{name: "no hash", digest: keccak},
+		{name: "keccak256", hash: &keccak, digest: keccak},
+		{name: "sha256", hash: &sha, scheme: da.SchemeSHA256, digest: sha},
+		{name: "hash of other data", hash: &other, digest: keccak, err: ErrHashMismatch},
+		{name: "sha256 of a keccak256 tenant", hash: &sha, digest: keccak, err: ErrHashMismatch},
+		{name: "keccak256 of a sha256 tenant", hash: &keccak, scheme: da.SchemeSHA256, digest: sha, err: ErrHashMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newIndexedBackend()
+			digest, err := StoreOffChainData(s, data, tt.hash, tt.scheme)
+			assert.Equal(t, tt.digest, digest)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				// ❌ Nothing is stored for a rejected request
+				_, err = s.Get(context.Background(), keccak)
+				assert.ErrorIs(t, err, da.ErrNotFound)
+				return
+			}
+			require.NoError(t, err)
+			for _, hash := range []common.Hash{keccak, sha} {
+				stored, err := Lookup(context.Background(), s, hash)
+				require.NoError(t, err)
+				assert.Equal(t, data, stored)
+			}
+		})
+	}
+
+	// ❌ Data too large
+	_, err := StoreOffChainData(newIndexedBackend(), make([]byte, MaxStoreOffChainData+1), nil, "")
+	assert.ErrorIs(t, err, ErrDataTooLarge)
+}
@@ -0,0 +1,169 @@
+// Package signature verifies the store requests signed by the sequencer, so only the
+// sequencer can populate the data of a DA server shared with other clients.
+package signature
+
+import (
+	"crypto/ecdsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Headers of a signed store request
+const (
+	HeaderChainID   = "X-Chain-Id"
+	HeaderTimestamp = "X-Signature-Timestamp"
+	HeaderSignature = "X-Signature"
+)
+
+var (
+	// ErrUnsigned is returned for store requests without signature
+	ErrUnsigned = errors.New("store requests must be signed by the sequencer")
+	// ErrInvalidSignature is returned for signatures that aren't of an allowed
+	// sequencer over the hash of the data, the chain id and the timestamp
+	ErrInvalidSignature = errors.New("invalid store request signature")
+	// ErrExpired is returned for signatures whose timestamp is too far from the time of
+	// the server
+	ErrExpired = errors.New("store request signature expired")
+	// ErrReplayed is returned for a signature that was already used
+	ErrReplayed = errors.New("store request signature already used")
+)
+
+// Digest returns the message a store request signs, the keccak256 of the chain id and
+// the unix timestamp as big endian uint64 followed by the keccak256 hash of the data.
+// It is signed as an EIP-191 personal message, so any Ethereum signer can sign it.
+func Digest(chainID uint64, timestamp int64, hash common.Hash) []byte {
+	msg := make([]byte, 16+common.HashLength)
+	binary.BigEndian.PutUint64(msg, chainID)
+	binary.BigEndian.PutUint64(msg[8:], uint64(timestamp))
+	copy(msg[16:], hash.Bytes())
+	return accounts.TextHash(crypto.Keccak256(msg))
+}
+
+// Sign signs the store of the data of hash with key, for clients and tests
+func Sign(key *ecdsa.PrivateKey, chainID uint64, timestamp int64, hash common.Hash) ([]byte, error) {
+	return crypto.Sign(Digest(chainID, timestamp, hash), key)
+}
+
+// Verifier checks the signatures of the store requests. A nil verifier accepts every
+// request, so signatures are optional.
+type Verifier struct {
+	chainID uint64
+	signers []common.Address
+	// maxAge is how far the timestamp of a signature may be from the time of the
+	// server, a signature is only used once within that window
+	maxAge time.Duration
+
+	mu sync.Mutex
+	// used holds the messages signed with their timestamp, until it leaves the window
+	used map[common.Hash]time.Time
+	now  func() time.Time
+}
+
+// New returns a verifier accepting the signatures of signers for chainID whose
+// timestamp is at most maxAge from the time of the server
+func New(chainID uint64, signers []common.Address, maxAge time.Duration) *Verifier {
+	return &Verifier{
+		chainID: chainID,
+		signers: signers,
+		maxAge:  maxAge,
+		used:    make(map[common.Hash]time.Time),
+		now:     time.Now,
+	}
+}
+
+// Claim is the signature of a store request being served. The signature is only used
+// up once the store succeeded, the identical retry of a failed store is accepted.
+type Claim struct {
+	v  *Verifier
+	id common.Hash
+}
+
+// Done uses up the signature when the store succeeded and releases it otherwise
+func (c *Claim) Done(err error) {
+	if c == nil || err == nil {
+		return
+	}
+	c.v.mu.Lock()
+	defer c.v.mu.Unlock()
+	delete(c.v.used, c.id)
+}
+
+// Verify checks the signature the request carries in its headers over the store of
+// the data of hash and claims it until Done is called with the result of the store.
+// A signature claimed by another request is refused with ErrReplayed.
+func (v *Verifier) Verify(r *http.Request, hash common.Hash) (*Claim, error) {
+	if v == nil {
+		return nil, nil
+	}
+	encoded := r.Header.Get(HeaderSignature)
+	if encoded == "" {
+		return nil, ErrUnsigned
+	}
+	chainID, err := strconv.ParseUint(r.Header.Get(HeaderChainID), 10, 64)
+	if err != nil || chainID != v.chainID {
+		return nil, fmt.Errorf("%w: chain id %q, expected %d", ErrInvalidSignature, r.Header.Get(HeaderChainID), v.chainID)
+	}
+	timestamp, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: timestamp %q", ErrInvalidSignature, r.Header.Get(HeaderTimestamp))
+	}
+	sig, err := hexutil.Decode(encoded)
+	if err != nil || len(sig) != crypto.SignatureLength {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidSignature)
+	}
+	// Signers following Ethereum conventions set v to 27 or 28
+	sig = slices.Clone(sig)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	digest := Digest(chainID, timestamp, hash)
+	pub, err := crypto.SigToPub(digest, sig)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	signer := crypto.PubkeyToAddress(*pub)
+	if !slices.Contains(v.signers, signer) {
+		return nil, fmt.Errorf("%w: %s isn't an allowed sequencer", ErrInvalidSignature, signer.Hex())
+	}
+
+	signed := time.Unix(timestamp, 0)
+	now := v.now()
+	if signed.Before(now.Add(-v.maxAge)) || signed.After(now.Add(v.maxAge)) {
+		return nil, fmt.Errorf("%w: signed at %s, accepted for %v", ErrExpired, signed.UTC().Format(time.RFC3339), v.maxAge)
+	}
+	// The message is recorded rather than the signature, which has other encodings
+	id := common.BytesToHash(digest)
+	if err := v.use(id, signed, now); err != nil {
+		return nil, err
+	}
+	return &Claim{v: v, id: id}, nil
+}
+
+// use records the signed message, ErrReplayed when it was already used. Messages whose
+// timestamp left the window are forgotten, they are rejected as expired.
+func (v *Verifier) use(id common.Hash, signed, now time.Time) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for seen, at := range v.used {
+		if at.Before(now.Add(-v.maxAge)) {
+			delete(v.used, seen)
+		}
+	}
+	if _, ok := v.used[id]; ok {
+		return ErrReplayed
+	}
+	v.used[id] = signed
+	return nil
+}
@@ -0,0 +1,131 @@
+package signature
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testChainID = 1001
+	testMaxAge  = 5 * time.Minute
+)
+
+var testNow = time.Unix(1_700_000_000, 0)
+
+// signedRequest returns a store request signed with key, sig is adjusted by tamper
+func signedRequest(t *testing.T, key *ecdsa.PrivateKey, chainID uint64, timestamp int64, hash common.Hash, tamper func(sig []byte)) *http.Request {
+	sig, err := Sign(key, chainID, timestamp, hash)
+	require.NoError(t, err)
+	if tamper != nil {
+		tamper(sig)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/data", nil)
+	r.Header.Set(HeaderChainID, strconv.FormatUint(chainID, 10))
+	r.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	r.Header.Set(HeaderSignature, hexutil.Encode(sig))
+	return r
+}
+
+func newTestVerifier(t *testing.T) (*Verifier, *ecdsa.PrivateKey) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	v := New(testChainID, []common.Address{crypto.PubkeyToAddress(key.PublicKey)}, testMaxAge)
+	v.now = func() time.Time { return testNow }
+	return v, key
+}
+
+// ✅ Test the signatures accepted and refused
+func TestVerify(t *testing.T) {
+	hash := crypto.Keccak256Hash([]byte("batch-1"))
+	other, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	now := testNow.Unix()
+	maxAge := int64(testMaxAge / time.Second)
+
+	tests := []struct {
+		name      string
+		key       func(own *ecdsa.PrivateKey) *ecdsa.PrivateKey
+		chainID   uint64
+		timestamp int64
+		tamper    func(sig []byte)
+		err       error
+	}{
+		{name: "v 0 or 1", chainID: testChainID, timestamp: now},
+		{name: "v 27 or 28", chainID: testChainID, timestamp: now, tamper: func(sig []byte) { sig[crypto.RecoveryIDOffset] += 27 }},
+		{name: "oldest accepted", chainID: testChainID, timestamp: now - maxAge},
+		{name: "newest accepted", chainID: testChainID, timestamp: now + maxAge},
+		{name: "expired", chainID: testChainID, timestamp: now - maxAge - 1, err: ErrExpired},
+		{name: "too far ahead", chainID: testChainID, timestamp: now + maxAge + 1, err: ErrExpired},
+		{name: "other chain", chainID: testChainID + 1, timestamp: now, err: ErrInvalidSignature},
+		{name: "unknown signer", key: func(*ecdsa.PrivateKey) *ecdsa.PrivateKey { return other }, chainID: testChainID, timestamp: now, err: ErrInvalidSignature},
+		{name: "tampered signature", chainID: testChainID, timestamp: now, tamper: func(sig []byte) { sig[0] ^= 0xff }, err: ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, key := newTestVerifier(t)
+			if tt.key != nil {
+				key = tt.key(key)
+			}
+			claim, err := v.Verify(signedRequest(t, key, tt.chainID, tt.timestamp, hash, tt.tamper), hash)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				assert.Nil(t, claim)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, claim)
+		})
+	}
+
+	// ❌ Unsigned request
+	v, _ := newTestVerifier(t)
+	_, err = v.Verify(httptest.NewRequest(http.MethodPost, "/data", nil), hash)
+	assert.ErrorIs(t, err, ErrUnsigned)
+
+	// ✅ A nil verifier accepts every request
+	var none *Verifier
+	claim, err := none.Verify(httptest.NewRequest(http.MethodPost, "/data", nil), hash)
+	require.NoError(t, err)
+	claim.Done(nil)
+}
+
+// ✅ Test a signature is used up by a successful store only
+func TestVerifyReplay(t *testing.T) {
+	hash := crypto.Keccak256Hash([]byte("batch-1"))
+	v, key := newTestVerifier(t)
+	r := signedRequest(t, key, testChainID, testNow.Unix(), hash, nil)
+
+	claim, err := v.Verify(r, hash)
+	require.NoError(t, err)
+	// ❌ Claimed by the request being served
+	_, err = v.Verify(r, hash)
+	assert.ErrorIs(t, err, ErrReplayed)
+
+	// The retry of a failed store is accepted
+	claim.Done(errors.New("bucket unavailable"))
+	claim, err = v.Verify(r, hash)
+	require.NoError(t, err)
+	claim.Done(nil)
+
+	// ❌ Replay of a stored request, also with v 27 or 28
+	_, err = v.Verify(r, hash)
+	assert.ErrorIs(t, err, ErrReplayed)
+	_, err = v.Verify(signedRequest(t, key, testChainID, testNow.Unix(), hash, func(sig []byte) { sig[crypto.RecoveryIDOffset] += 27 }), hash)
+	assert.ErrorIs(t, err, ErrReplayed)
+
+	// Forgotten once out of the window, and then expired
+	v.now = func() time.Time { return testNow.Add(testMaxAge + time.Second) }
+	_, err = v.Verify(r, hash)
+	assert.ErrorIs(t, err, ErrExpired)
+}
@@ -0,0 +1,295 @@
+// Package usage accounts the bytes of batch data served per tenant and enforces their
+// monthly bandwidth quotas, for operators offering the server as a shared service.
+package usage
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Anonymous is the tenant of the requests without the API key of a tenant
+const Anonymous = "anonymous"
+
+// HeaderTenantKey carries the API key of the tenant of a store request, whose bearer
+// token is the write API key
+const HeaderTenantKey = "X-Tenant-Key"
+
+// monthFormat is the format of the month the usage is accounted in, in UTC
+const monthFormat = "2006-01"
+
+var (
+	// ErrQuotaExceeded is returned for the requests of a tenant that used its monthly
+	// bandwidth quota
+	ErrQuotaExceeded = errors.New("monthly bandwidth quota exceeded")
+	// ErrUnknownTenant is returned for store requests whose tenant key isn't the API
+	// key of a tenant
+	ErrUnknownTenant = errors.New("unknown tenant key")
+)
+
+// Tenant is a client of the server identified by its API key. A zero quota is
+// unlimited. The Anonymous tenant has no API key, its quota is shared by the requests
+// without the key of a tenant.
+type Tenant struct {
+	Name       string
+	APIKey     string
+	QuotaBytes uint64
+	// Scheme is the commitment scheme the tenant addresses the data by, empty is
+	// keccak256
+	Scheme string
+}
+
+// Usage is the bandwidth used by a tenant in the month
+type Usage struct {
+	Month      string `json:"month"`
+	Bytes      uint64 `json:"bytes"`
+	QuotaBytes uint64 `json:"quotaBytes,omitempty"`
+}
+
+// state is the usage saved to the usage file
+type state struct {
+	Month string            `json:"month"`
+	Bytes map[string]uint64 `json:"bytes"`
+}
+
+// Meter accounts the bytes served per tenant. A nil meter accounts nothing and allows
+// every request, so the accounting is optional.
+type Meter struct {
+	mu      sync.Mutex
+	tenants []Tenant
+	month   string
+	bytes   map[string]uint64
+	// path is the file the usage is saved to, so quotas survive restarts. Empty keeps
+	// the usage in memory.
+	path string
+	// observe is called with every response accounted, e.g. to record metrics
+	observe func(tenant string, bytes int)
+}
+
+// New returns a meter of the tenants, the usage of the current month is loaded from
+// path when it exists
+func New(tenants []Tenant, path string) (*Meter, error) {
+	m := &Meter{
+		tenants: tenants,
+		month:   currentMonth(),
+		bytes:   make(map[string]uint64),
+		path:    path,
+	}
+	if path == "" {
+		return m, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage file %s: %w", path, err)
+	}
+	var saved state
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("invalid usage file %s: %w", path, err)
+	}
+	if saved.Month == m.month {
+		for tenant, n := range saved.Bytes {
+			m.bytes[tenant] = n
+		}
+	}
+	return m, nil
+}
+
+// Observe calls observe with the tenant and the size of every response accounted
+func (m *Meter) Observe(observe func(tenant string, bytes int)) {
+	if m != nil {
+		m.observe = observe
+	}
+}
+
+// Tenant returns the tenant whose API key the request carries as bearer token,
+// Anonymous when it carries none
+func (m *Meter) Tenant(r *http.Request) string {
+	if m == nil {
+		return Anonymous
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return Anonymous
+	}
+	if tenant, ok := m.tenantOf(token); ok {
+		return tenant
+	}
+	return Anonymous
+}
+
+// WriteTenant returns the tenant of a store request. Its bearer token is the write API
+// key, the tenant is identified by its API key in HeaderTenantKey instead, and only by
+// the bearer token when the request carries no tenant key. A tenant key of no tenant
+// is refused with ErrUnknownTenant, so data isn't returned under the digest of another
+// commitment scheme.
+func (m *Meter) WriteTenant(r *http.Request) (string, error) {
+	key := r.Header.Get(HeaderTenantKey)
+	if key == "" {
+		return m.Tenant(r), nil
+	}
+	if m != nil {
+		if tenant, ok := m.tenantOf(key); ok {
+			return tenant, nil
+		}
+	}
+	return "", ErrUnknownTenant
+}
+
+func (m *Meter) tenantOf(key string) (string, bool) {
+	for _, t := range m.tenants {
+		if t.APIKey == "" {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(key), []byte(t.APIKey)) == 1 {
+			return t.Name, true
+		}
+	}
+	return "", false
+}
+
+// Scheme returns the commitment scheme of the tenant, empty for the default
+func (m *Meter) Scheme(tenant string) string {
+	if m == nil {
+		return ""
+	}
+	for _, t := range m.tenants {
+		if t.Name == tenant {
+			return t.Scheme
+		}
+	}
+	return ""
+}
+
+// Allow returns ErrQuotaExceeded when the tenant used its quota of the month
+func (m *Meter) Allow(tenant string) error {
+	if m == nil {
+		return nil
+	}
+	quota := m.quota(tenant)
+	if quota == 0 {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rollover()
+	if m.bytes[tenant] >= quota {
+		return fmt.Errorf("%w: %s used %d of %d bytes in %s", ErrQuotaExceeded, tenant, m.bytes[tenant], quota, m.month)
+	}
+	return nil
+}
+
+// Add accounts n bytes served to the tenant
+func (m *Meter) Add(tenant string, n int) {
+	if m == nil || n <= 0 {
+		return
+	}
+	m.mu.Lock()
+	m.rollover()
+	m.bytes[tenant] += uint64(n)
+	m.mu.Unlock()
+
+	if m.observe != nil {
+		m.observe(tenant, n)
+	}
+}
+
+// Usage returns the usage of the month of every tenant that has a quota or was served
+func (m *Meter) Usage() map[string]Usage {
+	usage := make(map[string]Usage)
+	if m == nil {
+		return usage
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rollover()
+	for _, t := range m.tenants {
+		usage[t.Name] = Usage{Month: m.month, QuotaBytes: t.QuotaBytes}
+	}
+	for tenant, n := range m.bytes {
+		u := usage[tenant]
+		u.Month = m.month
+		u.Bytes = n
+		usage[tenant] = u
+	}
+	return usage
+}
+
+// Run saves the usage to the usage file every interval until ctx is done
+func (m *Meter) Run(ctx context.Context, interval time.Duration) {
+	if m == nil || m.path == "" {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			if err := m.Save(); err != nil {
+				log.Printf("Failed to save the usage: %v", err)
+			}
+		}
+	}()
+}
+
+// Save writes the usage to a temporary file renamed over the usage file, so a crash
+// never leaves a truncated file. Without usage file nothing is saved.
+func (m *Meter) Save() error {
+	if m == nil || m.path == "" {
+		return nil
+	}
+	m.mu.Lock()
+	m.rollover()
+	saved := state{Month: m.month, Bytes: make(map[string]uint64, len(m.bytes))}
+	for tenant, n := range m.bytes {
+		saved.Bytes[tenant] = n
+	}
+	m.mu.Unlock()
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
+
+func (m *Meter) quota(tenant string) uint64 {
+	for _, t := range m.tenants {
+		if t.Name == tenant {
+			return t.QuotaBytes
+		}
+	}
+	return 0
+}
+
+// rollover resets the usage when a new month started, m.mu must be held
+func (m *Meter) rollover() {
+	if month := currentMonth(); month != m.month {
+		m.month = month
+		m.bytes = make(map[string]uint64)
+	}
+}
+
+func currentMonth() string {
+	return time.Now().UTC().Format(monthFormat)
+}
@@ -0,0 +1,139 @@
+package usage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMeter(t *testing.T, path string) *Meter {
+	m, err := New([]Tenant{
+		{Name: "rollup-a", APIKey: "key-a", QuotaBytes: 100},
+		{Name: "rollup-b", APIKey: "key-b", Scheme: "sha256"},
+	}, path)
+	require.NoError(t, err)
+	return m
+}
+
+func requestWith(headers map[string]string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	return r
+}
+
+// ✅ Test tenants are identified by the API key of the request
+func TestTenant(t *testing.T) {
+	m := newTestMeter(t, "")
+	tests := []struct {
+		name    string
+		headers map[string]string
+		tenant  string
+	}{
+		{name: "tenant key", headers: map[string]string{"Authorization": "Bearer key-a"}, tenant: "rollup-a"},
+		{name: "no key", tenant: Anonymous},
+		{name: "unknown key", headers: map[string]string{"Authorization": "Bearer key-c"}, tenant: Anonymous},
+		{name: "not a bearer token", headers: map[string]string{"Authorization": "key-a"}, tenant: Anonymous},
+		{name: "key prefix", headers: map[string]string{"Authorization": "Bearer key-"}, tenant: Anonymous},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.tenant, m.Tenant(requestWith(tt.headers)))
+		})
+	}
+
+	var none *Meter
+	assert.Equal(t, Anonymous, none.Tenant(requestWith(map[string]string{"Authorization": "Bearer key-a"})))
+	assert.Equal(t, "", none.Scheme("rollup-b"))
+	assert.Equal(t, "sha256", m.Scheme("rollup-b"))
+	assert.Equal(t, "", m.Scheme(Anonymous))
+}
+
+// ✅ Test the tenant of store requests, whose bearer token is the write API key
+func TestWriteTenant(t *testing.T) {
+	m := newTestMeter(t, "")
+	tenant, err := m.WriteTenant(requestWith(map[string]string{"Authorization": "Bearer write-key", HeaderTenantKey: "key-b"}))
+	require.NoError(t, err)
+	assert.Equal(t, "rollup-b", tenant)
+
+	tenant, err = m.WriteTenant(requestWith(map[string]string{"Authorization": "Bearer write-key"}))
+	require.NoError(t, err)
+	assert.Equal(t, Anonymous, tenant)
+
+	// ❌ Unknown tenant key
+	_, err = m.WriteTenant(requestWith(map[string]string{HeaderTenantKey: "key-c"}))
+	assert.ErrorIs(t, err, ErrUnknownTenant)
+	var none *Meter
+	_, err = none.WriteTenant(requestWith(map[string]string{HeaderTenantKey: "key-b"}))
+	assert.ErrorIs(t, err, ErrUnknownTenant)
+}
+
+// ✅ Test quotas are enforced per tenant and reset every month
+func TestAllow(t *testing.T) {
+	m := newTestMeter(t, "")
+	require.NoError(t, m.Allow("rollup-a"))
+	m.Add("rollup-a", 99)
+	require.NoError(t, m.Allow("rollup-a"))
+
+	// ❌ The quota is used
+	m.Add("rollup-a", 1)
+	assert.ErrorIs(t, m.Allow("rollup-a"), ErrQuotaExceeded)
+
+	// Tenants without quota are unlimited
+	m.Add("rollup-b", 1000)
+	m.Add(Anonymous, 1000)
+	assert.NoError(t, m.Allow("rollup-b"))
+	assert.NoError(t, m.Allow(Anonymous))
+
+	usage := m.Usage()
+	assert.Equal(t, uint64(100), usage["rollup-a"].Bytes)
+	assert.Equal(t, uint64(100), usage["rollup-a"].QuotaBytes)
+	assert.Equal(t, uint64(1000), usage[Anonymous].Bytes)
+
+	// A new month starts from zero
+	m.mu.Lock()
+	m.month = "2000-01"
+	m.mu.Unlock()
+	assert.NoError(t, m.Allow("rollup-a"))
+	assert.Zero(t, m.Usage()["rollup-a"].Bytes)
+
+	// ❌ Requests without a tenant key share the anonymous quota
+	m, err := New([]Tenant{{Name: "rollup-a", APIKey: "key-a"}, {Name: Anonymous, QuotaBytes: 100}}, "")
+	require.NoError(t, err)
+	assert.Equal(t, Anonymous, m.Tenant(requestWith(map[string]string{"Authorization": "Bearer "})))
+	m.Add(Anonymous, 100)
+	assert.ErrorIs(t, m.Allow(m.Tenant(requestWith(nil))), ErrQuotaExceeded)
+	assert.NoError(t, m.Allow("rollup-a"))
+	assert.Equal(t, uint64(100), m.Usage()[Anonymous].QuotaBytes)
+
+	var none *Meter
+	none.Add("rollup-a", 1000)
+	assert.NoError(t, none.Allow("rollup-a"))
+}
+
+// ✅ Test the usage of the month survives restarts
+func TestSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	m := newTestMeter(t, path)
+	observed := 0
+	m.Observe(func(tenant string, bytes int) { observed += bytes })
+	m.Add("rollup-a", 100)
+	assert.Equal(t, 100, observed)
+	require.NoError(t, m.Save())
+
+	m = newTestMeter(t, path)
+	assert.ErrorIs(t, m.Allow("rollup-a"), ErrQuotaExceeded)
+
+	// The usage of another month is dropped
+	m.mu.Lock()
+	m.month = "2000-01"
+	m.mu.Unlock()
+	require.NoError(t, m.Save())
+	m = newTestMeter(t, path)
+	assert.NoError(t, m.Allow("rollup-a"))
+}
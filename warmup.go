@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/availproject/cdk-avail-da-server/da"
+	"github.com/availproject/cdk-avail-da-server/pkg/l1"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// warmUpRangeSize is the number of blocks queried with a single eth_getLogs request
+const warmUpRangeSize = 1000
+
+// warmUp prefetches the batches sequenced in the last cfg.WarmUpBlocks L1 blocks into
+// the hot cache, so CDK nodes resyncing after a restart of the server don't all miss
+// the cache at once
+func warmUp(ctx context.Context, cfg serverConfig, storage da.DAProvider) error {
+	start := time.Now()
+	ethClient, err := ethclient.DialContext(ctx, cfg.L1RPCURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to L1: %w", err)
+	}
+	client := l1.NewClient(ethClient, nil)
+	defer client.Close()
+
+	contractAbi, err := abi.JSON(strings.NewReader(l1.PolygonValidiumABI))
+	if err != nil {
+		return err
+	}
+	contract := common.HexToAddress(cfg.ValidiumContractAddress)
+
+	head, err := client.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get the L1 head: %w", err)
+	}
+	from := uint64(0)
+	if head > cfg.WarmUpBlocks {
+		from = head - cfg.WarmUpBlocks + 1
+	}
+	log.Printf("Warming up the cache with the batches of L1 blocks %d to %d", from, head)
+
+	var hashes []common.Hash
+	for rangeStart := from; rangeStart <= head; rangeStart += warmUpRangeSize {
+		rangeEnd := min(rangeStart+warmUpRangeSize-1, head)
+		blocks, err := l1.QueryBatchHashesFromL1ByRange(ctx, client, contractAbi, contract,
+			new(big.Int).SetUint64(rangeStart), new(big.Int).SetUint64(rangeEnd))
+		if err != nil {
+			return fmt.Errorf("failed to query the batches of blocks %d to %d: %w", rangeStart, rangeEnd, err)
+		}
+		for _, blockHashes := range blocks {
+			hashes = append(hashes, blockHashes...)
+		}
+	}
+
+	var loaded, failed atomic.Int64
+	sem := make(chan struct{}, cfg.WarmUpConcurrency)
+	var wg sync.WaitGroup
+	for _, hash := range hashes {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(hash common.Hash) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			getCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+			// Reading the batch promotes it to the hot cache
+			if _, err := storage.Get(getCtx, hash); err != nil {
+				log.Printf("Failed to warm up batch %s: %v", hash.Hex(), err)
+				failed.Add(1)
+				return
+			}
+			loaded.Add(1)
+		}(hash)
+	}
+	wg.Wait()
+
+	log.Printf("Warm-up finished, loaded %d of %d batches, %d failed (duration %v)",
+		loaded.Load(), len(hashes), failed.Load(), time.Since(start))
+	return nil
+}
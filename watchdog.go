@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/availproject/cdk-avail-da-server/da"
+)
+
+// watchdogFailures is the number of heartbeats in a row a client must fail before it
+// is rebuilt, so a single slow answer doesn't drop the connection
+const watchdogFailures = 3
+
+// runWatchdog sends a heartbeat to the L1 and Avail RPC every WATCHDOG_INTERVAL until
+// ctx is done, and rebuilds the clients whose connection is wedged. Endpoint flaps
+// are recovered without restarting the server, every rebuild is passed to
+// onReconnect.
+func runWatchdog(ctx context.Context, cfg serverConfig, a *da.AvailBackend, onReconnect func(client string)) {
+	go func() {
+		ticker := time.NewTicker(cfg.WatchdogInterval)
+		defer ticker.Stop()
+		failures := make(map[string]int)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			client, err := a.Heartbeat(cfg.WatchdogTimeout)
+			if err == nil {
+				clear(failures)
+				continue
+			}
+			failures[client]++
+			log.Printf("Heartbeat %d/%d failed: %v", failures[client], watchdogFailures, err)
+			if failures[client] < watchdogFailures {
+				continue
+			}
+			if err := a.Reconnect(client); err != nil {
+				log.Printf("Failed to reconnect the %s client: %v", client, err)
+				continue
+			}
+			failures[client] = 0
+			if onReconnect != nil {
+				onReconnect(client)
+			}
+		}
+	}()
+}